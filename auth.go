@@ -0,0 +1,190 @@
+package main
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/query"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Roles
+const (
+	roleRead      = "read"      // Get and Select queries
+	roleReadWrite = "readWrite" // Get, Select, Insert, Update, Upsert, and Delete queries
+	roleAdmin     = "admin"     // All queries, including Create and Drop
+)
+
+const (
+	masterUser    string = "master" // User name for authenticating with the masterPass
+	allTables     string = "*"      // Roles key that applies to every table
+	bcryptPrefix  string = "$2"
+	connectionKey ctxKey = 0
+)
+
+type ctxKey int
+
+// dbUser is a server user as listed in the config file. Password is a bcrypt hash made with helpers.EncryptString
+// (see the -hash flag), and Roles maps table names (or "*" for every table) to a role.
+type dbUser struct {
+	Name     string            `json:"name"`
+	Password string            `json:"password"`
+	Roles    map[string]string `json:"roles"`
+}
+
+// connection holds the authentication state of a single client connection, so credentials are only verified
+// once per connection rather than once per query.
+type connection struct {
+	mux      sync.Mutex
+	name     string
+	passSum  [sha256.Size]byte
+	roles    map[string]string
+	admin    bool
+	verified bool
+}
+
+// connContext attaches a new connection to the context of every request made on a client's connection.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connectionKey, &connection{})
+}
+
+// authRequired reports whether the server requires authentication. Authentication is only disabled when the config
+// file sets "noAuth".
+func authRequired() bool {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+	return !noAuth
+}
+
+// checkAuthConfig makes sure the server can't be started without authentication by mistake. The config file must
+// have a masterPass or users, unless "noAuth" is set.
+func checkAuthConfig() helpers.Error {
+	if !authRequired() {
+		return helpers.Error{}
+	}
+	statusMux.Lock()
+	hasPass := len(masterPass) > 0
+	statusMux.Unlock()
+	configMux.Lock()
+	hasUsers := len(config.Users) > 0
+	configMux.Unlock()
+	if !hasPass && !hasUsers {
+		return helpers.NewError(helpers.ErrorNotAuthenticated, "'"+configFile+"' has no masterPass or users. Add one, or set \"noAuth\" to true to serve without authentication")
+	}
+	return helpers.Error{}
+}
+
+// authenticate verifies a request's basic auth credentials and returns the connection they were verified on.
+func authenticate(r *http.Request) (*connection, helpers.Error) {
+	c, _ := r.Context().Value(connectionKey).(*connection)
+	if c == nil {
+		c = &connection{}
+	}
+	if !authRequired() {
+		c.mux.Lock()
+		c.admin = true
+		c.mux.Unlock()
+		return c, helpers.Error{}
+	}
+	name, pass, ok := r.BasicAuth()
+	if !ok {
+		return nil, helpers.NewError(helpers.ErrorNotAuthenticated, "Credentials required")
+	}
+	passSum := sha256.Sum256([]byte(pass))
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	// Credentials already verified on this connection
+	if c.verified && c.name == name && subtle.ConstantTimeCompare(c.passSum[:], passSum[:]) == 1 {
+		return c, helpers.Error{}
+	}
+	c.verified = false
+	if name == masterUser {
+		statusMux.Lock()
+		mp := masterPass
+		statusMux.Unlock()
+		if len(mp) == 0 || !passwordMatches(pass, mp) {
+			return nil, helpers.NewError(helpers.ErrorNotAuthenticated, "Incorrect credentials")
+		}
+		c.admin = true
+		c.roles = nil
+	} else {
+		u := getUser(name)
+		if u == nil || !helpers.StringMatchesEncryption(pass, []byte(u.Password)) {
+			return nil, helpers.NewError(helpers.ErrorNotAuthenticated, "Incorrect credentials")
+		}
+		c.admin = false
+		c.roles = u.Roles
+	}
+	c.name = name
+	c.passSum = passSum
+	c.verified = true
+	return c, helpers.Error{}
+}
+
+// passwordMatches compares a password to a plain text or bcrypt hashed masterPass
+func passwordMatches(pass string, mp []byte) bool {
+	if strings.HasPrefix(string(mp), bcryptPrefix) {
+		return helpers.StringMatchesEncryption(pass, mp)
+	}
+	return subtle.ConstantTimeCompare([]byte(pass), mp) == 1
+}
+
+// getUser gets a copy of a dbUser from the config by name
+func getUser(name string) *dbUser {
+	configMux.Lock()
+	defer configMux.Unlock()
+	for _, u := range config.Users {
+		if u.Name == name {
+			uc := u
+			return &uc
+		}
+	}
+	return nil
+}
+
+// authorize checks that a connection has the privileges to run a Query.
+func (c *connection) authorize(q *query.Query) helpers.Error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.admin {
+		return helpers.Error{}
+	}
+	role := c.role(q.Table)
+	var allowed bool
+	switch q.Type {
+	case query.TypeGet:
+		allowed = role == roleRead || role == roleReadWrite || role == roleAdmin
+	case query.TypeSelect:
+		// AuthTable Selects read users without their passwords
+		allowed = role == roleRead || role == roleReadWrite || role == roleAdmin
+		if q.TableType == query.TableTypeAuthTable {
+			allowed = role == roleAdmin
+		}
+	case query.TypeInsert, query.TypeUpdate, query.TypeUpsert, query.TypeDelete:
+		allowed = role == roleReadWrite || role == roleAdmin
+	case query.TypeLink:
+		// Linked fields are read from the linked table without it's own privileges, so it must be admin too
+		allowed = role == roleAdmin && (len(q.LinkTable) == 0 || c.role(q.LinkTable) == roleAdmin)
+	default:
+		allowed = role == roleAdmin
+	}
+	if !allowed {
+		if q.Type == query.TypeLink && role == roleAdmin {
+			return helpers.NewError(helpers.ErrorNoPrivileges, q.Type+" to '"+q.LinkTable+"'")
+		}
+		return helpers.NewError(helpers.ErrorNoPrivileges, q.Type+" on '"+q.Table+"'")
+	}
+	return helpers.Error{}
+}
+
+// role gets the connection's role for a table. c.mux must be locked.
+func (c *connection) role(table string) string {
+	if role, ok := c.roles[table]; ok {
+		return role
+	}
+	return c.roles[allTables]
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/query"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TO TEST:
+// go test -v .
+
+// useConfig sets the server's config and status settings for a test, and puts the old ones back when it's done
+func useConfig(t *testing.T, c dbConfig) {
+	t.Helper()
+	configMux.Lock()
+	oldConfig := config
+	config = c
+	configMux.Unlock()
+	statusMux.Lock()
+	oldPass, oldNoAuth, oldReplica, oldReadOnly := masterPass, noAuth, replica, readOnly
+	masterPass = []byte(c.MasterPass)
+	noAuth = c.NoAuth
+	replica = c.Replica
+	readOnly = c.ReadOnly
+	statusMux.Unlock()
+	t.Cleanup(func() {
+		configMux.Lock()
+		config = oldConfig
+		configMux.Unlock()
+		statusMux.Lock()
+		masterPass, noAuth, replica, readOnly = oldPass, oldNoAuth, oldReplica, oldReadOnly
+		statusMux.Unlock()
+	})
+}
+
+// authRequest makes a request on a client connection, with basic auth credentials unless name is empty
+func authRequest(c *connection, name string, pass string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	if len(name) > 0 {
+		r.SetBasicAuth(name, pass)
+	}
+	return r.WithContext(context.WithValue(r.Context(), connectionKey, c))
+}
+
+func testUsers(t *testing.T) []dbUser {
+	t.Helper()
+	hash, err := helpers.EncryptString("bobPass", 4)
+	if err != nil {
+		t.Fatalf("Could not hash password: %v", err)
+	}
+	return []dbUser{{Name: "bob", Password: string(hash), Roles: map[string]string{allTables: roleRead, "users": roleReadWrite}}}
+}
+
+func TestCheckAuthConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config dbConfig
+		err    int
+	}{
+		{"empty", dbConfig{}, helpers.ErrorNotAuthenticated},
+		{"noAuth", dbConfig{NoAuth: true}, 0},
+		{"masterPass", dbConfig{MasterPass: "secret"}, 0},
+		{"users", dbConfig{Users: testUsers(t)}, 0},
+	}
+	for _, test := range tests {
+		useConfig(t, test.config)
+		if err := checkAuthConfig(); err.ID != test.err {
+			t.Errorf("TestCheckAuthConfig %v expected error %v, but got: %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	users := testUsers(t)
+	masterHash, err := helpers.EncryptString("secret", 4)
+	if err != nil {
+		t.Fatalf("Could not hash password: %v", err)
+	}
+	tests := []struct {
+		name   string
+		config dbConfig
+		user   string
+		pass   string
+		err    int
+		admin  bool
+	}{
+		{"noAuth", dbConfig{NoAuth: true}, "", "", 0, true},
+		{"empty config", dbConfig{}, masterUser, "", helpers.ErrorNotAuthenticated, false},
+		{"no credentials", dbConfig{MasterPass: "secret"}, "", "", helpers.ErrorNotAuthenticated, false},
+		{"master", dbConfig{MasterPass: "secret"}, masterUser, "secret", 0, true},
+		{"master wrong password", dbConfig{MasterPass: "secret"}, masterUser, "secrets", helpers.ErrorNotAuthenticated, false},
+		{"master hash", dbConfig{MasterPass: string(masterHash)}, masterUser, "secret", 0, true},
+		{"master hash as password", dbConfig{MasterPass: string(masterHash)}, masterUser, string(masterHash), helpers.ErrorNotAuthenticated, false},
+		{"user", dbConfig{Users: users}, "bob", "bobPass", 0, false},
+		{"user wrong password", dbConfig{Users: users}, "bob", "bobpass", helpers.ErrorNotAuthenticated, false},
+		{"unknown user", dbConfig{Users: users}, "ann", "bobPass", helpers.ErrorNotAuthenticated, false},
+		{"master without masterPass", dbConfig{Users: users}, masterUser, "", helpers.ErrorNotAuthenticated, false},
+	}
+	for _, test := range tests {
+		useConfig(t, test.config)
+		c, err := authenticate(authRequest(&connection{}, test.user, test.pass))
+		if err.ID != test.err {
+			t.Errorf("TestAuthenticate %v expected error %v, but got: %v", test.name, test.err, err)
+			continue
+		}
+		if err.ID == 0 && c.admin != test.admin {
+			t.Errorf("TestAuthenticate %v expected admin %v, but got: %v", test.name, test.admin, c.admin)
+		}
+	}
+}
+
+func TestAuthenticateCache(t *testing.T) {
+	useConfig(t, dbConfig{MasterPass: "secret", Users: testUsers(t)})
+	c := &connection{}
+	if _, err := authenticate(authRequest(c, "bob", "bobPass")); err.ID != 0 {
+		t.Fatalf("TestAuthenticateCache expected bob to authenticate, but got: %v", err)
+	}
+	if !c.verified || c.name != "bob" || c.roles["users"] != roleReadWrite {
+		t.Fatalf("TestAuthenticateCache expected bob to be verified on the connection, but got: %v %v %v", c.verified, c.name, c.roles)
+	}
+
+	// Remove bob from the config. The connection's credentials are already verified, so they're not checked again.
+	configMux.Lock()
+	config.Users = []dbUser{}
+	configMux.Unlock()
+	if _, err := authenticate(authRequest(c, "bob", "bobPass")); err.ID != 0 {
+		t.Errorf("TestAuthenticateCache expected bob to stay verified on the connection, but got: %v", err)
+	}
+	if _, err := authenticate(authRequest(&connection{}, "bob", "bobPass")); err.ID != helpers.ErrorNotAuthenticated {
+		t.Errorf("TestAuthenticateCache expected bob to fail on a new connection, but got: %v", err)
+	}
+
+	// Different credentials on the connection are verified again
+	if _, err := authenticate(authRequest(c, "bob", "wrong")); err.ID != helpers.ErrorNotAuthenticated {
+		t.Errorf("TestAuthenticateCache expected a wrong password to fail, but got: %v", err)
+	}
+	if c.verified {
+		t.Errorf("TestAuthenticateCache expected the connection to be unverified after a wrong password")
+	}
+	if _, err := authenticate(authRequest(c, "bob", "bobPass")); err.ID != helpers.ErrorNotAuthenticated {
+		t.Errorf("TestAuthenticateCache expected bob to fail once unverified, but got: %v", err)
+	}
+	if _, err := authenticate(authRequest(c, masterUser, "secret")); err.ID != 0 || !c.admin || c.roles != nil {
+		t.Errorf("TestAuthenticateCache expected master to replace bob on the connection, but got: %v %v %v", err, c.admin, c.roles)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	roles := map[string]string{allTables: roleRead, "users": roleReadWrite, "scores": roleAdmin, "accounts": roleAdmin}
+	tests := []struct {
+		name  string
+		admin bool
+		roles map[string]string
+		query query.Query
+		err   int
+	}{
+		{"admin Drop", true, nil, query.Query{Type: query.TypeDrop, Table: "users"}, 0},
+		{"no roles Get", false, nil, query.Query{Type: query.TypeGet, Table: "users"}, helpers.ErrorNoPrivileges},
+		{"read Get", false, roles, query.Query{Type: query.TypeGet, Table: "items"}, 0},
+		{"read Select", false, roles, query.Query{Type: query.TypeSelect, Table: "items", TableType: query.TableTypeKeystore}, 0},
+		{"read Insert", false, roles, query.Query{Type: query.TypeInsert, Table: "items"}, helpers.ErrorNoPrivileges},
+		{"readWrite Update", false, roles, query.Query{Type: query.TypeUpdate, Table: "users"}, 0},
+		{"readWrite Delete", false, roles, query.Query{Type: query.TypeDelete, Table: "users"}, 0},
+		{"readWrite Create", false, roles, query.Query{Type: query.TypeCreate, Table: "users"}, helpers.ErrorNoPrivileges},
+		{"admin Create", false, roles, query.Query{Type: query.TypeCreate, Table: "scores"}, 0},
+		{"read AuthTable Select", false, roles, query.Query{Type: query.TypeSelect, Table: "items", TableType: query.TableTypeAuthTable}, helpers.ErrorNoPrivileges},
+		{"readWrite AuthTable Select", false, roles, query.Query{Type: query.TypeSelect, Table: "users", TableType: query.TableTypeAuthTable}, helpers.ErrorNoPrivileges},
+		{"admin AuthTable Select", false, roles, query.Query{Type: query.TypeSelect, Table: "accounts", TableType: query.TableTypeAuthTable}, 0},
+		{"Link admin on both", false, roles, query.Query{Type: query.TypeLink, Table: "scores", LinkTable: "accounts"}, 0},
+		{"Link readWrite table", false, roles, query.Query{Type: query.TypeLink, Table: "scores", LinkTable: "users"}, helpers.ErrorNoPrivileges},
+		{"Link readWrite Leaderboard", false, roles, query.Query{Type: query.TypeLink, Table: "users", LinkTable: "accounts"}, helpers.ErrorNoPrivileges},
+		{"unlink", false, roles, query.Query{Type: query.TypeLink, Table: "scores"}, 0},
+	}
+	for _, test := range tests {
+		c := &connection{admin: test.admin, roles: test.roles}
+		q := test.query
+		if err := c.authorize(&q); err.ID != test.err {
+			t.Errorf("TestAuthorize %v expected error %v, but got: %v", test.name, test.err, err)
+		}
+	}
+}
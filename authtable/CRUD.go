@@ -6,7 +6,6 @@ import (
 	"github.com/hewiefreeman/GopherDB/storage"
 	"strconv"
 	"strings"
-	"encoding/json"
 	"regexp"
 )
 
@@ -40,14 +39,25 @@ var (
 
 // NewUser creates a new authTableEntry in the AuthTable
 func (t *AuthTable) NewUser(name string, password string, insertObj map[string]interface{}) (*authTableEntry, helpers.Error) {
+	return t.insertUser(name, password, nil, insertObj)
+}
+
+// insertUser inserts a user with a password, or an already encrypted password (ePass). When ePass isn't nil, items
+// are filtered like when they're restored from a data file.
+func (t *AuthTable) insertUser(name string, password string, ePass []byte, insertObj map[string]interface{}) (*authTableEntry, helpers.Error) {
 	minPass := t.minPassword.Load().(uint8)
+	restore := ePass != nil
 	// Name and password are required
 	if len(name) == 0 {
 		return nil, helpers.NewError(helpers.ErrorNameRequired, "")
 	} else if strings.ContainsAny(name, " \t\n\r"){
 		return nil, helpers.NewError(helpers.ErrorInvalidNameCharacters, name)
-	} else if len(password) < int(minPass) {
+	} else if !restore && len(password) < int(minPass) {
+		return nil, helpers.NewError(helpers.ErrorPasswordLength, "")
+	} else if restore && len(ePass) == 0 {
 		return nil, helpers.NewError(helpers.ErrorPasswordLength, "")
+	} else if restore && !helpers.IsEncryption(ePass) {
+		return nil, helpers.NewError(helpers.ErrorPasswordEncryption, name)
 	}
 
 	// Create entry
@@ -64,7 +74,7 @@ func (t *AuthTable) NewUser(name string, password string, insertObj map[string]i
 	// Fill entry data with insertObj - Loop through schema to also check for required items
 	for itemName, schemaItem := range t.schema {
 		// Item filter
-		err := schema.ItemFilter(insertObj[itemName], nil, &ute.data[schemaItem.DataIndex()], nil, schemaItem, &uniqueVals, t.EncryptCost(), false, false)
+		err := schema.ItemFilter(insertObj[itemName], nil, &ute.data[schemaItem.DataIndex()], nil, schemaItem, &uniqueVals, t.EncryptCost(), false, restore)
 		if err != 0 {
 			return nil, helpers.NewError(err, itemName)
 		}
@@ -77,19 +87,21 @@ func (t *AuthTable) NewUser(name string, password string, insertObj map[string]i
 	}
 
 	// Encrypt password and store in entry
-	encryptCost := t.encryptCost.Load().(int)
-	ePass, ePassErr := helpers.EncryptString(password, encryptCost)
-	if ePassErr != nil {
-		helpers.LogAndPrint("Auth '" + t.name + "' password encryption failure on a NewUser() request", 4)
-		return nil, helpers.NewError(helpers.ErrorPasswordEncryption, name)
+	if !restore {
+		encryptCost := t.encryptCost.Load().(int)
+		var ePassErr error
+		if ePass, ePassErr = helpers.EncryptString(password, encryptCost); ePassErr != nil {
+			helpers.LogAndPrint("Auth '" + t.name + "' password encryption failure on a NewUser() request", 4)
+			return nil, helpers.NewError(helpers.ErrorPasswordEncryption, name)
+		}
 	}
 	ute.password.Store(ePass)
 
 	// Make JSON []byte for entry
 	var jBytes []byte
 	if !t.memOnly {
-		if jErr := makeJsonBytes(name, ePass, ute.data, &jBytes); jErr != 0 {
-			helpers.LogAndPrint("Auth '" + t.name + "' JSON failure on a NewUser() request", 4)
+		if jErr := t.makeEntryBytes(name, ePass, ute.data, &jBytes); jErr != 0 {
+			helpers.LogAndPrint("Auth '" + t.name + "' entry encoding failure on a NewUser() request", 4)
 			return nil, helpers.NewError(jErr, name)
 		}
 	}
@@ -151,6 +163,7 @@ func (t *AuthTable) NewUser(name string, password string, insertObj map[string]i
 	}
 
 	// Remove data from memory if dataOnDrive is true
+	data := ute.data
 	if t.dataOnDrive {
 		ute.data = nil
 	}
@@ -164,6 +177,7 @@ func (t *AuthTable) NewUser(name string, password string, insertObj map[string]i
 	t.entries[name] = &ute
 	t.eMux.Unlock()
 
+	t.runItemHooks(name, data, nil)
 	return &ute, helpers.Error{}
 }
 
@@ -178,23 +192,31 @@ func (t *AuthTable) GetUser(userName string, password string, items map[string]i
 	if err != 0 {
 		return nil, helpers.NewError(err, userName)
 	}
+	return t.getUserItems(e, userName, items)
+}
 
-	var data []interface{}
+func (t *AuthTable) getUserItems(e *authTableEntry, userName string, items map[string]interface{}) (map[string]interface{}, helpers.Error) {
+	data, dErr := t.entryData(e)
+	if dErr != 0 {
+		helpers.LogAndPrint("Auth '" + t.name + "' failed to retrieve data for a GetUser() request", 4)
+		return nil, helpers.NewError(dErr, userName)
+	}
+	return t.getItems(data, items)
+}
 
-	// Get entry data
+// entryData gets a copy of an entry's data
+func (t *AuthTable) entryData(e *authTableEntry) ([]interface{}, int) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
 	if t.dataOnDrive {
-		var dErr int
-		data, dErr = t.dataFromDrive(dataFolderPrefix + t.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage, e.persistIndex)
-		if dErr != 0 {
-			helpers.LogAndPrint("Auth '" + t.name + "' failed to retrieve data for a GetUser() request", 4)
-			return nil, helpers.NewError(dErr, userName)
-		}
-	} else {
-		e.mux.Lock()
-		data = append([]interface{}{}, e.data...)
-		e.mux.Unlock()
+		return t.dataFromDrive(dataFolderPrefix + t.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage, e.persistIndex)
 	}
+	return append([]interface{}{}, e.data...), 0
+}
 
+// getItems gets the requested items from an entry's data, or every item when none are requested. items is filled
+// with the results.
+func (t *AuthTable) getItems(data []interface{}, items map[string]interface{}) (map[string]interface{}, helpers.Error) {
 	// Check for specific items to get
 	if items != nil && len(items) > 0 {
 		for itemName, methodParams := range items {
@@ -233,15 +255,11 @@ func (t *AuthTable) dataFromDrive(file string, index uint16) ([]interface{}, int
 	if rErr != 0 {
 		return nil, rErr
 	}
-	var jEntry jsonEntry
-	jErr := json.Unmarshal(bytes, &jEntry)
-	if jErr != nil {
-		return nil, helpers.ErrorJsonDecoding
-	}
-	if jEntry.D == nil || len(jEntry.D) == 0 {
-		return nil, helpers.ErrorJsonDecoding
+	_, _, data, err := t.entryFromBytes(bytes)
+	if err != 0 {
+		return nil, err
 	}
-	return jEntry.D, 0
+	return data, 0
 }
 
 // Example JSON for update query:
@@ -291,16 +309,16 @@ func (t *AuthTable) UpdateUser(userName string, password string, updateObj map[s
 	var data []interface{}
 
 	// Get entry data
+	e.mux.Lock()
 	if t.dataOnDrive {
 		var dErr int
 		data, dErr = t.dataFromDrive(dataFolderPrefix + t.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage, e.persistIndex)
 		if dErr != 0 {
+			e.mux.Unlock()
 			helpers.LogAndPrint("Auth '" + t.name + "' failed to retrieve data for an UpdateUser() request", 4)
 			return helpers.NewError(dErr, userName)
 		}
-		e.mux.Lock()
 	} else {
-		e.mux.Lock()
 		data = append([]interface{}{}, e.data...)
 	}
 
@@ -322,6 +340,7 @@ func (t *AuthTable) UpdateUser(userName string, password string, updateObj map[s
 		}
 		// Check for email format if email item
 		if updateName == emailItem && !emailExp.MatchString(data[schemaItem.DataIndex()].(string)) {
+			e.mux.Unlock()
 			return helpers.NewError(helpers.ErrorInvalidEmail, data[schemaItem.DataIndex()].(string))
 		}
 		itemBefore := data[schemaItem.DataIndex()]
@@ -340,8 +359,9 @@ func (t *AuthTable) UpdateUser(userName string, password string, updateObj map[s
 	// Make JSON []byte for entry
 	var jBytes []byte
 	if !t.memOnly {
-		if jErr := makeJsonBytes(userName, e.password.Load().([]byte), data, &jBytes); jErr != 0 {
-			helpers.LogAndPrint("Auth '" + t.name + "' JSON failure on an UpdateUser() request", 4)
+		if jErr := t.makeEntryBytes(userName, e.password.Load().([]byte), data, &jBytes); jErr != 0 {
+			e.mux.Unlock()
+			helpers.LogAndPrint("Auth '" + t.name + "' entry encoding failure on an UpdateUser() request", 4)
 			return helpers.NewError(jErr, userName)
 		}
 	}
@@ -370,6 +390,7 @@ func (t *AuthTable) UpdateUser(userName string, password string, updateObj map[s
 	}
 
 	// Apply unique values
+	var altLoginBefore, altLogin string
 	for itemName, itemVal := range uniqueVals {
 		if t.uniqueVals[itemName] == nil {
 			t.uniqueVals[itemName] = make(map[interface{}]bool)
@@ -381,10 +402,8 @@ func (t *AuthTable) UpdateUser(userName string, password string, updateObj map[s
 			delete(t.uniqueVals[itemName], uniqueValsBefore[itemName])
 			// Replace altLoginItem as well if that item changed
 			if itemName == altLoginItem {
-				t.eMux.Lock()
-				delete(t.altLogins, uniqueValsBefore[itemName].(string))
-				t.altLogins[itemVal.(string)] = e
-				t.eMux.Unlock()
+				altLoginBefore = uniqueValsBefore[itemName].(string)
+				altLogin = itemVal.(string)
 			}
 		}
 	}
@@ -395,6 +414,15 @@ func (t *AuthTable) UpdateUser(userName string, password string, updateObj map[s
 	}
 	e.mux.Unlock()
 
+	// Replace altLogin after unlocking the entry, since t.eMux must be locked before an entry's mux
+	if altLogin != "" {
+		t.eMux.Lock()
+		delete(t.altLogins, altLoginBefore)
+		t.altLogins[altLogin] = e
+		t.eMux.Unlock()
+	}
+
+	t.runItemHooks(userName, data, updateObj)
 	return helpers.Error{}
 }
 
@@ -419,34 +447,37 @@ func (t *AuthTable) ChangeUserPassword(userName string, password string, newPass
 	var data []interface{}
 
 	// Get entry data
+	ue.mux.Lock()
 	if t.dataOnDrive {
 		var dErr int
 		data, dErr = t.dataFromDrive(dataFolderPrefix + t.name + "/" + strconv.Itoa(int(ue.persistFile)) + helpers.FileTypeStorage, ue.persistIndex)
 		if dErr != 0 {
+			ue.mux.Unlock()
 			helpers.LogAndPrint("Auth '" + t.name + "' failed to retrieve data for a ChangeUserPassword() request", 4)
 			return helpers.NewError(dErr, userName)
 		}
 	} else {
-		ue.mux.Lock()
 		data = append([]interface{}{}, ue.data...)
-		ue.mux.Unlock()
 	}
 
 	if !t.memOnly {
 		// Make JSON []byte for entry
 		var jBytes []byte
-		if jErr := makeJsonBytes(userName, ePass, data, &jBytes); jErr != 0 {
-			helpers.LogAndPrint("Auth '" + t.name + "' JSON failure on a ChangeUserPassword() request", 4)
+		if jErr := t.makeEntryBytes(userName, ePass, data, &jBytes); jErr != 0 {
+			ue.mux.Unlock()
+			helpers.LogAndPrint("Auth '" + t.name + "' entry encoding failure on a ChangeUserPassword() request", 4)
 			return helpers.NewError(jErr, userName)
 		}
 
 		// Update entry on disk with jBytes
 		uErr := storage.Update(dataFolderPrefix + t.name + "/" + strconv.Itoa(int(ue.persistFile)) + helpers.FileTypeStorage, ue.persistIndex, jBytes)
 		if uErr != 0 {
+			ue.mux.Unlock()
 			helpers.LogAndPrint("Auth '" + t.name + "' failed to store a ChangeUserPassword() request", 4)
 			return helpers.NewError(uErr, userName)
 		}
 	}
+	ue.mux.Unlock()
 
 	ue.password.Store(ePass)
 
@@ -487,27 +518,27 @@ func (t *AuthTable) ResetUserPassword(userName string) helpers.Error {
 		return helpers.Error{}
 	}
 
+	// Change password
+	ePass, eErr := helpers.EncryptString(string(newPass), t.encryptCost.Load().(int))
+	if eErr != nil {
+		helpers.LogAndPrint("Auth '" + t.name + "' password encryption failure on a ResetUserPassword() request", 4)
+		return helpers.Error{}
+	}
+
 	var data []interface{}
 
 	// Get entry data
+	ue.mux.Lock()
 	if t.dataOnDrive {
 		var dErr int
 		data, dErr = t.dataFromDrive(dataFolderPrefix + t.name + "/" + strconv.Itoa(int(ue.persistFile)) + helpers.FileTypeStorage, ue.persistIndex)
 		if dErr != 0 {
+			ue.mux.Unlock()
 			helpers.LogAndPrint("Auth '" + t.name + "' failed to retrieve data for a ResetUserPassword() request", 4)
 			return helpers.Error{}
 		}
 	} else {
-		ue.mux.Lock()
 		data = append([]interface{}{}, ue.data...)
-		ue.mux.Unlock()
-	}
-
-	// Change password
-	ePass, eErr := helpers.EncryptString(string(newPass), t.encryptCost.Load().(int))
-	if eErr != nil {
-		helpers.LogAndPrint("Auth '" + t.name + "' password encryption failure on a ResetUserPassword() request", 4)
-		return helpers.Error{}
 	}
 
 	// Delete auto-login hashes !!!
@@ -515,18 +546,21 @@ func (t *AuthTable) ResetUserPassword(userName string) helpers.Error {
 	if !t.memOnly {
 		// Make JSON []byte for entry
 		var jBytes []byte
-		if jErr := makeJsonBytes(userName, ePass, data, &jBytes); jErr != 0 {
-			helpers.LogAndPrint("Auth '" + t.name + "' JSON failure on a ResetUserPassword() request", 4)
+		if jErr := t.makeEntryBytes(userName, ePass, data, &jBytes); jErr != 0 {
+			ue.mux.Unlock()
+			helpers.LogAndPrint("Auth '" + t.name + "' entry encoding failure on a ResetUserPassword() request", 4)
 			return helpers.Error{}
 		}
 
 		// Update entry on disk with jBytes
 		uErr := storage.Update(dataFolderPrefix + t.name + "/" + strconv.Itoa(int(ue.persistFile)) + helpers.FileTypeStorage, ue.persistIndex, jBytes)
 		if uErr != 0 {
+			ue.mux.Unlock()
 			helpers.LogAndPrint("Auth '" + t.name + "' failed to store a ResetUserPassword() request", 4)
 			return helpers.Error{}
 		}
 	}
+	ue.mux.Unlock()
 
 	ue.password.Store(ePass)
 
@@ -544,21 +578,22 @@ func (t *AuthTable) DeleteUser(userName string, password string) helpers.Error {
 	var data []interface{}
 
 	// Get entry data
+	ue.mux.Lock()
 	if t.dataOnDrive {
 		var dErr int
 		data, dErr = t.dataFromDrive(dataFolderPrefix + t.name + "/" + strconv.Itoa(int(ue.persistFile)) + helpers.FileTypeStorage, ue.persistIndex)
 		if dErr != 0 {
+			ue.mux.Unlock()
 			helpers.LogAndPrint("Auth '" + t.name + "' failed to retrieve data for a DeleteUser() request", 4)
 			return helpers.NewError(dErr, userName)
 		}
-		ue.mux.Lock()
 	} else {
-		ue.mux.Lock()
 		data = append([]interface{}{}, ue.data...)
 	}
 
 	t.uMux.Lock()
 	uItems := []string{}
+	altLogin := ""
 	altLoginItem := t.altLoginItem.Load().(string)
 	schema.GetUniqueItems(t.schema, &uItems, "")
 	for _, itemName := range uItems {
@@ -582,30 +617,39 @@ func (t *AuthTable) DeleteUser(userName string, password string) helpers.Error {
 			return helpers.NewError(helpers.ErrorUnexpected, "")
 		}
 		if itemName == altLoginItem {
-			t.eMux.Lock()
-			delete(t.altLogins, i.(string))
-			t.eMux.Unlock()
+			altLogin = i.(string)
 		}
 		delete(t.uniqueVals[itemName], i)
 	}
 	t.uMux.Unlock()
-	ue.mux.Unlock()
-
-	// Delete entry
-	t.eMux.Lock()
-	delete(t.entries, userName)
-	t.eMux.Unlock()
 
 	// Update entry on disk with []byte{}
+	persistFile := ue.persistFile
 	if !t.memOnly {
 		uErr := storage.Update(dataFolderPrefix + t.name + "/" + strconv.Itoa(int(ue.persistFile)) + helpers.FileTypeStorage, ue.persistIndex, []byte{})
 		if uErr != 0 {
+			ue.mux.Unlock()
 			helpers.LogAndPrint("Auth '" + t.name + "' failed execute a DeleteUser() request due to internal storage engine error", 4)
 			return helpers.NewError(uErr, userName)
 		}
 	}
+	ue.mux.Unlock()
 
-	//
+	// Delete entry
+	t.eMux.Lock()
+	delete(t.entries, userName)
+	if altLogin != "" {
+		delete(t.altLogins, altLogin)
+	}
+	compact := !t.memOnly && t.addDeletedLine(persistFile)
+	t.eMux.Unlock()
+
+	// Compact the partition once enough of it has been deleted
+	if compact {
+		go t.CompactPartition(persistFile)
+	}
+
+	t.runItemHooks(userName, nil, nil)
 	return helpers.Error{}
 }
 
@@ -35,6 +35,7 @@ import (
 // File/folder prefixes
 const (
 	dataFolderPrefix = "Auth-"
+	configCopyFile   = "/config" + helpers.FileTypeConfig // Copy of a table's config file in it's data folder
 )
 
 // Defaults
@@ -71,16 +72,24 @@ type AuthTable struct {
 	verifyItem    atomic.Value // *string* when set, the database will send a verified boolean for the User along with insert/update/get queries. The verified boolean is true if the User has successfully verified their account through email. Requires emailItem to be set
 	emailSettings atomic.Value // *EmailSettings* Settings for email server authentication, and verification emails
 	altLoginItem  atomic.Value // *string* item in schema that a user can log in with as if it's their user name (usually the emailItem)
+	durability    atomic.Value // *int* storage durability mode for the AuthTable's data files
+	compactThreshold atomic.Value // *uint8* percent of a partition's lines that are deleted before it is compacted (0 disables)
+	format        atomic.Value // *uint8* format entries are written to the data files in
 
 	// entries
 	eMux      sync.Mutex // entries/altLogins map lock
 	entries   map[string]*authTableEntry // AuthTable uses a Map for storage since it's only look-up is with user name and password
 	altLogins map[string]*authTableEntry // Alternative login item references
+	deletedLines map[uint16]uint16 // number of deleted lines in each partition, by file number
 	vCodes    map[string]string //
 
 	// unique values
 	uMux       sync.Mutex
 	uniqueVals map[string]map[interface{}]bool
+
+	// item hooks
+	hMux  sync.Mutex
+	hooks map[string]itemHook
 }
 
 type EmailSettings struct {
@@ -121,6 +130,9 @@ type authtableConfig struct {
 	VerifyItem string
 	EmailSettings EmailSettings
 	AltLogin string
+	Durability int
+	CompactThreshold uint8
+	Format uint8
 }
 
 /////////////////////////////////////////////////////////////////////////////////////////////////
@@ -188,6 +200,8 @@ func New(name string, configFile *os.File, s schema.Schema, fileOn uint16, dataO
 			VerifyItem: "",
 			EmailSettings: EmailSettings{},
 			AltLogin: "",
+			CompactThreshold: helpers.DefaultCompactThreshold,
+			Format: helpers.FormatJSON,
 		}); wErr != 0 {
 			return nil, helpers.NewError(wErr, namePre + helpers.FileTypeConfig)
 		}
@@ -201,6 +215,7 @@ func New(name string, configFile *os.File, s schema.Schema, fileOn uint16, dataO
 		configFile:    configFile,
 		entries:       make(map[string]*authTableEntry),
 		altLogins:     make(map[string]*authTableEntry),
+		deletedLines:  make(map[uint16]uint16),
 		vCodes:        make(map[string]string),
 		uniqueVals:    make(map[string]map[interface{}]bool),
 		fileOn:        fileOn,
@@ -215,6 +230,9 @@ func New(name string, configFile *os.File, s schema.Schema, fileOn uint16, dataO
 	t.verifyItem.Store("")
 	t.emailSettings.Store(EmailSettings{})
 	t.altLoginItem.Store("")
+	t.durability.Store(storage.DurabilityDefault)
+	t.compactThreshold.Store(helpers.DefaultCompactThreshold)
+	t.format.Store(helpers.FormatJSON)
 	// Push to tables map
 	tablesMux.Lock()
 	tables[name] = &t
@@ -227,27 +245,15 @@ func (t *AuthTable) Close(save bool) {
 		t.eMux.Lock()
 		fileOn := t.fileOn
 		t.eMux.Unlock()
-		writeConfigFile(t.configFile, authtableConfig{
-			Name: t.name,
-			Schema: t.schema.MakeConfig(),
-			FileOn: fileOn,
-			DataOnDrive: t.dataOnDrive,
-			MemOnly: t.memOnly,
-			PartitionMax: t.partitionMax.Load().(uint16),
-			EncryptCost: t.encryptCost.Load().(int),
-			MaxEntries: t.maxEntries.Load().(uint64),
-			MinPass: t.minPassword.Load().(uint8),
-			PassResetLen: t.passResetLen.Load().(uint8),
-			EmailItem: t.emailItem.Load().(string),
-			VerifyItem: t.verifyItem.Load().(string),
-			EmailSettings: t.emailSettings.Load().(EmailSettings),
-			AltLogin: t.altLoginItem.Load().(string),
-		})
+		writeConfigFile(t.configFile, t.makeDefaultConfig(fileOn))
 	}
 	tablesMux.Lock()
 	delete(tables, t.name)
 	tablesMux.Unlock()
 	t.configFile.Close()
+	storage.CloseFiles(dataFolderPrefix + t.name)
+	storage.CloseWAL(dataFolderPrefix + t.name)
+	storage.SetFolderDurability(dataFolderPrefix + t.name, storage.DurabilityDefault)
 }
 
 // Delete deletes the AuthTable from memory and disk
@@ -261,7 +267,7 @@ func (t *AuthTable) Delete() helpers.Error {
 	if err := os.Remove(dataFolderPrefix + t.name + helpers.FileTypeConfig); err != nil {
 		return helpers.NewError(helpers.ErrorFileDelete, "Config file")
 	}
-	return 0
+	return helpers.Error{}
 }
 
 // Get retrieves a AuthTable by name
@@ -303,6 +309,16 @@ func (e *authTableEntry) CheckPassword(pass string) bool {
 	return helpers.StringMatchesEncryption(pass, p)
 }
 
+// Name returns the AuthTable's name
+func (t *AuthTable) Name() string {
+	return t.name
+}
+
+// Schema returns the AuthTable's schema
+func (t *AuthTable) Schema() schema.Schema {
+	return t.schema
+}
+
 func (t *AuthTable) Size() int {
 	t.eMux.Lock()
 	s := len(t.entries)
@@ -318,6 +334,21 @@ func (t *AuthTable) AltLoginItem() string {
 	return t.altLoginItem.Load().(string)
 }
 
+// Durability returns the storage durability mode saved for this AuthTable
+func (t *AuthTable) Durability() int {
+	return t.durability.Load().(int)
+}
+
+// CompactThreshold returns the percent of a partition's lines that must be deleted before it is compacted
+func (t *AuthTable) CompactThreshold() uint8 {
+	return t.compactThreshold.Load().(uint8)
+}
+
+// Format returns the format new entries are written to the AuthTable's data files in
+func (t *AuthTable) Format() uint8 {
+	return t.format.Load().(uint8)
+}
+
 //////////////////////////////////////////////////////////////////////////////////////////////////////
 //   Authtable Setters   /////////////////////////////////////////////////////////////////////////////
 //////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -356,6 +387,26 @@ func (t *AuthTable) SetMaxEntries(max uint64) int {
 	return 0
 }
 
+// SetDurability sets the storage durability mode for the AuthTable's data files. Use storage.DurabilityDefault
+// for the storage engine's durability mode. Returns helpers.ErrorInvalidItemValue for an unknown mode.
+func (t *AuthTable) SetDurability(mode int) int {
+	if mode < storage.DurabilityDefault || mode > storage.DurabilityBuffered {
+		return helpers.ErrorInvalidItemValue
+	}
+	t.eMux.Lock()
+	fileOn := t.fileOn
+	t.eMux.Unlock()
+	conf := t.makeDefaultConfig(fileOn)
+	conf.Durability = mode
+	if err := writeConfigFile(t.configFile, conf); err != 0 {
+		helpers.LogAndPrint("Failed to set durability for AuthTable '" + t.name + "' with error code: " + strconv.Itoa(err), 4)
+		return err
+	}
+	t.durability.Store(mode)
+	storage.SetFolderDurability(dataFolderPrefix + t.name, mode)
+	return 0
+}
+
 func (t *AuthTable) SetMinPasswordLength(min uint8) int {
 	if min < 1 {
 		min = 1
@@ -491,6 +542,24 @@ func (t *AuthTable) SetPartitionMax(max uint16) int {
 	return 0
 }
 
+// SetCompactThreshold sets the percent of a partition's lines that must be deleted before the partition is
+// automatically compacted. A threshold of 0 disables automatic compaction.
+func (t *AuthTable) SetCompactThreshold(percent uint8) int {
+	if percent > 100 {
+		percent = 100
+	}
+	t.eMux.Lock()
+	fileOn := t.fileOn
+	t.eMux.Unlock()
+	conf := t.makeDefaultConfig(fileOn)
+	conf.CompactThreshold = percent
+	if err := writeConfigFile(t.configFile, conf); err != 0 {
+		return err
+	}
+	t.compactThreshold.Store(percent)
+	return 0
+}
+
 func (t *AuthTable) makeDefaultConfig(fileOn uint16) authtableConfig {
 	return authtableConfig{
 		Name: t.name,
@@ -507,6 +576,9 @@ func (t *AuthTable) makeDefaultConfig(fileOn uint16) authtableConfig {
 		VerifyItem: t.verifyItem.Load().(string),
 		EmailSettings: t.emailSettings.Load().(EmailSettings),
 		AltLogin: t.altLoginItem.Load().(string),
+		Durability: t.durability.Load().(int),
+		CompactThreshold: t.compactThreshold.Load().(uint8),
+		Format: t.format.Load().(uint8),
 	}
 }
 
@@ -521,6 +593,11 @@ func writeConfigFile(f *os.File, c authtableConfig) int {
 		return helpers.ErrorFileUpdate
 	}
 	f.Truncate(int64(len(jBytes)))
+	// Keep a copy in the data folder for Repair to make a new config file from
+	copyFile := strings.TrimSuffix(f.Name(), helpers.FileTypeConfig) + configCopyFile
+	if cErr := helpers.WriteFileAtomic(copyFile, jBytes); cErr != nil {
+		helpers.LogAndPrint("Failed to write config copy '" + copyFile + "' with error: " + cErr.Error(), 4)
+	}
 	//
 	return 0
 }
@@ -583,6 +660,16 @@ func Restore(name string) (*AuthTable, helpers.Error) {
 	if confStruct.PartitionMax != helpers.DefaultPartitionMax {
 		at.partitionMax.Store(confStruct.PartitionMax)
 	}
+	if confStruct.CompactThreshold != helpers.DefaultCompactThreshold {
+		at.compactThreshold.Store(confStruct.CompactThreshold)
+	}
+	if confStruct.Format != helpers.FormatJSON {
+		at.format.Store(confStruct.Format)
+	}
+	if confStruct.Durability != storage.DurabilityDefault {
+		at.durability.Store(confStruct.Durability)
+		storage.SetFolderDurability(namePre, confStruct.Durability)
+	}
 	if confStruct.MinPass != defaultMinPassword {
 		at.minPassword.Store(confStruct.MinPass)
 	}
@@ -598,6 +685,13 @@ func Restore(name string) (*AuthTable, helpers.Error) {
 	if confStruct.AltLogin != "" {
 		at.altLoginItem.Store(confStruct.AltLogin)
 	}
+	// Apply writes left in the write-ahead log
+	if wErr := storage.ReplayWAL(namePre); wErr != 0 {
+		at.eMux.Unlock()
+		at.uMux.Unlock()
+		at.Close(false)
+		return nil, helpers.NewError(wErr, "Could not replay write-ahead log for Auth '" + name + "'")
+	}
 	// Open data folder
 	df, err := os.Open(namePre)
 	if err != nil {
@@ -639,12 +733,17 @@ func Restore(name string) (*AuthTable, helpers.Error) {
 			// Get line bytes
 			var lb []byte
 			if lb, err = of.Read(uint16(i+1)); err != 0 {
-				fmt.Printf("Error: Auth '%v':: Could not read line %v of '%v'!\n", name, i + 1, fileStats.Name())
+				fmt.Printf("Error: Auth '%v':: Could not read line %v of '%v' (user '%v'), with error code %v!\n", name, i + 1, fileStats.Name(), entryKey(lb), err)
+				continue
+			}
+			if len(lb) == 0 {
+				// Deleted line
+				at.deletedLines[uint16(fileNum)]++
 				continue
 			}
-			eKey, ePass, eData := restoreDataLine(lb)
+			eKey, ePass, eData := at.restoreDataLine(lb)
 			if eData == nil {
-				fmt.Printf("Error: Auth '%v':: Incorrect JSON format on line %v of '%v'!\n", name, i + 1, fileStats.Name())
+				fmt.Printf("Error: Auth '%v':: Incorrect entry format on line %v of '%v'!\n", name, i + 1, fileStats.Name())
 				continue
 			}
 			if err = at.restoreUser(eKey, []byte(ePass), eData, uint16(fileNum), uint16(i+1)); err != 0 {
@@ -660,14 +759,10 @@ func Restore(name string) (*AuthTable, helpers.Error) {
 	return at, helpers.Error{}
 }
 
-func restoreDataLine(line []byte) (string, string, []interface{}) {
-	var jEntry jsonEntry
-	mErr := json.Unmarshal(line, &jEntry)
-	if mErr != nil {
-		return "", "", nil
-	}
-	if jEntry.D == nil || jEntry.N == "" || len(jEntry.P) == 0 {
+func (t *AuthTable) restoreDataLine(line []byte) (string, string, []interface{}) {
+	name, pass, data, err := t.entryFromBytes(line)
+	if err != 0 || data == nil || name == "" || len(pass) == 0 {
 		return "", "", nil
 	}
-	return jEntry.N, jEntry.P, jEntry.D
+	return name, pass, data
 }
\ No newline at end of file
@@ -1,11 +1,16 @@
 package authtable
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"github.com/hewiefreeman/GopherDB/helpers"
 	"github.com/hewiefreeman/GopherDB/authtable"
+	"github.com/hewiefreeman/GopherDB/schema"
 	"github.com/hewiefreeman/GopherDB/storage"
+	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -90,6 +95,10 @@ func TestChangeTableSettings(t *testing.T) {
 		t.Errorf("Error while setting table encryption cost: %v", err)
 		return
 	}
+	// Unknown durability modes are rejected
+	if err = table.SetDurability(storage.DurabilityBuffered + 1); err != helpers.ErrorInvalidItemValue {
+		t.Errorf("Expected error %v while setting unknown durability mode, but got: %v", helpers.ErrorInvalidItemValue, err)
+	}
 	// Set table password min length
 	err = table.SetMinPasswordLength(tableMinPassLen)
 	if err != 0 {
@@ -702,7 +711,167 @@ func TestSortArray(t *testing.T) {
 	}
 }*/
 
+func TestSelect(t *testing.T) {
+	s, sErr := schema.New(map[string]interface{}{
+		"level":   []interface{}{"Uint16", float64(1), float64(0), float64(0), false, false},
+		"country": []interface{}{"String", "", float64(0), false, false, false},
+	}, false)
+	if sErr.ID != 0 {
+		t.Fatalf("TestSelect error making schema: %v", sErr)
+	}
+	at, aErr := authtable.New("testSelect", nil, s, 0, false, true)
+	if aErr.ID != 0 {
+		t.Fatalf("TestSelect error making AuthTable: %v", aErr)
+	}
+	defer func() { at.Delete() }()
+	users := map[string][]interface{}{"Mia": {float64(3), "CA"}, "Ann": {float64(7), "US"}, "Bob": {float64(3), "US"}, "Zed": {float64(9), "CA"}}
+	for name, items := range users {
+		if _, err := at.NewUser(name, "password", map[string]interface{}{"level": items[0], "country": items[1]}); err.ID != 0 {
+			t.Fatalf("TestSelect error inserting '%v': %v", name, err)
+		}
+	}
+	names := func(selected []authtable.Selected) string {
+		var n string
+		for _, e := range selected {
+			n += e.Name + " "
+		}
+		return n
+	}
+	selected, cursor, err := at.Select(nil, map[string]interface{}{"level.*lt": []interface{}{8}}, map[string]interface{}{"level": nil}, 2, 0, "")
+	if err.ID != 0 {
+		t.Fatalf("TestSelect error: %v", err)
+	} else if names(selected) != "Ann Bob " || cursor != "Bob" || selected[0].Items["level"] != uint16(7) {
+		t.Errorf("TestSelect expected Ann and Bob with cursor Bob, but got %v with cursor %v", selected, cursor)
+	}
+	if selected, cursor, err = at.Select(nil, map[string]interface{}{"level.*lt": []interface{}{8}}, nil, 2, 0, cursor); err.ID != 0 {
+		t.Fatalf("TestSelect error: %v", err)
+	} else if names(selected) != "Mia " || cursor != "" {
+		t.Errorf("TestSelect expected Mia after Bob, but got %v with cursor %v", names(selected), cursor)
+	}
+	if selected, _, err = at.Select([]string{"country", "level.*sortDesc"}, nil, nil, 0, 0, ""); err.ID != 0 {
+		t.Fatalf("TestSelect error: %v", err)
+	} else if names(selected) != "Zed Mia Ann Bob " {
+		t.Errorf("TestSelect expected Zed Mia Ann Bob, but got %v", names(selected))
+	}
+	// Ordered pages continue from the last user's place in the order, even once it's deleted
+	if selected, cursor, err = at.Select([]string{"country", "level.*sortDesc"}, nil, nil, 2, 0, ""); err.ID != 0 {
+		t.Fatalf("TestSelect error: %v", err)
+	} else if names(selected) != "Zed Mia " || cursor == "" {
+		t.Errorf("TestSelect expected Zed Mia with a cursor, but got %v with cursor %v", names(selected), cursor)
+	}
+	if err = at.DeleteUser("Mia", "password"); err.ID != 0 {
+		t.Fatalf("TestSelect error deleting Mia: %v", err)
+	}
+	if selected, _, err = at.Select([]string{"country", "level.*sortDesc"}, nil, nil, 0, 1, cursor); err.ID != 0 {
+		t.Fatalf("TestSelect error: %v", err)
+	} else if names(selected) != "Bob " {
+		t.Errorf("TestSelect expected Bob, but got %v", names(selected))
+	}
+	if _, _, err = at.Select([]string{"country"}, nil, nil, 0, 0, "Mia"); err.ID != helpers.ErrorInvalidItemValue {
+		t.Errorf("TestSelect expected error %v, but got: %v", helpers.ErrorInvalidItemValue, err)
+	}
+	if _, _, err = at.Select([]string{"password"}, nil, nil, 0, 0, ""); err.ID != helpers.ErrorInvalidItem {
+		t.Errorf("TestSelect expected error %v, but got: %v", helpers.ErrorInvalidItem, err)
+	}
+}
+
 // Must be last test!!
+func TestRepair(t *testing.T) {
+	s, sErr := schema.New(map[string]interface{}{
+		"level":   []interface{}{"Uint16", float64(1), float64(0), float64(0), false, false},
+		"country": []interface{}{"String", "", float64(0), false, false, false},
+	}, false)
+	if sErr.ID != 0 {
+		t.Fatalf("TestRepair error making schema: %v", sErr)
+	}
+	at, aErr := authtable.New("testRepair", nil, s, 0, false, false)
+	if aErr.ID != 0 {
+		t.Fatalf("TestRepair error making AuthTable: %v", aErr)
+	}
+	for i, name := range []string{"Ann", "Bob", "Mia"} {
+		if _, err := at.NewUser(name, "password", map[string]interface{}{"level": float64(i + 1), "country": "CA"}); err.ID != 0 {
+			t.Fatalf("TestRepair error inserting '%v': %v", name, err)
+		}
+	}
+	at.Close(false)
+	storage.ShutDown()
+	storage.Init()
+	// Lose the config file and it's copy, so the config is made from the AuthTable's users
+	os.Remove("Auth-testRepair" + helpers.FileTypeConfig)
+	os.Remove("Auth-testRepair/config" + helpers.FileTypeConfig)
+	if _, err := authtable.Repair("testRepair"); err.ID != 0 {
+		t.Fatalf("TestRepair repair error: %v", err)
+	}
+	if at, aErr = authtable.Restore("testRepair"); aErr.ID != 0 {
+		t.Fatalf("TestRepair restore error: %v", aErr)
+	}
+	defer func() { at.Delete() }()
+	// Users can still log in, and items are named by position
+	level := "item" + strconv.Itoa(int(s["level"].DataIndex()))
+	if data, err := at.GetUser("Bob", "password", nil); err.ID != 0 {
+		t.Errorf("TestRepair error logging in after repairing: %v", err)
+	} else if si := at.Schema()[level]; si.TypeName() != schema.ItemTypeInt64 || fmt.Sprint(data[level]) != "2" {
+		t.Errorf("TestRepair expected %v to be an Int64 of 2, but got a %v of %v", level, si.TypeName(), data[level])
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	s, sErr := schema.New(map[string]interface{}{
+		"level":   []interface{}{"Uint16", float64(1), float64(0), float64(0), false, false},
+		"country": []interface{}{"String", "", float64(0), false, false, false},
+	}, false)
+	if sErr.ID != 0 {
+		t.Fatalf("TestExportImport error making schema: %v", sErr)
+	}
+	at, aErr := authtable.New("testExportImport", nil, s, 0, false, true)
+	if aErr.ID != 0 {
+		t.Fatalf("TestExportImport error making AuthTable: %v", aErr)
+	}
+	defer func() { at.Delete() }()
+	for i, name := range []string{"Ann", "Bob", "Mia"} {
+		if _, err := at.NewUser(name, "password" + strconv.Itoa(i), map[string]interface{}{"level": float64(i + 1), "country": "CA"}); err.ID != 0 {
+			t.Fatalf("TestExportImport error inserting '%v': %v", name, err)
+		}
+	}
+	for _, asCSV := range []bool{false, true} {
+		var export bytes.Buffer
+		if n, err := at.Export(&export, asCSV); err.ID != 0 || n != 3 {
+			t.Fatalf("TestExportImport expected 3 users exported, but got %v (error %v)", n, err)
+		}
+		// Delete every user, then import them again
+		for i, name := range []string{"Ann", "Bob", "Mia"} {
+			if err := at.DeleteUser(name, "password" + strconv.Itoa(i)); err.ID != 0 {
+				t.Fatalf("TestExportImport error deleting '%v': %v", name, err)
+			}
+		}
+		if n, rowErrs, err := at.Import(strings.NewReader(export.String()), asCSV); err.ID != 0 || n != 3 || len(rowErrs) != 0 {
+			t.Fatalf("TestExportImport expected 3 users imported, but got %v (errors %v %v)", n, err, rowErrs)
+		}
+		// Imported users log in with their old passwords
+		if data, err := at.GetUser("Bob", "password1", nil); err.ID != 0 {
+			t.Errorf("TestExportImport error logging in after importing (CSV %v): %v", asCSV, err)
+		} else if fmt.Sprint(data["level"]) != "2" || data["country"] != "CA" {
+			t.Errorf("TestExportImport unexpected data after importing (CSV %v): %v", asCSV, data)
+		}
+		if _, err := at.GetUser("Bob", "password0", nil); err.ID != helpers.ErrorNoEntryFound {
+			t.Errorf("TestExportImport expected error %v logging in with the wrong password, but got: %v", helpers.ErrorNoEntryFound, err)
+		}
+	}
+	// Users without a password, or with one that isn't encrypted, are row errors
+	rows := "{\"Name\":\"Joe\",\"Password\":\"\",\"Items\":{\"level\":1}}\n" +
+		"{\"Name\":\"Sam\",\"Password\":\"password\",\"Items\":{\"level\":1}}\n"
+	n, rowErrs, err := at.Import(strings.NewReader(rows), false)
+	if err.ID != 0 || n != 0 || len(rowErrs) != 2 {
+		t.Fatalf("TestExportImport expected 2 row errors, but got %v imported and %v (error %v)", n, rowErrs, err)
+	}
+	if rowErrs[0].Error.ID != helpers.ErrorPasswordLength {
+		t.Errorf("TestExportImport expected error %v for an empty password, but got: %v", helpers.ErrorPasswordLength, rowErrs[0].Error)
+	}
+	if rowErrs[1].Error.ID != helpers.ErrorPasswordEncryption {
+		t.Errorf("TestExportImport expected error %v for an unencrypted password, but got: %v", helpers.ErrorPasswordEncryption, rowErrs[1].Error)
+	}
+}
+
 func TestStorageShutdown(t *testing.T) {
 	storage.ShutDown()
 	if storage.GetNumOpenFiles() != 0 {
@@ -0,0 +1,181 @@
+package authtable
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   AuthTable Backups   /////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A backup is a gzipped tar archive (see storage.WriteArchive) of an AuthTable's config file and partitions, taken at
+// a single point in time. The partitions are backed up from storage snapshots (see storage.TakeSnapshots), so the
+// AuthTable is only locked while the config is copied and the snapshots are taken, and keeps serving while the
+// partitions are read and the archive is written. MemOnly AuthTables have no partitions, so their users are written to
+// partitions in the backup instead, with the AuthTable locked while they're encoded.
+
+// Backup writes a backup of the AuthTable to an archive file.
+func (t *AuthTable) Backup(archive string) helpers.Error {
+	namePre := dataFolderPrefix + t.name
+	fileNums, ok := partitions(namePre)
+	if !ok && !t.memOnly {
+		return helpers.NewError(helpers.ErrorFileRead, "Error reading files in data folder for AuthTable '" + t.name + "'")
+	}
+
+	t.eMux.Lock()
+	conf, jErr := helpers.Fjson.MarshalIndent(t.makeDefaultConfig(t.fileOn), "", "   ")
+	if jErr != nil {
+		t.eMux.Unlock()
+		return helpers.NewError(helpers.ErrorJsonEncoding, t.name)
+	}
+	var snaps []*storage.FileSnapshot
+	if !t.memOnly {
+		partitionFiles := make([]string, len(fileNums))
+		for i, fileNum := range fileNums {
+			partitionFiles[i] = namePre + "/" + strconv.Itoa(fileNum) + helpers.FileTypeStorage
+		}
+		var err int
+		if snaps, err = storage.TakeSnapshots(partitionFiles); err != 0 {
+			t.eMux.Unlock()
+			return helpers.NewError(err, t.name)
+		}
+	}
+	t.eMux.Unlock()
+
+	files := []storage.ArchiveFile{{Name: namePre + helpers.FileTypeConfig, Bytes: conf}}
+	var partitionFiles []storage.ArchiveFile
+	var err helpers.Error
+	if t.memOnly {
+		partitionFiles, err = t.memPartitions(namePre)
+	} else if sFiles, sErr := storage.ArchiveSnapshots(snaps); sErr != 0 {
+		err = helpers.NewError(sErr, t.name)
+	} else {
+		partitionFiles = sFiles
+	}
+	if err.ID != 0 {
+		return err
+	}
+	files = append(files, partitionFiles...)
+
+	if wErr := storage.WriteArchive(archive, files); wErr != 0 {
+		helpers.LogAndPrint("Failed to write backup '" + archive + "' for AuthTable '" + t.name + "' with error code: " + strconv.Itoa(wErr), 4)
+		return helpers.NewError(wErr, archive)
+	}
+	return helpers.Error{}
+}
+
+// memPartitions writes a MemOnly AuthTable's users to partitions for a backup, in name order. The AuthTable is locked
+// while they're encoded.
+func (t *AuthTable) memPartitions(namePre string) ([]storage.ArchiveFile, helpers.Error) {
+	t.eMux.Lock()
+	defer t.eMux.Unlock()
+	names := make([]string, 0, len(t.entries))
+	for name := range t.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	partitionMax := int(t.partitionMax.Load().(uint16))
+	var files []storage.ArchiveFile
+	for i := 0; i < len(names); i += partitionMax {
+		end := i + partitionMax
+		if end > len(names) {
+			end = len(names)
+		}
+		lines := make([][]byte, 0, end-i)
+		for _, name := range names[i:end] {
+			e := t.entries[name]
+			var lb []byte
+			e.mux.Lock()
+			err := t.makeEntryBytes(name, e.password.Load().([]byte), e.data, &lb)
+			e.mux.Unlock()
+			if err != 0 {
+				return nil, helpers.NewError(err, t.name + " > " + name)
+			}
+			lines = append(lines, lb)
+		}
+		b, err := storage.MakeFile(lines)
+		if err != 0 {
+			return nil, helpers.NewError(err, t.name)
+		}
+		files = append(files, storage.ArchiveFile{Name: namePre + "/" + strconv.Itoa(len(files)) + helpers.FileTypeStorage, Bytes: b})
+	}
+	return files, helpers.Error{}
+}
+
+// RestoreBackup restores an AuthTable from a backup made with Backup. The AuthTable gets the name it had when it was
+// backed up, and must not exist yet.
+func RestoreBackup(archive string) (*AuthTable, helpers.Error) {
+	files, err := storage.ReadArchive(archive)
+	if err != 0 {
+		return nil, helpers.NewError(err, archive)
+	}
+	// Find the config file to get the AuthTable's name from
+	var name string
+	var conf []byte
+	for _, f := range files {
+		if !strings.Contains(f.Name, "/") && strings.HasPrefix(f.Name, dataFolderPrefix) && strings.HasSuffix(f.Name, helpers.FileTypeConfig) {
+			name = strings.TrimSuffix(strings.TrimPrefix(f.Name, dataFolderPrefix), helpers.FileTypeConfig)
+			conf = f.Bytes
+			break
+		}
+	}
+	if len(name) == 0 {
+		return nil, helpers.NewError(helpers.ErrorBackupFormat, "'" + archive + "' is not an AuthTable backup")
+	}
+	namePre := dataFolderPrefix + name
+	if Get(name) != nil {
+		return nil, helpers.NewError(helpers.ErrorTableExists, name)
+	} else if _, sErr := os.Stat(namePre + helpers.FileTypeConfig); sErr == nil {
+		return nil, helpers.NewError(helpers.ErrorTableExists, name)
+	} else if _, sErr = os.Stat(namePre); sErr == nil {
+		return nil, helpers.NewError(helpers.ErrorTableExists, name)
+	}
+	// Only partitions can be written to the data folder
+	for _, f := range files {
+		if f.Name != namePre + helpers.FileTypeConfig && (path.Dir(f.Name) != namePre || !strings.HasSuffix(f.Name, helpers.FileTypeStorage)) {
+			return nil, helpers.NewError(helpers.ErrorBackupFormat, "'" + archive + "' has an unexpected file '" + f.Name + "'")
+		}
+	}
+
+	if mErr := storage.MakeDir(namePre); mErr != nil {
+		return nil, helpers.NewError(helpers.ErrorCreatingFolder, namePre + ": " + mErr.Error())
+	}
+	for _, f := range files {
+		if f.Name == namePre + helpers.FileTypeConfig {
+			continue
+		}
+		if wErr := ioutil.WriteFile(f.Name, f.Bytes, 0755); wErr != nil {
+			os.RemoveAll(namePre)
+			return nil, helpers.NewError(helpers.ErrorFileWrite, f.Name + ": " + wErr.Error())
+		}
+	}
+	// The config file is written last, so the AuthTable can't be restored from a partially restored backup
+	if wErr := helpers.WriteFileAtomic(namePre + configCopyFile, conf); wErr != nil {
+		os.RemoveAll(namePre)
+		return nil, helpers.NewError(helpers.ErrorFileWrite, namePre + configCopyFile + ": " + wErr.Error())
+	}
+	if wErr := ioutil.WriteFile(namePre + helpers.FileTypeConfig, conf, 0755); wErr != nil {
+		os.RemoveAll(namePre)
+		return nil, helpers.NewError(helpers.ErrorFileWrite, namePre + helpers.FileTypeConfig + ": " + wErr.Error())
+	}
+	t, rErr := Restore(name)
+	if rErr.ID != 0 || !t.memOnly {
+		return t, rErr
+	}
+	// A MemOnly AuthTable's users are only kept in memory once restored
+	storage.CloseFiles(namePre)
+	for _, f := range files {
+		if f.Name != namePre + helpers.FileTypeConfig {
+			os.Remove(f.Name)
+		}
+	}
+	return t, helpers.Error{}
+}
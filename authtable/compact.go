@@ -0,0 +1,96 @@
+package authtable
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"strconv"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   AuthTable Compaction   //////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Deleting a user leaves an empty line in it's partition (data file). Compacting a partition rewrites it without
+// it's empty lines, and renumbers the persistIndex of every entry left in it. A partition is compacted automatically
+// once the percentage of it's lines that are deleted reaches the AuthTable's compact threshold.
+
+// addDeletedLine counts a deleted line in a partition, and reports whether the partition has reached the compact
+// threshold. t.eMux must be locked.
+func (t *AuthTable) addDeletedLine(fileNum uint16) bool {
+	t.deletedLines[fileNum]++
+	threshold := int(t.compactThreshold.Load().(uint8))
+	return threshold > 0 && int(t.deletedLines[fileNum])*100 >= threshold*int(t.partitionMax.Load().(uint16))
+}
+
+// Compact compacts every partition that has deleted lines.
+func (t *AuthTable) Compact() helpers.Error {
+	if t.memOnly {
+		return helpers.Error{}
+	}
+	t.eMux.Lock()
+	files := make([]uint16, 0, len(t.deletedLines))
+	for fileNum, deleted := range t.deletedLines {
+		if deleted > 0 {
+			files = append(files, fileNum)
+		}
+	}
+	t.eMux.Unlock()
+	for _, fileNum := range files {
+		if err := t.CompactPartition(fileNum); err.ID != 0 {
+			return err
+		}
+	}
+	return helpers.Error{}
+}
+
+// CompactPartition rewrites a partition without it's deleted lines. Entries in the partition are locked while it
+// is compacted.
+func (t *AuthTable) CompactPartition(fileNum uint16) helpers.Error {
+	if t.memOnly {
+		return helpers.Error{}
+	}
+	file := dataFolderPrefix + t.name + "/" + strconv.Itoa(int(fileNum)) + helpers.FileTypeStorage
+	t.eMux.Lock()
+	if t.deletedLines[fileNum] == 0 {
+		// Already compacted
+		t.eMux.Unlock()
+		return helpers.Error{}
+	}
+	// Lock every entry in the partition so none of them use their old persistIndex
+	var locked []*authTableEntry
+	for _, e := range t.entries {
+		if e.persistFile == fileNum {
+			e.mux.Lock()
+			locked = append(locked, e)
+		}
+	}
+	newLines, err := storage.Compact(file)
+	if err == 0 {
+		for _, e := range locked {
+			if int(e.persistIndex) <= len(newLines) && newLines[e.persistIndex-1] != 0 {
+				e.persistIndex = newLines[e.persistIndex-1]
+			}
+		}
+		delete(t.deletedLines, fileNum)
+	}
+	for _, e := range locked {
+		e.mux.Unlock()
+	}
+	t.eMux.Unlock()
+	if err != 0 {
+		helpers.LogAndPrint("Failed to compact '" + file + "' for Auth '" + t.name + "' with error code: " + strconv.Itoa(err), 4)
+		return helpers.NewError(err, file)
+	}
+	return helpers.Error{}
+}
+
+// DeletedLines returns the number of deleted lines in the AuthTable's partitions waiting to be compacted
+func (t *AuthTable) DeletedLines() int {
+	var n int
+	t.eMux.Lock()
+	for _, deleted := range t.deletedLines {
+		n += int(deleted)
+	}
+	t.eMux.Unlock()
+	return n
+}
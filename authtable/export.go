@@ -0,0 +1,107 @@
+package authtable
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"io"
+	"sort"
+	"strconv"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   AuthTable Export & Import   /////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// AuthTable entries are exported with schema.RowWriter, with their user name and encrypted password as the "Name" and
+// "Password" header values:
+//
+//	{"Name":"Mary","Password":"$2a$04$...","Items":{"email":"mary@example.com"}}
+//
+
+// exportHead is the names of the header values AuthTable entries are exported with
+var exportHead = []string{"Name", "Password"}
+
+// Export writes every user in the AuthTable to w as JSON Lines, or as CSV when asCSV is true and the schema is flat.
+// Users are written in order of their names. Returns the number of users exported.
+func (t *AuthTable) Export(w io.Writer, asCSV bool) (int, helpers.Error) {
+	rw, err := schema.NewRowWriter(w, t.schema, exportHead, asCSV)
+	if err.ID != 0 {
+		return 0, err
+	}
+	t.eMux.Lock()
+	names := make([]string, 0, len(t.entries))
+	entries := make(map[string]*authTableEntry, len(t.entries))
+	for name, e := range t.entries {
+		names = append(names, name)
+		entries[name] = e
+	}
+	t.eMux.Unlock()
+	sort.Strings(names)
+
+	var exported int
+	for _, name := range names {
+		e := entries[name]
+		var data []interface{}
+		var dErr int
+		e.mux.Lock()
+		if t.dataOnDrive {
+			data, dErr = t.dataFromDrive(dataFolderPrefix + t.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage, e.persistIndex)
+		} else {
+			data = append([]interface{}{}, e.data...)
+		}
+		e.mux.Unlock()
+		// Skip users deleted since the export started
+		t.eMux.Lock()
+		deleted := t.entries[name] != e
+		t.eMux.Unlock()
+		if deleted {
+			continue
+		} else if dErr != 0 {
+			return exported, helpers.NewError(dErr, t.name + " > " + name)
+		}
+		if wErr := rw.Write([]string{name, string(e.password.Load().([]byte))}, data); wErr != 0 {
+			return exported, helpers.NewError(wErr, t.name + " > " + name)
+		}
+		exported++
+	}
+	if fErr := rw.Flush(); fErr != 0 {
+		return exported, helpers.NewError(fErr, t.name)
+	}
+	return exported, helpers.Error{}
+}
+
+// Import inserts users from an export made with Export, read from r as JSON Lines, or as CSV when asCSV is true.
+// Every row is checked against the schema like a NewUser query, except passwords and items are taken as they were
+// exported. Passwords that aren't encrypted can't be logged in with, so their rows return
+// helpers.ErrorPasswordEncryption. Rows that can't be read or inserted are skipped and returned with their errors.
+// Returns the number of users imported.
+func (t *AuthTable) Import(r io.Reader, asCSV bool) (int, []schema.RowError, helpers.Error) {
+	rr, err := schema.NewRowReader(r, t.schema, exportHead, asCSV)
+	if err.ID != 0 {
+		return 0, nil, err
+	}
+	var imported int
+	var rowErrs []schema.RowError
+	for {
+		head, items, rErr, ok := rr.Read()
+		if !ok {
+			break
+		}
+		var name string
+		if len(head) > 0 {
+			name = head[0]
+		}
+		if rErr == helpers.ErrorFileRead {
+			return imported, rowErrs, helpers.NewError(rErr, t.name)
+		} else if rErr != 0 {
+			rowErrs = append(rowErrs, schema.RowError{Row: rr.Row(), Key: name, Error: helpers.NewError(rErr, t.name)})
+			continue
+		}
+		if _, iErr := t.insertUser(name, "", []byte(head[1]), items); iErr.ID != 0 {
+			rowErrs = append(rowErrs, schema.RowError{Row: rr.Row(), Key: name, Error: iErr})
+			continue
+		}
+		imported++
+	}
+	return imported, rowErrs, helpers.Error{}
+}
@@ -0,0 +1,109 @@
+package authtable
+
+import (
+	"encoding/json"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"strconv"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   AuthTable Entry Formats   ///////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Entries are written to the data files as JSON (helpers.FormatJSON), or with the schema's binary encoding
+// (helpers.FormatBinary). Entries are read in either format, so a data file can hold both while an AuthTable is
+// being converted.
+
+// makeEntryBytes makes the bytes for an entry in the AuthTable's format
+func (t *AuthTable) makeEntryBytes(name string, password []byte, data []interface{}, b *[]byte) int {
+	if t.format.Load().(uint8) == helpers.FormatBinary {
+		var err int
+		*b, err = schema.EncodeBinary(t.schema, []string{name, string(password)}, data)
+		return err
+	}
+	return makeJsonBytes(name, password, data, b)
+}
+
+// entryFromBytes gets the user name, password and data from an entry's bytes in either format
+func (t *AuthTable) entryFromBytes(b []byte) (string, string, []interface{}, int) {
+	if schema.IsBinary(b) {
+		header, data, err := schema.DecodeBinary(t.schema, b, 2)
+		if err != 0 {
+			return "", "", nil, err
+		}
+		return header[0], header[1], data, 0
+	}
+	return entryFromJson(b)
+}
+
+// entryFromJson gets the user name, password, and data from a JSON entry's bytes
+func entryFromJson(b []byte) (string, string, []interface{}, int) {
+	var jEntry jsonEntry
+	if jErr := json.Unmarshal(b, &jEntry); jErr != nil {
+		return "", "", nil, helpers.ErrorJsonDecoding
+	}
+	if jEntry.D == nil || len(jEntry.D) == 0 {
+		return "", "", nil, helpers.ErrorJsonDecoding
+	}
+	return jEntry.N, jEntry.P, jEntry.D, 0
+}
+
+// entryKey finds the user name of an entry from it's bytes in either format, even if the rest of the entry is
+// damaged. Returns an empty string when it can't be found.
+func entryKey(b []byte) string {
+	if schema.IsBinary(b) {
+		if header, err := schema.BinaryHeader(b, 2); err == 0 {
+			return header[0]
+		}
+		return ""
+	}
+	return helpers.JsonFirstString(b, "N")
+}
+
+// Convert sets the format entries are written to the AuthTable's data files in, and rewrites every entry in it.
+// Entries that fail to convert are left in their old format, and can still be read. The AuthTable is locked while
+// it's converted.
+func (t *AuthTable) Convert(format uint8) helpers.Error {
+	if format != helpers.FormatJSON && format != helpers.FormatBinary {
+		return helpers.NewError(helpers.ErrorQueryInvalidFormat, t.name)
+	}
+
+	t.eMux.Lock()
+	defer t.eMux.Unlock()
+	conf := t.makeDefaultConfig(t.fileOn)
+	conf.Format = format
+	if err := writeConfigFile(t.configFile, conf); err != 0 {
+		helpers.LogAndPrint("Failed to set format for AuthTable '" + t.name + "' with error code: " + strconv.Itoa(err), 4)
+		return helpers.NewError(err, t.name)
+	}
+	t.format.Store(format)
+	if t.memOnly {
+		return helpers.Error{}
+	}
+
+	for name, e := range t.entries {
+		e.mux.Lock()
+		file := dataFolderPrefix + t.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage
+		data := e.data
+		if t.dataOnDrive {
+			var err int
+			if data, err = t.dataFromDrive(file, e.persistIndex); err != 0 {
+				e.mux.Unlock()
+				return helpers.NewError(err, file)
+			}
+		}
+		var b []byte
+		if err := t.makeEntryBytes(name, e.password.Load().([]byte), data, &b); err != 0 {
+			e.mux.Unlock()
+			return helpers.NewError(err, t.name + " > " + name)
+		}
+		if err := storage.Update(file, e.persistIndex, b); err != 0 {
+			e.mux.Unlock()
+			return helpers.NewError(err, file)
+		}
+		e.mux.Unlock()
+	}
+	return helpers.Error{}
+}
@@ -0,0 +1,103 @@
+package authtable
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/schema"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   AuthTable Item Hooks   //////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// ItemHook is called with a user's name and the new value of an item after a NewUser or UpdateUser sets the item. The
+// value is nil when the user is deleted. Hooks are called after the user is unlocked, so they can query the AuthTable.
+type ItemHook func(name string, value interface{})
+
+type itemHook struct {
+	item   string
+	fields []string
+	hook   ItemHook
+}
+
+// SetItemHook sets a hook for an item in the schema, replacing any hook that was set with the same id. The hook's
+// owner can read the items named in fields from users with GetHookedData, without their passwords.
+func (t *AuthTable) SetItemHook(id string, item string, fields []string, hook ItemHook) int {
+	if !t.schema[item].QuickValidate() {
+		return helpers.ErrorInvalidItem
+	}
+	for _, field := range fields {
+		if !t.schema[field].QuickValidate() {
+			return helpers.ErrorInvalidItem
+		}
+	}
+	t.hMux.Lock()
+	if t.hooks == nil {
+		t.hooks = make(map[string]itemHook)
+	}
+	t.hooks[id] = itemHook{item, append([]string{}, fields...), hook}
+	t.hMux.Unlock()
+	return 0
+}
+
+// GetHookedData gets the items named in the fields of the hook that was set with id from a user, without checking
+// their password. Returns helpers.ErrorNoPrivileges if there is no hook set with id.
+func (t *AuthTable) GetHookedData(id string, userName string) (map[string]interface{}, helpers.Error) {
+	t.hMux.Lock()
+	h, ok := t.hooks[id]
+	t.hMux.Unlock()
+	if !ok {
+		return nil, helpers.NewError(helpers.ErrorNoPrivileges, userName)
+	}
+	t.eMux.Lock()
+	e := t.entries[userName]
+	t.eMux.Unlock()
+	if e == nil {
+		return nil, helpers.NewError(helpers.ErrorNoEntryFound, userName)
+	}
+	items := make(map[string]interface{}, len(h.fields))
+	for _, field := range h.fields {
+		items[field] = nil
+	}
+	return t.getUserItems(e, userName, items)
+}
+
+// RemoveItemHook removes the hook that was set with id
+func (t *AuthTable) RemoveItemHook(id string) {
+	t.hMux.Lock()
+	delete(t.hooks, id)
+	t.hMux.Unlock()
+}
+
+// runItemHooks calls the hooks for the items of a user that were set by an insert (updated is nil) or update, or
+// every hook when the user was deleted (data is nil).
+func (t *AuthTable) runItemHooks(name string, data []interface{}, updated map[string]interface{}) {
+	t.hMux.Lock()
+	if len(t.hooks) == 0 {
+		t.hMux.Unlock()
+		return
+	}
+	hooks := make([]itemHook, 0, len(t.hooks))
+	for _, h := range t.hooks {
+		hooks = append(hooks, h)
+	}
+	t.hMux.Unlock()
+	for _, h := range hooks {
+		if data == nil {
+			h.hook(name, nil)
+			continue
+		} else if updated != nil && !updatesItem(updated, h.item) {
+			continue
+		}
+		h.hook(name, data[t.schema[h.item].DataIndex()])
+	}
+}
+
+// updatesItem checks if an update object sets an item, or anything in it
+func updatesItem(updated map[string]interface{}, item string) bool {
+	for name := range updated {
+		if uName, _ := schema.GetQueryItemMethods(name); uName == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package authtable
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   AuthTable Repair   //////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Repair repairs an AuthTable that isn't restored. A missing or unreadable config file is made again from the copy
+// kept in the AuthTable's data folder, or when there's no copy, from the AuthTable's partitions and the users in them
+// (see inferConfig). Then every partition is repaired with storage.Repair, which rebuilds damaged indexes and moves
+// unreadable lines to the partition's quarantine file. Returns a report for each partition.
+func Repair(name string) ([]storage.RepairReport, helpers.Error) {
+	if Get(name) != nil {
+		return nil, helpers.NewError(helpers.ErrorTableExists, name)
+	}
+	namePre := dataFolderPrefix + name
+	fileNums, ok := partitions(namePre)
+	if !ok {
+		return nil, helpers.NewError(helpers.ErrorFileOpen, "Missing data folder for AuthTable '" + name + "'")
+	}
+
+	// Apply writes left in the write-ahead log
+	if rErr := storage.ReplayWAL(namePre); rErr != 0 {
+		return nil, helpers.NewError(rErr, "Could not replay write-ahead log for AuthTable '" + name + "'")
+	}
+
+	// Get the config, or make it again from the copy in the data folder, or from the AuthTable's entries
+	var conf authtableConfig
+	if cErr := readConfig(namePre + helpers.FileTypeConfig, &conf); cErr != 0 {
+		conf = authtableConfig{}
+		if cErr = readConfig(namePre + configCopyFile, &conf); cErr == 0 {
+			fmt.Printf("Making config file for AuthTable '%v' from it's copy in the data folder\n", name)
+		} else if conf, cErr = inferConfig(namePre, fileNums); cErr == 0 {
+			fmt.Printf("Making config file for AuthTable '%v' from it's entries, with items named by position\n", name)
+		} else {
+			return nil, helpers.NewError(cErr, "Config file for AuthTable '" + name + "' is missing or damaged, and has no copy or readable entries to make it from")
+		}
+		// Entries are inserted to the newest partition
+		if len(fileNums) > 0 && uint16(fileNums[len(fileNums)-1]) > conf.FileOn {
+			conf.FileOn = uint16(fileNums[len(fileNums)-1])
+		}
+	}
+	conf.Name = name
+	s, schemaErr := schema.Restore(conf.Schema)
+	if schemaErr.ID != 0 {
+		schemaErr.From = "(AuthTable '" + name + "') " + schemaErr.From
+		return nil, schemaErr
+	}
+	f, err := os.OpenFile(namePre + helpers.FileTypeConfig, os.O_RDWR | os.O_CREATE, 0755)
+	if err != nil {
+		return nil, helpers.NewError(helpers.ErrorFileOpen, namePre + helpers.FileTypeConfig + ": " + err.Error())
+	}
+	wErr := writeConfigFile(f, conf)
+	f.Close()
+	if wErr != 0 {
+		return nil, helpers.NewError(wErr, namePre + helpers.FileTypeConfig)
+	}
+	t := &AuthTable{name: name, schema: s}
+	reports := make([]storage.RepairReport, 0, len(fileNums))
+	for _, fileNum := range fileNums {
+		report, rErr := storage.Repair(namePre + "/" + strconv.Itoa(fileNum) + helpers.FileTypeStorage, t.scanEntry)
+		if rErr != 0 {
+			return reports, helpers.NewError(rErr, report.File)
+		}
+		reports = append(reports, report)
+	}
+	return reports, helpers.Error{}
+}
+
+// inferConfig makes a config for a AuthTable from the entries in it's partitions (see schema.Infer), for when it's config
+// file and the copy of it are both lost. Other settings are left at their defaults. Entries in the binary format
+// can't be read without their schema, so a config can't be made for AuthTables with binary entries.
+func inferConfig(namePre string, fileNums []int) (authtableConfig, int) {
+	var binary bool
+	scan := func(b []byte) (int, string, int) {
+		if n := schema.BinaryLength(b); n >= 0 {
+			binary = true
+			return n, "", helpers.ErrorBinaryDecoding
+		}
+		n := bytes.IndexByte(b, '\n')
+		if n < 0 {
+			n = len(b)
+		}
+		key, _, _, err := entryFromJson(b[:n])
+		return n, key, err
+	}
+	var data [][]interface{}
+	partitionMax := helpers.DefaultPartitionMax
+	for _, fileNum := range fileNums {
+		records, _, err := storage.Records(namePre + "/" + strconv.Itoa(fileNum) + helpers.FileTypeStorage, scan)
+		if err != 0 {
+			return authtableConfig{}, err
+		} else if binary {
+			return authtableConfig{}, helpers.ErrorBinaryDecoding
+		}
+		for _, rb := range records {
+			_, _, d, _ := entryFromJson(rb)
+			data = append(data, d)
+		}
+		// Partitions can't be given less lines than they already have
+		if n := len(records); n > int(partitionMax) && n <= math.MaxUint16 {
+			partitionMax = uint16(n)
+		}
+	}
+	sc, err := schema.Infer(data)
+	if err != 0 {
+		return authtableConfig{}, err
+	}
+	conf := authtableConfig{
+		PartitionMax: partitionMax,
+		EncryptCost: helpers.DefaultEncryptCost,
+		MaxEntries: helpers.DefaultMaxEntries,
+		MinPass: defaultMinPassword,
+		PassResetLen: defaultPassResetLen,
+		CompactThreshold: helpers.DefaultCompactThreshold,
+		Format: helpers.FormatJSON,
+	}
+	conf.Schema = sc
+	return conf, 0
+}
+
+// scanEntry reads the entry at the start of b for storage.Repair
+func (t *AuthTable) scanEntry(b []byte) (int, string, int) {
+	n := schema.BinaryLength(b)
+	if n < 0 {
+		if n = bytes.IndexByte(b, '\n'); n < 0 {
+			n = len(b)
+		}
+	}
+	name, _, _, err := t.entryFromBytes(b[:n])
+	return n, name, err
+}
+
+// readConfig reads a config file into conf
+func readConfig(file string, conf *authtableConfig) int {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return helpers.ErrorFileOpen
+	}
+	if err = json.Unmarshal(b, conf); err != nil {
+		return helpers.ErrorJsonDecoding
+	}
+	return 0
+}
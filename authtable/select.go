@@ -0,0 +1,134 @@
+package authtable
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"sort"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   AuthTable Select   //////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Example JSON for select query:
+//
+//     ["Select", "tableName", {"where": {"mmr.*gt": [2000]}, "items": {"mmr": []}, "order": ["mmr.*sortDesc"], "limit": 10}]
+//
+
+// Selected is a user found by Select, with the items that were requested
+type Selected struct {
+	Name  string
+	Items map[string]interface{}
+}
+
+// Select gets the users that match where (see schema.Where) with the items requested like GetUser, without
+// checking passwords, so Select queries on AuthTables need the admin role. Users are ordered by the items in order
+// (see schema.Order), then by their names. Users start after the cursor after (returned by the last Select, or "" to
+// start at the first user), then the first offset matches are skipped, and up to limit users are returned (every
+// match when limit is 0). The cursor returned is "" when there are no more users, or else the name of the last user,
+// or it's place in the order (see schema.Order.Cursor) when users are ordered. An ordered page starts at the first
+// match ordered after the cursor, even if the last user was changed or deleted since. Returns
+// helpers.ErrorInvalidItemValue if after isn't a cursor of the order.
+func (t *AuthTable) Select(order []string, where map[string]interface{}, items map[string]interface{}, limit int, offset int, after string) ([]Selected, string, helpers.Error) {
+	if limit < 0 || offset < 0 {
+		return nil, "", helpers.NewError(helpers.ErrorInvalidItemValue, t.name)
+	}
+	o, err := schema.NewOrder(t.schema, order)
+	if err.ID != 0 {
+		return nil, "", err
+	}
+	var afterValues []interface{}
+	var afterName string
+	if len(o) > 0 && after != "" {
+		var ok bool
+		if afterValues, afterName, ok = o.ParseCursor(after); !ok {
+			return nil, "", helpers.NewError(helpers.ErrorInvalidItemValue, after)
+		}
+	}
+	w, err := schema.NewWhere(t.schema, where)
+	if err.ID != 0 {
+		return nil, "", err
+	}
+
+	// Find matches in order of their names
+	t.eMux.Lock()
+	names := make([]string, 0, len(t.entries))
+	for name := range t.entries {
+		names = append(names, name)
+	}
+	t.eMux.Unlock()
+	sort.Strings(names)
+	type match struct {
+		name   string
+		data   []interface{}
+		values []interface{}
+	}
+	matches := []match{}
+	for _, name := range names {
+		if len(o) == 0 && after != "" && name <= after {
+			continue
+		}
+		t.eMux.Lock()
+		e := t.entries[name]
+		t.eMux.Unlock()
+		if e == nil {
+			// Deleted since the select started
+			continue
+		}
+		data, dErr := t.entryData(e)
+		if dErr != 0 {
+			return nil, "", helpers.NewError(dErr, t.name + " > " + name)
+		}
+		ok, mErr := w.Matches(data, t.EncryptCost())
+		if mErr.ID != 0 {
+			return nil, "", mErr
+		} else if ok {
+			matches = append(matches, match{name: name, data: data, values: o.Values(data)})
+		}
+		if len(o) == 0 && limit > 0 && len(matches) == offset + limit {
+			// Unordered selects stop once their page is found
+			break
+		}
+	}
+
+	if len(o) > 0 {
+		// Matches are in order of their names, so a stable sort keeps equal users in it
+		sort.SliceStable(matches, func(i int, j int) bool {
+			return o.Compare(matches[i].values, matches[j].values) < 0
+		})
+		if after != "" {
+			matches = matches[sort.Search(len(matches), func(i int) bool {
+				c := o.Compare(matches[i].values, afterValues)
+				return c > 0 || (c == 0 && matches[i].name > afterName)
+			}):]
+		}
+	}
+	if offset >= len(matches) {
+		return []Selected{}, "", helpers.Error{}
+	}
+
+	selected := []Selected{}
+	var cursor string
+	for _, m := range matches[offset:] {
+		var cp map[string]interface{}
+		if len(items) > 0 {
+			cp = make(map[string]interface{}, len(items))
+			for itemName, methodParams := range items {
+				cp[itemName] = methodParams
+			}
+		}
+		found, gErr := t.getItems(m.data, cp)
+		if gErr.ID != 0 {
+			return nil, "", gErr
+		}
+		selected = append(selected, Selected{Name: m.name, Items: found})
+		if limit > 0 && len(selected) == limit {
+			cursor = m.name
+			if len(o) > 0 {
+				cursor = o.Cursor(m.values, m.name)
+			}
+			break
+		}
+	}
+	return selected, cursor, helpers.Error{}
+}
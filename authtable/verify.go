@@ -0,0 +1,79 @@
+package authtable
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   AuthTable Verification   ////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Verify reads every line of the AuthTable's partitions, and returns the lines that don't match their checksum or
+// don't hold a readable entry, along with the user name of their entry when it can be found. Damaged lines are left in
+// their partition. Entries can't be inserted, and partitions aren't compacted, while the AuthTable is verified.
+func (t *AuthTable) Verify() ([]storage.DamagedLine, helpers.Error) {
+	if t.memOnly {
+		return nil, helpers.Error{}
+	}
+	namePre := dataFolderPrefix + t.name
+	fileNums, ok := partitions(namePre)
+	if !ok {
+		return nil, helpers.NewError(helpers.ErrorFileRead, "Error reading files in data folder for AuthTable '" + t.name + "'")
+	}
+
+	t.eMux.Lock()
+	defer t.eMux.Unlock()
+	// Entries by their position, for lines too damaged to find the user name in
+	names := make(map[[2]uint16]string, len(t.entries))
+	for name, e := range t.entries {
+		names[[2]uint16{e.persistFile, uint16(e.persistIndex)}] = name
+	}
+	var damaged []storage.DamagedLine
+	for _, fileNum := range fileNums {
+		file := namePre + "/" + strconv.Itoa(fileNum) + helpers.FileTypeStorage
+		of, err := storage.GetOpenFile(file)
+		if err != 0 {
+			damaged = append(damaged, storage.DamagedLine{File: file, Error: err})
+			continue
+		}
+		for i := 1; i <= of.Lines(); i++ {
+			b, err := of.Read(uint16(i))
+			if err == 0 && len(b) == 0 {
+				// Deleted line
+				continue
+			} else if err == 0 {
+				_, _, _, err = t.entryFromBytes(b)
+			}
+			if err != 0 {
+				name := names[[2]uint16{uint16(fileNum), uint16(i)}]
+				if name == "" {
+					name = entryKey(b)
+				}
+				damaged = append(damaged, storage.DamagedLine{File: file, Line: uint16(i), Key: name, Error: err})
+			}
+		}
+	}
+	return damaged, helpers.Error{}
+}
+
+// partitions lists the numbers of the partitions in a data folder, in order
+func partitions(namePre string) ([]int, bool) {
+	files, err := ioutil.ReadDir(namePre)
+	if err != nil {
+		return nil, false
+	}
+	var fileNums []int
+	for _, fileStats := range files {
+		fileNameSplit := strings.Split(fileStats.Name(), ".")
+		if fileNum, fnErr := strconv.Atoi(fileNameSplit[0]); fnErr == nil && len(fileNameSplit) == 2 && "."+fileNameSplit[1] == helpers.FileTypeStorage {
+			fileNums = append(fileNums, fileNum)
+		}
+	}
+	sort.Ints(fileNums)
+	return fileNums, true
+}
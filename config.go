@@ -0,0 +1,391 @@
+package main
+
+import (
+	"github.com/hewiefreeman/GopherDB/authtable"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/keystore"
+	"github.com/hewiefreeman/GopherDB/leaderboard"
+	"github.com/hewiefreeman/GopherDB/query"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+var (
+	configMux sync.Mutex
+	config    dbConfig
+)
+
+// dbConfig is the structure of the database's config file
+type dbConfig struct {
+	MasterPass   string   `json:"masterPass"`
+	NoAuth       bool     `json:"noAuth"`
+	Keystores    []string
+	Replica      bool     `json:"replica"`
+	ReadOnly     bool     `json:"readOnly"`
+	Replicas     []string `json:"replicas"`
+	Routers      []string `json:"routers"`
+	AuthTables   []string
+	Leaderboards []string
+	Users        []dbUser `json:"users"`
+	Limits       dbLimits `json:"limits"`
+}
+
+// loadConfig reads the database's config file, or creates one with the default settings if it doesn't exist yet,
+// then applies it's settings.
+func loadConfig() helpers.Error {
+	bytes, err := ioutil.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		bytes = []byte(defaultConfigFile)
+		if wErr := ioutil.WriteFile(configFile, bytes, 0600); wErr != nil {
+			return helpers.NewError(helpers.ErrorFileOpen, "Could not create '"+configFile+"': "+wErr.Error())
+		}
+	} else if err != nil {
+		return helpers.NewError(helpers.ErrorFileRead, "Could not read '"+configFile+"': "+err.Error())
+	}
+	configMux.Lock()
+	defer configMux.Unlock()
+	if mErr := json.Unmarshal(bytes, &config); mErr != nil {
+		return helpers.NewError(helpers.ErrorJsonDecoding, "'"+configFile+"' contains JSON syntax errors: "+mErr.Error())
+	}
+	// Missing lists are written back as empty lists
+	for _, list := range []*[]string{&config.Keystores, &config.Replicas, &config.Routers, &config.AuthTables, &config.Leaderboards} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+	if config.Users == nil {
+		config.Users = []dbUser{}
+	}
+	// Apply settings
+	statusMux.Lock()
+	masterPass = []byte(config.MasterPass)
+	noAuth = config.NoAuth
+	replica = config.Replica
+	readOnly = config.ReadOnly
+	statusMux.Unlock()
+	replicasMux.Lock()
+	replicas = append([]string{}, config.Replicas...)
+	replicasMux.Unlock()
+	balancersMux.Lock()
+	balancers = append([]string{}, config.Routers...)
+	balancersMux.Unlock()
+	return helpers.Error{}
+}
+
+// restoreTables restores every table listed in the config file. Tables that fail to restore are logged, but
+// stay listed so that they are not lost on the next config write.
+func restoreTables() {
+	configMux.Lock()
+	keystores := append([]string{}, config.Keystores...)
+	authTables := append([]string{}, config.AuthTables...)
+	leaderboards := append([]string{}, config.Leaderboards...)
+	configMux.Unlock()
+	for _, name := range keystores {
+		if _, err := keystore.Restore(name); err.ID != 0 {
+			helpers.LogAndPrint("Failed to restore Keystore '"+name+"': "+err.From, 5)
+		}
+	}
+	for _, name := range authTables {
+		if _, err := authtable.Restore(name); err.ID != 0 {
+			helpers.LogAndPrint("Failed to restore AuthTable '"+name+"': "+err.From, 5)
+		}
+	}
+	for _, name := range leaderboards {
+		if _, err := leaderboard.Restore(name); err.ID != 0 {
+			helpers.LogAndPrint("Failed to restore Leaderboard '"+name+"': "+err.From, 5)
+		}
+	}
+}
+
+// closeTables closes every open table listed in the config file, saving their settings.
+func closeTables() {
+	configMux.Lock()
+	defer configMux.Unlock()
+	for _, name := range config.Keystores {
+		if k := keystore.Get(name); k != nil {
+			k.Close(true)
+		}
+	}
+	for _, name := range config.AuthTables {
+		if t := authtable.Get(name); t != nil {
+			t.Close(true)
+		}
+	}
+	for _, name := range config.Leaderboards {
+		if l, _ := leaderboard.Get(name); l != nil {
+			l.Close(true)
+		}
+	}
+}
+
+// convertTable restores a table listed in the config file, rewrites it's entries in the format "json" or "binary",
+// then closes it. The database server must not be running.
+func convertTable(name string, format string) helpers.Error {
+	var f uint8
+	switch format {
+	case "json":
+		f = helpers.FormatJSON
+	case "binary":
+		f = helpers.FormatBinary
+	default:
+		return helpers.NewError(helpers.ErrorQueryInvalidFormat, "Unknown format '"+format+"'")
+	}
+	isKeystore, isAuthTable := tableType(name)
+	if isKeystore {
+		k, err := keystore.Restore(name)
+		if err.ID != 0 {
+			return err
+		}
+		defer k.Close(true)
+		return k.Convert(f)
+	} else if isAuthTable {
+		t, err := authtable.Restore(name)
+		if err.ID != 0 {
+			return err
+		}
+		defer t.Close(true)
+		return t.Convert(f)
+	}
+	return helpers.NewError(helpers.ErrorTableDoesntExist, name)
+}
+
+// verifyTables restores every table listed in the config file, prints each damaged line in their data files, then
+// closes them. Returns false if any table has damage, or could not be verified. The database server must not be
+// running.
+func verifyTables() bool {
+	configMux.Lock()
+	keystores := append([]string{}, config.Keystores...)
+	authTables := append([]string{}, config.AuthTables...)
+	configMux.Unlock()
+	ok := true
+	report := func(table string, damaged []storage.DamagedLine, err helpers.Error) {
+		if err.ID != 0 {
+			fmt.Printf("%v could not be verified: %v\n", table, err)
+			ok = false
+			return
+		}
+		for _, d := range damaged {
+			if d.Line == 0 {
+				fmt.Printf("%v: '%v' is damaged, with error code %v\n", table, d.File, d.Error)
+			} else {
+				fmt.Printf("%v: line %v of '%v' (entry '%v') is damaged, with error code %v\n", table, d.Line, d.File, d.Key, d.Error)
+			}
+		}
+		ok = ok && len(damaged) == 0
+	}
+	for _, name := range keystores {
+		k, err := keystore.Restore(name)
+		if err.ID != 0 {
+			report("Keystore '"+name+"'", nil, err)
+			continue
+		}
+		damaged, vErr := k.Verify()
+		k.Close(false)
+		report("Keystore '"+name+"'", damaged, vErr)
+	}
+	for _, name := range authTables {
+		t, err := authtable.Restore(name)
+		if err.ID != 0 {
+			report("AuthTable '"+name+"'", nil, err)
+			continue
+		}
+		damaged, vErr := t.Verify()
+		t.Close(false)
+		report("AuthTable '"+name+"'", damaged, vErr)
+	}
+	return ok
+}
+
+// repairTable repairs the data files of a table listed in the config file, and makes a new config file for it if it's
+// missing, then prints what was repaired. The database server must not be running.
+func repairTable(name string) helpers.Error {
+	isKeystore, isAuthTable := tableType(name)
+	var reports []storage.RepairReport
+	var err helpers.Error
+	if isKeystore {
+		reports, err = keystore.Repair(name)
+	} else if isAuthTable {
+		reports, err = authtable.Repair(name)
+	} else {
+		return helpers.NewError(helpers.ErrorTableDoesntExist, name)
+	}
+	for _, r := range reports {
+		if !r.Repaired {
+			continue
+		}
+		fmt.Printf("Repaired '%v': %v lines kept, %v moved to quarantine", r.File, r.Lines, r.Quarantined)
+		if r.Scanned {
+			fmt.Printf(" (index rebuilt)")
+		}
+		fmt.Println()
+	}
+	return err
+}
+
+// restoreBackup restores a Keystore or AuthTable from a backup archive, adds it to the config file's table lists, then
+// closes it. The database server must not be running.
+func restoreBackup(archive string) (string, helpers.Error) {
+	var name string
+	k, err := keystore.RestoreBackup(archive)
+	if err.ID == 0 {
+		name = k.Name()
+		k.Close(true)
+	} else if err.ID == helpers.ErrorBackupFormat {
+		var t *authtable.AuthTable
+		if t, err = authtable.RestoreBackup(archive); err.ID != 0 {
+			return "", err
+		}
+		name = t.Name()
+		t.Close(true)
+	} else {
+		return "", err
+	}
+	configMux.Lock()
+	defer configMux.Unlock()
+	list := &config.AuthTables
+	if k != nil {
+		list = &config.Keystores
+	}
+	for _, n := range *list {
+		if n == name {
+			return name, helpers.Error{}
+		}
+	}
+	*list = append(*list, name)
+	return name, writeConfig()
+}
+
+// exportTable restores a table listed in the config file, exports it's entries to a file as JSON Lines or CSV, then
+// closes it. Returns the number of entries exported. The database server must not be running.
+func exportTable(name string, file string, asCSV bool) (int, helpers.Error) {
+	var export func(io.Writer, bool) (int, helpers.Error)
+	isKeystore, isAuthTable := tableType(name)
+	if isKeystore {
+		k, err := keystore.Restore(name)
+		if err.ID != 0 {
+			return 0, err
+		}
+		defer k.Close(false)
+		export = k.Export
+	} else if isAuthTable {
+		t, err := authtable.Restore(name)
+		if err.ID != 0 {
+			return 0, err
+		}
+		defer t.Close(false)
+		export = t.Export
+	} else {
+		return 0, helpers.NewError(helpers.ErrorTableDoesntExist, name)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, helpers.NewError(helpers.ErrorFileOpen, file+": "+err.Error())
+	}
+	defer f.Close()
+	return export(f, asCSV)
+}
+
+// importTable restores a table listed in the config file, imports entries into it from a file made with exportTable,
+// prints each row that could not be imported, then closes it. Returns the number of entries imported. The database
+// server must not be running.
+func importTable(name string, file string, asCSV bool) (int, helpers.Error) {
+	var importRows func(io.Reader, bool) (int, []schema.RowError, helpers.Error)
+	isKeystore, isAuthTable := tableType(name)
+	if isKeystore {
+		k, err := keystore.Restore(name)
+		if err.ID != 0 {
+			return 0, err
+		}
+		defer k.Close(true)
+		importRows = k.Import
+	} else if isAuthTable {
+		t, err := authtable.Restore(name)
+		if err.ID != 0 {
+			return 0, err
+		}
+		defer t.Close(true)
+		importRows = t.Import
+	} else {
+		return 0, helpers.NewError(helpers.ErrorTableDoesntExist, name)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, helpers.NewError(helpers.ErrorFileOpen, file+": "+err.Error())
+	}
+	defer f.Close()
+	imported, rowErrs, iErr := importRows(f, asCSV)
+	for _, r := range rowErrs {
+		fmt.Printf("Row %v of '%v' (entry '%v') was not imported: %v\n", r.Row, file, r.Key, r.Error)
+	}
+	return imported, iErr
+}
+
+// tableType finds if a table listed in the config file is a Keystore or an AuthTable
+func tableType(name string) (bool, bool) {
+	configMux.Lock()
+	defer configMux.Unlock()
+	isKeystore, isAuthTable := false, false
+	for _, n := range config.Keystores {
+		isKeystore = isKeystore || n == name
+	}
+	for _, n := range config.AuthTables {
+		isAuthTable = isAuthTable || n == name
+	}
+	return isKeystore, isAuthTable
+}
+
+// updateTableList adds or removes a table from the config file's table lists after a successful Create or Drop query.
+func updateTableList(q *query.Query) {
+	if q.Type != query.TypeCreate && q.Type != query.TypeDrop {
+		return
+	}
+	configMux.Lock()
+	defer configMux.Unlock()
+	var list *[]string
+	switch q.TableType {
+	case query.TableTypeKeystore:
+		list = &config.Keystores
+	case query.TableTypeAuthTable:
+		list = &config.AuthTables
+	case query.TableTypeLeaderboard:
+		list = &config.Leaderboards
+	default:
+		return
+	}
+	// Remove any existing entry for the table, then add it back if created
+	for i := 0; i < len(*list); i++ {
+		if (*list)[i] == q.Table {
+			*list = append((*list)[:i], (*list)[i+1:]...)
+			i--
+		}
+	}
+	if q.Type == query.TypeCreate {
+		*list = append(*list, q.Table)
+	}
+	if err := writeConfig(); err.ID != 0 {
+		helpers.LogAndPrint("Failed to update '"+configFile+"': "+err.From, 5)
+	}
+}
+
+// writeConfig writes the current config to the config file. configMux must be locked.
+func writeConfig() helpers.Error {
+	jBytes, jErr := json.MarshalIndent(config, "", "   ")
+	if jErr != nil {
+		return helpers.NewError(helpers.ErrorJsonEncoding, jErr.Error())
+	}
+	// Write to a temporary file first, so a crash can't leave a partially written config
+	tmp := configFile + ".tmp"
+	if wErr := ioutil.WriteFile(tmp, jBytes, 0600); wErr != nil {
+		return helpers.NewError(helpers.ErrorFileUpdate, wErr.Error())
+	}
+	if rErr := os.Rename(tmp, configFile); rErr != nil {
+		return helpers.NewError(helpers.ErrorFileUpdate, rErr.Error())
+	}
+	return helpers.Error{}
+}
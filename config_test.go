@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/query"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useConfig(t, dbConfig{})
+
+	// Default config is created when there is none
+	if err := loadConfig(); err.ID != 0 {
+		t.Fatalf("TestConfigRoundTrip expected the default config to load, but got: %v", err)
+	}
+	info, err := os.Stat(configFile)
+	if err != nil {
+		t.Fatalf("TestConfigRoundTrip expected '%v' to be created, but got: %v", configFile, err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("TestConfigRoundTrip expected '%v' to have mode 0600, but got: %v", configFile, info.Mode().Perm())
+	}
+	configMux.Lock()
+	def := config
+	configMux.Unlock()
+	if def.NoAuth || def.ReadOnly || len(def.MasterPass) > 0 || def.Keystores == nil || def.Users == nil {
+		t.Errorf("TestConfigRoundTrip expected the default config, but got: %+v", def)
+	}
+
+	// Write a config, then load it back
+	want := dbConfig{
+		MasterPass:   "secret",
+		NoAuth:       false,
+		ReadOnly:     true,
+		Keystores:    []string{"users", "items"},
+		Replicas:     []string{},
+		Routers:      []string{},
+		AuthTables:   []string{"accounts"},
+		Leaderboards: []string{"scores"},
+		Users:        []dbUser{{Name: "bob", Password: "$2a$04$hash", Roles: map[string]string{allTables: roleRead}}},
+		Limits:       dbLimits{MaxConnections: 10, QueryRate: 2.5, QueryBurst: 5, Tables: map[string]map[string]rateLimit{"accounts": {query.TypeInsert: {Rate: 1, Burst: 2}}}},
+	}
+	configMux.Lock()
+	config = want
+	wErr := writeConfig()
+	config = dbConfig{}
+	configMux.Unlock()
+	if wErr.ID != 0 {
+		t.Fatalf("TestConfigRoundTrip expected the config to be written, but got: %v", wErr)
+	}
+	if info, err = os.Stat(configFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("TestConfigRoundTrip expected the written '%v' to have mode 0600, but got: %v %v", configFile, info, err)
+	}
+	if _, err = os.Stat(configFile + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("TestConfigRoundTrip expected the temporary file to be renamed, but got: %v", err)
+	}
+	if err := loadConfig(); err.ID != 0 {
+		t.Fatalf("TestConfigRoundTrip expected the written config to load, but got: %v", err)
+	}
+	configMux.Lock()
+	got := config
+	configMux.Unlock()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TestConfigRoundTrip expected %+v, but got: %+v", want, got)
+	}
+	statusMux.Lock()
+	mp, ro := string(masterPass), readOnly
+	statusMux.Unlock()
+	if mp != "secret" || !ro {
+		t.Errorf("TestConfigRoundTrip expected the masterPass and readOnly settings to be applied, but got: %v %v", mp, ro)
+	}
+
+	// Syntax errors are reported
+	if err := ioutil.WriteFile(configFile, []byte("{\"masterPass\":"), 0600); err != nil {
+		t.Fatalf("Could not write '%v': %v", configFile, err)
+	}
+	if err := loadConfig(); err.ID != helpers.ErrorJsonDecoding {
+		t.Errorf("TestConfigRoundTrip expected error %v, but got: %v", helpers.ErrorJsonDecoding, err)
+	}
+}
+
+func TestUpdateTableList(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useConfig(t, dbConfig{Keystores: []string{"users"}, AuthTables: []string{}, Leaderboards: []string{}})
+
+	tests := []struct {
+		query        query.Query
+		keystores    []string
+		authTables   []string
+		leaderboards []string
+	}{
+		{query.Query{Type: query.TypeCreate, Table: "items", TableType: query.TableTypeKeystore}, []string{"users", "items"}, []string{}, []string{}},
+		{query.Query{Type: query.TypeCreate, Table: "accounts", TableType: query.TableTypeAuthTable}, []string{"users", "items"}, []string{"accounts"}, []string{}},
+		{query.Query{Type: query.TypeCreate, Table: "scores", TableType: query.TableTypeLeaderboard}, []string{"users", "items"}, []string{"accounts"}, []string{"scores"}},
+		// Created again, the table is only listed once
+		{query.Query{Type: query.TypeCreate, Table: "users", TableType: query.TableTypeKeystore}, []string{"items", "users"}, []string{"accounts"}, []string{"scores"}},
+		// Other queries don't change the lists
+		{query.Query{Type: query.TypeInsert, Table: "bob", TableType: query.TableTypeKeystore}, []string{"items", "users"}, []string{"accounts"}, []string{"scores"}},
+		{query.Query{Type: query.TypeDrop, Table: "items", TableType: query.TableTypeKeystore}, []string{"users"}, []string{"accounts"}, []string{"scores"}},
+		{query.Query{Type: query.TypeDrop, Table: "accounts", TableType: query.TableTypeAuthTable}, []string{"users"}, []string{}, []string{"scores"}},
+		{query.Query{Type: query.TypeDrop, Table: "scores", TableType: query.TableTypeLeaderboard}, []string{"users"}, []string{}, []string{}},
+	}
+	for i, test := range tests {
+		q := test.query
+		updateTableList(&q)
+		configMux.Lock()
+		got := [][]string{config.Keystores, config.AuthTables, config.Leaderboards}
+		configMux.Unlock()
+		want := [][]string{test.keystores, test.authTables, test.leaderboards}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("TestUpdateTableList %v (%v %v) expected %v, but got: %v", i, q.Type, q.Table, want, got)
+		}
+	}
+
+	// Every change is written to the config file
+	b, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		t.Fatalf("TestUpdateTableList expected '%v' to be written, but got: %v", configFile, err)
+	}
+	var written dbConfig
+	if err := json.Unmarshal(b, &written); err != nil {
+		t.Fatalf("TestUpdateTableList expected '%v' to be valid JSON, but got: %v", configFile, err)
+	}
+	if !reflect.DeepEqual(written.Keystores, []string{"users"}) || len(written.AuthTables) != 0 || len(written.Leaderboards) != 0 {
+		t.Errorf("TestUpdateTableList expected the written table lists to match, but got: %+v", written)
+	}
+}
@@ -39,6 +39,13 @@ func StringMatchesEncryption(str string, hash []byte) bool {
 	return err == nil
 }
 
+// IsEncryption returns true if an encrypted `[]byte` was made by the `golang.org/x/crypto/bcrypt` library, so
+// strings can be compared to it.
+func IsEncryption(hash []byte) bool {
+	_, err := bcrypt.Cost(hash)
+	return err == nil
+}
+
 // HashString hashes a string into a number viable for use as a key
 func HashString(s string) int {
 	h := fnv.New32a()
@@ -8,6 +8,13 @@ const (
 	DefaultEncryptCost int     = 4
 	EncryptCostMax int         = 31
 	EncryptCostMin int         = 4
+	DefaultCompactThreshold uint8 = 50
+)
+
+// Table entry formats
+const (
+	FormatJSON   uint8 = 0 // Entries are stored as JSON
+	FormatBinary uint8 = 1 // Entries are stored with the schema's binary encoding
 )
 
 // File types
@@ -15,4 +22,7 @@ const (
 	FileTypeConfig = ".gdbconf"
 	FileTypeLog     = ".gdbl"
 	FileTypeStorage = ".gdbs"
+	FileTypeWAL     = ".gdbw"
+	FileTypeQuarantine = ".gdbq"
+	FileTypeBackup  = ".gdbb"
 )
\ No newline at end of file
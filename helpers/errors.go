@@ -17,6 +17,8 @@ const (
 	ErrorTableFull
 	ErrorQueryInvalidFormat
 	ErrorNoEntryFound
+	ErrorIndexExists
+	ErrorIndexDoesntExist
 )
 
 const (
@@ -52,6 +54,7 @@ const (
 	ErrorInvalidTimeFormat
 	ErrorUniqueValueDuplicate
 	ErrorRestoreItemSchema
+	ErrorSumOverflow
 )
 
 const (
@@ -78,6 +81,15 @@ const (
 	ErrorLeaderboardDoesntExist
 )
 
+const (
+	// Server errors
+	ErrorNotAuthenticated = 6001 + iota
+	ErrorNoPrivileges
+	ErrorRateLimited
+	ErrorTooManyConnections
+	ErrorReadOnly
+)
+
 const (
 	// Storage errors
 	ErrorStorageNotInitialized = 9001 + iota
@@ -94,6 +106,13 @@ const (
 	ErrorJsonDataFormat
 	ErrorJsonIndexingFormat
 	ErrorInternalFormatting
+	ErrorBinaryEncoding
+	ErrorBinaryDecoding
+	ErrorLineChecksum
+	ErrorIndexChecksum
+	ErrorBackupFormat
+	ErrorCSVFormat
+	ErrorFileSnapshot
 )
 
 // NewError creates a new Error message with given ID and From message
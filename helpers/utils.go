@@ -2,9 +2,50 @@ package helpers
 
 import (
 	"github.com/json-iterator/go"
+	"os"
 )
 
 var (
 	// Faster JSON Mashaling
 	Fjson = jsoniter.ConfigCompatibleWithStandardLibrary
-)
\ No newline at end of file
+)
+
+// JsonFirstString returns the value of a JSON object's first item when it's a string named field. The rest of the
+// object isn't read, so the value can still be found when it's damaged.
+func JsonFirstString(b []byte, field string) string {
+	iter := jsoniter.ParseBytes(Fjson, b)
+	if iter.WhatIsNext() != jsoniter.ObjectValue {
+		return ""
+	} else if name := iter.ReadObject(); iter.Error != nil || name != field {
+		return ""
+	} else if iter.WhatIsNext() != jsoniter.StringValue {
+		return ""
+	}
+	if s := iter.ReadString(); iter.Error == nil {
+		return s
+	}
+	return ""
+}
+
+// WriteFileAtomic writes b to a temporary file next to file and syncs it, then renames it over file, so file is never
+// left partly written.
+func WriteFileAtomic(file string, b []byte) error {
+	tmpName := file + ".tmp"
+	tmp, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(b); err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, file)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+	}
+	return err
+}
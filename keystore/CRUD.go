@@ -1,7 +1,6 @@
 package keystore
 
 import (
-	"encoding/json"
 	"github.com/hewiefreeman/GopherDB/helpers"
 	"github.com/hewiefreeman/GopherDB/schema"
 	"github.com/hewiefreeman/GopherDB/storage"
@@ -40,9 +39,14 @@ func makeJsonBytes(key string, data []interface{}, jBytes *[]byte) int {
 
 // Insert creates a new keystoreEntry in the Keystore, as long as one doesnt already exist
 func (k *Keystore) InsertKey(key string, insertObj map[string]interface{}) (*keystoreEntry, helpers.Error) {
+	return k.insertKey(key, insertObj, false)
+}
+
+// insertKey inserts an entry. When restore is true, items are filtered like when they're restored from a data file.
+func (k *Keystore) insertKey(key string, insertObj map[string]interface{}, restore bool) (*keystoreEntry, helpers.Error) {
 	// Key is required
 	if len(key) == 0 {
-		return nil, helpers.+(helpers.ErrorKeyRequired, k.name)
+		return nil, helpers.NewError(helpers.ErrorKeyRequired, k.name)
 	} else if strings.ContainsAny(key, ".*\t\n\r") {
 		return nil, helpers.NewError(helpers.ErrorInvalidKeyCharacters, key)
 	}
@@ -57,7 +61,7 @@ func (k *Keystore) InsertKey(key string, insertObj map[string]interface{}) (*key
 	// Fill entry data with insertObj - Loop through schema to also check for required items
 	for itemName, schemaItem := range k.schema {
 		// Item filter
-		err := schema.ItemFilter(insertObj[itemName], nil, &e.data[schemaItem.DataIndex()], nil, schemaItem, &uniqueVals, k.EncryptCost(), false, false)
+		err := schema.ItemFilter(insertObj[itemName], nil, &e.data[schemaItem.DataIndex()], nil, schemaItem, &uniqueVals, k.EncryptCost(), false, restore)
 		if err != 0 {
 			return nil, helpers.NewError(err, itemName)
 		}
@@ -66,7 +70,7 @@ func (k *Keystore) InsertKey(key string, insertObj map[string]interface{}) (*key
 	// Make JSON []byte for entry
 	var jBytes []byte
 	if !k.memOnly {
-		if jErr := makeJsonBytes(key, e.data, &jBytes); jErr != 0 {
+		if jErr := k.makeEntryBytes(key, e.data, &jBytes); jErr != 0 {
 			return nil, helpers.NewError(jErr, key)
 		}
 	}
@@ -120,27 +124,24 @@ func (k *Keystore) InsertKey(key string, insertObj map[string]interface{}) (*key
 	// Increase fileOn when the index has reached or surpassed partitionMax
 	if e.persistIndex >= k.partitionMax.Load().(uint16) {
 		k.fileOn++
-		writeConfigFile(k.configFile, keystoreConfig{
-			Name:         k.name,
-			Schema:       k.schema.MakeConfig(),
-			FileOn:       k.fileOn,
-			DataOnDrive:  k.dataOnDrive,
-			MemOnly:      k.memOnly,
-			PartitionMax: k.partitionMax.Load().(uint16),
-			EncryptCost:  k.encryptCost.Load().(int),
-			MaxEntries:   k.maxEntries.Load().(uint64),
-		})
+		writeConfigFile(k.configFile, k.makeDefaultConfig(k.fileOn))
 	}
 
 	// Remove data from memory if dataOnDrive is true
+	data := e.data
 	if k.dataOnDrive {
 		e.data = nil
 	}
 
 	// Insert item
 	k.entries[key] = &e
+	if k.keys != nil {
+		k.keys.put(key, nil)
+	}
+	k.indexEntry(key, data)
 	k.eMux.Unlock()
 
+	k.runItemHooks(key, data, nil)
 	return &e, helpers.Error{}
 }
 
@@ -160,17 +161,25 @@ func (k *Keystore) GetKey(key string, items map[string]interface{}) (map[string]
 	var data []interface{}
 
 	// Get entry data
+	e.mux.Lock()
 	if k.dataOnDrive {
 		data, err = k.dataFromDrive(dataFolderPrefix + k.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage, e.persistIndex)
 		if err != 0 {
+			e.mux.Unlock()
 			return nil, helpers.NewError(err, dataFolderPrefix + k.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage)
 		}
 	} else {
-		e.mux.Lock()
 		data = append([]interface{}{}, e.data...)
-		e.mux.Unlock()
 	}
+	e.mux.Unlock()
 
+	return k.getItems(data, items)
+}
+
+// getItems gets the requested items from an entry's data, or every item when none are requested. items is filled
+// with the results.
+func (k *Keystore) getItems(data []interface{}, items map[string]interface{}) (map[string]interface{}, helpers.Error) {
+	var err int
 	// Check for specific items to get
 	if items != nil && len(items) > 0 {
 		// Items were found in query, get requested items
@@ -211,15 +220,11 @@ func (k *Keystore) dataFromDrive(file string, index uint16) ([]interface{}, int)
 	if rErr != 0 {
 		return nil, rErr
 	}
-	var jEntry jsonEntry
-	jErr := json.Unmarshal(bytes, &jEntry)
-	if jErr != nil {
-		return nil, helpers.ErrorJsonDecoding
-	}
-	if jEntry.D == nil || len(jEntry.D) == 0 {
-		return nil, helpers.ErrorJsonDecoding
+	_, data, err := k.entryFromBytes(bytes)
+	if err != 0 {
+		return nil, err
 	}
-	return jEntry.D, 0
+	return data, 0
 }
 
 // Example JSON for update query:
@@ -269,14 +274,14 @@ func (k *Keystore) UpdateKey(key string, updateObj map[string]interface{}) helpe
 	var data []interface{}
 
 	// Get entry data
+	e.mux.Lock()
 	if k.dataOnDrive {
 		data, err = k.dataFromDrive(dataFolderPrefix + k.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage, e.persistIndex)
 		if err != 0 {
+			e.mux.Unlock()
 			return helpers.NewError(err, dataFolderPrefix + k.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage)
 		}
-		e.mux.Lock()
 	} else {
-		e.mux.Lock()
 		data = append([]interface{}{}, e.data...)
 	}
 
@@ -312,7 +317,8 @@ func (k *Keystore) UpdateKey(key string, updateObj map[string]interface{}) helpe
 	// Make JSON []byte for entry
 	var jBytes []byte
 	if !k.memOnly {
-		if jErr := makeJsonBytes(key, data, &jBytes); jErr != 0 {
+		if jErr := k.makeEntryBytes(key, data, &jBytes); jErr != 0 {
+			e.mux.Unlock()
 			return helpers.NewError(jErr, k.name + " > " + key)
 		}
 	}
@@ -356,8 +362,10 @@ func (k *Keystore) UpdateKey(key string, updateObj map[string]interface{}) helpe
 	if !k.dataOnDrive {
 		e.data = data
 	}
+	k.indexEntry(key, data)
 	e.mux.Unlock()
 
+	k.runItemHooks(key, data, updateObj)
 	return helpers.Error{}
 }
 
@@ -386,14 +394,14 @@ func (k *Keystore) DeleteKey(key string) helpers.Error {
 	var data []interface{}
 
 	// Get entry data
+	ue.mux.Lock()
 	if k.dataOnDrive {
 		data, err = k.dataFromDrive(dataFolderPrefix + k.name + "/" + strconv.Itoa(int(ue.persistFile)) + helpers.FileTypeStorage, ue.persistIndex)
 		if err != 0 {
+			ue.mux.Unlock()
 			return helpers.NewError(err, dataFolderPrefix + k.name + "/" + strconv.Itoa(int(ue.persistFile)) + helpers.FileTypeStorage)
 		}
-		ue.mux.Lock()
 	} else {
-		ue.mux.Lock()
 		data = append([]interface{}{}, ue.data...)
 	}
 
@@ -416,27 +424,40 @@ func (k *Keystore) DeleteKey(key string) helpers.Error {
 		if err != 0 {
 			ue.mux.Unlock()
 			k.uMux.Unlock()
-			return helpers.NewError(helpers.ErrorUnexpected, k.name ": Item filter failed while deleting Keystore")
+			return helpers.NewError(helpers.ErrorUnexpected, k.name + ": Item filter failed while deleting Keystore")
 		}
 		delete(k.uniqueVals[itemName], i)
 	}
-	ue.mux.Unlock()
 	k.uMux.Unlock()
 
 	// Update entry on disk with []byte{}
+	persistFile := ue.persistFile
 	if !k.memOnly {
 		err = storage.Update(dataFolderPrefix + k.name + "/" + strconv.Itoa(int(ue.persistFile)) + helpers.FileTypeStorage, ue.persistIndex, []byte{})
 		if err != 0 {
+			ue.mux.Unlock()
 			return helpers.NewError(err, dataFolderPrefix + k.name + "/" + strconv.Itoa(int(ue.persistFile)) + helpers.FileTypeStorage)
 		}
 	}
+	ue.deleted = true
+	k.unindexEntry(key)
+	ue.mux.Unlock()
 
 	k.eMux.Lock()
 	// Delete entry
 	delete(k.entries, key)
+	if k.keys != nil {
+		k.keys.remove(key)
+	}
+	compact := !k.memOnly && k.addDeletedLine(persistFile)
 	k.eMux.Unlock()
 
-	//
+	// Compact the partition once enough of it has been deleted
+	if compact {
+		go k.CompactPartition(persistFile)
+	}
+
+	k.runItemHooks(key, nil, nil)
 	return helpers.Error{}
 }
 
@@ -488,6 +509,10 @@ func (k *Keystore) restoreKey(key string, data []interface{}, fileOn uint32, lin
 	//
 	e.persistIndex = lineOn
 	e.persistFile = fileOn
+	if k.keys != nil {
+		k.keys.put(key, nil)
+	}
+	k.indexEntry(key, e.data)
 
 	// Remove data from memory if dataOnDrive is true
 	if k.dataOnDrive {
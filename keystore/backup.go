@@ -0,0 +1,181 @@
+package keystore
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Keystore Backups   //////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A backup is a gzipped tar archive (see storage.WriteArchive) of a Keystore's config file and partitions, taken at a
+// single point in time. The partitions are backed up from storage snapshots (see storage.TakeSnapshots), so the
+// Keystore is only locked while the config is copied and the snapshots are taken, and keeps serving while the
+// partitions are read and the archive is written. MemOnly Keystores have no partitions, so their entries are written
+// to partitions in the backup instead, with the Keystore locked while they're encoded.
+
+// Backup writes a backup of the Keystore to an archive file.
+func (k *Keystore) Backup(archive string) helpers.Error {
+	namePre := dataFolderPrefix + k.name
+	fileNums, ok := partitions(namePre)
+	if !ok && !k.memOnly {
+		return helpers.NewError(helpers.ErrorFileRead, "Error reading files in data folder for Keystore '" + k.name + "'")
+	}
+
+	k.eMux.Lock()
+	conf, jErr := helpers.Fjson.MarshalIndent(k.makeDefaultConfig(k.fileOn), "", "   ")
+	if jErr != nil {
+		k.eMux.Unlock()
+		return helpers.NewError(helpers.ErrorJsonEncoding, k.name)
+	}
+	var snaps []*storage.FileSnapshot
+	if !k.memOnly {
+		partitionFiles := make([]string, len(fileNums))
+		for i, fileNum := range fileNums {
+			partitionFiles[i] = namePre + "/" + strconv.Itoa(fileNum) + helpers.FileTypeStorage
+		}
+		var err int
+		if snaps, err = storage.TakeSnapshots(partitionFiles); err != 0 {
+			k.eMux.Unlock()
+			return helpers.NewError(err, k.name)
+		}
+	}
+	k.eMux.Unlock()
+
+	files := []storage.ArchiveFile{{Name: namePre + helpers.FileTypeConfig, Bytes: conf}}
+	var partitionFiles []storage.ArchiveFile
+	var err helpers.Error
+	if k.memOnly {
+		partitionFiles, err = k.memPartitions(namePre)
+	} else if sFiles, sErr := storage.ArchiveSnapshots(snaps); sErr != 0 {
+		err = helpers.NewError(sErr, k.name)
+	} else {
+		partitionFiles = sFiles
+	}
+	if err.ID != 0 {
+		return err
+	}
+	files = append(files, partitionFiles...)
+
+	if wErr := storage.WriteArchive(archive, files); wErr != 0 {
+		helpers.LogAndPrint("Failed to write backup '" + archive + "' for Keystore '" + k.name + "' with error code: " + strconv.Itoa(wErr), 4)
+		return helpers.NewError(wErr, archive)
+	}
+	return helpers.Error{}
+}
+
+// memPartitions writes a MemOnly Keystore's entries to partitions for a backup, in key order. The Keystore is locked
+// while they're encoded.
+func (k *Keystore) memPartitions(namePre string) ([]storage.ArchiveFile, helpers.Error) {
+	k.eMux.Lock()
+	defer k.eMux.Unlock()
+	keys := make([]string, 0, len(k.entries))
+	for key := range k.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	partitionMax := int(k.partitionMax.Load().(uint16))
+	var files []storage.ArchiveFile
+	for i := 0; i < len(keys); i += partitionMax {
+		end := i + partitionMax
+		if end > len(keys) {
+			end = len(keys)
+		}
+		lines := make([][]byte, 0, end-i)
+		for _, key := range keys[i:end] {
+			e := k.entries[key]
+			var lb []byte
+			e.mux.Lock()
+			err := k.makeEntryBytes(key, e.data, &lb)
+			e.mux.Unlock()
+			if err != 0 {
+				return nil, helpers.NewError(err, k.name + " > " + key)
+			}
+			lines = append(lines, lb)
+		}
+		b, err := storage.MakeFile(lines)
+		if err != 0 {
+			return nil, helpers.NewError(err, k.name)
+		}
+		files = append(files, storage.ArchiveFile{Name: namePre + "/" + strconv.Itoa(len(files)) + helpers.FileTypeStorage, Bytes: b})
+	}
+	return files, helpers.Error{}
+}
+
+// RestoreBackup restores a Keystore from a backup made with Backup. The Keystore gets the name it had when it was
+// backed up, and must not exist yet.
+func RestoreBackup(archive string) (*Keystore, helpers.Error) {
+	files, err := storage.ReadArchive(archive)
+	if err != 0 {
+		return nil, helpers.NewError(err, archive)
+	}
+	// Find the config file to get the Keystore's name from
+	var name string
+	var conf []byte
+	for _, f := range files {
+		if !strings.Contains(f.Name, "/") && strings.HasPrefix(f.Name, dataFolderPrefix) && strings.HasSuffix(f.Name, helpers.FileTypeConfig) {
+			name = strings.TrimSuffix(strings.TrimPrefix(f.Name, dataFolderPrefix), helpers.FileTypeConfig)
+			conf = f.Bytes
+			break
+		}
+	}
+	if len(name) == 0 {
+		return nil, helpers.NewError(helpers.ErrorBackupFormat, "'" + archive + "' is not a Keystore backup")
+	}
+	namePre := dataFolderPrefix + name
+	if Get(name) != nil {
+		return nil, helpers.NewError(helpers.ErrorTableExists, name)
+	} else if _, sErr := os.Stat(namePre + helpers.FileTypeConfig); sErr == nil {
+		return nil, helpers.NewError(helpers.ErrorTableExists, name)
+	} else if _, sErr = os.Stat(namePre); sErr == nil {
+		return nil, helpers.NewError(helpers.ErrorTableExists, name)
+	}
+	// Only partitions can be written to the data folder
+	for _, f := range files {
+		if f.Name != namePre + helpers.FileTypeConfig && (path.Dir(f.Name) != namePre || !strings.HasSuffix(f.Name, helpers.FileTypeStorage)) {
+			return nil, helpers.NewError(helpers.ErrorBackupFormat, "'" + archive + "' has an unexpected file '" + f.Name + "'")
+		}
+	}
+
+	if mErr := storage.MakeDir(namePre); mErr != nil {
+		return nil, helpers.NewError(helpers.ErrorCreatingFolder, namePre + ": " + mErr.Error())
+	}
+	for _, f := range files {
+		if f.Name == namePre + helpers.FileTypeConfig {
+			continue
+		}
+		if wErr := ioutil.WriteFile(f.Name, f.Bytes, 0755); wErr != nil {
+			os.RemoveAll(namePre)
+			return nil, helpers.NewError(helpers.ErrorFileWrite, f.Name + ": " + wErr.Error())
+		}
+	}
+	// The config file is written last, so the Keystore can't be restored from a partially restored backup
+	if wErr := helpers.WriteFileAtomic(namePre + configCopyFile, conf); wErr != nil {
+		os.RemoveAll(namePre)
+		return nil, helpers.NewError(helpers.ErrorFileWrite, namePre + configCopyFile + ": " + wErr.Error())
+	}
+	if wErr := ioutil.WriteFile(namePre + helpers.FileTypeConfig, conf, 0755); wErr != nil {
+		os.RemoveAll(namePre)
+		return nil, helpers.NewError(helpers.ErrorFileWrite, namePre + helpers.FileTypeConfig + ": " + wErr.Error())
+	}
+	k, rErr := Restore(name)
+	if rErr.ID != 0 || !k.memOnly {
+		return k, rErr
+	}
+	// A MemOnly Keystore's entries are only kept in memory once restored
+	storage.CloseFiles(namePre)
+	for _, f := range files {
+		if f.Name != namePre + helpers.FileTypeConfig {
+			os.Remove(f.Name)
+		}
+	}
+	return k, helpers.Error{}
+}
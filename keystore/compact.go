@@ -0,0 +1,96 @@
+package keystore
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"strconv"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Keystore Compaction   ///////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Deleting a key leaves an empty line in it's partition (data file). Compacting a partition rewrites it without
+// it's empty lines, and renumbers the persistIndex of every entry left in it. A partition is compacted automatically
+// once the percentage of it's lines that are deleted reaches the Keystore's compact threshold.
+
+// addDeletedLine counts a deleted line in a partition, and reports whether the partition has reached the compact
+// threshold. k.eMux must be locked.
+func (k *Keystore) addDeletedLine(fileNum uint32) bool {
+	k.deletedLines[fileNum]++
+	threshold := int(k.compactThreshold.Load().(uint8))
+	return threshold > 0 && int(k.deletedLines[fileNum])*100 >= threshold*int(k.partitionMax.Load().(uint16))
+}
+
+// Compact compacts every partition that has deleted lines.
+func (k *Keystore) Compact() helpers.Error {
+	if k.memOnly {
+		return helpers.Error{}
+	}
+	k.eMux.Lock()
+	files := make([]uint32, 0, len(k.deletedLines))
+	for fileNum, deleted := range k.deletedLines {
+		if deleted > 0 {
+			files = append(files, fileNum)
+		}
+	}
+	k.eMux.Unlock()
+	for _, fileNum := range files {
+		if err := k.CompactPartition(fileNum); err.ID != 0 {
+			return err
+		}
+	}
+	return helpers.Error{}
+}
+
+// CompactPartition rewrites a partition without it's deleted lines. Entries in the partition are locked while it
+// is compacted.
+func (k *Keystore) CompactPartition(fileNum uint32) helpers.Error {
+	if k.memOnly {
+		return helpers.Error{}
+	}
+	file := dataFolderPrefix + k.name + "/" + strconv.Itoa(int(fileNum)) + helpers.FileTypeStorage
+	k.eMux.Lock()
+	if k.deletedLines[fileNum] == 0 {
+		// Already compacted
+		k.eMux.Unlock()
+		return helpers.Error{}
+	}
+	// Lock every entry in the partition so none of them use their old persistIndex
+	var locked []*keystoreEntry
+	for _, e := range k.entries {
+		if e.persistFile == fileNum {
+			e.mux.Lock()
+			locked = append(locked, e)
+		}
+	}
+	newLines, err := storage.Compact(file)
+	if err == 0 {
+		for _, e := range locked {
+			if int(e.persistIndex) <= len(newLines) && newLines[e.persistIndex-1] != 0 {
+				e.persistIndex = newLines[e.persistIndex-1]
+			}
+		}
+		delete(k.deletedLines, fileNum)
+	}
+	for _, e := range locked {
+		e.mux.Unlock()
+	}
+	k.eMux.Unlock()
+	if err != 0 {
+		helpers.LogAndPrint("Failed to compact '" + file + "' for Keystore '" + k.name + "' with error code: " + strconv.Itoa(err), 4)
+		return helpers.NewError(err, file)
+	}
+	return helpers.Error{}
+}
+
+// DeletedLines returns the number of deleted lines in the Keystore's partitions waiting to be compacted
+func (k *Keystore) DeletedLines() int {
+	var n int
+	k.eMux.Lock()
+	for _, deleted := range k.deletedLines {
+		n += int(deleted)
+	}
+	k.eMux.Unlock()
+	return n
+}
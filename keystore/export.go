@@ -0,0 +1,102 @@
+package keystore
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"io"
+	"sort"
+	"strconv"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Keystore Export & Import   //////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Keystore entries are exported with schema.RowWriter, with their key as the "Key" header value:
+//
+//	{"Key":"Mary","Items":{"email":"mary@example.com","friends":[{"name":"Joe","status":1}]}}
+//
+
+// exportHead is the name of the header value Keystore entries are exported with
+var exportHead = []string{"Key"}
+
+// Export writes every entry in the Keystore to w as JSON Lines, or as CSV when asCSV is true and the schema is flat.
+// Entries are written in order of their keys. Returns the number of entries exported.
+func (k *Keystore) Export(w io.Writer, asCSV bool) (int, helpers.Error) {
+	rw, err := schema.NewRowWriter(w, k.schema, exportHead, asCSV)
+	if err.ID != 0 {
+		return 0, err
+	}
+	k.eMux.Lock()
+	keys := make([]string, 0, len(k.entries))
+	for key := range k.entries {
+		keys = append(keys, key)
+	}
+	k.eMux.Unlock()
+	sort.Strings(keys)
+
+	var exported int
+	for _, key := range keys {
+		e, gErr := k.Get(key)
+		if gErr != 0 {
+			// Deleted since the export started
+			continue
+		}
+		var data []interface{}
+		e.mux.Lock()
+		if k.dataOnDrive {
+			data, gErr = k.dataFromDrive(dataFolderPrefix + k.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage, e.persistIndex)
+		} else {
+			data = append([]interface{}{}, e.data...)
+		}
+		e.mux.Unlock()
+		if gErr != 0 {
+			if _, dErr := k.Get(key); dErr != 0 {
+				continue
+			}
+			return exported, helpers.NewError(gErr, k.name + " > " + key)
+		}
+		if wErr := rw.Write([]string{key}, data); wErr != 0 {
+			return exported, helpers.NewError(wErr, k.name + " > " + key)
+		}
+		exported++
+	}
+	if fErr := rw.Flush(); fErr != 0 {
+		return exported, helpers.NewError(fErr, k.name)
+	}
+	return exported, helpers.Error{}
+}
+
+// Import inserts entries from an export made with Export, read from r as JSON Lines, or as CSV when asCSV is true.
+// Every row is checked against the schema like an Insert query, except items are taken as they were exported. Rows
+// that can't be read or inserted are skipped and returned with their errors. Returns the number of entries imported.
+func (k *Keystore) Import(r io.Reader, asCSV bool) (int, []schema.RowError, helpers.Error) {
+	rr, err := schema.NewRowReader(r, k.schema, exportHead, asCSV)
+	if err.ID != 0 {
+		return 0, nil, err
+	}
+	var imported int
+	var rowErrs []schema.RowError
+	for {
+		head, items, rErr, ok := rr.Read()
+		if !ok {
+			break
+		}
+		var key string
+		if len(head) > 0 {
+			key = head[0]
+		}
+		if rErr == helpers.ErrorFileRead {
+			return imported, rowErrs, helpers.NewError(rErr, k.name)
+		} else if rErr != 0 {
+			rowErrs = append(rowErrs, schema.RowError{Row: rr.Row(), Key: key, Error: helpers.NewError(rErr, k.name)})
+			continue
+		}
+		if _, iErr := k.insertKey(key, items, true); iErr.ID != 0 {
+			rowErrs = append(rowErrs, schema.RowError{Row: rr.Row(), Key: key, Error: iErr})
+			continue
+		}
+		imported++
+	}
+	return imported, rowErrs, helpers.Error{}
+}
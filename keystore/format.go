@@ -0,0 +1,109 @@
+package keystore
+
+import (
+	"encoding/json"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"strconv"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Keystore Entry Formats   ////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Entries are written to the data files as JSON (helpers.FormatJSON), or with the schema's binary encoding
+// (helpers.FormatBinary), which is smaller and keeps each item's exact type. Entries are read in either format, so a
+// data file can hold both while a Keystore is being converted.
+
+// makeEntryBytes makes the bytes for an entry in the Keystore's format
+func (k *Keystore) makeEntryBytes(key string, data []interface{}, b *[]byte) int {
+	if k.format.Load().(uint8) == helpers.FormatBinary {
+		var err int
+		*b, err = schema.EncodeBinary(k.schema, []string{key}, data)
+		return err
+	}
+	return makeJsonBytes(key, data, b)
+}
+
+// entryFromBytes gets the key and data from an entry's bytes in either format
+func (k *Keystore) entryFromBytes(b []byte) (string, []interface{}, int) {
+	if schema.IsBinary(b) {
+		header, data, err := schema.DecodeBinary(k.schema, b, 1)
+		if err != 0 {
+			return "", nil, err
+		}
+		return header[0], data, 0
+	}
+	return entryFromJson(b)
+}
+
+// entryFromJson gets the key and data from a JSON entry's bytes
+func entryFromJson(b []byte) (string, []interface{}, int) {
+	var jEntry jsonEntry
+	if jErr := json.Unmarshal(b, &jEntry); jErr != nil {
+		return "", nil, helpers.ErrorJsonDecoding
+	}
+	if jEntry.D == nil || len(jEntry.D) == 0 {
+		return "", nil, helpers.ErrorJsonDecoding
+	}
+	return jEntry.K, jEntry.D, 0
+}
+
+// entryKey finds the key of an entry from it's bytes in either format, even if the rest of the entry is damaged.
+// Returns an empty string when it can't be found.
+func entryKey(b []byte) string {
+	if schema.IsBinary(b) {
+		if header, err := schema.BinaryHeader(b, 1); err == 0 {
+			return header[0]
+		}
+		return ""
+	}
+	return helpers.JsonFirstString(b, "K")
+}
+
+// Convert sets the format entries are written to the Keystore's data files in, and rewrites every entry in it.
+// Entries that fail to convert are left in their old format, and can still be read. The Keystore is locked while
+// it's converted.
+func (k *Keystore) Convert(format uint8) helpers.Error {
+	if format != helpers.FormatJSON && format != helpers.FormatBinary {
+		return helpers.NewError(helpers.ErrorQueryInvalidFormat, k.name)
+	}
+
+	k.eMux.Lock()
+	defer k.eMux.Unlock()
+	conf := k.makeDefaultConfig(k.fileOn)
+	conf.Format = format
+	if err := writeConfigFile(k.configFile, conf); err != 0 {
+		helpers.LogAndPrint("Failed to set format for Keystore '" + k.name + "' with error code: " + strconv.Itoa(err), 4)
+		return helpers.NewError(err, k.name)
+	}
+	k.format.Store(format)
+	if k.memOnly {
+		return helpers.Error{}
+	}
+
+	for key, e := range k.entries {
+		e.mux.Lock()
+		file := dataFolderPrefix + k.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage
+		data := e.data
+		if k.dataOnDrive {
+			var err int
+			if data, err = k.dataFromDrive(file, e.persistIndex); err != 0 {
+				e.mux.Unlock()
+				return helpers.NewError(err, file)
+			}
+		}
+		var b []byte
+		if err := k.makeEntryBytes(key, data, &b); err != 0 {
+			e.mux.Unlock()
+			return helpers.NewError(err, k.name + " > " + key)
+		}
+		if err := storage.Update(file, e.persistIndex, b); err != 0 {
+			e.mux.Unlock()
+			return helpers.NewError(err, file)
+		}
+		e.mux.Unlock()
+	}
+	return helpers.Error{}
+}
@@ -0,0 +1,74 @@
+package keystore
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/schema"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Keystore Item Hooks   ///////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// ItemHook is called with an entry's key and the new value of an item after an insert or update sets the item. The
+// value is nil when the entry is deleted. Hooks are called after the entry is unlocked, so they can query the Keystore.
+type ItemHook func(key string, value interface{})
+
+type itemHook struct {
+	item string
+	hook ItemHook
+}
+
+// SetItemHook sets a hook for an item in the schema, replacing any hook that was set with the same id.
+func (k *Keystore) SetItemHook(id string, item string, hook ItemHook) int {
+	if !k.schema[item].QuickValidate() {
+		return helpers.ErrorInvalidItem
+	}
+	k.hMux.Lock()
+	if k.hooks == nil {
+		k.hooks = make(map[string]itemHook)
+	}
+	k.hooks[id] = itemHook{item, hook}
+	k.hMux.Unlock()
+	return 0
+}
+
+// RemoveItemHook removes the hook that was set with id
+func (k *Keystore) RemoveItemHook(id string) {
+	k.hMux.Lock()
+	delete(k.hooks, id)
+	k.hMux.Unlock()
+}
+
+// runItemHooks calls the hooks for the items of an entry that were set by an insert (updated is nil) or update, or
+// every hook when the entry was deleted (data is nil).
+func (k *Keystore) runItemHooks(key string, data []interface{}, updated map[string]interface{}) {
+	k.hMux.Lock()
+	if len(k.hooks) == 0 {
+		k.hMux.Unlock()
+		return
+	}
+	hooks := make([]itemHook, 0, len(k.hooks))
+	for _, h := range k.hooks {
+		hooks = append(hooks, h)
+	}
+	k.hMux.Unlock()
+	for _, h := range hooks {
+		if data == nil {
+			h.hook(key, nil)
+			continue
+		} else if updated != nil && !updatesItem(updated, h.item) {
+			continue
+		}
+		h.hook(key, data[k.schema[h.item].DataIndex()])
+	}
+}
+
+// updatesItem checks if an update object sets an item, or anything in it
+func updatesItem(updated map[string]interface{}, item string) bool {
+	for name := range updated {
+		if uName, _ := schema.GetQueryItemMethods(name); uName == item {
+			return true
+		}
+	}
+	return false
+}
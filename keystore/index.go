@@ -0,0 +1,303 @@
+package keystore
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Keystore Indexes   //////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A Keystore can index items of it's schema (see schema.IndexPath), so Selects with *eq, *gt, *gte, *lt, or *lte
+// conditions on them only read the entries in range, instead of every entry. An index keeps every key ordered by the
+// item's value in a skip list. The Keystore's key index (see SetKeyIndex) is an index with no path, so it's keys are
+// only ordered by themselves. The names of a Keystore's indexes are saved in it's config file, and indexes are built
+// again from the data files when the Keystore is restored.
+
+const (
+	indexMaxLevel = 32 // enough levels for 4^32 entries
+	indexP        = 4  // 1 in indexP nodes are promoted to the next level
+)
+
+type index struct {
+	path   schema.IndexPath
+	ready  bool // false while the index is being built
+	head   *indexNode
+	tail   *indexNode // last node, or nil when the index is empty
+	level  int
+	values map[string]interface{} // indexed value of each key
+}
+
+type indexNode struct {
+	key   string
+	value interface{}
+	prev  *indexNode // previous node on the bottom level
+	next  []*indexNode
+}
+
+func newIndex(path schema.IndexPath) *index {
+	return &index{path: path, head: &indexNode{next: make([]*indexNode, indexMaxLevel)}, level: 1, values: make(map[string]interface{})}
+}
+
+// before returns true if n is ordered before a node with value and key
+func (n *indexNode) before(value interface{}, key string) bool {
+	if c := schema.CompareIndexValues(n.value, value); c != 0 {
+		return c < 0
+	}
+	return n.key < key
+}
+
+// put indexes key with value, replacing it's last value
+func (x *index) put(key string, value interface{}) {
+	if v, ok := x.values[key]; ok {
+		if schema.CompareIndexValues(v, value) == 0 {
+			return
+		}
+		x.remove(key)
+	}
+	var update [indexMaxLevel]*indexNode
+	n := x.head
+	for i := x.level - 1; i >= 0; i-- {
+		for n.next[i] != nil && n.next[i].before(value, key) {
+			n = n.next[i]
+		}
+		update[i] = n
+	}
+	level := 1
+	for level < indexMaxLevel && rand.Intn(indexP) == 0 {
+		level++
+	}
+	for i := x.level; i < level; i++ {
+		update[i] = x.head
+	}
+	if level > x.level {
+		x.level = level
+	}
+	node := &indexNode{key: key, value: value, prev: update[0], next: make([]*indexNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	if node.next[0] != nil {
+		node.next[0].prev = node
+	} else {
+		x.tail = node
+	}
+	x.values[key] = value
+}
+
+// remove takes key out of the index
+func (x *index) remove(key string) {
+	value, ok := x.values[key]
+	if !ok {
+		return
+	}
+	n := x.head
+	var found *indexNode
+	for i := x.level - 1; i >= 0; i-- {
+		for n.next[i] != nil && n.next[i].before(value, key) {
+			n = n.next[i]
+		}
+		if n.next[i] != nil && n.next[i].key == key {
+			found = n.next[i]
+			n.next[i] = found.next[i]
+		}
+	}
+	if found.next[0] != nil {
+		found.next[0].prev = found.prev
+	} else if found.prev == x.head {
+		x.tail = nil
+	} else {
+		x.tail = found.prev
+	}
+	for x.level > 1 && x.head.next[x.level-1] == nil {
+		x.level--
+	}
+	delete(x.values, key)
+}
+
+// below gets the last node ordered before a node with value and key, or the head
+func (x *index) below(value interface{}, key string) *indexNode {
+	n := x.head
+	for i := x.level - 1; i >= 0; i-- {
+		for n.next[i] != nil && n.next[i].before(value, key) {
+			n = n.next[i]
+		}
+	}
+	return n
+}
+
+// keys gets the keys with values from lo to hi. lo and hi are inclusive, and nil for no bound.
+func (x *index) keys(lo interface{}, hi interface{}) []string {
+	n := x.head
+	if lo != nil {
+		for i := x.level - 1; i >= 0; i-- {
+			for n.next[i] != nil && schema.CompareIndexValues(n.next[i].value, lo) < 0 {
+				n = n.next[i]
+			}
+		}
+	}
+	keys := []string{}
+	for n = n.next[0]; n != nil; n = n.next[0] {
+		if hi != nil && schema.CompareIndexValues(n.value, hi) > 0 {
+			break
+		}
+		keys = append(keys, n.key)
+	}
+	return keys
+}
+
+// CreateIndex indexes an item of the schema, like "mmr" or "profile.country". The index is built from a copy of the
+// Keystore's entries, so the Keystore keeps serving while it's built. Inserts, updates, and deletes made during the
+// build index their entries themselves, and Selects don't use the index until it's built.
+func (k *Keystore) CreateIndex(item string) helpers.Error {
+	path, ok := schema.NewIndexPath(k.schema, item)
+	if !ok {
+		return helpers.NewError(helpers.ErrorInvalidItem, item)
+	}
+	k.iMux.Lock()
+	if k.indexes[item] != nil {
+		k.iMux.Unlock()
+		return helpers.NewError(helpers.ErrorIndexExists, item)
+	}
+	x := newIndex(path)
+	k.indexes[item] = x
+	k.iMux.Unlock()
+
+	// Copy the entries after adding the index, so entries inserted after the copy are indexed by their inserts
+	k.eMux.Lock()
+	entries := make(map[string]*keystoreEntry, len(k.entries))
+	for key, e := range k.entries {
+		entries[key] = e
+	}
+	k.eMux.Unlock()
+
+	// Updates and deletes index their entries while the index is built, so entries are read with their lock held
+	for key, e := range entries {
+		e.mux.Lock()
+		if e.deleted {
+			e.mux.Unlock()
+			continue
+		}
+		data := e.data
+		if k.dataOnDrive {
+			var err int
+			if data, err = k.dataFromDrive(dataFolderPrefix + k.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage, e.persistIndex); err != 0 {
+				e.mux.Unlock()
+				k.iMux.Lock()
+				if k.indexes[item] == x {
+					delete(k.indexes, item)
+				}
+				k.iMux.Unlock()
+				return helpers.NewError(err, k.name + " > " + key)
+			}
+		}
+		if v, ok := path.Value(data); ok {
+			k.iMux.Lock()
+			x.put(key, v)
+			k.iMux.Unlock()
+		}
+		e.mux.Unlock()
+	}
+	k.iMux.Lock()
+	x.ready = true
+	k.iMux.Unlock()
+
+	k.eMux.Lock()
+	defer k.eMux.Unlock()
+	if err := writeConfigFile(k.configFile, k.makeDefaultConfig(k.fileOn)); err != 0 {
+		return helpers.NewError(err, k.name)
+	}
+	return helpers.Error{}
+}
+
+// DropIndex removes the index of an item
+func (k *Keystore) DropIndex(item string) helpers.Error {
+	k.eMux.Lock()
+	defer k.eMux.Unlock()
+	k.iMux.Lock()
+	if k.indexes[item] == nil {
+		k.iMux.Unlock()
+		return helpers.NewError(helpers.ErrorIndexDoesntExist, item)
+	}
+	delete(k.indexes, item)
+	k.iMux.Unlock()
+	if err := writeConfigFile(k.configFile, k.makeDefaultConfig(k.fileOn)); err != 0 {
+		return helpers.NewError(err, k.name)
+	}
+	return helpers.Error{}
+}
+
+// Indexes gets the names of the Keystore's indexed items
+func (k *Keystore) Indexes() []string {
+	k.iMux.Lock()
+	defer k.iMux.Unlock()
+	names := make([]string, 0, len(k.indexes))
+	for name := range k.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// indexEntry indexes an inserted or updated entry's data
+func (k *Keystore) indexEntry(key string, data []interface{}) {
+	k.iMux.Lock()
+	for _, x := range k.indexes {
+		if v, ok := x.path.Value(data); ok {
+			x.put(key, v)
+		} else {
+			x.remove(key)
+		}
+	}
+	k.iMux.Unlock()
+}
+
+// unindexEntry removes a deleted entry from the indexes
+func (k *Keystore) unindexEntry(key string) {
+	k.iMux.Lock()
+	for _, x := range k.indexes {
+		x.remove(key)
+	}
+	k.iMux.Unlock()
+}
+
+// indexedKeys gets the keys that are in range of w's conditions on an indexed item. Equality conditions are used
+// before ranges. Returns false if w has no conditions on an indexed item.
+func (k *Keystore) indexedKeys(w schema.Where) ([]string, bool) {
+	k.iMux.Lock()
+	var best *index
+	var bestLo, bestHi interface{}
+	var bestScore int
+	for _, x := range k.indexes {
+		if !x.ready {
+			continue
+		}
+		lo, hi, ok := w.IndexBounds(x.path)
+		if !ok {
+			continue
+		}
+		var score int
+		if lo != nil && hi != nil && schema.CompareIndexValues(lo, hi) == 0 {
+			score = 3
+		} else if lo != nil && hi != nil {
+			score = 2
+		} else {
+			score = 1
+		}
+		if score > bestScore || (score == bestScore && x.path.Name() < best.path.Name()) {
+			best, bestLo, bestHi, bestScore = x, lo, hi, score
+		}
+	}
+	if best == nil {
+		k.iMux.Unlock()
+		return nil, false
+	}
+	keys := best.keys(bestLo, bestHi)
+	k.iMux.Unlock()
+	return keys, true
+}
@@ -0,0 +1,162 @@
+package keystore
+
+import (
+	"github.com/hewiefreeman/GopherDB/schema"
+	"sort"
+	"strings"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Keystore Key Ranges   ///////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Selects can be limited to a range of keys, or keys that start with a prefix, and go through them in reverse. Without
+// the Keystore's key index, every key is sorted to find the range. With it (see SetKeyIndex), keys are kept in order
+// in an index, so a range is found in O(log n) and only it's keys are read.
+
+// KeyRange limits a Select to keys from From to To (both inclusive, and empty for no bound) that start with Prefix.
+// Keys are selected in reverse order when Reverse is true.
+type KeyRange struct {
+	Prefix  string
+	From    string
+	To      string
+	Reverse bool
+}
+
+// contains checks if key is in the range
+func (r KeyRange) contains(key string) bool {
+	return strings.HasPrefix(key, r.Prefix) && (r.From == "" || key >= r.From) && (r.To == "" || key <= r.To)
+}
+
+// follows checks if key comes after the key after in the range's order
+func (r KeyRange) follows(key string, after string) bool {
+	if after == "" {
+		return true
+	} else if r.Reverse {
+		return key < after
+	}
+	return key > after
+}
+
+// keys gets the keys that are in the range and follow after, in the range's order
+func (r KeyRange) keys(keys []string, after string) []string {
+	inRange := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if r.contains(key) && r.follows(key, after) {
+			inRange = append(inRange, key)
+		}
+	}
+	if r.Reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(inRange)))
+	} else {
+		sort.Strings(inRange)
+	}
+	return inRange
+}
+
+// newKeyIndex makes an index that orders keys by themselves, for the Keystore's key index
+func newKeyIndex() *index {
+	return newIndex(schema.IndexPath{})
+}
+
+// lower gets the node of a and b with the lowest key in a key index
+func (x *index) lower(a *indexNode, b *indexNode) *indexNode {
+	if a == x.head || (b != x.head && a.key <= b.key) {
+		return a
+	}
+	return b
+}
+
+// prefixEnd gets the lowest key that's above every key starting with prefix, or "" if there isn't one
+func prefixEnd(prefix string) string {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] < 0xff {
+			return prefix[:i] + string([]byte{prefix[i] + 1})
+		}
+	}
+	return ""
+}
+
+// page gets up to limit keys in r that follow after from a key index, in r's order
+func (x *index) page(r KeyRange, after string, limit int) []string {
+	keys := make([]string, 0, limit)
+	var n *indexNode
+	if r.Reverse {
+		// Start at the last key that could be in the range
+		if n = x.tail; n == nil {
+			return keys
+		}
+		if after != "" {
+			n = x.lower(n, x.below(nil, after))
+		}
+		if r.To != "" {
+			to := x.below(nil, r.To)
+			if to.next[0] != nil && to.next[0].key == r.To {
+				to = to.next[0]
+			}
+			n = x.lower(n, to)
+		}
+		if end := prefixEnd(r.Prefix); end != "" {
+			n = x.lower(n, x.below(nil, end))
+		}
+		for ; n != x.head && len(keys) < limit; n = n.prev {
+			if n.key < r.From || n.key < r.Prefix {
+				break
+			}
+			keys = append(keys, n.key)
+		}
+		return keys
+	}
+	// Start at the first key that could be in the range
+	start := r.Prefix
+	if r.From > start {
+		start = r.From
+	}
+	n = x.below(nil, start).next[0]
+	if after != "" && after >= start {
+		if n = x.below(nil, after).next[0]; n != nil && n.key == after {
+			n = n.next[0]
+		}
+	}
+	for ; n != nil && len(keys) < limit; n = n.next[0] {
+		if (r.To != "" && n.key > r.To) || !strings.HasPrefix(n.key, r.Prefix) {
+			break
+		}
+		keys = append(keys, n.key)
+	}
+	return keys
+}
+
+// SetKeyIndex turns the Keystore's key index on or off. The key index keeps keys in order, so Selects with a
+// KeyRange only read the keys in range, instead of sorting every key.
+func (k *Keystore) SetKeyIndex(on bool) int {
+	k.eMux.Lock()
+	defer k.eMux.Unlock()
+	if on == (k.keys != nil) {
+		return 0
+	}
+	k.keys = nil
+	if on {
+		k.keys = newKeyIndex()
+		for key := range k.entries {
+			k.keys.put(key, nil)
+		}
+	}
+	k.keyIndex.Store(on)
+	return writeConfigFile(k.configFile, k.makeDefaultConfig(k.fileOn))
+}
+
+// KeyIndex returns true if the Keystore's key index is on
+func (k *Keystore) KeyIndex() bool {
+	return k.keyIndex.Load().(bool)
+}
+
+// keyPage gets up to limit keys in r that follow after from the key index. Returns false if the key index is off.
+func (k *Keystore) keyPage(r KeyRange, after string, limit int) ([]string, bool) {
+	k.eMux.Lock()
+	defer k.eMux.Unlock()
+	if k.keys == nil {
+		return nil, false
+	}
+	return k.keys.page(r, after, limit), true
+}
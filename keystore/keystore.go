@@ -34,6 +34,7 @@ import (
 // File/folder prefixes
 const (
 	dataFolderPrefix = "Keystore-"
+	configCopyFile   = "/config" + helpers.FileTypeConfig // Copy of a table's config file in it's data folder
 )
 
 var (
@@ -61,10 +62,15 @@ type Keystore struct {
 	partitionMax atomic.Value // *uint16* maximum entries per data file
 	maxEntries   atomic.Value // *uint64* maximum amount of entries in the AuthTable
 	encryptCost  atomic.Value // *int* encryption cost of encrypted items
+	durability   atomic.Value // *int* storage durability mode for the Keystore's data files
+	compactThreshold atomic.Value // *uint8* percent of a partition's lines that are deleted before it is compacted (0 disables)
+	format       atomic.Value // *uint8* format entries are written to the data files in
+	keyIndex     atomic.Value // *bool* keeps keys ordered for Selects with a KeyRange (see SetKeyIndex)
 
 	// entries
 	eMux    sync.Mutex                // entries/configFile lock
 	entries map[string]*keystoreEntry // Keystore map
+	deletedLines map[uint32]uint16    // number of deleted lines in each partition, by file number
 	// entries as map = 8 + (len(entries) * 8)
 	// entries total  = (entries as map) + (len(entries) * keystoreEntry)
 	// keystoreEntry  = 38 + (len(data) * (data.size))
@@ -75,6 +81,17 @@ type Keystore struct {
 	// unique values
 	uMux       sync.Mutex
 	uniqueVals map[string]map[interface{}]bool
+
+	// item hooks
+	hMux  sync.Mutex
+	hooks map[string]itemHook
+
+	// secondary indexes, by item name
+	iMux    sync.Mutex
+	indexes map[string]*index
+
+	// ordered key index, locked by eMux (nil when off)
+	keys *index
 }
 
 type keystoreEntry struct {
@@ -82,8 +99,9 @@ type keystoreEntry struct {
 	persistFile  uint32
 	persistIndex uint16
 
-	mux  sync.Mutex
-	data []interface{}
+	mux     sync.Mutex
+	data    []interface{}
+	deleted bool // set when the entry is deleted, for readers that got it before it was removed
 }
 
 type keystoreConfig struct {
@@ -97,6 +115,11 @@ type keystoreConfig struct {
 	PartitionMax uint16
 	EncryptCost  int
 	MaxEntries   uint64
+	Durability   int
+	CompactThreshold uint8
+	Format       uint8
+	Indexes      []string
+	KeyIndex     bool
 }
 
 //////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -142,13 +165,15 @@ func New(name string, configFile *os.File, s schema.Schema, fileOn uint32, dataO
 			Name:         name,
 			Schema:       s.MakeConfig(),
 			SchemaID:     0,
-			ShemaH:       make([][]schema.SchemaConfigItem, 0),
+			SchemaH:      make([][]schema.SchemaConfigItem, 0),
 			FileOn:       fileOn,
 			DataOnDrive:  dataOnDrive,
 			MemOnly:      memOnly,
 			PartitionMax: helpers.DefaultPartitionMax,
 			EncryptCost:  helpers.DefaultEncryptCost,
 			MaxEntries:   helpers.DefaultMaxEntries,
+			CompactThreshold: helpers.DefaultCompactThreshold,
+			Format:       helpers.FormatJSON,
 		}); wErr != 0 {
 			return nil, helpers.NewError(wErr, namePre + helpers.FileTypeConfig)
 		}
@@ -164,7 +189,9 @@ func New(name string, configFile *os.File, s schema.Schema, fileOn uint32, dataO
 		schemaH:     make([]schema.Schema, 0),
 		configFile:  configFile,
 		entries:     make(map[string]*keystoreEntry),
+		deletedLines: make(map[uint32]uint16),
 		uniqueVals:  make(map[string]map[interface{}]bool),
+		indexes:     make(map[string]*index),
 		fileOn:      fileOn,
 	}
 
@@ -172,6 +199,10 @@ func New(name string, configFile *os.File, s schema.Schema, fileOn uint32, dataO
 	t.partitionMax.Store(helpers.DefaultPartitionMax)
 	t.maxEntries.Store(helpers.DefaultMaxEntries)
 	t.encryptCost.Store(helpers.DefaultEncryptCost)
+	t.durability.Store(storage.DurabilityDefault)
+	t.compactThreshold.Store(helpers.DefaultCompactThreshold)
+	t.format.Store(helpers.FormatJSON)
+	t.keyIndex.Store(false)
 
 	// Push to stores map
 	storesMux.Lock()
@@ -210,6 +241,9 @@ func (k *Keystore) Close(save bool) {
 	stores[k.name] = nil
 	delete(stores, k.name)
 	storesMux.Unlock()
+	storage.CloseFiles(dataFolderPrefix + k.name)
+	storage.CloseWAL(dataFolderPrefix + k.name)
+	storage.SetFolderDurability(dataFolderPrefix + k.name, storage.DurabilityDefault)
 }
 
 // Delete a Keystore with the given name.
@@ -250,6 +284,16 @@ func (k *Keystore) Get(key string) (*keystoreEntry, int) {
 	return e, 0
 }
 
+// Name returns the Keystore's name
+func (k *Keystore) Name() string {
+	return k.name
+}
+
+// Schema returns the Keystore's schema
+func (k *Keystore) Schema() schema.Schema {
+	return k.schema
+}
+
 // Size returns the number of entries in the Keystore
 func (k *Keystore) Size() int {
 	k.eMux.Lock()
@@ -272,6 +316,21 @@ func (k *Keystore) EncryptCost() int {
 	return k.encryptCost.Load().(int)
 }
 
+// CompactThreshold returns the percent of a partition's lines that must be deleted before it is compacted
+func (k *Keystore) CompactThreshold() uint8 {
+	return k.compactThreshold.Load().(uint8)
+}
+
+// Durability returns the storage durability mode saved for this Keystore
+func (k *Keystore) Durability() int {
+	return k.durability.Load().(int)
+}
+
+// Format returns the format new entries are written to the Keystore's data files in
+func (k *Keystore) Format() uint8 {
+	return k.format.Load().(uint8)
+}
+
 //////////////////////////////////////////////////////////////////////////////////////////////////////
 //   Keystore Setters   //////////////////////////////////////////////////////////////////////////////
 //////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -333,6 +392,49 @@ func (k *Keystore) SetPartitionMax(max uint16) int {
 	return 0
 }
 
+// SetDurability sets the storage durability mode for the Keystore's data files. Use storage.DurabilityDefault
+// for the storage engine's durability mode. Returns helpers.ErrorInvalidItemValue for an unknown mode.
+func (k *Keystore) SetDurability(mode int) int {
+	if mode < storage.DurabilityDefault || mode > storage.DurabilityBuffered {
+		return helpers.ErrorInvalidItemValue
+	}
+
+	// Write to configFile
+	k.eMux.Lock()
+	fileOn := k.fileOn
+	k.eMux.Unlock()
+	conf := k.makeDefaultConfig(fileOn)
+	conf.Durability = mode
+	if err := writeConfigFile(k.configFile, conf); err != 0 {
+		helpers.LogAndPrint("Failed to set durability for Keystore '" + k.name + "' with error code: " + strconv.Itoa(err), 4)
+		return err
+	}
+	k.durability.Store(mode)
+	storage.SetFolderDurability(dataFolderPrefix + k.name, mode)
+	return 0
+}
+
+// SetCompactThreshold sets the percent of a partition's lines that must be deleted before the partition is
+// automatically compacted. A threshold of 0 disables automatic compaction.
+func (k *Keystore) SetCompactThreshold(percent uint8) int {
+	if percent > 100 {
+		percent = 100
+	}
+
+	// Write to configFile
+	k.eMux.Lock()
+	fileOn := k.fileOn
+	k.eMux.Unlock()
+	conf := k.makeDefaultConfig(fileOn)
+	conf.CompactThreshold = percent
+	if err := writeConfigFile(k.configFile, conf); err != 0 {
+		helpers.LogAndPrint("Failed to set compact threshold for Keystore '" + k.name + "' with error code: " + strconv.Itoa(err), 4)
+		return err
+	}
+	k.compactThreshold.Store(percent)
+	return 0
+}
+
 func (k *Keystore) makeDefaultConfig(fileOn uint32) keystoreConfig {
 	return keystoreConfig {
 		Name:         k.name,
@@ -345,7 +447,21 @@ func (k *Keystore) makeDefaultConfig(fileOn uint32) keystoreConfig {
 		PartitionMax: k.partitionMax.Load().(uint16),
 		EncryptCost:  k.encryptCost.Load().(int),
 		MaxEntries:   k.maxEntries.Load().(uint64),
+		Durability:   k.durability.Load().(int),
+		CompactThreshold: k.compactThreshold.Load().(uint8),
+		Format:       k.format.Load().(uint8),
+		Indexes:      k.Indexes(),
+		KeyIndex:     k.keyIndex.Load().(bool),
+	}
+}
+
+// MakeSchemaHConfig makes the Keystore's schema history for a config file
+func (k *Keystore) MakeSchemaHConfig() [][]schema.SchemaConfigItem {
+	sh := make([][]schema.SchemaConfigItem, len(k.schemaH), len(k.schemaH))
+	for i, s := range k.schemaH {
+		sh[i] = s.MakeConfig()
 	}
+	return sh
 }
 
 // Writes k to f and truncates file
@@ -360,6 +476,11 @@ func writeConfigFile(f *os.File, k keystoreConfig) int {
 		return helpers.ErrorFileUpdate
 	}
 	f.Truncate(int64(len(jBytes)))
+	// Keep a copy in the data folder for Repair to make a new config file from
+	copyFile := strings.TrimSuffix(f.Name(), helpers.FileTypeConfig) + configCopyFile
+	if cErr := helpers.WriteFileAtomic(copyFile, jBytes); cErr != nil {
+		helpers.LogAndPrint("Failed to write config copy '" + copyFile + "' with error: " + cErr.Error(), 4)
+	}
 	return 0
 }
 
@@ -422,6 +543,37 @@ func Restore(name string) (*Keystore, helpers.Error) {
 	if confStruct.PartitionMax != helpers.DefaultPartitionMax {
 		ks.partitionMax.Store(confStruct.PartitionMax)
 	}
+	if confStruct.CompactThreshold != helpers.DefaultCompactThreshold {
+		ks.compactThreshold.Store(confStruct.CompactThreshold)
+	}
+	if confStruct.Format != helpers.FormatJSON {
+		ks.format.Store(confStruct.Format)
+	}
+	if confStruct.Durability != storage.DurabilityDefault {
+		ks.durability.Store(confStruct.Durability)
+		storage.SetFolderDurability(namePre, confStruct.Durability)
+	}
+	// Indexes are built while entries are restored
+	for _, item := range confStruct.Indexes {
+		path, ok := schema.NewIndexPath(s, item)
+		if !ok {
+			helpers.LogAndPrint("Error: Keystore '" + name + "':: Can't index item '" + item + "'!\n", 4)
+			continue
+		}
+		ks.indexes[item] = newIndex(path)
+		ks.indexes[item].ready = true
+	}
+	if confStruct.KeyIndex {
+		ks.keyIndex.Store(true)
+		ks.keys = newKeyIndex()
+	}
+	// Apply writes left in the write-ahead log
+	if wErr := storage.ReplayWAL(namePre); wErr != 0 {
+		ks.eMux.Unlock()
+		ks.uMux.Unlock()
+		ks.Close(false)
+		return nil, helpers.NewError(wErr, "Could not replay write-ahead log for Keystore '" + name + "'")
+	}
 	// Open data folder
 	df, err := os.Open(namePre)
 	if err != nil {
@@ -464,12 +616,17 @@ func Restore(name string) (*Keystore, helpers.Error) {
 			// Get line bytes
 			var lb []byte
 			if lb, err = of.Read(uint16(i+1)); err != 0 {
-				helpers.LogAndPrint("Error: Keystore '" + name + "':: Could not read line " + strconv.Itoa(i + 1) + " of '" + fileStats.Name() + "'!\n", 4)
+				helpers.LogAndPrint("Error: Keystore '" + name + "':: Could not read line " + strconv.Itoa(i + 1) + " of '" + fileStats.Name() + "' (key '" + entryKey(lb) + "'), with error code " + strconv.Itoa(err) + "!\n", 4)
+				continue
+			}
+			if len(lb) == 0 {
+				// Deleted line
+				ks.deletedLines[uint32(fileNum)]++
 				continue
 			}
-			eKey, eData := restoreDataLine(lb)
+			eKey, eData := ks.restoreDataLine(lb)
 			if eData == nil {
-				helpers.LogAndPrint("Error: Keystore '" + name + "':: Incorrect JSON format on line " + strconv.Itoa(i + 1) + " of '" + fileStats.Name() + "'!\n", 4)
+				helpers.LogAndPrint("Error: Keystore '" + name + "':: Incorrect entry format on line " + strconv.Itoa(i + 1) + " of '" + fileStats.Name() + "'!\n", 4)
 				continue
 			}
 			if err = ks.restoreKey(eKey, eData, uint32(fileNum), uint16(i+1)); err != 0 {
@@ -485,17 +642,12 @@ func Restore(name string) (*Keystore, helpers.Error) {
 	return ks, helpers.Error{}
 }
 
-// Resore a line of data from
-func restoreDataLine(line []byte) (string, []interface{}) {
-	var jEntry jsonEntry
-	mErr := json.Unmarshal(line, &jEntry)
-	if mErr != nil {
-		return "", nil
-	}
-
-	if jEntry.D == nil || jEntry.K == "" {
+// Resore a line of data from a JSON or binary entry
+func (k *Keystore) restoreDataLine(line []byte) (string, []interface{}) {
+	key, data, err := k.entryFromBytes(line)
+	if err != 0 || data == nil || key == "" {
 		return "", nil
 	}
 
-	return jEntry.K, jEntry.D
+	return key, data
 }
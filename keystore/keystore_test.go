@@ -1,11 +1,17 @@
 package keystore
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"github.com/hewiefreeman/GopherDB/helpers"
 	"github.com/hewiefreeman/GopherDB/keystore"
+	"github.com/hewiefreeman/GopherDB/schema"
 	"github.com/hewiefreeman/GopherDB/storage"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -87,6 +93,10 @@ func TestChangeTableSettings(t *testing.T) {
 		t.Errorf("Error while setting table encryption cost: %v", err)
 		return
 	}
+	// Unknown durability modes are rejected
+	if err = table.SetDurability(storage.DurabilityBuffered + 1); err != helpers.ErrorInvalidItemValue {
+		t.Errorf("Expected error %v while setting unknown durability mode, but got: %v", helpers.ErrorInvalidItemValue, err)
+	}
 }
 
 func TestInsert(t *testing.T) {
@@ -686,6 +696,893 @@ func TestSortArray(t *testing.T) {
 	}
 }*/
 
+func TestConvert(t *testing.T) {
+	entries := map[string]map[string]interface{}{
+		"Vokome": {"name": "Vokome", "mmr": float64(1674), "ratios": map[string]interface{}{"one": float64(0.5), "two": float64(-2.25)}, "tags": []interface{}{"a", "b"}},
+		"Mary":   {"name": "Mary", "mmr": float64(12), "ratios": map[string]interface{}{}, "tags": []interface{}{}},
+		"Bill":   {"name": "Bill \"the\" gopher", "mmr": float64(0), "ratios": map[string]interface{}{"x": float64(3)}, "tags": []interface{}{"c"}},
+	}
+	k := newTestKeystore(t, "testConvert", map[string]interface{}{
+		"name":   []interface{}{"String", "", float64(0), false, false, false},
+		"mmr":    []interface{}{"Uint16", float64(1500), float64(0), float64(0), false, false},
+		"ratios": []interface{}{"Map", []interface{}{"Float32", float64(0), float64(0), float64(0), false, false, false}, float64(0), false},
+		"tags":   []interface{}{"Array", []interface{}{"String", "", float64(0), false, false, false}, float64(0), false},
+	}, false, false, entries)
+	before := make(map[string]string, len(entries))
+	for key := range entries {
+		data, err := k.GetKey(key, nil)
+		if err.ID != 0 {
+			t.Fatalf("TestConvert get error: %v", err)
+		}
+		before[key] = fmt.Sprint(data)
+	}
+	// check reads every entry after each conversion, and the data file once it's flushed
+	check := func(when string, format uint8, flushed bool) {
+		t.Helper()
+		if k.Format() != format || k.Size() != len(entries) {
+			t.Errorf("TestConvert expected %v entries with format %v %v, but got %v entries with format %v", len(entries), format, when, k.Size(), k.Format())
+		}
+		for key, b := range before {
+			if after, err := k.GetKey(key, nil); err.ID != 0 || fmt.Sprint(after) != b {
+				t.Errorf("TestConvert expected %v %v, but got: %v (error %v)", b, when, after, err)
+			}
+		}
+		if !flushed {
+			return
+		}
+		file, err := os.ReadFile("Keystore-testConvert/0" + helpers.FileTypeStorage)
+		if err != nil {
+			t.Fatalf("TestConvert could not read data file %v: %v", when, err)
+		}
+		// Updated lines are appended, so the last line with Vokome's key is it's entry (binary keys are prefixed with their length)
+		isJSON := bytes.LastIndex(file, []byte("{\"K\":\"Vokome\"")) > bytes.LastIndex(file, []byte("\x06Vokome"))
+		if isJSON != (format == helpers.FormatJSON) {
+			t.Errorf("TestConvert expected the data file to be written with format %v %v", format, when)
+		}
+	}
+	check("before converting", helpers.FormatJSON, false)
+
+	if err := k.Convert(helpers.FormatBinary); err.ID != 0 {
+		t.Fatalf("TestConvert error: %v", err)
+	}
+	check("after converting to binary", helpers.FormatBinary, false)
+	// Map items read from binary keep their schema type, where JSON gives float64s
+	if data, _ := k.GetKey("Vokome", nil); data != nil {
+		if _, ok := data["ratios"].(map[string]interface{})["one"].(float32); !ok {
+			t.Errorf("TestConvert expected a float32, but got: %T", data["ratios"].(map[string]interface{})["one"])
+		}
+	}
+
+	// Entries are read from binary after restoring
+	restore := func() {
+		t.Helper()
+		k.Close(true)
+		storage.ShutDown()
+		storage.Init()
+		var rErr helpers.Error
+		if k, rErr = keystore.Restore("testConvert"); rErr.ID != 0 {
+			t.Fatalf("TestConvert restore error: %v", rErr)
+		}
+	}
+	restore()
+	check("after restoring", helpers.FormatBinary, true)
+
+	// Inserts after converting are written as binary too
+	if _, err := k.InsertKey("Anna", map[string]interface{}{"name": "Anna", "mmr": float64(5)}); err.ID != 0 {
+		t.Fatalf("TestConvert insert error: %v", err)
+	}
+	data, _ := k.GetKey("Anna", nil)
+	before["Anna"] = fmt.Sprint(data)
+	entries["Anna"] = nil
+
+	if err := k.Convert(helpers.FormatJSON); err.ID != 0 {
+		t.Fatalf("TestConvert error: %v", err)
+	}
+	check("after converting back to JSON", helpers.FormatJSON, false)
+	restore()
+	check("after restoring as JSON", helpers.FormatJSON, true)
+	if err := k.Convert(9); err.ID != helpers.ErrorQueryInvalidFormat {
+		t.Errorf("TestConvert expected error %v, but got: %v", helpers.ErrorQueryInvalidFormat, err)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	entries := make(map[string]map[string]interface{})
+	for i := 0; i < 300; i++ {
+		entries["key" + strconv.Itoa(i)] = map[string]interface{}{"name": "user" + strconv.Itoa(i), "mmr": float64(i), "tags": []interface{}{"t" + strconv.Itoa(i % 3)}}
+	}
+	k := newTestKeystore(t, "testBackup", map[string]interface{}{
+		"name": []interface{}{"String", "", float64(0), false, false, false},
+		"mmr":  []interface{}{"Int16", float64(0), float64(0), float64(0), false, false, false},
+		"tags": []interface{}{"Array", []interface{}{"String", "", float64(0), false, false, false}, float64(0), false},
+	}, true, false, entries)
+	archive := "testBackup" + helpers.FileTypeBackup
+	defer os.Remove(archive)
+	before := make(map[string]string, len(entries))
+	for key := range entries {
+		data, err := k.GetKey(key, nil)
+		if err.ID != 0 {
+			t.Fatalf("TestBackup get error: %v", err)
+		}
+		before[key] = fmt.Sprint(data)
+	}
+	if err := k.Backup(archive); err.ID != 0 {
+		t.Fatalf("TestBackup backup error: %v", err)
+	}
+	if _, err := keystore.RestoreBackup(archive); err.ID != helpers.ErrorTableExists {
+		t.Errorf("TestBackup expected error %v restoring over an existing Keystore, but got: %v", helpers.ErrorTableExists, err)
+	}
+
+	// Changes after the backup are not in it
+	if err := k.UpdateKey("key7", map[string]interface{}{"mmr": float64(-7)}); err.ID != 0 {
+		t.Fatalf("TestBackup update error: %v", err)
+	}
+	if err := k.DeleteKey("key8"); err.ID != 0 {
+		t.Fatalf("TestBackup delete error: %v", err)
+	}
+	if _, err := k.InsertKey("new", map[string]interface{}{"name": "new"}); err.ID != 0 {
+		t.Fatalf("TestBackup insert error: %v", err)
+	}
+	k.Delete()
+	storage.ShutDown()
+	storage.Init()
+
+	// Restore the Keystore from the backup, with every entry read from the drive
+	var rErr helpers.Error
+	if k, rErr = keystore.RestoreBackup(archive); rErr.ID != 0 {
+		t.Fatalf("TestBackup restore error: %v", rErr)
+	}
+	if !k.DataOnDrive() || k.MemOnly() || k.Size() != len(entries) {
+		t.Errorf("TestBackup expected %v entries on the drive after restoring, but got %v (dataOnDrive %v, memOnly %v)", len(entries), k.Size(), k.DataOnDrive(), k.MemOnly())
+	}
+	for key, b := range before {
+		if after, err := k.GetKey(key, nil); err.ID != 0 || fmt.Sprint(after) != b {
+			t.Errorf("TestBackup expected %v after restoring, but got: %v (error %v)", b, after, err)
+		}
+	}
+	if _, err := k.GetKey("new", nil); err.ID != helpers.ErrorNoEntryFound {
+		t.Errorf("TestBackup expected error %v for an entry made after the backup, but got: %v", helpers.ErrorNoEntryFound, err)
+	}
+	// 300 entries fill more than one partition
+	for _, p := range []string{"0", "1"} {
+		if _, sErr := os.Stat("Keystore-testBackup/" + p + helpers.FileTypeStorage); sErr != nil {
+			t.Errorf("TestBackup expected partition %v after restoring, but got: %v", p, sErr)
+		}
+	}
+
+	// The restored Keystore can be changed, and restored again
+	if err := k.UpdateKey("key7", map[string]interface{}{"mmr": float64(70)}); err.ID != 0 {
+		t.Errorf("TestBackup update error after restoring: %v", err)
+	}
+	k.Close(true)
+	storage.ShutDown()
+	storage.Init()
+	if k, rErr = keystore.Restore("testBackup"); rErr.ID != 0 {
+		t.Fatalf("TestBackup restore error: %v", rErr)
+	}
+	if data, err := k.GetKey("key7", map[string]interface{}{"mmr": nil}); err.ID != 0 || fmt.Sprint(data["mmr"]) != "70" {
+		t.Errorf("TestBackup expected mmr 70 after restoring, but got: %v (error %v)", data, err)
+	}
+}
+
+func TestBackupMemOnly(t *testing.T) {
+	s, sErr := schema.New(map[string]interface{}{
+		"name": []interface{}{"String", "", float64(0), false, false, false},
+		"mmr":  []interface{}{"Int16", float64(0), float64(0), float64(0), false, false, false},
+	}, false)
+	if sErr.ID != 0 {
+		t.Fatalf("TestBackupMemOnly error making schema: %v", sErr)
+	}
+	k, kErr := keystore.New("testBackupMemOnly", nil, s, 0, false, true)
+	if kErr.ID != 0 {
+		t.Fatalf("TestBackupMemOnly error making Keystore: %v", kErr)
+	}
+	archive := "testBackupMemOnly" + helpers.FileTypeBackup
+	defer os.Remove(archive)
+	for i := 0; i < 300; i++ {
+		if _, err := k.InsertKey("key" + strconv.Itoa(i), map[string]interface{}{"name": "user" + strconv.Itoa(i), "mmr": float64(i)}); err.ID != 0 {
+			k.Delete()
+			t.Fatalf("TestBackupMemOnly insert error: %v", err)
+		}
+	}
+	if err := k.Backup(archive); err.ID != 0 {
+		k.Delete()
+		t.Fatalf("TestBackupMemOnly backup error: %v", err)
+	}
+	k.Delete()
+	// MemOnly entries are backed up, and only kept in memory once restored
+	if k, kErr = keystore.RestoreBackup(archive); kErr.ID != 0 {
+		t.Fatalf("TestBackupMemOnly restore error: %v", kErr)
+	}
+	defer func() { k.Delete() }()
+	if k.Size() != 300 {
+		t.Errorf("TestBackupMemOnly expected 300 entries after restoring, but got %v", k.Size())
+	} else if data, err := k.GetKey("key123", nil); err.ID != 0 || data["name"] != "user123" {
+		t.Errorf("TestBackupMemOnly expected user123 after restoring, but got: %v (error %v)", data, err)
+	}
+	if _, sErr := os.Stat("Keystore-testBackupMemOnly/0" + helpers.FileTypeStorage); sErr == nil {
+		t.Errorf("TestBackupMemOnly expected no partitions after restoring")
+	}
+}
+
+func TestRepair(t *testing.T) {
+	s, sErr := schema.New(map[string]interface{}{
+		"name":  []interface{}{"String", "", float64(0), false, false, false},
+		"mmr":   []interface{}{"Int16", float64(0), float64(0), float64(0), false, false, false},
+		"ratio": []interface{}{"Float64", float64(0), float64(0), float64(0), false, false, false},
+		"tags":  []interface{}{"Array", []interface{}{"String", "", float64(0), false, false, false}, float64(0), false},
+	}, false)
+	if sErr.ID != 0 {
+		t.Fatalf("TestRepair error making schema: %v", sErr)
+	}
+	k, kErr := keystore.New("testRepair", nil, s, 0, false, false)
+	if kErr.ID != 0 {
+		t.Fatalf("TestRepair error making Keystore: %v", kErr)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := k.InsertKey("key" + strconv.Itoa(i), map[string]interface{}{"name": "user" + strconv.Itoa(i), "mmr": float64(i * 100), "ratio": float64(i) / 4, "tags": []interface{}{"a", "b"}}); err.ID != 0 {
+			t.Fatalf("TestRepair insert error: %v", err)
+		}
+	}
+	k.Close(false)
+	storage.ShutDown()
+	storage.Init()
+	// Lose the config file and it's copy, so the config is made from the Keystore's entries
+	os.Remove("Keystore-testRepair" + helpers.FileTypeConfig)
+	os.Remove("Keystore-testRepair/config" + helpers.FileTypeConfig)
+	if _, err := keystore.Repair("testRepair"); err.ID != 0 {
+		t.Fatalf("TestRepair repair error: %v", err)
+	}
+	if k, kErr = keystore.Restore("testRepair"); kErr.ID != 0 {
+		t.Fatalf("TestRepair restore error: %v", kErr)
+	}
+	defer func() { k.Delete() }()
+	if k.Size() != 10 {
+		t.Errorf("TestRepair expected 10 entries after repairing, but got %v", k.Size())
+	}
+	// Items are named by position, with the simplest type that fits their values
+	expected := map[string][]interface{}{
+		"name":  {schema.ItemTypeString, "user3"},
+		"mmr":   {schema.ItemTypeInt64, int64(300)},
+		"ratio": {schema.ItemTypeFloat64, float64(0.75)},
+		"tags":  {schema.ItemTypeArray, []interface{}{"a", "b"}},
+	}
+	data, err := k.GetKey("key3", nil)
+	if err.ID != 0 {
+		t.Fatalf("TestRepair get error: %v", err)
+	}
+	for item, e := range expected {
+		name := "item" + strconv.Itoa(int(s[item].DataIndex()))
+		if si, ok := k.Schema()[name]; !ok || si.TypeName() != e[0] {
+			t.Errorf("TestRepair expected item %v (%v) to be a %v, but got: %v", name, item, e[0], si.TypeName())
+		} else if fmt.Sprint(data[name]) != fmt.Sprint(e[1]) {
+			t.Errorf("TestRepair expected item %v (%v) to be %v, but got: %v", name, item, e[1], data[name])
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	entries := map[string]map[string]interface{}{
+		"Vokome": {"name": "Vokome", "mmr": float64(1674), "tags": []interface{}{"a", "b"}, "profile": map[string]interface{}{"country": "CA"}},
+		"Mary":   {"name": "Mary \"M\"\n", "mmr": float64(-12), "tags": []interface{}{}, "profile": map[string]interface{}{"country": ""}},
+		"Bill":   {"name": "Bill", "mmr": float64(0), "tags": []interface{}{"c"}, "profile": map[string]interface{}{"country": "US"}},
+	}
+	k := newTestKeystore(t, "testExportImport", map[string]interface{}{
+		"name":    []interface{}{"String", "", float64(0), false, false, false},
+		"mmr":     []interface{}{"Int16", float64(0), float64(0), float64(0), false, false, false},
+		"tags":    []interface{}{"Array", []interface{}{"String", "", float64(0), false, false, false}, float64(0), false},
+		"profile": []interface{}{"Object", map[string]interface{}{"country": []interface{}{"String", "", float64(0), false, false, false}}},
+	}, false, false, entries)
+	before := make(map[string]string, len(entries))
+	for key := range entries {
+		data, err := k.GetKey(key, nil)
+		if err.ID != 0 {
+			t.Fatalf("TestExportImport get error: %v", err)
+		}
+		before[key] = fmt.Sprint(data)
+	}
+	var export bytes.Buffer
+	if n, err := k.Export(&export, false); err.ID != 0 || n != len(entries) {
+		t.Fatalf("TestExportImport expected %v entries exported, but got %v (error %v)", len(entries), n, err)
+	}
+	lines := strings.Split(strings.TrimSuffix(export.String(), "\n"), "\n")
+	if len(lines) != len(entries) || !strings.HasPrefix(lines[0], "{\"Key\":\"Bill\",") {
+		t.Errorf("TestExportImport expected one line per entry in order of their keys, but got: %v", lines)
+	}
+	if _, err := k.Export(&bytes.Buffer{}, true); err.ID != helpers.ErrorCSVFormat {
+		t.Errorf("TestExportImport expected error %v exporting a schema with Arrays as CSV, but got: %v", helpers.ErrorCSVFormat, err)
+	}
+
+	// Every entry is already in the Keystore
+	n, rowErrs, err := k.Import(strings.NewReader(export.String() + "{bad row\n"), false)
+	if err.ID != 0 || n != 0 || len(rowErrs) != len(entries) + 1 {
+		t.Fatalf("TestExportImport expected %v row errors, but got %v imported and %v (error %v)", len(entries) + 1, n, rowErrs, err)
+	}
+	for i, r := range rowErrs[:len(entries)] {
+		if r.Row != i + 1 || r.Error.ID != helpers.ErrorKeyInUse {
+			t.Errorf("TestExportImport expected error %v on row %v, but got: %+v", helpers.ErrorKeyInUse, i + 1, r)
+		}
+	}
+	if r := rowErrs[len(entries)]; r.Row != len(entries) + 1 || r.Error.ID != helpers.ErrorJsonDecoding {
+		t.Errorf("TestExportImport expected error %v on row %v, but got: %+v", helpers.ErrorJsonDecoding, len(entries) + 1, r)
+	}
+
+	// Delete every entry, then import them again
+	for key := range entries {
+		if err := k.DeleteKey(key); err.ID != 0 {
+			t.Fatalf("TestExportImport delete error: %v", err)
+		}
+	}
+	if n, rowErrs, err = k.Import(strings.NewReader(export.String()), false); err.ID != 0 || n != len(entries) || len(rowErrs) != 0 {
+		t.Fatalf("TestExportImport expected %v entries imported, but got %v (errors %v %v)", len(entries), n, err, rowErrs)
+	}
+	if k.Size() != len(entries) {
+		t.Errorf("TestExportImport expected %v entries after importing, but got %v", len(entries), k.Size())
+	}
+	for key, b := range before {
+		if after, gErr := k.GetKey(key, nil); gErr.ID != 0 || fmt.Sprint(after) != b {
+			t.Errorf("TestExportImport expected %v after importing, but got: %v (error %v)", b, after, gErr)
+		}
+	}
+
+	// Rows are checked against the schema
+	bad := "{\"Key\":\"x\",\"Items\":{\"mmr\":\"high\"}}\n{\"Key\":\"y\",\"Items\":{\"rank\":1}}\n{\"Items\":{\"mmr\":1}}\n{\"Key\":\"z\",\"Items\":{\"mmr\":5}}\n"
+	if n, rowErrs, err = k.Import(strings.NewReader(bad), false); err.ID != 0 || n != 1 || len(rowErrs) != 3 {
+		t.Errorf("TestExportImport expected 1 entry imported and 3 row errors, but got %v imported and %v (error %v)", n, rowErrs, err)
+	} else if data, gErr := k.GetKey("z", map[string]interface{}{"mmr": nil}); gErr.ID != 0 || fmt.Sprint(data["mmr"]) != "5" {
+		t.Errorf("TestExportImport expected mmr 5 for 'z', but got: %v (error %v)", data, gErr)
+	}
+}
+
+func TestExportImportCSV(t *testing.T) {
+	entries := map[string]map[string]interface{}{
+		"a": {"balance": "9223372036854775807", "active": true, "joined": "2026-01-01T00:00:00Z"},
+		"b": {"balance": float64(-42), "active": false, "joined": "2026-02-15T12:30:00Z"},
+		"c,\"d\"": {"balance": float64(0), "active": true, "joined": "2026-03-01T00:00:00Z"},
+	}
+	k := newTestKeystore(t, "testExportImportCSV", map[string]interface{}{
+		"balance": []interface{}{"Int64", float64(0), float64(0), float64(0), false, false, false},
+		"active":  []interface{}{"Bool", false},
+		"joined":  []interface{}{"Time", "RFC3339", false},
+	}, false, true, entries)
+	before := make(map[string]string, len(entries))
+	for key := range entries {
+		data, err := k.GetKey(key, nil)
+		if err.ID != 0 {
+			t.Fatalf("TestExportImportCSV get error: %v", err)
+		}
+		before[key] = fmt.Sprint(data)
+	}
+	var export bytes.Buffer
+	if n, err := k.Export(&export, true); err.ID != 0 || n != len(entries) {
+		t.Fatalf("TestExportImportCSV expected %v entries exported, but got %v (error %v)", len(entries), n, err)
+	}
+	if !strings.HasPrefix(export.String(), "Key,active,balance,joined\n") {
+		t.Errorf("TestExportImportCSV unexpected header row: %v", strings.SplitN(export.String(), "\n", 2)[0])
+	}
+	// Delete every entry, then import them again
+	for key := range entries {
+		if err := k.DeleteKey(key); err.ID != 0 {
+			t.Fatalf("TestExportImportCSV delete error: %v", err)
+		}
+	}
+	n, rowErrs, err := k.Import(strings.NewReader(export.String()), true)
+	if err.ID != 0 || n != len(entries) || len(rowErrs) != 0 {
+		t.Fatalf("TestExportImportCSV expected %v entries imported, but got %v (errors %v %v)", len(entries), n, err, rowErrs)
+	}
+	for key, b := range before {
+		if after, gErr := k.GetKey(key, nil); gErr.ID != 0 || fmt.Sprint(after) != b {
+			t.Errorf("TestExportImportCSV expected %v after importing, but got: %v (error %v)", b, after, gErr)
+		}
+	}
+	// Values that don't fit their items are row errors
+	bad := "Key,active,balance,joined\nx,maybe,1,2026-01-01T00:00:00Z\ny,true,1,yesterday\nz,true,1\n"
+	if n, rowErrs, err = k.Import(strings.NewReader(bad), true); err.ID != 0 || n != 0 || len(rowErrs) != 3 {
+		t.Errorf("TestExportImportCSV expected 3 row errors, but got %v imported and %v (error %v)", n, rowErrs, err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	entries := map[string]map[string]interface{}{}
+	for key, mmr := range map[string]float64{"ann": 1200, "bob": 1500, "cat": 1800, "dan": 900, "eve": 2100, "fay": 1500, "gus": 1700, "hal": 3000, "ivy": 1499} {
+		entries[key] = map[string]interface{}{"mmr": mmr, "name": "user " + key}
+	}
+	k := newTestKeystore(t, "testSelect", map[string]interface{}{
+		"mmr":  []interface{}{"Uint16", float64(1500), float64(0), float64(0), false, false},
+		"name": []interface{}{"String", "", float64(0), false, false, false},
+	}, false, false, entries)
+	keys := func(selected []keystore.Selected) string {
+		var s []string
+		for _, e := range selected {
+			s = append(s, e.Key)
+		}
+		return strings.Join(s, " ")
+	}
+
+	// Every entry in order of their keys, with the requested items
+	all, after, err := k.Select(nil, map[string]interface{}{"mmr": nil}, 0, 0, "")
+	if err.ID != 0 {
+		t.Fatalf("TestSelect error: %v", err)
+	} else if keys(all) != "ann bob cat dan eve fay gus hal ivy" || after != "" {
+		t.Errorf("TestSelect expected every entry and no cursor, but got '%v' and '%v'", keys(all), after)
+	} else if fmt.Sprint(all[1].Items) != "map[mmr:1500]" {
+		t.Errorf("TestSelect expected only mmr for 'bob', but got: %v", all[1].Items)
+	}
+	if all, _, err = k.Select(nil, nil, 1, 0, ""); err.ID != 0 || len(all) != 1 || fmt.Sprint(all[0].Items) != "map[mmr:1200 name:user ann]" {
+		t.Errorf("TestSelect expected every item for 'ann', but got: %v (error %v)", all, err)
+	}
+
+	where := map[string]interface{}{"mmr.*gte": []interface{}{1500}}
+	tests := []struct {
+		limit  int
+		offset int
+		after  string
+		keys   string
+		cursor string
+	}{
+		{0, 0, "", "bob cat eve fay gus hal", ""},
+		{2, 0, "", "bob cat", "cat"},
+		{2, 0, "cat", "eve fay", "fay"},
+		{2, 0, "fay", "gus hal", "hal"},
+		{2, 0, "hal", "", ""},
+		{2, 1, "", "cat eve", "eve"},
+		{2, 1, "cat", "fay gus", "gus"},
+		{0, 4, "", "gus hal", ""},
+		{3, 5, "", "hal", ""},
+		{0, 9, "", "", ""},
+		// The cursor doesn't have to be a matching key, or a key at all
+		{2, 0, "dan", "eve fay", "fay"},
+		{2, 0, "c", "cat eve", "eve"},
+		{0, 0, "zzz", "", ""},
+	}
+	for _, test := range tests {
+		page, cursor, err := k.Select(where, nil, test.limit, test.offset, test.after)
+		if err.ID != 0 {
+			t.Errorf("TestSelect error with limit %v, offset %v, after '%v': %v", test.limit, test.offset, test.after, err)
+		} else if keys(page) != test.keys || cursor != test.cursor {
+			t.Errorf("TestSelect expected '%v' and cursor '%v' with limit %v, offset %v, after '%v', but got '%v' and '%v'", test.keys, test.cursor, test.limit, test.offset, test.after, keys(page), cursor)
+		}
+	}
+
+	// Conditions on more than one item must all match
+	if page, _, err := k.Select(map[string]interface{}{"mmr.*lt": []interface{}{1800}, "name.*contains": []interface{}{"a"}}, nil, 0, 0, ""); err.ID != 0 || keys(page) != "ann dan fay" {
+		t.Errorf("TestSelect expected 'ann dan fay', but got '%v' (error %v)", keys(page), err)
+	}
+
+	if _, _, err = k.Select(map[string]interface{}{"rank.*gt": []interface{}{1}}, nil, 0, 0, ""); err.ID != helpers.ErrorInvalidItem {
+		t.Errorf("TestSelect expected error %v, but got: %v", helpers.ErrorInvalidItem, err)
+	}
+	if _, _, err = k.Select(map[string]interface{}{"mmr": nil}, nil, 0, 0, ""); err.ID != helpers.ErrorInvalidMethod {
+		t.Errorf("TestSelect expected error %v, but got: %v", helpers.ErrorInvalidMethod, err)
+	}
+	if _, _, err = k.Select(where, nil, -1, 0, ""); err.ID != helpers.ErrorInvalidItemValue {
+		t.Errorf("TestSelect expected error %v, but got: %v", helpers.ErrorInvalidItemValue, err)
+	}
+}
+
+// newTestKeystore makes a Keystore with a schema of items for a test, inserts entries into it in order of their keys,
+// and deletes it when the test ends
+func newTestKeystore(t *testing.T, name string, items map[string]interface{}, dataOnDrive bool, memOnly bool, entries map[string]map[string]interface{}) *keystore.Keystore {
+	t.Helper()
+	s, sErr := schema.New(items, false)
+	if sErr.ID != 0 {
+		t.Fatalf("%v error making schema: %v", t.Name(), sErr)
+	}
+	k, kErr := keystore.New(name, nil, s, 0, dataOnDrive, memOnly)
+	if kErr.ID != 0 {
+		t.Fatalf("%v error making Keystore: %v", t.Name(), kErr)
+	}
+	t.Cleanup(func() { k.Delete() })
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := k.InsertKey(key, entries[key]); err.ID != 0 {
+			t.Fatalf("%v insert error: %v", t.Name(), err)
+		}
+	}
+	return k
+}
+
+func TestIndex(t *testing.T) {
+	countries := []string{"CA", "US", "FR"}
+	entries := make(map[string]map[string]interface{}, 30)
+	for i := 0; i < 30; i++ {
+		entries["player" + strconv.Itoa(i)] = map[string]interface{}{"mmr": float64(1000 + i * 50), "profile": map[string]interface{}{"country": countries[i % 3]}}
+	}
+	k := newTestKeystore(t, "testIndex", map[string]interface{}{
+		"mmr":     []interface{}{"Uint16", float64(1500), float64(0), float64(0), false, false},
+		"profile": []interface{}{"Object", map[string]interface{}{"country": []interface{}{"String", "", float64(0), false, false, false}}},
+	}, true, false, entries)
+	if err := k.CreateIndex("profile.friends"); err.ID != helpers.ErrorInvalidItem {
+		t.Errorf("TestIndex expected error %v, but got: %v", helpers.ErrorInvalidItem, err)
+	}
+	for _, item := range []string{"mmr", "profile.country"} {
+		if err := k.CreateIndex(item); err.ID != 0 {
+			t.Fatalf("TestIndex error creating index '%v': %v", item, err)
+		}
+	}
+	if err := k.CreateIndex("mmr"); err.ID != helpers.ErrorIndexExists {
+		t.Errorf("TestIndex expected error %v, but got: %v", helpers.ErrorIndexExists, err)
+	}
+	k.UpdateKey("player3", map[string]interface{}{"mmr": float64(2400)})
+	k.UpdateKey("player4", map[string]interface{}{"profile.country": "CA"})
+	k.DeleteKey("player6")
+	wheres := []map[string]interface{}{
+		{"profile.country.*eq": []interface{}{"CA"}},
+		{"mmr.*gte": []interface{}{1500}, "mmr.*lt": []interface{}{2000}},
+		{"mmr.*gt": []interface{}{2200}, "profile.country.*eq": []interface{}{"CA"}},
+		{"mmr.*lte": []interface{}{1100}},
+	}
+	selectAll := func(where map[string]interface{}) string {
+		selected, _, err := k.Select(where, map[string]interface{}{"mmr": nil}, 0, 0, "")
+		if err.ID != 0 {
+			t.Fatalf("TestIndex select error: %v", err)
+		}
+		return fmt.Sprint(selected)
+	}
+	indexed := make([]string, len(wheres))
+	for i, where := range wheres {
+		indexed[i] = selectAll(where)
+	}
+	// Indexes are built again when the Keystore is restored
+	k.Close(true)
+	var rErr helpers.Error
+	if k, rErr = keystore.Restore("testIndex"); rErr.ID != 0 {
+		t.Fatalf("TestIndex error restoring Keystore: %v", rErr)
+	} else if fmt.Sprint(k.Indexes()) != "[mmr profile.country]" {
+		t.Errorf("TestIndex expected indexes [mmr profile.country] after restoring, but got %v", k.Indexes())
+	}
+	for i, where := range wheres {
+		if r := selectAll(where); r != indexed[i] {
+			t.Errorf("TestIndex expected %v after restoring, but got %v", indexed[i], r)
+		}
+	}
+	// Selects without indexes find the same entries
+	k.DropIndex("mmr")
+	k.DropIndex("profile.country")
+	for i, where := range wheres {
+		if r := selectAll(where); r != indexed[i] {
+			t.Errorf("TestIndex expected %v without indexes, but got %v", r, indexed[i])
+		}
+	}
+	if !strings.Contains(indexed[2], "player3") || !strings.Contains(indexed[0], "player4") || strings.Contains(indexed[0], "player6") {
+		t.Errorf("TestIndex indexes weren't updated: %v", indexed)
+	}
+}
+
+func TestCreateIndexConcurrent(t *testing.T) {
+	// Entries fit in one partition, so the storage engine doesn't close it while it's read with maxOpenFiles set to 2
+	entries := make(map[string]map[string]interface{}, 150)
+	for i := 0; i < 150; i++ {
+		entries["player" + strconv.Itoa(i)] = map[string]interface{}{"mmr": float64(i)}
+	}
+	k := newTestKeystore(t, "testCreateIndexConcurrent", map[string]interface{}{
+		"mmr": []interface{}{"Uint16", float64(1500), float64(0), float64(0), false, false},
+	}, true, false, entries)
+	// Change entries while the index is built
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 150; i += 3 {
+			k.UpdateKey("player" + strconv.Itoa(i), map[string]interface{}{"mmr": float64(5000 + i)})
+			k.DeleteKey("player" + strconv.Itoa(i + 1))
+			k.InsertKey("new" + strconv.Itoa(i), map[string]interface{}{"mmr": float64(i)})
+			k.GetKey("player" + strconv.Itoa(i + 2), nil)
+		}
+		done <- true
+	}()
+	if err := k.CreateIndex("mmr"); err.ID != 0 {
+		t.Fatalf("TestCreateIndexConcurrent error creating index: %v", err)
+	}
+	<-done
+	wheres := []map[string]interface{}{
+		{"mmr.*gte": []interface{}{0}},
+		{"mmr.*gte": []interface{}{5000}},
+		{"mmr.*lt": []interface{}{300}},
+	}
+	indexed := make([]string, len(wheres))
+	for i, where := range wheres {
+		selected, _, err := k.Select(where, nil, 0, 0, "")
+		if err.ID != 0 {
+			t.Fatalf("TestCreateIndexConcurrent select error: %v", err)
+		}
+		indexed[i] = fmt.Sprint(selected)
+		if i == 0 && len(selected) != 150 {
+			t.Errorf("TestCreateIndexConcurrent expected 150 entries, but got %v", len(selected))
+		}
+	}
+	// The index has every change made during the build
+	k.DropIndex("mmr")
+	for i, where := range wheres {
+		if selected, _, _ := k.Select(where, nil, 0, 0, ""); fmt.Sprint(selected) != indexed[i] {
+			t.Errorf("TestCreateIndexConcurrent expected %v without the index, but got %v with it", selected, indexed[i])
+		}
+	}
+}
+
+func TestKeyIndex(t *testing.T) {
+	entries := map[string]map[string]interface{}{"user:anna": {}, "user:bob": {}}
+	for i := 0; i < 600; i++ {
+		entries[fmt.Sprintf("match:2026-%02d-%03d", 9 + i % 2, i)] = map[string]interface{}{"mmr": float64(i)}
+	}
+	k := newTestKeystore(t, "testKeyIndex", map[string]interface{}{
+		"mmr": []interface{}{"Uint16", float64(1500), float64(0), float64(0), false, false},
+	}, false, false, entries)
+	ranges := []keystore.KeyRange{
+		{},
+		{Reverse: true},
+		{Prefix: "match:2026-10-"},
+		{Prefix: "match:2026-10-", Reverse: true},
+		{From: "match:2026-09-100", To: "match:2026-10-101"},
+		{From: "match:2026-09-100", To: "match:2026-10-101", Reverse: true},
+		{Prefix: "user:", From: "user:b"},
+		{Prefix: "user:", To: "user:b", Reverse: true},
+		{Prefix: "zzz"},
+	}
+	// selectPages gets every key in r, a page of 7 at a time
+	selectPages := func(r keystore.KeyRange) []string {
+		var keys []string
+		var after string
+		for {
+			selected, cursor, err := k.SelectRange(r, map[string]interface{}{"mmr.*gte": []interface{}{0}}, nil, 7, 0, after)
+			if err.ID != 0 {
+				t.Fatalf("TestKeyIndex select error: %v", err)
+			}
+			for _, e := range selected {
+				keys = append(keys, e.Key)
+			}
+			if after = cursor; after == "" {
+				return keys
+			}
+		}
+	}
+	sorted := make([]string, len(ranges))
+	for i, r := range ranges {
+		sorted[i] = fmt.Sprint(selectPages(r))
+	}
+	if err := k.SetKeyIndex(true); err != 0 {
+		t.Fatalf("TestKeyIndex error turning on key index: %v", err)
+	}
+	k.DeleteKey("match:2026-10-101")
+	k.InsertKey("match:2026-10-101", map[string]interface{}{"mmr": float64(101)})
+	for i, r := range ranges {
+		if keys := fmt.Sprint(selectPages(r)); keys != sorted[i] {
+			t.Errorf("TestKeyIndex expected %v with key index for %+v, but got %v", sorted[i], r, keys)
+		}
+	}
+	// The key index is built again when the Keystore is restored
+	k.Close(true)
+	var rErr helpers.Error
+	if k, rErr = keystore.Restore("testKeyIndex"); rErr.ID != 0 {
+		t.Fatalf("TestKeyIndex error restoring Keystore: %v", rErr)
+	} else if !k.KeyIndex() {
+		t.Errorf("TestKeyIndex expected key index after restoring")
+	}
+	for i, r := range ranges {
+		if keys := fmt.Sprint(selectPages(r)); keys != sorted[i] {
+			t.Errorf("TestKeyIndex expected %v after restoring for %+v, but got %v", sorted[i], r, keys)
+		}
+	}
+	if keys := selectPages(ranges[3]); len(keys) != 300 || keys[0] != "match:2026-10-599" || keys[299] != "match:2026-10-001" {
+		t.Errorf("TestKeyIndex unexpected reverse prefix scan: %v", keys)
+	}
+	if selected, _, err := k.SelectRange(keystore.KeyRange{Reverse: true}, nil, nil, 0, 0, ""); err.ID != 0 || len(selected) != 602 {
+		t.Errorf("TestKeyIndex expected 602 entries, but got %v (%v)", len(selected), err)
+	}
+	if sorted[6] != "[user:bob]" || sorted[7] != "[user:anna]" || sorted[8] != "[]" {
+		t.Errorf("TestKeyIndex unexpected user ranges: %v %v %v", sorted[6], sorted[7], sorted[8])
+	}
+}
+
+func TestKeyIndexToggle(t *testing.T) {
+	entries := make(map[string]map[string]interface{}, 1000)
+	for i := 0; i < 1000; i++ {
+		entries[fmt.Sprintf("key%04d", i)] = map[string]interface{}{"mmr": float64(i)}
+	}
+	k := newTestKeystore(t, "testKeyIndexToggle", map[string]interface{}{
+		"mmr": []interface{}{"Uint16", float64(1500), float64(0), float64(0), false, false},
+	}, false, true, entries)
+	// Turn the key index on and off while Selects read it in batches
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		for on := true; ; on = !on {
+			select {
+			case <-stop:
+				done <- true
+				return
+			default:
+				k.SetKeyIndex(on)
+			}
+		}
+	}()
+	defer func() {
+		stop <- true
+		<-done
+	}()
+	for i := 0; i < 50; i++ {
+		r := keystore.KeyRange{Reverse: i % 2 == 1}
+		selected, after, err := k.SelectRange(r, nil, nil, 0, 0, "")
+		if err.ID != 0 {
+			t.Fatalf("TestKeyIndexToggle select error: %v", err)
+		} else if len(selected) != 1000 || after != "" {
+			t.Fatalf("TestKeyIndexToggle expected 1000 entries and no cursor, but got %v and '%v'", len(selected), after)
+		}
+		for j, e := range selected {
+			expected := fmt.Sprintf("key%04d", j)
+			if r.Reverse {
+				expected = fmt.Sprintf("key%04d", 999 - j)
+			}
+			if e.Key != expected {
+				t.Fatalf("TestKeyIndexToggle expected entries in order of their keys, but got '%v' at %v", e.Key, j)
+			}
+		}
+		if res, err := k.Aggregate(keystore.KeyRange{}, nil, map[string]interface{}{"count": []interface{}{}}, ""); err.ID != 0 || fmt.Sprint(res["count"]) != "1000" {
+			t.Fatalf("TestKeyIndexToggle expected a count of 1000, but got: %v (error %v)", res, err)
+		}
+	}
+}
+
+func TestSelectOrdered(t *testing.T) {
+	entry := func(level int, joined string, country string) map[string]interface{} {
+		return map[string]interface{}{"level": float64(level), "joined": joined, "secret": "hidden", "profile": map[string]interface{}{"country": country}}
+	}
+	k := newTestKeystore(t, "testSelectOrdered", map[string]interface{}{
+		"level":   []interface{}{"Uint16", float64(1), float64(0), float64(0), false, false},
+		"joined":  []interface{}{"Time", "RFC3339", false},
+		"secret":  []interface{}{"String", "", float64(0), true, false, false},
+		"profile": []interface{}{"Object", map[string]interface{}{"country": []interface{}{"String", "", float64(0), false, false, false}}},
+	}, false, true, map[string]map[string]interface{}{
+		"e": entry(2, "2026-03-01T00:00:00Z", "CA"),
+		"a": entry(5, "2026-01-01T00:00:00Z", "US"),
+		"d": entry(5, "2026-02-01T00:00:00Z", "CA"),
+		"b": entry(2, "2026-01-15T00:00:00Z", "US"),
+		"c": entry(5, "2026-01-01T00:00:00Z", "CA"),
+	})
+	orderedKeys := func(order []string, limit int, offset int, after string) (string, string) {
+		selected, cursor, err := k.SelectOrdered(order, keystore.KeyRange{}, nil, map[string]interface{}{"level": nil}, limit, offset, after)
+		if err.ID != 0 {
+			t.Fatalf("TestSelectOrdered select error: %v", err)
+		}
+		var keys string
+		for _, e := range selected {
+			keys += e.Key
+		}
+		return keys, cursor
+	}
+	tests := []struct {
+		order []string
+		keys  string
+	}{
+		{[]string{"level"}, "beacd"},
+		{[]string{"level.*sortDesc"}, "acdbe"},
+		{[]string{"level.*sortDesc", "joined.*sortAsc"}, "acdbe"},
+		{[]string{"level.*sortDesc", "joined.*sortDesc"}, "daceb"},
+		{[]string{"profile.country", "level.*sortDesc", "joined"}, "cdeab"},
+		{[]string{"joined.*sortDesc"}, "edbac"},
+	}
+	for _, test := range tests {
+		if keys, _ := orderedKeys(test.order, 0, 0, ""); keys != test.keys {
+			t.Errorf("TestSelectOrdered expected %v for order %v, but got %v", test.keys, test.order, keys)
+		}
+	}
+	// Pages with limit and offset, and with the cursor
+	order := []string{"profile.country", "level.*sortDesc", "joined"}
+	keys, cursor := orderedKeys(order, 2, 1, "")
+	if keys != "de" || cursor == "" {
+		t.Errorf("TestSelectOrdered expected page de with a cursor, but got %v with cursor %v", keys, cursor)
+	} else if keys, next := orderedKeys(order, 2, 0, cursor); keys != "ab" || next == "" {
+		t.Errorf("TestSelectOrdered expected page ab with a cursor, but got %v with cursor %v", keys, next)
+	}
+	// The cursor is the last entry's place in the order, so it still works once the entry is changed or deleted
+	if err := k.DeleteKey("e"); err.ID != 0 {
+		t.Fatalf("TestSelectOrdered delete error: %v", err)
+	} else if err = k.UpdateKey("d", map[string]interface{}{"level": float64(9)}); err.ID != 0 {
+		t.Fatalf("TestSelectOrdered update error: %v", err)
+	}
+	if keys, _ = orderedKeys(order, 2, 0, cursor); keys != "ab" {
+		t.Errorf("TestSelectOrdered expected page ab after the cursor's entry was deleted, but got %v", keys)
+	}
+	for item, errID := range map[string]int{"friends": helpers.ErrorInvalidItem, "profile": helpers.ErrorInvalidItem, "secret": helpers.ErrorArrayItemNotSortable} {
+		if _, _, err := k.SelectOrdered([]string{item}, keystore.KeyRange{}, nil, nil, 0, 0, ""); err.ID != errID {
+			t.Errorf("TestSelectOrdered expected error %v for %v, but got: %v", errID, item, err)
+		}
+	}
+	if _, _, err := k.SelectOrdered(order, keystore.KeyRange{}, nil, nil, 0, 0, "z"); err.ID != helpers.ErrorInvalidItemValue {
+		t.Errorf("TestSelectOrdered expected error %v, but got: %v", helpers.ErrorInvalidItemValue, err)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	k := newTestKeystore(t, "testAggregate", map[string]interface{}{
+		"change":  []interface{}{"Int16", float64(0), float64(0), float64(0), false, false, false},
+		"mmr":     []interface{}{"Uint16", float64(1500), float64(0), float64(0), false, false},
+		"ratio":   []interface{}{"Float64", float64(0), float64(0), float64(0), false, false, false},
+		"joined":  []interface{}{"Time", "RFC3339", false},
+		"profile": []interface{}{"Object", map[string]interface{}{"country": []interface{}{"String", "", float64(0), false, false, false}}},
+	}, false, true, map[string]map[string]interface{}{
+		"player0": {"change": float64(-20), "mmr": float64(1000), "ratio": 0.5, "joined": "2026-01-01T00:00:00Z", "profile": map[string]interface{}{"country": "CA"}},
+		"player1": {"change": float64(15), "mmr": float64(2000), "ratio": 1.5, "joined": "2026-03-01T00:00:00Z", "profile": map[string]interface{}{"country": "US"}},
+		"player2": {"change": float64(-5), "mmr": float64(3000), "ratio": 2.5, "joined": "2026-02-01T00:00:00Z", "profile": map[string]interface{}{"country": "CA"}},
+		"player3": {"change": float64(30), "mmr": float64(2000), "ratio": 1.5, "joined": "2026-02-01T00:00:00Z", "profile": map[string]interface{}{"country": "FR"}},
+	})
+	ops := map[string]interface{}{
+		"count":    []interface{}{},
+		"sum":      []interface{}{"change", "mmr", "ratio"},
+		"avg":      []interface{}{"mmr"},
+		"min":      []interface{}{"change", "joined"},
+		"max":      []interface{}{"mmr", "profile.country"},
+		"distinct": []interface{}{"mmr", "profile.country"},
+	}
+	r, err := k.Aggregate(keystore.KeyRange{}, nil, ops, "")
+	if err.ID != 0 {
+		t.Fatalf("TestAggregate error: %v", err)
+	}
+	joined, _ := time.Parse(time.RFC3339, "2026-01-01T00:00:00Z")
+	sum := r["sum"].(map[string]interface{})
+	min := r["min"].(map[string]interface{})
+	max := r["max"].(map[string]interface{})
+	distinct := r["distinct"].(map[string]interface{})
+	if r["count"] != uint64(4) {
+		t.Errorf("TestAggregate expected count 4, but got %v", r["count"])
+	} else if sum["change"] != int64(20) || sum["mmr"] != uint64(8000) || sum["ratio"] != float64(6) {
+		t.Errorf("TestAggregate expected sums 20, 8000, and 6, but got %v", sum)
+	} else if avg := r["avg"].(map[string]interface{})["mmr"]; avg != float64(2000) {
+		t.Errorf("TestAggregate expected avg 2000, but got %v", avg)
+	} else if min["change"] != int64(-20) || !min["joined"].(time.Time).Equal(joined) || max["mmr"] != uint64(3000) || max["profile.country"] != "US" {
+		t.Errorf("TestAggregate unexpected min %v or max %v", min, max)
+	} else if distinct["mmr"] != uint64(3) || distinct["profile.country"] != uint64(3) {
+		t.Errorf("TestAggregate expected 3 distinct values, but got %v", distinct)
+	}
+	// Groups are ordered by their value
+	r, err = k.Aggregate(keystore.KeyRange{}, map[string]interface{}{"mmr.*gte": []interface{}{2000}}, map[string]interface{}{"count": []interface{}{}, "sum": []interface{}{"mmr"}}, "profile.country")
+	if err.ID != 0 {
+		t.Fatalf("TestAggregate error: %v", err)
+	}
+	groups := r["groups"].([]map[string]interface{})
+	if len(groups) != 3 || groups[0]["group"] != "CA" || groups[1]["group"] != "FR" || groups[2]["group"] != "US" {
+		t.Fatalf("TestAggregate expected groups CA, FR, and US, but got %v", groups)
+	} else if groups[0]["count"] != uint64(1) || groups[0]["sum"].(map[string]interface{})["mmr"] != uint64(3000) {
+		t.Errorf("TestAggregate unexpected group CA: %v", groups[0])
+	}
+	// Aggregations of no entries
+	if r, err = k.Aggregate(keystore.KeyRange{Prefix: "none"}, nil, ops, ""); err.ID != 0 {
+		t.Fatalf("TestAggregate error: %v", err)
+	} else if r["count"] != uint64(0) || r["sum"].(map[string]interface{})["change"] != int64(0) || r["avg"].(map[string]interface{})["mmr"] != nil {
+		t.Errorf("TestAggregate unexpected results for no entries: %v", r)
+	}
+	for op, errID := range map[string]int{"median": helpers.ErrorInvalidMethod, "sum": helpers.ErrorInvalidMethod, "max": helpers.ErrorInvalidItem} {
+		item := "profile.country"
+		if op == "max" {
+			item = "profile"
+		}
+		if _, err = k.Aggregate(keystore.KeyRange{}, nil, map[string]interface{}{op: []interface{}{item}}, ""); err.ID != errID {
+			t.Errorf("TestAggregate expected error %v for %v, but got: %v", errID, op, err)
+		}
+	}
+	// Int64 and Uint64 sums that don't fit their type are errors
+	big := newTestKeystore(t, "testAggregateOverflow", map[string]interface{}{
+		"balance": []interface{}{"Int64", float64(0), float64(0), float64(0), false, false, false},
+		"total":   []interface{}{"Uint64", float64(0), float64(0), float64(0), false, false},
+	}, false, true, map[string]map[string]interface{}{
+		"a": {"balance": "9223372036854775807", "total": "18446744073709551615"},
+		"b": {"balance": "1", "total": "1"},
+		"c": {"balance": "-9223372036854775808", "total": "0"},
+	})
+	for _, item := range []string{"balance", "total"} {
+		if _, err = big.Aggregate(keystore.KeyRange{To: "b"}, nil, map[string]interface{}{"sum": []interface{}{item}}, ""); err.ID != helpers.ErrorSumOverflow {
+			t.Errorf("TestAggregate expected error %v for the sum of %v, but got: %v", helpers.ErrorSumOverflow, item, err)
+		}
+	}
+	if r, err = big.Aggregate(keystore.KeyRange{From: "b"}, nil, map[string]interface{}{"sum": []interface{}{"balance"}}, ""); err.ID != 0 {
+		t.Errorf("TestAggregate error: %v", err)
+	} else if sum := r["sum"].(map[string]interface{})["balance"]; sum != int64(-9223372036854775807) {
+		t.Errorf("TestAggregate expected a balance sum of -9223372036854775807, but got %v", sum)
+	}
+}
+
 // Must be last test!!
 func TestStorageShutdown(t *testing.T) {
 	storage.ShutDown()
@@ -0,0 +1,268 @@
+package keystore
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"sort"
+	"strconv"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Keystore Select   ///////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Example JSON for select query:
+//
+//     ["Select", "tableName", {"where": {"mmr.*gt": [2000]}, "items": {"mmr": []}, "limit": 10, "offset": 0, "after": "key"}]
+//
+// Keys can be limited with "prefix", "from", and "to", and selected in reverse with "reverse":
+//
+//     ["Select", "tableName", {"prefix": "match:2026-10-", "reverse": true, "limit": 10}]
+//
+// Entries can be ordered by items of the schema with "order" (see schema.Order):
+//
+//     ["Select", "tableName", {"order": ["mmr.*sortDesc", "profile.joined"], "limit": 10}]
+//
+// Entries can be aggregated instead with "aggregate", and grouped with "groupBy" (see schema.Aggregation):
+//
+//     ["Select", "tableName", {"aggregate": {"count": [], "avg": ["mmr"]}, "groupBy": "profile.country"}]
+//
+
+const scanBatch = 256 // keys read from the key index at a time
+
+// Selected is an entry found by Select, with the items that were requested
+type Selected struct {
+	Key   string
+	Items map[string]interface{}
+}
+
+// Select gets the entries that match where (see schema.Where) in order of their keys, with the items requested like
+// GetKey. Entries start after the key after (the cursor returned by the last Select, or "" to start at the first key),
+// then the first offset matches are skipped, and up to limit entries are returned (every match when limit is 0). The
+// cursor returned is the key of the last entry when limit was reached, or "" when there are no more entries.
+func (k *Keystore) Select(where map[string]interface{}, items map[string]interface{}, limit int, offset int, after string) ([]Selected, string, helpers.Error) {
+	return k.SelectRange(KeyRange{}, where, items, limit, offset, after)
+}
+
+// SelectRange is Select for the keys in r (see KeyRange), in r's order. The cursor continues in r's order, so with
+// Reverse it gets the keys before the last entry.
+func (k *Keystore) SelectRange(r KeyRange, where map[string]interface{}, items map[string]interface{}, limit int, offset int, after string) ([]Selected, string, helpers.Error) {
+	if limit < 0 || offset < 0 {
+		return nil, "", helpers.NewError(helpers.ErrorInvalidItemValue, k.name)
+	}
+	w, err := schema.NewWhere(k.schema, where)
+	if err.ID != 0 {
+		return nil, "", err
+	}
+	selected := []Selected{}
+	var cursor string
+	err = k.scan(w, r, after, func(key string, data []interface{}) (bool, helpers.Error) {
+		if offset > 0 {
+			offset--
+			return true, helpers.Error{}
+		}
+		found, gErr := k.selectItems(data, items)
+		if gErr.ID != 0 {
+			return false, gErr
+		}
+		selected = append(selected, Selected{Key: key, Items: found})
+		if limit > 0 && len(selected) == limit {
+			cursor = key
+			return false, helpers.Error{}
+		}
+		return true, helpers.Error{}
+	})
+	if err.ID != 0 {
+		return nil, "", err
+	}
+	return selected, cursor, helpers.Error{}
+}
+
+// SelectOrdered is SelectRange with the entries ordered by items of the schema (see schema.Order), then by their keys in
+// r's order. Every match is read before entries are returned. The cursor is the last entry's place in the order (see
+// schema.Order.Cursor), so the next page starts at the first match ordered after it, even if the last entry was
+// changed or deleted since. Returns helpers.ErrorInvalidItemValue if after isn't a cursor of the order.
+func (k *Keystore) SelectOrdered(order []string, r KeyRange, where map[string]interface{}, items map[string]interface{}, limit int, offset int, after string) ([]Selected, string, helpers.Error) {
+	if len(order) == 0 {
+		return k.SelectRange(r, where, items, limit, offset, after)
+	} else if limit < 0 || offset < 0 {
+		return nil, "", helpers.NewError(helpers.ErrorInvalidItemValue, k.name)
+	}
+	o, err := schema.NewOrder(k.schema, order)
+	if err.ID != 0 {
+		return nil, "", err
+	}
+	var afterValues []interface{}
+	var afterKey string
+	if after != "" {
+		var ok bool
+		if afterValues, afterKey, ok = o.ParseCursor(after); !ok {
+			return nil, "", helpers.NewError(helpers.ErrorInvalidItemValue, after)
+		}
+	}
+	w, err := schema.NewWhere(k.schema, where)
+	if err.ID != 0 {
+		return nil, "", err
+	}
+	type match struct {
+		key    string
+		values []interface{}
+	}
+	matches := []match{}
+	err = k.scan(w, r, "", func(key string, data []interface{}) (bool, helpers.Error) {
+		matches = append(matches, match{key: key, values: o.Values(data)})
+		return true, helpers.Error{}
+	})
+	if err.ID != 0 {
+		return nil, "", err
+	}
+	// Matches are in r's order, so a stable sort keeps equal entries in it
+	sort.SliceStable(matches, func(i int, j int) bool {
+		return o.Compare(matches[i].values, matches[j].values) < 0
+	})
+	if after != "" {
+		matches = matches[sort.Search(len(matches), func(i int) bool {
+			c := o.Compare(matches[i].values, afterValues)
+			return c > 0 || (c == 0 && r.follows(matches[i].key, afterKey))
+		}):]
+	}
+	if offset >= len(matches) {
+		return []Selected{}, "", helpers.Error{}
+	}
+	matches = matches[offset:]
+
+	selected := []Selected{}
+	var cursor string
+	for _, m := range matches {
+		data, ok, dErr := k.entryData(m.key)
+		if dErr != 0 {
+			return nil, "", helpers.NewError(dErr, k.name + " > " + m.key)
+		} else if !ok {
+			// Deleted since the scan
+			continue
+		}
+		found, gErr := k.selectItems(data, items)
+		if gErr.ID != 0 {
+			return nil, "", gErr
+		}
+		selected = append(selected, Selected{Key: m.key, Items: found})
+		if limit > 0 && len(selected) == limit {
+			cursor = o.Cursor(m.values, m.key)
+			break
+		}
+	}
+	return selected, cursor, helpers.Error{}
+}
+
+// Aggregate aggregates the entries in r that match where (see schema.Aggregation), grouped by the item groupBy, or
+// "" for no groups.
+func (k *Keystore) Aggregate(r KeyRange, where map[string]interface{}, ops map[string]interface{}, groupBy string) (map[string]interface{}, helpers.Error) {
+	a, err := schema.NewAggregation(k.schema, ops, groupBy)
+	if err.ID != 0 {
+		return nil, err
+	}
+	w, err := schema.NewWhere(k.schema, where)
+	if err.ID != 0 {
+		return nil, err
+	}
+	err = k.scan(w, r, "", func(key string, data []interface{}) (bool, helpers.Error) {
+		if aErr := a.Add(data); aErr.ID != 0 {
+			return false, aErr
+		}
+		return true, helpers.Error{}
+	})
+	if err.ID != 0 {
+		return nil, err
+	}
+	return a.Result(), helpers.Error{}
+}
+
+// selectItems gets the items requested by a Select from an entry's data
+func (k *Keystore) selectItems(data []interface{}, items map[string]interface{}) (map[string]interface{}, helpers.Error) {
+	var cp map[string]interface{}
+	if len(items) > 0 {
+		cp = make(map[string]interface{}, len(items))
+		for itemName, methodParams := range items {
+			cp[itemName] = methodParams
+		}
+	}
+	return k.getItems(data, cp)
+}
+
+// scan calls next with the key and data of every entry in r with a key after after that matches w, in r's order,
+// until next returns false or an error. When w has conditions on an indexed item, only the entries in their range are
+// read. Otherwise, keys come from the key index when it's on, or every key is sorted.
+func (k *Keystore) scan(w schema.Where, r KeyRange, after string, next func(key string, data []interface{}) (bool, helpers.Error)) helpers.Error {
+	keys, indexed := k.indexedKeys(w)
+	if indexed {
+		keys = r.keys(keys, after)
+	} else {
+		// Read the key index in batches, so it isn't locked while entries are read
+		for {
+			page, ok := k.keyPage(r, after, scanBatch)
+			if !ok {
+				// The key index is off, or was turned off between batches, so the rest of the keys are sorted
+				break
+			}
+			if more, err := k.scanKeys(w, page, next); err.ID != 0 || !more || len(page) < scanBatch {
+				return err
+			}
+			after = page[len(page)-1]
+		}
+		k.eMux.Lock()
+		keys = make([]string, 0, len(k.entries))
+		for key := range k.entries {
+			keys = append(keys, key)
+		}
+		k.eMux.Unlock()
+		keys = r.keys(keys, after)
+	}
+	_, err := k.scanKeys(w, keys, next)
+	return err
+}
+
+// scanKeys calls next with the key and data of the entries of keys that match w. Returns false when next does.
+func (k *Keystore) scanKeys(w schema.Where, keys []string, next func(key string, data []interface{}) (bool, helpers.Error)) (bool, helpers.Error) {
+	for _, key := range keys {
+		data, ok, err := k.entryData(key)
+		if err != 0 {
+			return false, helpers.NewError(err, k.name + " > " + key)
+		} else if !ok {
+			// Deleted since the scan started
+			continue
+		}
+		match, mErr := w.Matches(data, k.EncryptCost())
+		if mErr.ID != 0 {
+			return false, mErr
+		} else if !match {
+			continue
+		}
+		if more, nErr := next(key, data); nErr.ID != 0 || !more {
+			return false, nErr
+		}
+	}
+	return true, helpers.Error{}
+}
+
+// entryData gets a copy of an entry's data. Returns false if the entry doesn't exist.
+func (k *Keystore) entryData(key string) ([]interface{}, bool, int) {
+	e, err := k.Get(key)
+	if err != 0 {
+		return nil, false, 0
+	}
+	var data []interface{}
+	e.mux.Lock()
+	if k.dataOnDrive {
+		data, err = k.dataFromDrive(dataFolderPrefix + k.name + "/" + strconv.Itoa(int(e.persistFile)) + helpers.FileTypeStorage, e.persistIndex)
+	} else {
+		data = append([]interface{}{}, e.data...)
+	}
+	e.mux.Unlock()
+	if err != 0 {
+		if _, dErr := k.Get(key); dErr != 0 {
+			return nil, false, 0
+		}
+		return nil, false, err
+	}
+	return data, true, 0
+}
@@ -3,25 +3,47 @@ package leaderboard
 import (
 	"fmt"
 	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"os"
 	"sync"
+	"time"
 )
 
-// Potential memory leak problem? Reference: https://github.com/golang/go/wiki/SliceTricks#delete-without-preserving-order
-
 var (
 	leaderboardsMux sync.Mutex
 	leaderboards    map[string]*Leaderboard = make(map[string]*Leaderboard)
 )
 
+// Tie-break policies
+const (
+	TieBreakFirst = iota // Entries pushed first rank above later entries with the same target
+	TieBreakLast         // Entries pushed last rank above earlier entries with the same target
+	TieBreakExtra        // Entries with the same target are ranked by an item in their extra data, then by TieBreakFirst
+)
+
 type Leaderboard struct {
-	maxEntries    uint64
-	dupePushAbove bool
+	name          string
+	maxEntries    int
+	ascending     bool   // lowest targets rank first
+	tieBreak      int    // tie-break policy
+	tieItem       string // extra data item for TieBreakExtra
 	alwaysReplace bool
+	configFile    *os.File
+
+	mux       sync.Mutex
+	entries   *skipList                    // entries in order of rank
+	names     map[string]*LeaderboardEntry // index of entries by name
+	fileOn    uint16                       // partition new lines are inserted to
+	freeLines []linePos                    // deleted lines that can be used again
+	pushes    uint64                       // number of entries pushed, for ordering ties
+
+	period      int            // reset period
+	location    *time.Location // timezone periods start in
+	periodStart time.Time      // start of the current period
+	resetTimer  *time.Timer
+	closed      bool
 
-	mux     sync.Mutex
-	least   float64
-	most    float64
-	entries []*LeaderboardEntry
+	link *link // table the Leaderboard is linked to
 }
 
 // LeaderboardEntry is sorted in Leaderboard entries by the target.
@@ -29,16 +51,48 @@ type LeaderboardEntry struct {
 	name   string
 	target float64
 	extra  map[string]interface{}
+
+	seq          uint64 // order the entry was pushed in
+	persistFile  uint16
+	persistIndex uint16
+
+	linked map[string]interface{} // fields from a linked table
 }
 
-// New creates a new leaderboard.
-func New(name string, maxEntries int, dupePushAbove bool, alwaysReplace bool) (*Leaderboard, int) {
+// New creates a new leaderboard. Entries are ranked by highest target, or by lowest target if ascending is true, and
+// ties are broken with the tieBreak policy. tieItem is the extra data item used by TieBreakExtra. A new config file
+// and data folder are made for it, unless it's being restored with it's config file.
+func New(name string, configFile *os.File, maxEntries int, ascending bool, tieBreak int, tieItem string, alwaysReplace bool) (*Leaderboard, int) {
+	if len(name) == 0 {
+		return nil, helpers.ErrorTableNameRequired
+	} else if maxEntries <= 0 || tieBreak < TieBreakFirst || tieBreak > TieBreakExtra || (tieBreak == TieBreakExtra && len(tieItem) == 0) {
+		return nil, helpers.ErrorInvalidItemValue
+	}
 	leaderboardsMux.Lock()
 	if leaderboards[name] != nil {
 		leaderboardsMux.Unlock()
 		return nil, helpers.ErrorLeaderboardExists
 	}
-	lb := &Leaderboard{maxEntries: maxEntries, dupePushAbove: dupePushAbove, alwaysReplace: alwaysReplace, entries: make([]*LeaderboardEntry, 0)}
+	lb := &Leaderboard{name: name, maxEntries: maxEntries, ascending: ascending, tieBreak: tieBreak, tieItem: tieItem, alwaysReplace: alwaysReplace, names: make(map[string]*LeaderboardEntry)}
+	lb.entries = newSkipList(lb.ranksAbove)
+	if configFile == nil {
+		namePre := dataFolderPrefix + name
+		if err := storage.MakeDir(namePre); err != nil {
+			leaderboardsMux.Unlock()
+			return nil, helpers.ErrorCreatingFolder
+		}
+		var err error
+		if configFile, err = os.OpenFile(namePre + helpers.FileTypeConfig, os.O_RDWR | os.O_CREATE, 0755); err != nil {
+			leaderboardsMux.Unlock()
+			return nil, helpers.ErrorFileOpen
+		}
+		if wErr := writeConfigFile(configFile, lb.makeConfig()); wErr != 0 {
+			configFile.Close()
+			leaderboardsMux.Unlock()
+			return nil, wErr
+		}
+	}
+	lb.configFile = configFile
 	leaderboards[name] = lb
 	leaderboardsMux.Unlock()
 
@@ -57,152 +111,231 @@ func Get(name string) (*Leaderboard, int) {
 	return lb, 0
 }
 
+// Name returns the name of the leaderboard
+func (l *Leaderboard) Name() string {
+	return l.name
+}
+
 // Len returns the length of the leaderboard
 func (l *Leaderboard) Len() int {
 	l.mux.Lock()
-	length := len(l.entries)
+	length := l.entries.length
 	l.mux.Unlock()
 	return length
 }
 
+// ranksAbove is true if entry a ranks above entry b. Entries are ranked by their target, then ties are ranked by the
+// tie-break policy.
+func (l *Leaderboard) ranksAbove(a *LeaderboardEntry, b *LeaderboardEntry) bool {
+	if a.target != b.target {
+		return (a.target > b.target) != l.ascending
+	}
+	if l.tieBreak == TieBreakExtra {
+		// Ranked like targets, and entries without the item rank below ones with it
+		aItem, aOk := tieValue(a.extra[l.tieItem])
+		bItem, bOk := tieValue(b.extra[l.tieItem])
+		if aOk != bOk {
+			return aOk
+		} else if c := compareTieValues(aItem, bItem); c != 0 {
+			return (c > 0) != l.ascending
+		}
+	}
+	if a.seq != b.seq {
+		return (a.seq > b.seq) == (l.tieBreak == TieBreakLast)
+	}
+	return a.name < b.name
+}
+
+// tieValue converts an extra data item to a float64 or string for breaking ties. Returns false if the item can't be
+// used to break ties.
+func tieValue(item interface{}) (interface{}, bool) {
+	if s, ok := item.(string); ok {
+		return s, true
+	} else if n, ok := number(item); ok {
+		return n, true
+	}
+	return nil, false
+}
+
+// number converts any number type to a float64. Returns false if v isn't a number.
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// compareTieValues returns 1 if a is greater than b, -1 if a is less than b, or 0 if they're equal or can't be compared
+func compareTieValues(a interface{}, b interface{}) int {
+	switch av := a.(type) {
+	case float64:
+		if bv, ok := b.(float64); ok && av != bv {
+			if av > bv {
+				return 1
+			}
+			return -1
+		}
+	case string:
+		if bv, ok := b.(string); ok && av != bv {
+			if av > bv {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
 // GetPage gets a segment of the list for paging.
 func (l *Leaderboard) GetPage(limit int, page int) []LeaderboardEntry {
 	if page < 0 {
 		page = 0
 	}
-	var p []*LeaderboardEntry
-	// Get entries
 	l.mux.Lock()
-	if page*limit >= len(l.entries) {
-		p = make([]*LeaderboardEntry, 0)
-	} else if (page+1)*limit > len(l.entries) {
-		p = l.entries[page*limit:]
-	} else {
-		p = l.entries[page*limit : (page+1)*limit]
+	p := l.entries.slice(page*limit, limit)
+	l.mux.Unlock()
+	l.hydrate(p)
+	return p
+}
+
+// GetRank gets the rank (starting at 1) and entry for a name on the Leaderboard.
+func (l *Leaderboard) GetRank(name string) (int, LeaderboardEntry, int) {
+	l.mux.Lock()
+	pos := -1
+	var entry []LeaderboardEntry
+	if e := l.names[name]; e != nil {
+		pos = l.entries.index(e)
+		entry = []LeaderboardEntry{*e}
 	}
 	l.mux.Unlock()
-	// Convert to non-pointer list
-	cp := make([]LeaderboardEntry, len(p), len(p))
-	for i := 0; i < len(p); i++ {
-		cp[i] = *p[i]
+	if pos < 0 {
+		return 0, LeaderboardEntry{}, helpers.ErrorNoEntryFound
 	}
-	return cp
+	l.hydrate(entry)
+	return pos + 1, entry[0], 0
 }
 
-// CheckAndPush checks the target against the leaderboard, and pushes worthy entries into it. Returns true if entry was pushed to leaderboard.
-func (l *Leaderboard) CheckAndPush(name string, target float64, extra map[string]interface{}) bool {
+// GetAround gets the entry for a name on the Leaderboard, with up to n entries above and below it. Returns the rank
+// (starting at 1) of the first entry in the list.
+func (l *Leaderboard) GetAround(name string, n int) (int, []LeaderboardEntry, int) {
+	if n < 0 {
+		n = 0
+	}
 	l.mux.Lock()
-	// Check if Leaderboard is empty
-	entriesLen := len(l.entries)
-	if entriesLen == 0 {
-		newEntry := LeaderboardEntry{name: name, target: target, extra: extra}
-		l.entries = []*LeaderboardEntry{&newEntry}
-		l.least = target
-		l.most = target
+	pos := -1
+	if e := l.names[name]; e != nil {
+		pos = l.entries.index(e)
+	}
+	if pos < 0 {
 		l.mux.Unlock()
-		return true
-	}
-	// Check if entry is worthy and for previous entry by same name
-	previousPos := -1
-	var previousTarget float64 = -1
-	newPos := -1
-	if target > l.most {
-		newPos = 0
-	} else if entriesLen < l.maxEntries && target < l.least {
-		newPos = entriesLen
-	} else if entriesLen == l.maxEntries && target < l.least {
-		newPos = -2
-	}
-	for i := 0; i < entriesLen; i++ {
-		currTarget := l.entries[i].target
-		if l.entries[i].name == name {
-			previousPos = i
-			previousTarget = currTarget
-		}
-		if newPos == -1 {
-			if target > currTarget {
-				newPos = i
-			} else if target == currTarget {
-				if l.dupePushAbove {
-					newPos = i
-				} else {
-					if i == l.maxEntries-1 {
-						newPos = -2
-					} else if i == entriesLen-1 {
-						newPos = i + 1
-					} else {
-						for j := i + 1; j < entriesLen; j++ {
-							if target > l.entries[j].target {
-								newPos = j
-								break
-							} else if j == entriesLen-1 {
-								if entriesLen < l.maxEntries {
-									newPos = j + 1
-								} else {
-									newPos = -2
-								}
-							}
-						}
-					}
-				}
-			}
+		return 0, nil, helpers.ErrorNoEntryFound
+	}
+	start := pos - n
+	if start < 0 {
+		start = 0
+	}
+	entries := l.entries.slice(start, pos+n+1-start)
+	l.mux.Unlock()
+	l.hydrate(entries)
+	return start + 1, entries, 0
+}
+
+// CheckAndPush checks the target against the leaderboard, and pushes worthy entries into it. A name's previous entry is
+// only replaced by one that ranks above it, unless alwaysReplace is true. Returns true if entry was pushed to leaderboard.
+func (l *Leaderboard) CheckAndPush(name string, target float64, extra map[string]interface{}) bool {
+	l.mux.Lock()
+	newEntry := &LeaderboardEntry{name: name, target: target, extra: extra, seq: l.pushes + 1}
+	if prev := l.names[name]; prev != nil {
+		if !l.alwaysReplace && !l.ranksAbove(newEntry, prev) {
+			l.mux.Unlock()
+			return false
 		}
-		if newPos != -1 && previousPos != -1 {
-			break
+		// Replaces the previous entry and it's line
+		l.entries.remove(prev)
+		newEntry.persistFile = prev.persistFile
+		newEntry.persistIndex = prev.persistIndex
+	} else if l.entries.length >= l.maxEntries {
+		// Check against the last entry, and remove it to make room
+		last := l.entries.at(l.entries.length - 1).entry
+		if !l.ranksAbove(newEntry, last) {
+			l.mux.Unlock()
+			return false
 		}
+		l.entries.remove(last)
+		delete(l.names, last.name)
+		l.unpersist(last)
 	}
-	var onList bool
-	// Apply any changes
-	if newPos >= 0 {
-		newEntry := LeaderboardEntry{name: name, target: target, extra: extra}
-		if previousPos >= 0 {
-			if previousPos > newPos || (previousPos < newPos && l.alwaysReplace) {
-				// move previousPos to newPos
-				if previousPos < newPos {
-					newPos--
-				}
-				l.entries = append(l.entries[:previousPos], l.entries[previousPos+1:]...)
-				l.entries = append(l.entries[:newPos], append([]*LeaderboardEntry{&newEntry}, l.entries[newPos:]...)...)
-				l.least = l.entries[len(l.entries)-1].target
-				l.most = l.entries[0].target
-				onList = true
-			} else if previousPos == newPos && (previousTarget < target || l.alwaysReplace) {
-				// replace previousPos
-				l.entries[previousPos] = &newEntry
-				l.least = l.entries[len(l.entries)-1].target
-				l.most = l.entries[0].target
-				onList = true
-			}
-		} else {
-			// insert to newPos
-			l.entries = append(l.entries[:newPos], append([]*LeaderboardEntry{&newEntry}, l.entries[newPos:]...)...)
-			//remove last item if too large
-			if len(l.entries) > l.maxEntries {
-				l.entries = l.entries[:l.maxEntries]
-			}
-			l.least = l.entries[len(l.entries)-1].target
-			l.most = l.entries[0].target
-			onList = true
-		}
-	} else if previousPos >= 0 && l.alwaysReplace {
-		// move previousPos to end
-		newEntry := LeaderboardEntry{name: name, target: target, extra: extra}
-		l.entries = append(l.entries[:previousPos], l.entries[previousPos+1:]...)
-		l.entries = append(l.entries, &newEntry)
-		l.least = target
-		onList = true
+	l.pushes = newEntry.seq
+	l.entries.insert(newEntry)
+	l.names[name] = newEntry
+	l.persist(newEntry)
+	l.mux.Unlock()
+	return true
+}
+
+// Remove removes a name's entry from the Leaderboard. Returns true if the name had an entry.
+func (l *Leaderboard) Remove(name string) bool {
+	l.mux.Lock()
+	e := l.names[name]
+	if e == nil {
+		l.mux.Unlock()
+		return false
 	}
+	l.entries.remove(e)
+	delete(l.names, name)
+	l.unpersist(e)
 	l.mux.Unlock()
-	return onList
+	return true
+}
+
+// Name returns the name of the LeaderboardEntry
+func (e LeaderboardEntry) Name() string {
+	return e.name
+}
+
+// Target returns the target value the LeaderboardEntry is sorted by
+func (e LeaderboardEntry) Target() float64 {
+	return e.target
+}
+
+// Extra returns the extra data stored with the LeaderboardEntry
+func (e LeaderboardEntry) Extra() map[string]interface{} {
+	return e.extra
+}
+
+// Linked returns the fields from the LeaderboardEntry's linked table entry, or nil if the Leaderboard isn't linked
+func (e LeaderboardEntry) Linked() map[string]interface{} {
+	return e.linked
 }
 
 // Print prints the leaderboard to console.
 func (l *Leaderboard) Print() {
 	fmt.Println("=================================================")
 	l.mux.Lock()
-	fmt.Println("[ Least:", l.least, "]")
-	for i := 0; i < len(l.entries); i++ {
-		fmt.Println(l.entries[i].name, "|", l.entries[i].target, "|", l.entries[i].extra)
+	fmt.Println("[ Entries:", l.entries.length, "]")
+	for x := l.entries.head.next[0].node; x != nil; x = x.next[0].node {
+		fmt.Println(x.entry.name, "|", x.entry.target, "|", x.entry.extra)
 	}
 	l.mux.Unlock()
 	fmt.Println("=================================================")
@@ -0,0 +1,367 @@
+package leaderboard
+
+import (
+	"fmt"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/keystore"
+	"github.com/hewiefreeman/GopherDB/leaderboard"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	// Test settings
+	boardName       string = "test"
+	boardMaxEntries int    = 3
+)
+
+var (
+	// Test variables
+	board *leaderboard.Leaderboard
+)
+
+// TO TEST:
+// go test -v leaderboard_test.go
+//
+// Use -v to display fmt output
+
+func TestSetup(t *testing.T) {
+	storage.Init()
+	var err int
+	if board, err = leaderboard.New(boardName, nil, boardMaxEntries, false, leaderboard.TieBreakFirst, "", false); err != 0 {
+		t.Fatalf("Error making Leaderboard: %v", err)
+	}
+}
+
+// pages lists the names and targets on the Leaderboard
+func pages(l *leaderboard.Leaderboard) string {
+	var s string
+	for _, e := range l.GetPage(l.Len(), 0) {
+		s += fmt.Sprintf("%v:%v ", e.Name(), e.Target())
+	}
+	return s
+}
+
+func TestRestore(t *testing.T) {
+	board.CheckAndPush("Mary", 1500, map[string]interface{}{"level": float64(3)})
+	board.CheckAndPush("Harry", 1200, nil)
+	board.CheckAndPush("Vokome", 1500, nil)
+	board.CheckAndPush("Harry", 1600, nil)
+	before := pages(board)
+	board.Close(true)
+	var err helpers.Error
+	if board, err = leaderboard.Restore(boardName); err.ID != 0 {
+		t.Fatalf("Error restoring Leaderboard: %v", err)
+	}
+	if after := pages(board); after != before {
+		t.Errorf("Expected '%v' after restoring, but got '%v'", before, after)
+	}
+	if extra := board.GetPage(3, 0)[1].Extra(); extra["level"] != float64(3) {
+		t.Errorf("Expected extra data %v after restoring, but got %v", map[string]interface{}{"level": float64(3)}, extra)
+	}
+}
+
+func TestRestoreRemovedEntries(t *testing.T) {
+	// Bob and Joe push Vokome and Mary off the Leaderboard, and use their lines
+	board.CheckAndPush("Bob", 1700, nil)
+	board.CheckAndPush("Joe", 1800, nil)
+	before := pages(board)
+	board.Close(true)
+	var err helpers.Error
+	if board, err = leaderboard.Restore(boardName); err.ID != 0 {
+		t.Fatalf("Error restoring Leaderboard: %v", err)
+	}
+	if after := pages(board); after != before {
+		t.Errorf("Expected '%v' after restoring, but got '%v'", before, after)
+	}
+	f, oErr := storage.GetOpenFile("Leaderboard-" + boardName + "/0" + helpers.FileTypeStorage)
+	if oErr != 0 {
+		t.Fatalf("Error opening partition: %v", oErr)
+	} else if f.Lines() != boardMaxEntries {
+		t.Errorf("Expected %v lines in partition, but got %v", boardMaxEntries, f.Lines())
+	}
+}
+
+func TestGetRank(t *testing.T) {
+	// Board is Joe:1800 Bob:1700 Harry:1600
+	rank, e, err := board.GetRank("Bob")
+	if err != 0 {
+		t.Fatalf("Error getting rank: %v", err)
+	} else if rank != 2 || e.Name() != "Bob" || e.Target() != 1700 {
+		t.Errorf("Expected rank 2 for 'Bob' with target 1700, but got rank %v for '%v' with target %v", rank, e.Name(), e.Target())
+	}
+	if _, _, err = board.GetRank("Vokome"); err != helpers.ErrorNoEntryFound {
+		t.Errorf("Expected error %v for a name that isn't on the Leaderboard, but got %v", helpers.ErrorNoEntryFound, err)
+	}
+}
+
+func TestGetAround(t *testing.T) {
+	rank, entries, err := board.GetAround("Bob", 1)
+	if err != 0 {
+		t.Fatalf("Error getting entries around 'Bob': %v", err)
+	} else if rank != 1 || len(entries) != 3 || entries[1].Name() != "Bob" {
+		t.Errorf("Expected 3 entries from rank 1 with 'Bob' second, but got %v entries from rank %v", len(entries), rank)
+	}
+	if rank, entries, _ = board.GetAround("Joe", 1); rank != 1 || len(entries) != 2 || entries[0].Name() != "Joe" {
+		t.Errorf("Expected 2 entries from rank 1 with 'Joe' first, but got %v entries from rank %v", len(entries), rank)
+	}
+	// Harry moves above Joe
+	board.CheckAndPush("Harry", 1900, nil)
+	if rank, _, _ = board.GetRank("Harry"); rank != 1 {
+		t.Errorf("Expected rank 1 for 'Harry' after pushing, but got %v", rank)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	l, err := leaderboard.New("testOrder", nil, 100, false, leaderboard.TieBreakLast, "", false)
+	if err != 0 {
+		t.Fatalf("Error making Leaderboard: %v", err)
+	}
+	defer l.Delete()
+	for i := 0; i < 2000; i++ {
+		l.CheckAndPush("p" + strconv.Itoa(rand.Intn(300)), float64(rand.Intn(500)), nil)
+	}
+	entries := l.GetPage(l.Len(), 0)
+	if len(entries) != 100 {
+		t.Fatalf("Expected 100 entries, but got %v", len(entries))
+	}
+	for i, e := range entries {
+		if i > 0 && e.Target() > entries[i-1].Target() {
+			t.Fatalf("Entry %v (%v) is ranked below entry %v (%v)", i, e.Target(), i-1, entries[i-1].Target())
+		}
+		if rank, _, _ := l.GetRank(e.Name()); rank != i + 1 {
+			t.Fatalf("Expected rank %v for '%v', but got %v", i + 1, e.Name(), rank)
+		}
+	}
+	if page := l.GetPage(30, 3); len(page) != 10 || page[0].Name() != entries[90].Name() {
+		t.Errorf("Expected last page to have 10 entries from rank 91")
+	}
+}
+
+func TestAscending(t *testing.T) {
+	l, err := leaderboard.New("testAscending", nil, 3, true, leaderboard.TieBreakFirst, "", false)
+	if err != 0 {
+		t.Fatalf("Error making Leaderboard: %v", err)
+	}
+	defer l.Delete()
+	l.CheckAndPush("Mary", 62.5, nil)
+	l.CheckAndPush("Harry", 58, nil)
+	l.CheckAndPush("Vokome", 70, nil)
+	l.CheckAndPush("Joe", 62.5, nil)
+	l.CheckAndPush("Harry", 60, nil)
+	if p := pages(l); p != "Harry:58 Mary:62.5 Joe:62.5 " {
+		t.Errorf("Expected 'Harry:58 Mary:62.5 Joe:62.5 ', but got '%v'", p)
+	}
+}
+
+func TestTieBreakExtra(t *testing.T) {
+	if _, err := leaderboard.New("testTieBreak", nil, 5, false, leaderboard.TieBreakExtra, "", false); err != helpers.ErrorInvalidItemValue {
+		t.Fatalf("Expected error %v for TieBreakExtra without an item, but got %v", helpers.ErrorInvalidItemValue, err)
+	}
+	l, err := leaderboard.New("testTieBreak", nil, 5, false, leaderboard.TieBreakExtra, "kills", false)
+	if err != 0 {
+		t.Fatalf("Error making Leaderboard: %v", err)
+	}
+	l.CheckAndPush("Mary", 1500, map[string]interface{}{"kills": float64(3)})
+	l.CheckAndPush("Harry", 1500, nil)
+	l.CheckAndPush("Vokome", 1500, map[string]interface{}{"kills": float64(8)})
+	l.CheckAndPush("Joe", 1500, map[string]interface{}{"kills": float64(3)})
+	l.CheckAndPush("Bob", 1600, nil)
+	before := pages(l)
+	if before != "Bob:1600 Vokome:1500 Mary:1500 Joe:1500 Harry:1500 " {
+		t.Errorf("Expected 'Bob:1600 Vokome:1500 Mary:1500 Joe:1500 Harry:1500 ', but got '%v'", before)
+	}
+	l.Close(true)
+	var rErr helpers.Error
+	if l, rErr = leaderboard.Restore("testTieBreak"); rErr.ID != 0 {
+		t.Fatalf("Error restoring Leaderboard: %v", rErr)
+	}
+	defer l.Delete()
+	if after := pages(l); after != before {
+		t.Errorf("Expected '%v' after restoring, but got '%v'", before, after)
+	}
+}
+
+func TestReset(t *testing.T) {
+	l, err := leaderboard.New("testReset", nil, 5, false, leaderboard.TieBreakFirst, "", false)
+	if err != 0 {
+		t.Fatalf("Error making Leaderboard: %v", err)
+	}
+	if err = l.SetResetPeriod(leaderboard.ResetDaily, "Nowhere/Nope"); err != helpers.ErrorInvalidItemValue {
+		t.Errorf("Expected error %v for an unknown timezone, but got %v", helpers.ErrorInvalidItemValue, err)
+	}
+	if err = l.SetResetPeriod(leaderboard.ResetDaily, "UTC"); err != 0 {
+		t.Fatalf("Error setting reset period: %v", err)
+	}
+	l.CheckAndPush("Mary", 1500, nil)
+	l.CheckAndPush("Harry", 1200, nil)
+	l.Close(true)
+	// Make the period end while the Leaderboard is closed
+	configFile := "Leaderboard-testReset" + helpers.FileTypeConfig
+	b, rErr := ioutil.ReadFile(configFile)
+	if rErr != nil {
+		t.Fatalf("Error reading config file: %v", rErr)
+	}
+	var conf map[string]interface{}
+	helpers.Fjson.Unmarshal(b, &conf)
+	conf["PeriodStart"] = "2020-01-06T00:00:00Z"
+	b, _ = helpers.Fjson.Marshal(conf)
+	ioutil.WriteFile(configFile, b, 0755)
+
+	var lErr helpers.Error
+	if l, lErr = leaderboard.Restore("testReset"); lErr.ID != 0 {
+		t.Fatalf("Error restoring Leaderboard: %v", lErr)
+	}
+	defer l.Delete()
+	if l.Len() != 0 {
+		t.Errorf("Expected Leaderboard to be reset, but it has %v entries", l.Len())
+	}
+	if _, _, start := l.ResetPeriod(); !start.Equal(time.Now().UTC().Truncate(24 * time.Hour)) {
+		t.Errorf("Expected current period to start at %v, but got %v", time.Now().UTC().Truncate(24 * time.Hour), start)
+	}
+	if archives := l.Archives(); len(archives) != 1 || archives[0] != "2020-01-06" {
+		t.Fatalf("Expected archive '2020-01-06', but got %v", archives)
+	}
+	entries, aErr := l.GetArchive("2020-01-06")
+	if aErr != 0 {
+		t.Fatalf("Error getting archive: %v", aErr)
+	} else if len(entries) != 2 || entries[0].Name() != "Mary" || entries[1].Name() != "Harry" {
+		t.Errorf("Expected archive to have Mary then Harry, but got %v", entries)
+	}
+	// New entries start in an empty partition
+	l.CheckAndPush("Joe", 1000, nil)
+	if f, _ := storage.GetOpenFile("Leaderboard-testReset/0" + helpers.FileTypeStorage); f == nil || f.Lines() != 1 {
+		t.Errorf("Expected 1 line in partition after resetting")
+	}
+}
+
+func TestLink(t *testing.T) {
+	s, sErr := schema.New(map[string]interface{}{
+		"mmr":  []interface{}{"Uint16", float64(1500), float64(0), float64(0), false, false},
+		"nick": []interface{}{"String", "", float64(0), false, false, false},
+	}, false)
+	if sErr.ID != 0 {
+		t.Fatalf("Error making schema: %v", sErr)
+	}
+	k, kErr := keystore.New("testLinkKS", nil, s, 0, false, true)
+	if kErr.ID != 0 {
+		t.Fatalf("Error making Keystore: %v", kErr)
+	}
+	defer k.Delete()
+	l, err := leaderboard.New("testLink", nil, 5, false, leaderboard.TieBreakFirst, "", false)
+	if err != 0 {
+		t.Fatalf("Error making Leaderboard: %v", err)
+	}
+	defer l.Delete()
+	if err = l.Link("testLinkKS", "nick", nil); err != helpers.ErrorInvalidItem {
+		t.Errorf("Expected error %v for linking a String item, but got %v", helpers.ErrorInvalidItem, err)
+	}
+	if err = l.Link("testLinkKS", "mmr", []string{"nick"}); err != 0 {
+		t.Fatalf("Error linking Leaderboard: %v", err)
+	}
+	k.InsertKey("Mary", map[string]interface{}{"mmr": float64(1600), "nick": "mare"})
+	k.InsertKey("Harry", map[string]interface{}{"nick": "harr"})
+	k.UpdateKey("Harry", map[string]interface{}{"mmr": float64(1700)})
+	k.UpdateKey("Mary", map[string]interface{}{"nick": "mary"})
+	if p := pages(l); p != "Harry:1700 Mary:1600 " {
+		t.Errorf("Expected 'Harry:1700 Mary:1600 ', but got '%v'", p)
+	}
+	if e := l.GetPage(5, 0); len(e) != 2 || e[1].Linked()["nick"] != "mary" {
+		t.Errorf("Expected Mary's linked nick to be 'mary', but got %v", e)
+	}
+	k.DeleteKey("Harry")
+	if p := pages(l); p != "Mary:1600 " {
+		t.Errorf("Expected 'Mary:1600 ' after deleting Harry, but got '%v'", p)
+	}
+	// Int64 items are stored as decimal strings, and still push their values
+	s, sErr = schema.New(map[string]interface{}{
+		"xp": []interface{}{"Int64", float64(0), float64(0), float64(0), false, false, false},
+	}, false)
+	if sErr.ID != 0 {
+		t.Fatalf("Error making schema: %v", sErr)
+	}
+	k64, kErr := keystore.New("testLinkKS64", nil, s, 0, false, true)
+	if kErr.ID != 0 {
+		t.Fatalf("Error making Keystore: %v", kErr)
+	}
+	defer k64.Delete()
+	if err = l.Link("testLinkKS64", "xp", nil); err != 0 {
+		t.Fatalf("Error linking Leaderboard: %v", err)
+	}
+	l.Remove("Mary")
+	k64.InsertKey("Anna", map[string]interface{}{"xp": "9000000000"})
+	k64.InsertKey("Bob", map[string]interface{}{"xp": float64(-5)})
+	k64.UpdateKey("Bob", map[string]interface{}{"xp": float64(12)})
+	if p := pages(l); p != "Anna:9e+09 Bob:12 " {
+		t.Errorf("Expected 'Anna:9e+09 Bob:12 ', but got '%v'", p)
+	}
+}
+
+// Must be last test!!
+func TestDelete(t *testing.T) {
+	if err := board.Delete(); err != 0 {
+		t.Errorf("Error deleting Leaderboard: %v", err)
+	}
+	storage.ShutDown()
+}
+
+// go test leaderboard_test.go -run=NONE -bench=.
+//
+// Costs should grow with the log of the Leaderboard's size
+func BenchmarkCheckAndPush(b *testing.B) {
+	benchBoards(b, func(b *testing.B, l *leaderboard.Leaderboard, size int) {
+		for i := 0; i < b.N; i++ {
+			l.CheckAndPush("new" + strconv.Itoa(i), rand.Float64() * float64(size * 2), nil)
+		}
+	})
+}
+
+func BenchmarkGetRank(b *testing.B) {
+	benchBoards(b, func(b *testing.B, l *leaderboard.Leaderboard, size int) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := l.GetRank("p" + strconv.Itoa(i % size)); err != 0 {
+				b.Fatalf("Error getting rank: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkGetPage(b *testing.B) {
+	benchBoards(b, func(b *testing.B, l *leaderboard.Leaderboard, size int) {
+		for i := 0; i < b.N; i++ {
+			if len(l.GetPage(10, (i % size) / 10)) == 0 {
+				b.Fatalf("Page %v is empty", (i % size) / 10)
+			}
+		}
+	})
+}
+
+// benchBoards runs a benchmark on full Leaderboards of growing sizes
+func benchBoards(b *testing.B, bench func(b *testing.B, l *leaderboard.Leaderboard, size int)) {
+	for _, size := range []int{1000, 10000, 100000} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			storage.Init()
+			// Measure the Leaderboard rather than the disk's sync speed, or reopening partitions
+			storage.SetMaxOpenFiles(uint16(size / int(helpers.DefaultPartitionMax)) + 1)
+			storage.SetFolderDurability("Leaderboard-bench", storage.DurabilityBuffered)
+			defer storage.SetFolderDurability("Leaderboard-bench", storage.DurabilityDefault)
+			l, err := leaderboard.New("bench", nil, size, false, leaderboard.TieBreakFirst, "", false)
+			if err != 0 {
+				b.Fatalf("Error making Leaderboard: %v", err)
+			}
+			for i := 0; i < size; i++ {
+				l.CheckAndPush("p" + strconv.Itoa(i), float64(rand.Intn(size * 2)), nil)
+			}
+			b.ResetTimer()
+			bench(b, l, size)
+			b.StopTimer()
+			l.Delete()
+			storage.ShutDown()
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package leaderboard
+
+import (
+	"github.com/hewiefreeman/GopherDB/authtable"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/keystore"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"strconv"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Linked Leaderboards   ///////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A Leaderboard linked to a numeric item of a Keystore or AuthTable is pushed to with an item hook on the table, so
+// entries are named by their key (or user name) and targeted by the item's value. Linked fields are read from the
+// table when entries are retrieved, instead of being copied into an entry's extra data where they'd get stale.
+
+type link struct {
+	table  string
+	item   string
+	fields []string
+}
+
+// Link links the Leaderboard to a numeric item of a Keystore or AuthTable. Every insert or update that sets the item
+// pushes the entry's key (or user name) with the item's value as it's target, and entries deleted from the table are
+// removed from the Leaderboard. Entries retrieved with GetPage, GetAround, and GetRank have the items named in fields
+// from their table entry. A Leaderboard can only be linked to one table.
+func (l *Leaderboard) Link(table string, item string, fields []string) int {
+	s, ok := linkSchema(table)
+	if !ok {
+		return helpers.ErrorTableDoesntExist
+	} else if si := s[item]; !si.QuickValidate() || !si.IsNumeric() {
+		return helpers.ErrorInvalidItem
+	}
+	for _, field := range fields {
+		if !s[field].QuickValidate() {
+			return helpers.ErrorInvalidItem
+		}
+	}
+	l.removeLinkHook()
+	l.mux.Lock()
+	l.link = &link{table: table, item: item, fields: append([]string{}, fields...)}
+	if err := writeConfigFile(l.configFile, l.makeConfig()); err != 0 {
+		l.link = nil
+		l.mux.Unlock()
+		helpers.LogAndPrint("Failed to link Leaderboard '" + l.name + "' with error code: " + strconv.Itoa(err), 4)
+		return err
+	}
+	l.mux.Unlock()
+	return l.setLinkHook()
+}
+
+// Unlink removes the Leaderboard's link to a table. Entries pushed by the table stay on the Leaderboard.
+func (l *Leaderboard) Unlink() int {
+	l.removeLinkHook()
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.link = nil
+	if err := writeConfigFile(l.configFile, l.makeConfig()); err != 0 {
+		helpers.LogAndPrint("Failed to unlink Leaderboard '" + l.name + "' with error code: " + strconv.Itoa(err), 4)
+		return err
+	}
+	return 0
+}
+
+// Linked gets the name, item, and fields of the table the Leaderboard is linked to. The name is empty if it isn't
+// linked.
+func (l *Leaderboard) Linked() (string, string, []string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.link == nil {
+		return "", "", nil
+	}
+	return l.link.table, l.link.item, append([]string{}, l.link.fields...)
+}
+
+// linkSchema gets the schema of a Keystore or AuthTable
+func linkSchema(table string) (schema.Schema, bool) {
+	if k := keystore.Get(table); k != nil {
+		return k.Schema(), true
+	} else if t := authtable.Get(table); t != nil {
+		return t.Schema(), true
+	}
+	return nil, false
+}
+
+// hookID is the id of the Leaderboard's item hook on it's linked table
+func (l *Leaderboard) hookID() string {
+	return dataFolderPrefix + l.name
+}
+
+func (l *Leaderboard) setLinkHook() int {
+	l.mux.Lock()
+	lk := l.link
+	l.mux.Unlock()
+	if lk == nil {
+		return 0
+	}
+	s, ok := linkSchema(lk.table)
+	if !ok {
+		return helpers.ErrorTableDoesntExist
+	}
+	si := s[lk.item]
+	push := func(name string, value interface{}) {
+		l.linkedPush(si, name, value)
+	}
+	if k := keystore.Get(lk.table); k != nil {
+		return k.SetItemHook(l.hookID(), lk.item, push)
+	} else if t := authtable.Get(lk.table); t != nil {
+		return t.SetItemHook(l.hookID(), lk.item, lk.fields, push)
+	}
+	return helpers.ErrorTableDoesntExist
+}
+
+func (l *Leaderboard) removeLinkHook() {
+	l.mux.Lock()
+	lk := l.link
+	l.mux.Unlock()
+	if lk == nil {
+		return
+	}
+	if k := keystore.Get(lk.table); k != nil {
+		k.RemoveItemHook(l.hookID())
+	} else if t := authtable.Get(lk.table); t != nil {
+		t.RemoveItemHook(l.hookID())
+	}
+}
+
+// linkedPush is the item hook for the linked table's item si
+func (l *Leaderboard) linkedPush(si schema.SchemaItem, name string, value interface{}) {
+	if value == nil {
+		l.Remove(name)
+		return
+	}
+	if target, ok := si.Float64(value); ok {
+		l.CheckAndPush(name, target, nil)
+	}
+}
+
+// hydrate gets the linked fields for entries from their table entries. Entries that aren't in the table are left
+// without linked fields.
+func (l *Leaderboard) hydrate(entries []LeaderboardEntry) {
+	l.mux.Lock()
+	lk := l.link
+	l.mux.Unlock()
+	if lk == nil || len(lk.fields) == 0 {
+		return
+	}
+	k := keystore.Get(lk.table)
+	t := authtable.Get(lk.table)
+	for i := range entries {
+		var items map[string]interface{}
+		var err helpers.Error
+		if k != nil {
+			items = make(map[string]interface{}, len(lk.fields))
+			for _, field := range lk.fields {
+				items[field] = nil
+			}
+			items, err = k.GetKey(entries[i].name, items)
+		} else if t != nil {
+			items, err = t.GetHookedData(l.hookID(), entries[i].name)
+		} else {
+			return
+		}
+		if err.ID == 0 {
+			entries[i].linked = items
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Leaderboard Persistence   ///////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A Leaderboard's settings are kept in it's config file, and each entry is a line in one of the partitions in it's
+// data folder. Since a Leaderboard never holds more than maxEntries entries, lines of entries that fall off of it are
+// used again by new entries instead of being compacted.
+
+// File/folder prefixes
+const (
+	dataFolderPrefix = "Leaderboard-"
+)
+
+// linePos is the partition and line number of an entry
+type linePos struct {
+	file uint16
+	line uint16
+}
+
+type jsonEntry struct {
+	N string
+	T float64
+	E map[string]interface{}
+	S uint64
+}
+
+type leaderboardConfig struct {
+	Name          string
+	MaxEntries    int
+	Ascending     bool
+	TieBreak      int
+	TieItem       string
+	AlwaysReplace bool
+	FileOn        uint16
+	Period        int
+	Timezone      string
+	PeriodStart   time.Time
+	LinkTable     string
+	LinkItem      string
+	LinkFields    []string
+
+	DupePushAbove bool `json:",omitempty"` // Config files made before tie-break policies use TieBreakLast when true
+}
+
+// makeConfig makes the Leaderboard's config. l.mux must be locked.
+func (l *Leaderboard) makeConfig() leaderboardConfig {
+	var timezone string
+	if l.location != nil {
+		timezone = l.location.String()
+	}
+	var lk link
+	if l.link != nil {
+		lk = *l.link
+	}
+	return leaderboardConfig{
+		Name:          l.name,
+		MaxEntries:    l.maxEntries,
+		Ascending:     l.ascending,
+		TieBreak:      l.tieBreak,
+		TieItem:       l.tieItem,
+		AlwaysReplace: l.alwaysReplace,
+		FileOn:        l.fileOn,
+		Period:        l.period,
+		Timezone:      timezone,
+		PeriodStart:   l.periodStart,
+		LinkTable:     lk.table,
+		LinkItem:      lk.item,
+		LinkFields:    lk.fields,
+	}
+}
+
+// Writes c to f and truncates file
+func writeConfigFile(f *os.File, c leaderboardConfig) int {
+	jBytes, jErr := helpers.Fjson.MarshalIndent(c, "", "   ")
+	if jErr != nil {
+		return helpers.ErrorJsonEncoding
+	}
+	if _, wErr := f.WriteAt(jBytes, 0); wErr != nil {
+		return helpers.ErrorFileUpdate
+	}
+	f.Truncate(int64(len(jBytes)))
+	return 0
+}
+
+// partitionName makes the name of a partition in the Leaderboard's data folder
+func (l *Leaderboard) partitionName(fileNum uint16) string {
+	return dataFolderPrefix + l.name + "/" + strconv.Itoa(int(fileNum)) + helpers.FileTypeStorage
+}
+
+// persist writes a pushed entry to the entry's line, a deleted line, or a new line. l.mux must be locked.
+func (l *Leaderboard) persist(e *LeaderboardEntry) {
+	jBytes, jErr := helpers.Fjson.Marshal(jsonEntry{N: e.name, T: e.target, E: e.extra, S: e.seq})
+	if jErr != nil {
+		helpers.LogAndPrint("Leaderboard '" + l.name + "' failed to encode entry '" + e.name + "'", 4)
+		return
+	}
+	if e.persistIndex == 0 && len(l.freeLines) > 0 {
+		free := l.freeLines[len(l.freeLines)-1]
+		l.freeLines = l.freeLines[:len(l.freeLines)-1]
+		e.persistFile, e.persistIndex = free.file, free.line
+	}
+	if e.persistIndex > 0 {
+		if err := storage.Update(l.partitionName(e.persistFile), e.persistIndex, jBytes); err != 0 {
+			helpers.LogAndPrint("Leaderboard '" + l.name + "' failed to store entry '" + e.name + "' with error code: " + strconv.Itoa(err), 4)
+		}
+		return
+	}
+	lineOn, err := storage.Insert(l.partitionName(l.fileOn), jBytes)
+	if err != 0 {
+		helpers.LogAndPrint("Leaderboard '" + l.name + "' failed to store entry '" + e.name + "' with error code: " + strconv.Itoa(err), 4)
+		return
+	}
+	e.persistFile, e.persistIndex = l.fileOn, lineOn
+	// Increase fileOn when the index has reached or surpassed partitionMax
+	if lineOn >= helpers.DefaultPartitionMax {
+		l.fileOn++
+		writeConfigFile(l.configFile, l.makeConfig())
+	}
+}
+
+// unpersist deletes the line of an entry that was removed from the Leaderboard. l.mux must be locked.
+func (l *Leaderboard) unpersist(e *LeaderboardEntry) {
+	if e.persistIndex == 0 {
+		return
+	}
+	if err := storage.Update(l.partitionName(e.persistFile), e.persistIndex, []byte{}); err != 0 {
+		helpers.LogAndPrint("Leaderboard '" + l.name + "' failed to delete entry '" + e.name + "' with error code: " + strconv.Itoa(err), 4)
+		return
+	}
+	l.freeLines = append(l.freeLines, linePos{e.persistFile, e.persistIndex})
+}
+
+// Close closes a Leaderboard and saves it's settings to it's config file if save is true.
+func (l *Leaderboard) Close(save bool) {
+	l.removeLinkHook()
+	l.mux.Lock()
+	l.closed = true
+	l.scheduleReset()
+	if save {
+		if err := writeConfigFile(l.configFile, l.makeConfig()); err != 0 {
+			helpers.LogAndPrint("Failed to write config file for Leaderboard '" + l.name + "' while closing, with error code: " + strconv.Itoa(err), 5)
+		}
+	}
+	l.mux.Unlock()
+	leaderboardsMux.Lock()
+	delete(leaderboards, l.name)
+	leaderboardsMux.Unlock()
+	l.configFile.Close()
+	storage.CloseFiles(dataFolderPrefix + l.name)
+	storage.CloseWAL(dataFolderPrefix + l.name)
+}
+
+// Delete closes a Leaderboard and deletes it's config file and data folder.
+func (l *Leaderboard) Delete() int {
+	l.Close(false)
+	if err := os.RemoveAll(dataFolderPrefix + l.name); err != nil {
+		helpers.LogAndPrint("Failed delete Leaderboard '" + l.name + "' with error: " + err.Error(), 5)
+		return helpers.ErrorFileDelete
+	}
+	if err := os.Remove(dataFolderPrefix + l.name + helpers.FileTypeConfig); err != nil {
+		helpers.LogAndPrint("Failed delete Leaderboard '" + l.name + "' with error: " + err.Error(), 5)
+		return helpers.ErrorFileDelete
+	}
+	return 0
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Leaderboard Restoring   /////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Restore restores a Leaderboard by name; requires a valid config file and data folder. Entries are put back in
+// the order they were ranked in before the Leaderboard closed.
+func Restore(name string) (*Leaderboard, helpers.Error) {
+	fmt.Printf("Restoring Leaderboard '%v'...\n", name)
+	namePre := dataFolderPrefix + name
+	f, err := os.OpenFile(namePre + helpers.FileTypeConfig, os.O_RDWR, 0755)
+	if err != nil {
+		return nil, helpers.NewError(helpers.ErrorFileOpen, "Config file missing for Leaderboard '" + name + "'")
+	}
+	b, rErr := ioutil.ReadAll(f)
+	if rErr != nil {
+		f.Close()
+		return nil, helpers.NewError(helpers.ErrorFileRead, "Config data is corrupt for Leaderboard '" + name + "'")
+	}
+	var conf leaderboardConfig
+	if mErr := json.Unmarshal(b, &conf); mErr != nil {
+		f.Close()
+		return nil, helpers.NewError(helpers.ErrorJsonDecoding, "Config contains JSON syntax errors for Leaderboard '" + name + "': " + mErr.Error())
+	}
+	// Apply writes left in the write-ahead log
+	if wErr := storage.ReplayWAL(namePre); wErr != 0 {
+		f.Close()
+		return nil, helpers.NewError(wErr, "Could not replay write-ahead log for Leaderboard '" + name + "'")
+	}
+	files, dErr := ioutil.ReadDir(namePre)
+	if dErr != nil {
+		f.Close()
+		return nil, helpers.NewError(helpers.ErrorFileOpen, "Missing data folder for Leaderboard '" + name + "'")
+	}
+	if conf.DupePushAbove {
+		conf.TieBreak = TieBreakLast
+	}
+	l, lErr := New(name, f, conf.MaxEntries, conf.Ascending, conf.TieBreak, conf.TieItem, conf.AlwaysReplace)
+	if lErr != 0 {
+		f.Close()
+		return nil, helpers.NewError(lErr, name)
+	}
+	if conf.Period != ResetNever {
+		if l.location, err = time.LoadLocation(conf.Timezone); err != nil {
+			l.Close(false)
+			return nil, helpers.NewError(helpers.ErrorInvalidItemValue, "Unknown timezone '" + conf.Timezone + "' for Leaderboard '" + name + "'")
+		}
+		l.period = conf.Period
+		l.periodStart = conf.PeriodStart
+	}
+	if len(conf.LinkTable) > 0 {
+		l.link = &link{table: conf.LinkTable, item: conf.LinkItem, fields: conf.LinkFields}
+	}
+	l.mux.Lock()
+	l.fileOn = conf.FileOn
+	// Read every entry
+	for _, fileStats := range files {
+		fileNum, fnErr := strconv.Atoi(strings.TrimSuffix(fileStats.Name(), helpers.FileTypeStorage))
+		if fnErr != nil || !strings.HasSuffix(fileStats.Name(), helpers.FileTypeStorage) {
+			// Not a valid storage file
+			continue
+		}
+		of, oErr := storage.GetOpenFile(namePre + "/" + fileStats.Name())
+		if oErr != 0 {
+			helpers.LogAndPrint("Error: Leaderboard '" + name + "':: Could not read data file '" + namePre + "/" + fileStats.Name() + "'!\n", 4)
+			continue
+		}
+		for i := 1; i <= of.Lines(); i++ {
+			lb, lErr := of.Read(uint16(i))
+			if lErr != 0 {
+				helpers.LogAndPrint("Error: Leaderboard '" + name + "':: Could not read line " + strconv.Itoa(i) + " of '" + fileStats.Name() + "', with error code " + strconv.Itoa(lErr) + "!\n", 4)
+				continue
+			}
+			pos := linePos{uint16(fileNum), uint16(i)}
+			if len(lb) == 0 {
+				// Deleted line
+				l.freeLines = append(l.freeLines, pos)
+				continue
+			}
+			var jEntry jsonEntry
+			if jErr := json.Unmarshal(lb, &jEntry); jErr != nil || len(jEntry.N) == 0 {
+				helpers.LogAndPrint("Error: Leaderboard '" + name + "':: Incorrect entry format on line " + strconv.Itoa(i) + " of '" + fileStats.Name() + "'!\n", 4)
+				continue
+			}
+			e := &LeaderboardEntry{name: jEntry.N, target: jEntry.T, extra: jEntry.E, seq: jEntry.S, persistFile: pos.file, persistIndex: pos.line}
+			if jEntry.S > l.pushes {
+				l.pushes = jEntry.S
+			}
+			// Only the newest entry for a name is kept
+			if prev := l.names[e.name]; prev != nil {
+				if prev.seq > e.seq {
+					prev, e = e, prev
+				}
+				l.unpersist(prev)
+			}
+			l.names[e.name] = e
+		}
+	}
+	// Entries are ranked by target, with ties in the order they were pushed
+	for _, e := range l.names {
+		l.entries.insert(e)
+	}
+	// Entries past maxEntries are removed, like when it's been lowered
+	for l.entries.length > l.maxEntries {
+		last := l.entries.at(l.entries.length - 1).entry
+		l.entries.remove(last)
+		delete(l.names, last.name)
+		l.unpersist(last)
+	}
+	// Resets if the period ended while the Leaderboard was closed
+	l.resetIfEnded()
+	l.mux.Unlock()
+	if err := l.setLinkHook(); err != 0 {
+		helpers.LogAndPrint("Leaderboard '" + name + "' could not link to table '" + conf.LinkTable + "' with error code: " + strconv.Itoa(err), 4)
+	}
+	fmt.Printf("Successfully restored table '%v'!\n", name)
+	return l, helpers.Error{}
+}
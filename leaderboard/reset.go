@@ -0,0 +1,235 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Leaderboard Resetting   /////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A Leaderboard with a reset period is reset when each period ends, at midnight in it's timezone. The finished period's
+// final standings are written to an archive in the Leaderboard's data folder, named by the date the period started,
+// then every entry is removed.
+
+// Reset periods
+const (
+	ResetNever   = iota
+	ResetDaily   // Periods start every day
+	ResetWeekly  // Periods start every Monday
+	ResetMonthly // Periods start on the first day of every month
+)
+
+const (
+	archiveFolder     = "Archives"
+	archiveDateFormat = "2006-01-02"
+	archiveFileType   = ".json"
+	archiveRetryTime  = time.Minute // time to wait before trying to reset again when archiving fails
+)
+
+type archive struct {
+	Start   time.Time
+	End     time.Time
+	Entries []jsonEntry
+}
+
+// SetResetPeriod sets how often the Leaderboard is reset, and the timezone (an IANA Time Zone name like
+// "America/New_York", or "UTC") periods start in. The current period starts at the beginning of the period that
+// includes now. ResetNever stops the Leaderboard from being reset.
+func (l *Leaderboard) SetResetPeriod(period int, timezone string) int {
+	if period < ResetNever || period > ResetMonthly {
+		return helpers.ErrorInvalidItemValue
+	}
+	loc, lErr := time.LoadLocation(timezone)
+	if lErr != nil {
+		return helpers.ErrorInvalidItemValue
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.period = period
+	l.location = loc
+	l.periodStart = time.Time{}
+	if period != ResetNever {
+		l.periodStart = periodStart(time.Now(), period, loc)
+	}
+	if err := writeConfigFile(l.configFile, l.makeConfig()); err != 0 {
+		helpers.LogAndPrint("Failed to set reset period for Leaderboard '" + l.name + "' with error code: " + strconv.Itoa(err), 4)
+		return err
+	}
+	l.scheduleReset()
+	return 0
+}
+
+// ResetPeriod gets the Leaderboard's reset period, timezone, and the time the current period started
+func (l *Leaderboard) ResetPeriod() (int, string, time.Time) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.location == nil {
+		return l.period, "UTC", l.periodStart
+	}
+	return l.period, l.location.String(), l.periodStart
+}
+
+// periodStart gets the start of the period that includes t
+func periodStart(t time.Time, period int, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch period {
+	case ResetWeekly:
+		return time.Date(t.Year(), t.Month(), t.Day() - (int(t.Weekday()) + 6) % 7, 0, 0, 0, 0, loc)
+	case ResetMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// periodEnd gets the end of the period that started at start
+func periodEnd(start time.Time, period int) time.Time {
+	switch period {
+	case ResetWeekly:
+		return start.AddDate(0, 0, 7)
+	case ResetMonthly:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// scheduleReset starts a timer for the end of the current period, stopping the last one. l.mux must be locked.
+func (l *Leaderboard) scheduleReset() {
+	if l.resetTimer != nil {
+		l.resetTimer.Stop()
+		l.resetTimer = nil
+	}
+	if l.period == ResetNever || l.closed {
+		return
+	}
+	l.resetTimer = time.AfterFunc(time.Until(periodEnd(l.periodStart, l.period)), l.reset)
+}
+
+// reset is run by the reset timer
+func (l *Leaderboard) reset() {
+	l.mux.Lock()
+	l.resetIfEnded()
+	l.mux.Unlock()
+}
+
+// resetIfEnded archives and clears the Leaderboard if it's period has ended, then schedules the next reset. l.mux must
+// be locked.
+func (l *Leaderboard) resetIfEnded() {
+	if l.period == ResetNever || l.closed {
+		return
+	}
+	now := time.Now()
+	end := periodEnd(l.periodStart, l.period)
+	if now.Before(end) {
+		// Timer fired early
+		l.scheduleReset()
+		return
+	}
+	if err := l.writeArchive(end); err != 0 {
+		helpers.LogAndPrint("Leaderboard '" + l.name + "' failed to archive period starting " + l.periodStart.Format(archiveDateFormat) + " with error code: " + strconv.Itoa(err), 5)
+		l.resetTimer = time.AfterFunc(archiveRetryTime, l.reset)
+		return
+	}
+	l.clear()
+	l.periodStart = periodStart(now, l.period, l.location)
+	if err := writeConfigFile(l.configFile, l.makeConfig()); err != 0 {
+		helpers.LogAndPrint("Failed to write config file for Leaderboard '" + l.name + "' after resetting, with error code: " + strconv.Itoa(err), 5)
+	}
+	l.scheduleReset()
+}
+
+// writeArchive writes the Leaderboard's standings to the current period's archive. l.mux must be locked.
+func (l *Leaderboard) writeArchive(end time.Time) int {
+	a := archive{Start: l.periodStart, End: end, Entries: make([]jsonEntry, 0, l.entries.length)}
+	for x := l.entries.head.next[0].node; x != nil; x = x.next[0].node {
+		a.Entries = append(a.Entries, jsonEntry{N: x.entry.name, T: x.entry.target, E: x.entry.extra, S: x.entry.seq})
+	}
+	jBytes, jErr := helpers.Fjson.Marshal(a)
+	if jErr != nil {
+		return helpers.ErrorJsonEncoding
+	}
+	folder := dataFolderPrefix + l.name + "/" + archiveFolder
+	if err := storage.MakeDir(folder); err != nil {
+		return helpers.ErrorCreatingFolder
+	}
+	file := folder + "/" + l.periodStart.Format(archiveDateFormat) + archiveFileType
+	if err := ioutil.WriteFile(file + ".tmp", jBytes, 0755); err != nil {
+		return helpers.ErrorFileWrite
+	}
+	if err := os.Rename(file + ".tmp", file); err != nil {
+		return helpers.ErrorFileWrite
+	}
+	return 0
+}
+
+// clear removes every entry, and compacts the partitions they were in. l.mux must be locked.
+func (l *Leaderboard) clear() {
+	files := make(map[uint16]bool)
+	for x := l.entries.head.next[0].node; x != nil; x = x.next[0].node {
+		if x.entry.persistIndex == 0 {
+			continue
+		}
+		if err := storage.Update(l.partitionName(x.entry.persistFile), x.entry.persistIndex, []byte{}); err != 0 {
+			helpers.LogAndPrint("Leaderboard '" + l.name + "' failed to delete entry '" + x.entry.name + "' with error code: " + strconv.Itoa(err), 4)
+		}
+		files[x.entry.persistFile] = true
+	}
+	for _, pos := range l.freeLines {
+		files[pos.file] = true
+	}
+	for file := range files {
+		if _, err := storage.Compact(l.partitionName(file)); err != 0 {
+			helpers.LogAndPrint("Leaderboard '" + l.name + "' failed to compact '" + l.partitionName(file) + "' with error code: " + strconv.Itoa(err), 4)
+		}
+	}
+	l.entries = newSkipList(l.ranksAbove)
+	l.names = make(map[string]*LeaderboardEntry)
+	l.freeLines = nil
+	l.fileOn = 0
+}
+
+// Archives lists the dates (as "2006-01-02") of the periods the Leaderboard has archived, from oldest to newest.
+func (l *Leaderboard) Archives() []string {
+	files, err := ioutil.ReadDir(dataFolderPrefix + l.name + "/" + archiveFolder)
+	if err != nil {
+		return []string{}
+	}
+	dates := make([]string, 0, len(files))
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), archiveFileType) {
+			dates = append(dates, strings.TrimSuffix(f.Name(), archiveFileType))
+		}
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+// GetArchive gets the final standings of the period that started on date (as "2006-01-02").
+func (l *Leaderboard) GetArchive(date string) ([]LeaderboardEntry, int) {
+	if _, tErr := time.Parse(archiveDateFormat, date); tErr != nil {
+		return nil, helpers.ErrorInvalidItemValue
+	}
+	b, err := ioutil.ReadFile(dataFolderPrefix + l.name + "/" + archiveFolder + "/" + date + archiveFileType)
+	if os.IsNotExist(err) {
+		return nil, helpers.ErrorNoEntryFound
+	} else if err != nil {
+		return nil, helpers.ErrorFileRead
+	}
+	var a archive
+	if jErr := json.Unmarshal(b, &a); jErr != nil {
+		return nil, helpers.ErrorJsonDecoding
+	}
+	entries := make([]LeaderboardEntry, len(a.Entries), len(a.Entries))
+	for i, e := range a.Entries {
+		entries[i] = LeaderboardEntry{name: e.N, target: e.T, extra: e.E, seq: e.S}
+	}
+	return entries, 0
+}
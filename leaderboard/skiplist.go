@@ -0,0 +1,164 @@
+package leaderboard
+
+import (
+	"math/rand"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Leaderboard Skip List   /////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A Leaderboard's entries are kept in order in a skip list. Every link keeps the number of entries it skips over (it's
+// span), so an entry's rank and the entry at a rank are found in O(log n), like inserting and removing entries.
+
+const (
+	skipListMaxLevel = 32 // enough levels for 4^32 entries
+	skipListP        = 4  // 1 in skipListP nodes are promoted to the next level
+)
+
+type skipList struct {
+	head   *skipNode
+	level  int
+	length int
+	above  func(a *LeaderboardEntry, b *LeaderboardEntry) bool // true if a ranks above b
+}
+
+type skipNode struct {
+	entry *LeaderboardEntry
+	next  []skipLink
+}
+
+type skipLink struct {
+	node *skipNode
+	span int // number of entries from the node to the next node at this level
+}
+
+func newSkipList(above func(a *LeaderboardEntry, b *LeaderboardEntry) bool) *skipList {
+	return &skipList{head: &skipNode{next: make([]skipLink, skipListMaxLevel)}, level: 1, above: above}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Intn(skipListP) == 0 {
+		level++
+	}
+	return level
+}
+
+// insert adds e to the list, and returns it's index
+func (s *skipList) insert(e *LeaderboardEntry) int {
+	var update [skipListMaxLevel]*skipNode
+	var rank [skipListMaxLevel]int
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		if i < s.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.next[i].node != nil && s.above(x.next[i].node.entry, e) {
+			rank[i] += x.next[i].span
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+	level := randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = s.head
+			update[i].next[i].span = s.length
+		}
+		s.level = level
+	}
+	n := &skipNode{entry: e, next: make([]skipLink, level)}
+	for i := 0; i < level; i++ {
+		n.next[i].node = update[i].next[i].node
+		update[i].next[i].node = n
+		n.next[i].span = update[i].next[i].span - (rank[0] - rank[i])
+		update[i].next[i].span = (rank[0] - rank[i]) + 1
+	}
+	// Levels above the new node skip over it
+	for i := level; i < s.level; i++ {
+		update[i].next[i].span++
+	}
+	s.length++
+	return rank[0]
+}
+
+// remove takes e out of the list. Returns false if e isn't in the list.
+func (s *skipList) remove(e *LeaderboardEntry) bool {
+	var update [skipListMaxLevel]*skipNode
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && s.above(x.next[i].node.entry, e) {
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+	x = x.next[0].node
+	if x == nil || x.entry != e {
+		return false
+	}
+	for i := 0; i < s.level; i++ {
+		if update[i].next[i].node == x {
+			update[i].next[i].span += x.next[i].span - 1
+			update[i].next[i].node = x.next[i].node
+		} else {
+			update[i].next[i].span--
+		}
+	}
+	for s.level > 1 && s.head.next[s.level-1].node == nil {
+		s.level--
+	}
+	s.length--
+	return true
+}
+
+// index gets the index of e in the list, or -1 if e isn't in the list
+func (s *skipList) index(e *LeaderboardEntry) int {
+	var rank int
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && (x.next[i].node.entry == e || s.above(x.next[i].node.entry, e)) {
+			rank += x.next[i].span
+			x = x.next[i].node
+		}
+		if x.entry == e {
+			return rank - 1
+		}
+	}
+	return -1
+}
+
+// at gets the node at index i, or nil if i is out of bounds
+func (s *skipList) at(i int) *skipNode {
+	if i < 0 || i >= s.length {
+		return nil
+	}
+	var rank int
+	x := s.head
+	for l := s.level - 1; l >= 0; l-- {
+		for x.next[l].node != nil && rank+x.next[l].span <= i+1 {
+			rank += x.next[l].span
+			x = x.next[l].node
+		}
+		if rank == i+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+// slice copies up to limit entries starting at index i
+func (s *skipList) slice(i int, limit int) []LeaderboardEntry {
+	if limit <= 0 || i < 0 || i >= s.length {
+		return make([]LeaderboardEntry, 0)
+	}
+	if i+limit > s.length {
+		limit = s.length - i
+	}
+	cp := make([]LeaderboardEntry, 0, limit)
+	for x := s.at(i); x != nil && len(cp) < limit; x = x.next[0].node {
+		cp = append(cp, *x.entry)
+	}
+	return cp
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/query"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	bucketSweepInterval time.Duration = time.Minute
+)
+
+var (
+	limitsMux    sync.Mutex
+	clientLimits map[string]*tokenBucket // Per-client query rate limits by remote host
+	tableLimits  map[string]*tokenBucket // Per-table query type limits by table name + query type
+)
+
+// dbLimits are the server's rate and connection limits as listed in the config file. A zero value disables a limit.
+type dbLimits struct {
+	MaxConnections int                             `json:"maxConnections"` // Maximum concurrent client connections
+	QueryRate      float64                         `json:"queryRate"`      // Queries per second for each client
+	QueryBurst     int                             `json:"queryBurst"`     // Queries a client can burst above QueryRate
+	Tables         map[string]map[string]rateLimit `json:"tables"`         // Table name -> query type -> rate limit
+}
+
+// rateLimit is a per-table limit for a query type, shared by every client. Used for throttling expensive queries
+// like AuthTable Inserts (new users) that make the server run bcrypt.
+type rateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Token Buckets   /////////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// tokenBucket allows bursts of up to `burst` actions, refilling at `rate` actions per second.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// take takes a token from the bucket if there is one. limitsMux must be locked.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full reports whether the bucket has refilled completely, meaning it can be dropped. limitsMux must be locked.
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+func getLimits() dbLimits {
+	configMux.Lock()
+	l := config.Limits
+	configMux.Unlock()
+	return l
+}
+
+// allowClient takes a token from a client's query rate limit
+func allowClient(r *http.Request) helpers.Error {
+	l := getLimits()
+	if l.QueryRate <= 0 {
+		return helpers.Error{}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	now := time.Now()
+	limitsMux.Lock()
+	defer limitsMux.Unlock()
+	b := clientLimits[host]
+	if b == nil {
+		b = newTokenBucket(l.QueryRate, l.QueryBurst, now)
+		clientLimits[host] = b
+	}
+	if !b.take(now) {
+		return helpers.NewError(helpers.ErrorRateLimited, "Query rate limit reached")
+	}
+	return helpers.Error{}
+}
+
+// allowTableQuery takes a token from the table's rate limit for the Query's type
+func allowTableQuery(q *query.Query) helpers.Error {
+	rl, ok := getLimits().Tables[q.Table][q.Type]
+	if !ok || rl.Rate <= 0 {
+		return helpers.Error{}
+	}
+	key := q.Table + "." + q.Type
+	now := time.Now()
+	limitsMux.Lock()
+	defer limitsMux.Unlock()
+	b := tableLimits[key]
+	if b == nil {
+		b = newTokenBucket(rl.Rate, rl.Burst, now)
+		tableLimits[key] = b
+	}
+	if !b.take(now) {
+		return helpers.NewError(helpers.ErrorRateLimited, q.Type+" rate limit reached on '"+q.Table+"'")
+	}
+	return helpers.Error{}
+}
+
+// sweepBuckets periodically drops refilled client buckets so idle clients don't accumulate in memory
+func sweepBuckets() {
+	for range time.Tick(bucketSweepInterval) {
+		dropFullBuckets(time.Now())
+	}
+}
+
+// dropFullBuckets drops every client bucket that has refilled completely
+func dropFullBuckets(now time.Time) {
+	limitsMux.Lock()
+	defer limitsMux.Unlock()
+	for host, b := range clientLimits {
+		if b.full(now) {
+			delete(clientLimits, host)
+		}
+	}
+}
+
+func initLimits() {
+	limitsMux.Lock()
+	clientLimits = make(map[string]*tokenBucket)
+	tableLimits = make(map[string]*tokenBucket)
+	limitsMux.Unlock()
+	go sweepBuckets()
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Connection Limiting   ///////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// limitListener is a net.Listener that rejects connections past a maximum number of concurrent connections
+type limitListener struct {
+	net.Listener
+	mux   sync.Mutex
+	max   int
+	conns int
+}
+
+// limitConn is a net.Conn that frees it's limitListener slot when closed
+type limitConn struct {
+	net.Conn
+	l    *limitListener
+	once sync.Once
+}
+
+func newLimitListener(l net.Listener, max int) net.Listener {
+	if max <= 0 {
+		return l
+	}
+	return &limitListener{Listener: l, max: max}
+}
+
+// Accept waits for the next connection. Connections past the maximum are sent an ErrorTooManyConnections
+// response and closed.
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		l.mux.Lock()
+		if l.conns >= l.max {
+			l.mux.Unlock()
+			go rejectConn(c)
+			continue
+		}
+		l.conns++
+		l.mux.Unlock()
+		return &limitConn{Conn: c, l: l}, nil
+	}
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.l.mux.Lock()
+		c.l.conns--
+		c.l.mux.Unlock()
+	})
+	return err
+}
+
+// rejectConn writes a raw ErrorTooManyConnections response to a connection, then closes it
+func rejectConn(c net.Conn) {
+	jBytes, _ := helpers.Fjson.Marshal(queryResponse{E: &helpers.Error{ID: helpers.ErrorTooManyConnections, From: "Too many connections"}})
+	c.SetWriteDeadline(time.Now().Add(time.Second))
+	c.Write([]byte("HTTP/1.1 503 Service Unavailable\r\nContent-Type: application/json\r\nConnection: close\r\nContent-Length: " +
+		strconv.Itoa(len(jBytes)) + "\r\n\r\n"))
+	c.Write(jBytes)
+	c.Close()
+}
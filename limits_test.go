@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/query"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// useLimits sets the server's limits for a test with empty token buckets
+func useLimits(t *testing.T, l dbLimits) {
+	t.Helper()
+	useConfig(t, dbConfig{Limits: l})
+	limitsMux.Lock()
+	clientLimits = make(map[string]*tokenBucket)
+	tableLimits = make(map[string]*tokenBucket)
+	limitsMux.Unlock()
+}
+
+func clientRequest(addr string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.RemoteAddr = addr
+	return r
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(2, 3, now)
+
+	// Burst
+	for i := 0; i < 3; i++ {
+		if !b.take(now) {
+			t.Fatalf("TestTokenBucket expected token %v of the burst, but the bucket was empty", i+1)
+		}
+	}
+	if b.take(now) {
+		t.Fatalf("TestTokenBucket expected the bucket to be empty after the burst")
+	}
+
+	// Refill at 2 per second
+	now = now.Add(500 * time.Millisecond)
+	if !b.take(now) {
+		t.Errorf("TestTokenBucket expected a token after half a second")
+	}
+	if b.take(now) {
+		t.Errorf("TestTokenBucket expected only one token after half a second")
+	}
+	if b.full(now.Add(time.Second)) {
+		t.Errorf("TestTokenBucket expected the bucket not to be full after a second")
+	}
+
+	// Refills stop at the burst
+	now = now.Add(time.Minute)
+	if !b.full(now) {
+		t.Errorf("TestTokenBucket expected the bucket to be full after a minute")
+	}
+	taken := 0
+	for b.take(now) {
+		taken++
+	}
+	if taken != 3 {
+		t.Errorf("TestTokenBucket expected 3 tokens after a minute, but got: %v", taken)
+	}
+
+	// Burst is at least 1
+	if b = newTokenBucket(1, 0, now); !b.take(now) || b.take(now) {
+		t.Errorf("TestTokenBucket expected a burst of 0 to allow one action")
+	}
+}
+
+func TestDropFullBuckets(t *testing.T) {
+	useLimits(t, dbLimits{})
+	now := time.Now()
+	limitsMux.Lock()
+	clientLimits["idle"] = newTokenBucket(1, 2, now)
+	clientLimits["busy"] = newTokenBucket(1, 2, now)
+	clientLimits["busy"].take(now)
+	clientLimits["busy"].take(now)
+	limitsMux.Unlock()
+
+	dropFullBuckets(now)
+	limitsMux.Lock()
+	_, idle := clientLimits["idle"]
+	_, busy := clientLimits["busy"]
+	limitsMux.Unlock()
+	if idle || !busy {
+		t.Errorf("TestDropFullBuckets expected only the idle bucket to be dropped, but got: idle %v, busy %v", idle, busy)
+	}
+
+	dropFullBuckets(now.Add(2 * time.Second))
+	limitsMux.Lock()
+	n := len(clientLimits)
+	limitsMux.Unlock()
+	if n != 0 {
+		t.Errorf("TestDropFullBuckets expected the refilled bucket to be dropped, but %v are left", n)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	useLimits(t, dbLimits{QueryRate: 0.001, QueryBurst: 2, Tables: map[string]map[string]rateLimit{
+		"accounts": {query.TypeInsert: {Rate: 0.001, Burst: 1}},
+	}})
+	insert := &query.Query{Type: query.TypeInsert, Table: "accounts"}
+
+	// Clients are limited by host, whatever their port
+	for i, addr := range []string{"10.0.0.1:1000", "10.0.0.1:2000"} {
+		if err := allowClient(clientRequest(addr)); err.ID != 0 {
+			t.Errorf("TestRateLimits expected query %v from 10.0.0.1 to be allowed, but got: %v", i+1, err)
+		}
+	}
+	if err := allowClient(clientRequest("10.0.0.1:3000")); err.ID != helpers.ErrorRateLimited {
+		t.Errorf("TestRateLimits expected 10.0.0.1 to be rate limited, but got: %v", err)
+	}
+	if err := allowClient(clientRequest("10.0.0.2:1000")); err.ID != 0 {
+		t.Errorf("TestRateLimits expected 10.0.0.2 to have it's own limit, but got: %v", err)
+	}
+
+	// The table limit is shared by every client, and doesn't use client tokens
+	if err := allowTableQuery(insert); err.ID != 0 {
+		t.Errorf("TestRateLimits expected the first Insert on 'accounts' to be allowed, but got: %v", err)
+	}
+	if err := allowTableQuery(insert); err.ID != helpers.ErrorRateLimited {
+		t.Errorf("TestRateLimits expected the second Insert on 'accounts' to be rate limited, but got: %v", err)
+	}
+	if err := allowClient(clientRequest("10.0.0.2:1000")); err.ID != 0 {
+		t.Errorf("TestRateLimits expected the table limit not to use 10.0.0.2's tokens, but got: %v", err)
+	}
+
+	// Other tables and query types have no limit
+	for _, q := range []*query.Query{{Type: query.TypeGet, Table: "accounts"}, {Type: query.TypeInsert, Table: "users"}} {
+		for i := 0; i < 3; i++ {
+			if err := allowTableQuery(q); err.ID != 0 {
+				t.Errorf("TestRateLimits expected %v on '%v' to have no limit, but got: %v", q.Type, q.Table, err)
+			}
+		}
+	}
+}
+
+func TestRejectConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go rejectConn(server)
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil {
+		t.Fatalf("TestRejectConn expected an HTTP response, but got: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("TestRejectConn could not read the response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("TestRejectConn expected a 503 JSON response, but got: %v %v", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var qr queryResponse
+	if err := helpers.Fjson.Unmarshal(body, &qr); err != nil || qr.E == nil || qr.E.ID != helpers.ErrorTooManyConnections {
+		t.Errorf("TestRejectConn expected error %v, but got: %s (%v)", helpers.ErrorTooManyConnections, body, err)
+	}
+}
+
+func TestLimitListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	ll := newLimitListener(l, 2)
+	defer ll.Close()
+	if newLimitListener(l, 0) != l {
+		t.Errorf("TestLimitListener expected a maximum of 0 to return the listener as is")
+	}
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			c, err := ll.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- c
+		}
+	}()
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Could not dial: %v", err)
+		}
+		return c
+	}
+	accept := func() net.Conn {
+		select {
+		case c := <-accepted:
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestLimitListener expected a connection to be accepted")
+		}
+		return nil
+	}
+
+	// Connections up to the maximum are accepted
+	c1, c2 := dial(), dial()
+	defer c1.Close()
+	defer c2.Close()
+	s1, s2 := accept(), accept()
+	defer s2.Close()
+
+	// The next connection is rejected with a 503
+	c3 := dial()
+	defer c3.Close()
+	c3.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if resp, err := http.ReadResponse(bufio.NewReader(c3), nil); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("TestLimitListener expected the third connection to get a 503, but got: %v %v", resp, err)
+	}
+	select {
+	case <-accepted:
+		t.Errorf("TestLimitListener expected the third connection not to be accepted")
+	default:
+	}
+
+	// Closing a connection frees it's slot, even when closed twice
+	s1.Close()
+	s1.Close()
+	c4 := dial()
+	defer c4.Close()
+	s4 := accept()
+	defer s4.Close()
+	c5 := dial()
+	defer c5.Close()
+	c5.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if resp, err := http.ReadResponse(bufio.NewReader(c5), nil); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("TestLimitListener expected the connection past the maximum to get a 503, but got: %v %v", resp, err)
+	}
+}
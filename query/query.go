@@ -0,0 +1,724 @@
+/*
+query package Copyright 2020 Dominique Debergue
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at:
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+either express or implied. See the License for the specific
+language governing permissions and limitations under the License.
+*/
+
+// Package query parses and executes GopherDB's JSON query language independently of any transport.
+package query
+
+import (
+	"github.com/hewiefreeman/GopherDB/authtable"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/keystore"
+	"github.com/hewiefreeman/GopherDB/leaderboard"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"strings"
+	"time"
+)
+
+// Query types
+const (
+	TypeGet       = "Get"
+	TypeInsert    = "Insert"
+	TypeUpdate    = "Update"
+	TypeUpsert    = "Upsert"
+	TypeDelete    = "Delete"
+	TypeCreate    = "Create"
+	TypeDrop      = "Drop"
+	TypeCompact   = "Compact"
+	TypeBackup    = "Backup"
+	TypeLink      = "Link"
+	TypeSelect    = "Select"
+	TypeIndex     = "Index"
+	TypeDropIndex = "DropIndex"
+)
+
+// Folder Backup queries write their archives to
+const BackupFolder = "Backups"
+
+// Table types
+const (
+	TableTypeKeystore    = "Keystore"
+	TableTypeAuthTable   = "AuthTable"
+	TableTypeLeaderboard = "Leaderboard"
+)
+
+// Leaderboard query item names
+const (
+	itemLimit  = "limit"
+	itemPage   = "page"
+	itemTarget = "target"
+	itemExtra  = "extra"
+	itemName   = "name"
+	itemAround = "around"
+	itemRank     = "rank"
+	itemArchive  = "archive"
+	itemArchives = "archives"
+	itemLinked   = "linked"
+)
+
+// Select query item names
+const (
+	itemWhere     = "where"
+	itemItems     = "items"
+	itemOffset    = "offset"
+	itemAfter     = "after"
+	itemKey       = "key"
+	itemEntries   = "entries"
+	itemPrefix    = "prefix"
+	itemFrom      = "from"
+	itemTo        = "to"
+	itemReverse   = "reverse"
+	itemOrder     = "order"
+	itemAggregate = "aggregate"
+	itemGroupBy   = "groupBy"
+)
+
+// Leaderboard tie-break policy names
+const (
+	tieBreakFirst = "First"
+	tieBreakLast  = "Last"
+)
+
+// Leaderboard reset period names
+var resetPeriods = map[string]int{
+	"Never":   leaderboard.ResetNever,
+	"Daily":   leaderboard.ResetDaily,
+	"Weekly":  leaderboard.ResetWeekly,
+	"Monthly": leaderboard.ResetMonthly,
+}
+
+// Query represents a parsed and validated query, ready to be executed on the table it targets.
+type Query struct {
+	Type      string                 // Query type (Get, Insert, etc)
+	Table     string                 // Table name
+	TableType string                 // Type of the table the query targets
+	Key       string                 // Keystore key, AuthTable user name, or Leaderboard entry name
+	Password  string                 // AuthTable password
+	Items     map[string]interface{} // Items to get, or items that match the table's schema
+
+	// Create query settings
+	Schema        schema.Schema
+	DataOnDrive   bool
+	MemOnly       bool
+	MaxEntries    int    // Leaderboard maximum entries
+	Ascending     bool   // Leaderboard entries with the lowest targets rank first
+	TieBreak      int    // Leaderboard tie-break policy
+	TieItem       string // Leaderboard extra data item ties are broken by
+	AlwaysReplace bool   // Leaderboard entries always replace previous entries with the same name
+	ResetPeriod   int    // Leaderboard reset period
+	Timezone      string // Leaderboard timezone reset periods start in
+
+	// Link query settings
+	LinkTable  string   // Keystore or AuthTable a Leaderboard is linked to, or empty to unlink
+	LinkItem   string   // Numeric item entries are pushed with
+	LinkFields []string // Items retrieved entries get from the table
+
+	// Select query settings
+	Where     map[string]interface{} // Conditions entries must match
+	Limit     int                    // Maximum entries to select, or 0 for every match
+	Offset    int                    // Number of matches to skip
+	After     string                 // Cursor (a key, or a place in Order) to select entries after
+	Keys      keystore.KeyRange      // Range of keys to select entries from
+	Order     []string               // Items to order entries by (see schema.Order)
+	Aggregate map[string]interface{} // Operations to aggregate entries with instead of selecting them (see schema.Aggregation)
+	GroupBy   string                 // Item to group aggregated entries by
+
+	// Index query settings
+	IndexItem string // Item to index, or drop the index of
+
+	keystore    *keystore.Keystore
+	authTable   *authtable.AuthTable
+	leaderboard *leaderboard.Leaderboard
+}
+
+// Run parses and executes a JSON encoded query.
+func Run(b []byte) (interface{}, helpers.Error) {
+	q, err := Parse(b)
+	if err.ID != 0 {
+		return nil, err
+	}
+	return q.Execute()
+}
+
+// Parse makes a Query from a JSON encoded query array.
+//
+//     ["Update", "users", "Maya", {"mmr.*add.*divide": [10, 2]}]
+//
+func Parse(b []byte) (*Query, helpers.Error) {
+	var q []interface{}
+	if jErr := helpers.Fjson.Unmarshal(b, &q); jErr != nil {
+		return nil, helpers.NewError(helpers.ErrorJsonDecoding, jErr.Error())
+	}
+	return New(q)
+}
+
+// New makes a Query from a decoded query array. The query's type, table, and key are validated, and
+// the table's type is resolved.
+func New(q []interface{}) (*Query, helpers.Error) {
+	if len(q) < 2 {
+		return nil, helpers.NewError(helpers.ErrorQueryInvalidFormat, "")
+	}
+	qType, ok := q[0].(string)
+	if !ok {
+		return nil, helpers.NewError(helpers.ErrorQueryInvalidFormat, "Query type")
+	}
+	switch qType {
+	case TypeGet, TypeInsert, TypeUpdate, TypeUpsert, TypeDelete, TypeCreate, TypeDrop, TypeCompact, TypeBackup, TypeLink, TypeSelect, TypeIndex, TypeDropIndex:
+	default:
+		return nil, helpers.NewError(helpers.ErrorQueryInvalidFormat, qType)
+	}
+	tableName, ok := q[1].(string)
+	if !ok || len(tableName) == 0 {
+		return nil, helpers.NewError(helpers.ErrorTableNameRequired, "")
+	}
+	query := Query{Type: qType, Table: tableName}
+	if qType == TypeCreate {
+		return &query, query.parseCreateParams(q[2:])
+	}
+	// Resolve table
+	if k := keystore.Get(tableName); k != nil {
+		query.TableType = TableTypeKeystore
+		query.keystore = k
+		return &query, query.parseKeystoreParams(q[2:])
+	} else if t := authtable.Get(tableName); t != nil {
+		query.TableType = TableTypeAuthTable
+		query.authTable = t
+		return &query, query.parseAuthTableParams(q[2:])
+	} else if l, _ := leaderboard.Get(tableName); l != nil {
+		query.TableType = TableTypeLeaderboard
+		query.leaderboard = l
+		return &query, query.parseLeaderboardParams(q[2:])
+	}
+	return nil, helpers.NewError(helpers.ErrorTableDoesntExist, tableName)
+}
+
+// Create queries:
+//
+//     ["Create", "tableName", "Keystore" | "AuthTable", { *schema* }, dataOnDrive, memOnly]
+//     ["Create", "tableName", "Leaderboard", maxEntries, ascending, "First" | "Last" | "extra.itemName", alwaysReplace,
+//         "Never" | "Daily" | "Weekly" | "Monthly", "timezone"]
+//
+func (q *Query) parseCreateParams(params []interface{}) helpers.Error {
+	if l, _ := leaderboard.Get(q.Table); l != nil || keystore.Get(q.Table) != nil || authtable.Get(q.Table) != nil {
+		return helpers.NewError(helpers.ErrorTableExists, q.Table)
+	} else if len(params) < 2 {
+		return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+	}
+	var ok bool
+	if q.TableType, ok = params[0].(string); ok && q.TableType == TableTypeLeaderboard {
+		return q.parseCreateLeaderboardParams(params[1:])
+	} else if !ok || (q.TableType != TableTypeKeystore && q.TableType != TableTypeAuthTable) || len(params) > 4 {
+		return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+	}
+	var sErr helpers.Error
+	if q.Schema, sErr = schema.New(params[1], false); sErr.ID != 0 {
+		return sErr
+	}
+	if len(params) > 2 {
+		if q.DataOnDrive, ok = params[2].(bool); !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+		}
+	}
+	if len(params) > 3 {
+		if q.MemOnly, ok = params[3].(bool); !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+		}
+	}
+	return helpers.Error{}
+}
+
+func (q *Query) parseCreateLeaderboardParams(params []interface{}) helpers.Error {
+	maxEntries, ok := params[0].(float64)
+	if !ok || maxEntries < 1 {
+		return helpers.NewError(helpers.ErrorInvalidItemValue, "maxEntries")
+	}
+	q.MaxEntries = int(maxEntries)
+	if len(params) > 6 {
+		return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+	}
+	if len(params) > 1 {
+		if q.Ascending, ok = params[1].(bool); !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+		}
+	}
+	if len(params) > 2 {
+		tieBreak, ok := params[2].(string)
+		if !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+		}
+		switch {
+		case tieBreak == tieBreakFirst:
+			q.TieBreak = leaderboard.TieBreakFirst
+		case tieBreak == tieBreakLast:
+			q.TieBreak = leaderboard.TieBreakLast
+		case strings.HasPrefix(tieBreak, itemExtra + ".") && len(tieBreak) > len(itemExtra) + 1:
+			q.TieBreak = leaderboard.TieBreakExtra
+			q.TieItem = tieBreak[len(itemExtra) + 1:]
+		default:
+			return helpers.NewError(helpers.ErrorInvalidItemValue, "tieBreak")
+		}
+	}
+	if len(params) > 3 {
+		if q.AlwaysReplace, ok = params[3].(bool); !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+		}
+	}
+	if len(params) > 4 {
+		period, ok := params[4].(string)
+		if !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+		}
+		if q.ResetPeriod, ok = resetPeriods[period]; !ok {
+			return helpers.NewError(helpers.ErrorInvalidItemValue, "resetPeriod")
+		}
+	}
+	if len(params) > 5 {
+		if q.Timezone, ok = params[5].(string); !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+		} else if _, tErr := time.LoadLocation(q.Timezone); tErr != nil {
+			return helpers.NewError(helpers.ErrorInvalidItemValue, "timezone")
+		}
+	}
+	return helpers.Error{}
+}
+
+// Keystore queries:
+//
+//     ["Get", "tableName", "key", { *items to get* }]
+//     ["Insert" | "Update" | "Upsert", "tableName", "key", { *items that match schema* }]
+//     ["Delete", "tableName", "key"]
+//     ["Select", "tableName", {"where": { *conditions* }, "items": { *items to get* }, "order": ["item.*sortDesc", ...], "limit": 10, "offset": 0, "after": "key"}]
+//     ["Select", "tableName", {"where": { *conditions* }, "aggregate": {"count": [], "sum": ["item", ...], ...}, "groupBy": "item"}]
+//     ["Index" | "DropIndex", "tableName", "item"]
+//     ["Drop" | "Compact" | "Backup", "tableName"]
+//
+func (q *Query) parseKeystoreParams(params []interface{}) helpers.Error {
+	if q.Type == TypeDrop || q.Type == TypeCompact || q.Type == TypeBackup {
+		return q.parseItems(params)
+	} else if q.Type == TypeSelect {
+		return q.parseSelectParams(params)
+	} else if q.Type == TypeIndex || q.Type == TypeDropIndex {
+		var ok bool
+		if len(params) != 1 {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+		} else if q.IndexItem, ok = params[0].(string); !ok || len(q.IndexItem) == 0 {
+			return helpers.NewError(helpers.ErrorInvalidItem, q.Table)
+		}
+		return helpers.Error{}
+	}
+	if len(params) == 0 {
+		return helpers.NewError(helpers.ErrorKeyRequired, q.Table)
+	}
+	var ok bool
+	if q.Key, ok = params[0].(string); !ok || len(q.Key) == 0 {
+		return helpers.NewError(helpers.ErrorKeyRequired, q.Table)
+	}
+	return q.parseItems(params[1:])
+}
+
+// AuthTable queries:
+//
+//     ["Get", "tableName", "userName", "password", { *items to get* }]
+//     ["Insert" | "Update", "tableName", "userName", "password", { *items that match schema* }]
+//     ["Delete", "tableName", "userName", "password"]
+//     ["Select", "tableName", {"where": { *conditions* }, "items": { *items to get* }, "order": ["item.*sortDesc", ...], "limit": 10, "offset": 0, "after": "userName"}]
+//     ["Drop" | "Compact" | "Backup", "tableName"]
+//
+func (q *Query) parseAuthTableParams(params []interface{}) helpers.Error {
+	if q.Type == TypeUpsert || q.Type == TypeIndex || q.Type == TypeDropIndex {
+		return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Type)
+	} else if q.Type == TypeSelect {
+		if err := q.parseSelectParams(params); err.ID != 0 {
+			return err
+		} else if q.Keys != (keystore.KeyRange{}) || q.Aggregate != nil {
+			// AuthTables have no key ranges or aggregations
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Type)
+		}
+		return helpers.Error{}
+	} else if q.Type == TypeDrop || q.Type == TypeCompact || q.Type == TypeBackup {
+		return q.parseItems(params)
+	}
+	if len(params) == 0 {
+		return helpers.NewError(helpers.ErrorNameRequired, q.Table)
+	}
+	var ok bool
+	if q.Key, ok = params[0].(string); !ok || len(q.Key) == 0 {
+		return helpers.NewError(helpers.ErrorNameRequired, q.Table)
+	}
+	if len(params) < 2 {
+		return helpers.NewError(helpers.ErrorPasswordLength, q.Key)
+	}
+	if q.Password, ok = params[1].(string); !ok {
+		return helpers.NewError(helpers.ErrorPasswordLength, q.Key)
+	}
+	return q.parseItems(params[2:])
+}
+
+// Leaderboard queries:
+//
+//     ["Get", "tableName", {"limit": 10, "page": 0}]
+//     ["Get", "tableName", {"name": "name", "around": 5}]
+//     ["Get", "tableName", {"archive": "2006-01-02", "limit": 10, "page": 0}]
+//     ["Get", "tableName", {"archives": true}]
+//     ["Insert" | "Update" | "Upsert", "tableName", "name", {"target": 1500, "extra": { *any data* }}]
+//     ["Link", "tableName", "linkTableName", "item", ["field", ...]]
+//     ["Link", "tableName"]
+//     ["Drop", "tableName"]
+//
+func (q *Query) parseLeaderboardParams(params []interface{}) helpers.Error {
+	switch q.Type {
+	case TypeGet, TypeDrop:
+		return q.parseItems(params)
+	case TypeLink:
+		return q.parseLinkParams(params)
+	case TypeInsert, TypeUpdate, TypeUpsert:
+		if len(params) == 0 {
+			return helpers.NewError(helpers.ErrorNameRequired, q.Table)
+		}
+		var ok bool
+		if q.Key, ok = params[0].(string); !ok || len(q.Key) == 0 {
+			return helpers.NewError(helpers.ErrorNameRequired, q.Table)
+		}
+		if err := q.parseItems(params[1:]); err.ID != 0 {
+			return err
+		} else if _, ok = q.Items[itemTarget].(float64); !ok {
+			return helpers.NewError(helpers.ErrorInvalidItemValue, itemTarget)
+		}
+		return helpers.Error{}
+	}
+	return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Type)
+}
+
+func (q *Query) parseLinkParams(params []interface{}) helpers.Error {
+	if len(params) == 0 {
+		// Unlink
+		return helpers.Error{}
+	} else if len(params) < 2 || len(params) > 3 {
+		return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+	}
+	var ok bool
+	if q.LinkTable, ok = params[0].(string); !ok || len(q.LinkTable) == 0 {
+		return helpers.NewError(helpers.ErrorTableNameRequired, q.Table)
+	}
+	if q.LinkItem, ok = params[1].(string); !ok {
+		return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+	}
+	if len(params) > 2 {
+		fields, ok := params[2].([]interface{})
+		if !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+		}
+		for _, f := range fields {
+			field, ok := f.(string)
+			if !ok {
+				return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+			}
+			q.LinkFields = append(q.LinkFields, field)
+		}
+	}
+	return helpers.Error{}
+}
+
+func (q *Query) parseSelectParams(params []interface{}) helpers.Error {
+	if err := q.parseItems(params); err.ID != 0 {
+		return err
+	}
+	var ok bool
+	if w := q.Items[itemWhere]; w != nil {
+		if q.Where, ok = w.(map[string]interface{}); !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, itemWhere)
+		}
+	}
+	for itemName, s := range map[string]*string{itemAfter: &q.After, itemPrefix: &q.Keys.Prefix, itemFrom: &q.Keys.From, itemTo: &q.Keys.To} {
+		if v := q.Items[itemName]; v != nil {
+			if *s, ok = v.(string); !ok {
+				return helpers.NewError(helpers.ErrorQueryInvalidFormat, itemName)
+			}
+		}
+	}
+	if a := q.Items[itemAggregate]; a != nil {
+		if q.Aggregate, ok = a.(map[string]interface{}); !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, itemAggregate)
+		}
+	}
+	if g := q.Items[itemGroupBy]; g != nil {
+		if q.GroupBy, ok = g.(string); !ok || q.Aggregate == nil {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, itemGroupBy)
+		}
+	}
+	if o := q.Items[itemOrder]; o != nil {
+		order, ok := o.([]interface{})
+		if !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, itemOrder)
+		}
+		q.Order = make([]string, len(order), len(order))
+		for i, item := range order {
+			if q.Order[i], ok = item.(string); !ok {
+				return helpers.NewError(helpers.ErrorQueryInvalidFormat, itemOrder)
+			}
+		}
+	}
+	if r := q.Items[itemReverse]; r != nil {
+		if q.Keys.Reverse, ok = r.(bool); !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, itemReverse)
+		}
+	}
+	limit, _ := q.Items[itemLimit].(float64)
+	offset, _ := q.Items[itemOffset].(float64)
+	if limit < 0 {
+		return helpers.NewError(helpers.ErrorInvalidItemValue, itemLimit)
+	} else if offset < 0 {
+		return helpers.NewError(helpers.ErrorInvalidItemValue, itemOffset)
+	}
+	q.Limit, q.Offset = int(limit), int(offset)
+	items := q.Items[itemItems]
+	q.Items = nil
+	if items != nil {
+		if q.Items, ok = items.(map[string]interface{}); !ok {
+			return helpers.NewError(helpers.ErrorQueryInvalidFormat, itemItems)
+		}
+	}
+	return helpers.Error{}
+}
+
+// Items must be the last parameter of a query
+func (q *Query) parseItems(params []interface{}) helpers.Error {
+	if len(params) == 0 {
+		return helpers.Error{}
+	} else if len(params) > 1 {
+		return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+	}
+	var ok bool
+	if q.Items, ok = params[0].(map[string]interface{}); !ok {
+		return helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Table)
+	}
+	return helpers.Error{}
+}
+
+// Execute runs the Query on it's table and returns the result.
+func (q *Query) Execute() (interface{}, helpers.Error) {
+	if q.Type == TypeCreate {
+		return nil, q.executeCreate()
+	}
+	switch q.TableType {
+	case TableTypeKeystore:
+		return q.executeKeystore()
+	case TableTypeAuthTable:
+		return q.executeAuthTable()
+	case TableTypeLeaderboard:
+		return q.executeLeaderboard()
+	}
+	return nil, helpers.NewError(helpers.ErrorTableDoesntExist, q.Table)
+}
+
+func (q *Query) executeCreate() helpers.Error {
+	var err helpers.Error
+	switch q.TableType {
+	case TableTypeKeystore:
+		_, err = keystore.New(q.Table, nil, q.Schema, 0, q.DataOnDrive, q.MemOnly)
+	case TableTypeAuthTable:
+		_, err = authtable.New(q.Table, nil, q.Schema, 0, q.DataOnDrive, q.MemOnly)
+	case TableTypeLeaderboard:
+		l, lErr := leaderboard.New(q.Table, nil, q.MaxEntries, q.Ascending, q.TieBreak, q.TieItem, q.AlwaysReplace)
+		if lErr != 0 {
+			err = helpers.NewError(lErr, q.Table)
+		} else if q.ResetPeriod != leaderboard.ResetNever {
+			if rErr := l.SetResetPeriod(q.ResetPeriod, q.Timezone); rErr != 0 {
+				l.Delete()
+				err = helpers.NewError(rErr, q.Table)
+			}
+		}
+	default:
+		err = helpers.NewError(helpers.ErrorQueryInvalidFormat, q.TableType)
+	}
+	return err
+}
+
+func (q *Query) executeKeystore() (interface{}, helpers.Error) {
+	switch q.Type {
+	case TypeGet:
+		return q.keystore.GetKey(q.Key, q.Items)
+	case TypeInsert:
+		_, err := q.keystore.InsertKey(q.Key, q.Items)
+		return nil, err
+	case TypeUpdate:
+		return nil, q.keystore.UpdateKey(q.Key, q.Items)
+	case TypeUpsert:
+		_, err := q.keystore.UpsertKey(q.Key, q.Items)
+		return nil, err
+	case TypeDelete:
+		return nil, q.keystore.DeleteKey(q.Key)
+	case TypeSelect:
+		if q.Aggregate != nil {
+			return q.keystore.Aggregate(q.Keys, q.Where, q.Aggregate, q.GroupBy)
+		}
+		selected, after, err := q.keystore.SelectOrdered(q.Order, q.Keys, q.Where, q.Items, q.Limit, q.Offset, q.After)
+		if err.ID != 0 {
+			return nil, err
+		}
+		return makeSelectResult(selected, after), helpers.Error{}
+	case TypeIndex:
+		return nil, q.keystore.CreateIndex(q.IndexItem)
+	case TypeDropIndex:
+		return nil, q.keystore.DropIndex(q.IndexItem)
+	case TypeDrop:
+		if err := q.keystore.Delete(); err != 0 {
+			return nil, helpers.NewError(err, q.Table)
+		}
+		return nil, helpers.Error{}
+	case TypeCompact:
+		return nil, q.keystore.Compact()
+	case TypeBackup:
+		archive, err := q.backupFile()
+		if err.ID != 0 {
+			return nil, err
+		}
+		if err = q.keystore.Backup(archive); err.ID != 0 {
+			return nil, err
+		}
+		return archive, helpers.Error{}
+	}
+	return nil, helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Type)
+}
+
+func (q *Query) executeAuthTable() (interface{}, helpers.Error) {
+	switch q.Type {
+	case TypeGet:
+		return q.authTable.GetUser(q.Key, q.Password, q.Items)
+	case TypeInsert:
+		_, err := q.authTable.NewUser(q.Key, q.Password, q.Items)
+		return nil, err
+	case TypeUpdate:
+		return nil, q.authTable.UpdateUser(q.Key, q.Password, q.Items)
+	case TypeDelete:
+		return nil, q.authTable.DeleteUser(q.Key, q.Password)
+	case TypeSelect:
+		selected, after, err := q.authTable.Select(q.Order, q.Where, q.Items, q.Limit, q.Offset, q.After)
+		if err.ID != 0 {
+			return nil, err
+		}
+		entries := make([]keystore.Selected, len(selected), len(selected))
+		for i, e := range selected {
+			entries[i] = keystore.Selected{Key: e.Name, Items: e.Items}
+		}
+		return makeSelectResult(entries, after), helpers.Error{}
+	case TypeDrop:
+		return nil, q.authTable.Delete()
+	case TypeCompact:
+		return nil, q.authTable.Compact()
+	case TypeBackup:
+		archive, err := q.backupFile()
+		if err.ID != 0 {
+			return nil, err
+		}
+		if err = q.authTable.Backup(archive); err.ID != 0 {
+			return nil, err
+		}
+		return archive, helpers.Error{}
+	}
+	return nil, helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Type)
+}
+
+// backupFile makes BackupFolder if needed, and names a Backup query's archive after it's table and the time
+func (q *Query) backupFile() (string, helpers.Error) {
+	if err := storage.MakeDir(BackupFolder); err != nil {
+		return "", helpers.NewError(helpers.ErrorCreatingFolder, BackupFolder + ": " + err.Error())
+	}
+	return BackupFolder + "/" + q.Table + "-" + time.Now().UTC().Format("20060102-150405.000") + helpers.FileTypeBackup, helpers.Error{}
+}
+
+func (q *Query) executeLeaderboard() (interface{}, helpers.Error) {
+	switch q.Type {
+	case TypeGet:
+		if name, ok := q.Items[itemName].(string); ok {
+			// Entries around a name
+			around, _ := q.Items[itemAround].(float64)
+			rank, entries, err := q.leaderboard.GetAround(name, int(around))
+			if err != 0 {
+				return nil, helpers.NewError(err, name)
+			}
+			return makeLeaderboardEntries(entries, rank), helpers.Error{}
+		}
+		if archives, _ := q.Items[itemArchives].(bool); archives {
+			return q.leaderboard.Archives(), helpers.Error{}
+		}
+		limit, _ := q.Items[itemLimit].(float64)
+		page, _ := q.Items[itemPage].(float64)
+		if limit <= 0 {
+			return nil, helpers.NewError(helpers.ErrorInvalidItemValue, itemLimit)
+		} else if page < 0 {
+			page = 0
+		}
+		start := int(page) * int(limit)
+		if date, ok := q.Items[itemArchive].(string); ok {
+			// Page of an archived period
+			entries, err := q.leaderboard.GetArchive(date)
+			if err != 0 {
+				return nil, helpers.NewError(err, date)
+			}
+			if start > len(entries) {
+				start = len(entries)
+			}
+			end := start + int(limit)
+			if end > len(entries) {
+				end = len(entries)
+			}
+			return makeLeaderboardEntries(entries[start:end], start+1), helpers.Error{}
+		}
+		return makeLeaderboardEntries(q.leaderboard.GetPage(int(limit), int(page)), start+1), helpers.Error{}
+	case TypeInsert, TypeUpdate, TypeUpsert:
+		extra, _ := q.Items[itemExtra].(map[string]interface{})
+		return q.leaderboard.CheckAndPush(q.Key, q.Items[itemTarget].(float64), extra), helpers.Error{}
+	case TypeLink:
+		var err int
+		if len(q.LinkTable) == 0 {
+			err = q.leaderboard.Unlink()
+		} else {
+			err = q.leaderboard.Link(q.LinkTable, q.LinkItem, q.LinkFields)
+		}
+		if err != 0 {
+			return nil, helpers.NewError(err, q.Table)
+		}
+		return nil, helpers.Error{}
+	case TypeDrop:
+		if err := q.leaderboard.Delete(); err != 0 {
+			return nil, helpers.NewError(err, q.Table)
+		}
+		return nil, helpers.Error{}
+	}
+	return nil, helpers.NewError(helpers.ErrorQueryInvalidFormat, q.Type)
+}
+
+// Converts LeaderboardEntries into Objects for query output, starting at rank
+func makeLeaderboardEntries(entries []leaderboard.LeaderboardEntry, rank int) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(entries), len(entries))
+	for i, e := range entries {
+		out[i] = map[string]interface{}{itemName: e.Name(), itemRank: rank + i, itemTarget: e.Target(), itemExtra: e.Extra()}
+		if linked := e.Linked(); linked != nil {
+			out[i][itemLinked] = linked
+		}
+	}
+	return out
+}
+
+// Converts Keystore (or AuthTable) Select results into an Object for query output, with the cursor for the next Select
+func makeSelectResult(selected []keystore.Selected, after string) map[string]interface{} {
+	entries := make([]map[string]interface{}, len(selected), len(selected))
+	for i, e := range selected {
+		entries[i] = map[string]interface{}{itemKey: e.Key, itemItems: e.Items}
+	}
+	return map[string]interface{}{itemEntries: entries, itemAfter: after}
+}
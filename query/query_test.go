@@ -0,0 +1,300 @@
+package query
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/keystore"
+	"github.com/hewiefreeman/GopherDB/query"
+	"github.com/hewiefreeman/GopherDB/schema"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"os"
+	"strconv"
+	"testing"
+)
+
+const (
+	// Test settings
+	tableName string = "queryTest"
+)
+
+var (
+	// Test variables
+	table *keystore.Keystore
+)
+
+// TO TEST:
+// go test -v query_test.go
+//
+// Use -v to display fmt output
+
+func TestSetup(t *testing.T) {
+	storage.Init()
+	s, sErr := schema.New(map[string]interface{}{
+		"mmr":     []interface{}{"Uint16", float64(1500), float64(0), float64(0), false, false},
+		"friends": []interface{}{"Array", []interface{}{"String", "", float64(0), false, false, false}, float64(0), false},
+	}, false)
+	if sErr.ID != 0 {
+		t.Fatalf("Error making schema: %v", sErr)
+	}
+	var tErr helpers.Error
+	if table, tErr = keystore.New(tableName, nil, s, 0, false, true); tErr.ID != 0 {
+		t.Fatalf("Error making Keystore: %v", tErr)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := query.Parse([]byte("[\"Get\", ")); err.ID != helpers.ErrorJsonDecoding {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorJsonDecoding, err)
+	}
+	if _, err := query.Parse([]byte("[\"Fetch\", \"" + tableName + "\", \"Maya\"]")); err.ID != helpers.ErrorQueryInvalidFormat {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorQueryInvalidFormat, err)
+	}
+	if _, err := query.Parse([]byte("[\"Get\", \"noTable\", \"Maya\"]")); err.ID != helpers.ErrorTableDoesntExist {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorTableDoesntExist, err)
+	}
+	if _, err := query.Parse([]byte("[\"Get\", \"" + tableName + "\"]")); err.ID != helpers.ErrorKeyRequired {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorKeyRequired, err)
+	}
+	if _, err := query.Parse([]byte("[\"Get\", \"" + tableName + "\", \"Maya\", {}, {}]")); err.ID != helpers.ErrorQueryInvalidFormat {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorQueryInvalidFormat, err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	q, err := query.Parse([]byte("[\"Update\", \"" + tableName + "\", \"Maya\", {\"mmr.*add\": [10]}]"))
+	if err.ID != 0 {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if q.Type != query.TypeUpdate || q.TableType != query.TableTypeKeystore || q.Key != "Maya" || q.Items["mmr.*add"] == nil {
+		t.Errorf("Parse produced an incorrect Query: %+v", q)
+	}
+}
+
+func TestRun(t *testing.T) {
+	if _, err := query.Run([]byte("[\"Insert\", \"" + tableName + "\", \"Maya\", {\"friends\": [\"Mary\", \"Bill\"]}]")); err.ID != 0 {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if _, err := query.Run([]byte("[\"Update\", \"" + tableName + "\", \"Maya\", {\"mmr.*add.*div\": [10, 2]}]")); err.ID != 0 {
+		t.Fatalf("Update error: %v", err)
+	}
+	res, err := query.Run([]byte("[\"Get\", \"" + tableName + "\", \"Maya\", {\"mmr\": [], \"friends.1\": []}]"))
+	if err.ID != 0 {
+		t.Fatalf("Get error: %v", err)
+	}
+	items := res.(map[string]interface{})
+	if items["mmr"] != uint16(755) {
+		t.Errorf("Expected mmr 755, but got: %v", items["mmr"])
+	} else if items["friends.1"] != "Bill" {
+		t.Errorf("Expected friend 'Bill', but got: %v", items["friends.1"])
+	}
+	if _, err = query.Run([]byte("[\"Delete\", \"" + tableName + "\", \"Maya\"]")); err.ID != 0 {
+		t.Errorf("Delete error: %v", err)
+	}
+}
+
+func TestCreateAndDrop(t *testing.T) {
+	if _, err := query.Run([]byte("[\"Create\", \"" + tableName + "\", \"Keystore\", {}]")); err.ID != helpers.ErrorTableExists {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorTableExists, err)
+	}
+	if _, err := query.Run([]byte("[\"Create\", \"queryCreateTest\", \"Ledger\", {}]")); err.ID != helpers.ErrorQueryInvalidFormat {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorQueryInvalidFormat, err)
+	}
+	if _, err := query.Run([]byte("[\"Create\", \"queryCreateTest\", \"Keystore\", {\"level\": [\"Uint8\", 1, 1, 99, false, false]}, false, true]")); err.ID != 0 {
+		t.Fatalf("Create error: %v", err)
+	}
+	if keystore.Get("queryCreateTest") == nil {
+		t.Fatalf("Create did not make the Keystore")
+	}
+	q, err := query.Parse([]byte("[\"Drop\", \"queryCreateTest\"]"))
+	if err.ID != 0 {
+		t.Fatalf("Parse error: %v", err)
+	} else if q.TableType != query.TableTypeKeystore {
+		t.Errorf("Expected table type %v, but got: %v", query.TableTypeKeystore, q.TableType)
+	}
+	if _, err = q.Execute(); err.ID != 0 {
+		t.Errorf("Drop error: %v", err)
+	}
+	if keystore.Get("queryCreateTest") != nil {
+		t.Errorf("Drop did not remove the Keystore")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	if _, err := query.Run([]byte("[\"Create\", \"queryCompactTest\", \"Keystore\", {\"level\": [\"Uint8\", 1, 1, 99, false, false]}, true]")); err.ID != 0 {
+		t.Fatalf("Create error: %v", err)
+	}
+	defer query.Run([]byte("[\"Drop\", \"queryCompactTest\"]"))
+	// Disable automatic compaction
+	keystore.Get("queryCompactTest").SetCompactThreshold(0)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if _, err := query.Run([]byte("[\"Insert\", \"queryCompactTest\", \"" + key + "\", {\"level\": 5}]")); err.ID != 0 {
+			t.Fatalf("Insert error: %v", err)
+		}
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := query.Run([]byte("[\"Delete\", \"queryCompactTest\", \"" + key + "\"]")); err.ID != 0 {
+			t.Fatalf("Delete error: %v", err)
+		}
+	}
+	if deleted := keystore.Get("queryCompactTest").DeletedLines(); deleted != 2 {
+		t.Fatalf("Expected 2 deleted lines, but got: %v", deleted)
+	}
+	if _, err := query.Run([]byte("[\"Compact\", \"queryCompactTest\"]")); err.ID != 0 {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if deleted := keystore.Get("queryCompactTest").DeletedLines(); deleted != 0 {
+		t.Errorf("Expected 0 deleted lines after compacting, but got: %v", deleted)
+	}
+	for _, key := range []string{"b", "d"} {
+		if r, err := query.Run([]byte("[\"Get\", \"queryCompactTest\", \"" + key + "\"]")); err.ID != 0 {
+			t.Errorf("Get error after compacting: %v", err)
+		} else if level := r.(map[string]interface{})["level"]; level != uint8(5) {
+			t.Errorf("Expected level 5 for '%v' after compacting, but got: %v", key, level)
+		}
+	}
+}
+
+func TestBackup(t *testing.T) {
+	if _, err := query.Run([]byte("[\"Create\", \"queryBackupTest\", \"Keystore\", {\"level\": [\"Uint8\", 1, 1, 99, false, false]}]")); err.ID != 0 {
+		t.Fatalf("Create error: %v", err)
+	}
+	defer os.RemoveAll(query.BackupFolder)
+	if _, err := query.Run([]byte("[\"Insert\", \"queryBackupTest\", \"a\", {\"level\": 5}]")); err.ID != 0 {
+		t.Fatalf("Insert error: %v", err)
+	}
+	r, err := query.Run([]byte("[\"Backup\", \"queryBackupTest\"]"))
+	if err.ID != 0 {
+		t.Fatalf("Backup error: %v", err)
+	}
+	// Changes after the backup aren't restored
+	if _, err = query.Run([]byte("[\"Update\", \"queryBackupTest\", \"a\", {\"level\": 6}]")); err.ID != 0 {
+		t.Fatalf("Update error: %v", err)
+	}
+	if _, err = query.Run([]byte("[\"Drop\", \"queryBackupTest\"]")); err.ID != 0 {
+		t.Fatalf("Drop error: %v", err)
+	}
+	k, err := keystore.RestoreBackup(r.(string))
+	if err.ID != 0 {
+		t.Fatalf("Error restoring backup '%v': %v", r, err)
+	}
+	defer k.Delete()
+	if r, err = query.Run([]byte("[\"Get\", \"queryBackupTest\", \"a\"]")); err.ID != 0 {
+		t.Errorf("Get error after restoring: %v", err)
+	} else if level := r.(map[string]interface{})["level"]; level != uint8(5) {
+		t.Errorf("Expected level 5 after restoring, but got: %v", level)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	if _, err := query.Run([]byte("[\"Create\", \"querySelectTest\", \"Keystore\", {\"level\": [\"Uint8\", 1, 1, 99, false, false]}, false, true]")); err.ID != 0 {
+		t.Fatalf("Create error: %v", err)
+	}
+	defer query.Run([]byte("[\"Drop\", \"querySelectTest\"]"))
+	for i, key := range []string{"d", "a", "c", "b", "e"} {
+		if _, err := query.Run([]byte("[\"Insert\", \"querySelectTest\", \"" + key + "\", {\"level\": " + strconv.Itoa(i+1) + "}]")); err.ID != 0 {
+			t.Fatalf("Insert error: %v", err)
+		}
+	}
+	r, err := query.Run([]byte("[\"Select\", \"querySelectTest\", {\"where\": {\"level.*gt\": [1]}, \"items\": {\"level\": []}, \"limit\": 2}]"))
+	if err.ID != 0 {
+		t.Fatalf("Select error: %v", err)
+	}
+	res := r.(map[string]interface{})
+	entries := res["entries"].([]map[string]interface{})
+	if len(entries) != 2 || entries[0]["key"] != "a" || entries[1]["key"] != "b" || res["after"] != "b" {
+		t.Fatalf("Expected entries 'a' and 'b' with cursor 'b', but got: %v", res)
+	} else if level := entries[1]["items"].(map[string]interface{})["level"]; level != uint8(4) {
+		t.Errorf("Expected level 4 for 'b', but got: %v", level)
+	}
+	if r, err = query.Run([]byte("[\"Select\", \"querySelectTest\", {\"where\": {\"level.*gt\": [1]}, \"limit\": 2, \"after\": \"b\"}]")); err.ID != 0 {
+		t.Fatalf("Select error: %v", err)
+	}
+	res = r.(map[string]interface{})
+	entries = res["entries"].([]map[string]interface{})
+	if len(entries) != 2 || entries[0]["key"] != "c" || entries[1]["key"] != "e" {
+		t.Errorf("Expected entries 'c' and 'e' after 'b', but got: %v", res)
+	}
+	if r, err = query.Run([]byte("[\"Select\", \"querySelectTest\", {\"from\": \"b\", \"to\": \"d\", \"reverse\": true, \"limit\": 2}]")); err.ID != 0 {
+		t.Fatalf("Select error: %v", err)
+	}
+	res = r.(map[string]interface{})
+	entries = res["entries"].([]map[string]interface{})
+	if len(entries) != 2 || entries[0]["key"] != "d" || entries[1]["key"] != "c" || res["after"] != "c" {
+		t.Errorf("Expected entries 'd' and 'c' from 'b' to 'd' in reverse, but got: %v", res)
+	}
+	if r, err = query.Run([]byte("[\"Select\", \"querySelectTest\", {\"order\": [\"level.*sortDesc\"], \"limit\": 2, \"after\": \"[\\\"4\\\",\\\"b\\\"]\"}]")); err.ID != 0 {
+		t.Fatalf("Select error: %v", err)
+	}
+	res = r.(map[string]interface{})
+	entries = res["entries"].([]map[string]interface{})
+	if len(entries) != 2 || entries[0]["key"] != "c" || entries[1]["key"] != "a" || res["after"] != "[\"2\",\"a\"]" {
+		t.Errorf("Expected entries 'c' and 'a' after 'b' by level descending, but got: %v", res)
+	}
+	if _, err = query.Run([]byte("[\"Select\", \"querySelectTest\", {\"order\": \"level\"}]")); err.ID != helpers.ErrorQueryInvalidFormat {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorQueryInvalidFormat, err)
+	}
+	if r, err = query.Run([]byte("[\"Select\", \"querySelectTest\", {\"where\": {\"level.*gt\": [1]}, \"aggregate\": {\"count\": [], \"sum\": [\"level\"]}}]")); err.ID != 0 {
+		t.Fatalf("Select error: %v", err)
+	}
+	res = r.(map[string]interface{})
+	if res["count"] != uint64(4) || res["sum"].(map[string]interface{})["level"] != uint64(14) {
+		t.Errorf("Expected count 4 and level sum 14, but got: %v", res)
+	}
+	if _, err = query.Run([]byte("[\"Select\", \"querySelectTest\", {\"groupBy\": \"level\"}]")); err.ID != helpers.ErrorQueryInvalidFormat {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorQueryInvalidFormat, err)
+	}
+	if _, err = query.Run([]byte("[\"Select\", \"querySelectTest\", {\"prefix\": 1}]")); err.ID != helpers.ErrorQueryInvalidFormat {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorQueryInvalidFormat, err)
+	}
+	if _, err = query.Run([]byte("[\"Select\", \"querySelectTest\", {\"limit\": -1}]")); err.ID != helpers.ErrorInvalidItemValue {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorInvalidItemValue, err)
+	}
+}
+
+func TestSelectAuthTable(t *testing.T) {
+	if _, err := query.Run([]byte("[\"Create\", \"querySelectAuthTest\", \"AuthTable\", {\"level\": [\"Uint8\", 1, 1, 99, false, false]}, false, true]")); err.ID != 0 {
+		t.Fatalf("Create error: %v", err)
+	}
+	defer query.Run([]byte("[\"Drop\", \"querySelectAuthTest\"]"))
+	for i, name := range []string{"Mia", "Ann", "Bob"} {
+		if _, err := query.Run([]byte("[\"Insert\", \"querySelectAuthTest\", \"" + name + "\", \"password\", {\"level\": " + strconv.Itoa(i+1) + "}]")); err.ID != 0 {
+			t.Fatalf("Insert error: %v", err)
+		}
+	}
+	r, err := query.Run([]byte("[\"Select\", \"querySelectAuthTest\", {\"items\": {\"level\": []}, \"order\": [\"level.*sortDesc\"], \"limit\": 2}]"))
+	if err.ID != 0 {
+		t.Fatalf("Select error: %v", err)
+	}
+	res := r.(map[string]interface{})
+	entries := res["entries"].([]map[string]interface{})
+	if len(entries) != 2 || entries[0]["key"] != "Bob" || entries[1]["key"] != "Ann" || res["after"] != "[\"2\",\"Ann\"]" {
+		t.Errorf("Expected users 'Bob' and 'Ann' with Ann's place as the cursor, but got: %v", res)
+	}
+	if _, err = query.Run([]byte("[\"Select\", \"querySelectAuthTest\", {\"prefix\": \"M\"}]")); err.ID != helpers.ErrorQueryInvalidFormat {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorQueryInvalidFormat, err)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	if _, err := query.Run([]byte("[\"Index\", \"" + tableName + "\", \"friends\"]")); err.ID != helpers.ErrorInvalidItem {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorInvalidItem, err)
+	}
+	if _, err := query.Run([]byte("[\"Index\", \"" + tableName + "\", \"mmr\"]")); err.ID != 0 {
+		t.Fatalf("Index error: %v", err)
+	} else if indexes := table.Indexes(); len(indexes) != 1 || indexes[0] != "mmr" {
+		t.Errorf("Expected index 'mmr', but got: %v", indexes)
+	}
+	if _, err := query.Run([]byte("[\"DropIndex\", \"" + tableName + "\", \"mmr\"]")); err.ID != 0 {
+		t.Errorf("DropIndex error: %v", err)
+	}
+	if _, err := query.Run([]byte("[\"DropIndex\", \"" + tableName + "\", \"mmr\"]")); err.ID != helpers.ErrorIndexDoesntExist {
+		t.Errorf("Expected error %v, but got: %v", helpers.ErrorIndexDoesntExist, err)
+	}
+}
+
+// Must be last test!!
+func TestCleanUp(t *testing.T) {
+	if table != nil {
+		table.Delete()
+	}
+	storage.ShutDown()
+}
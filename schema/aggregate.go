@@ -0,0 +1,253 @@
+package schema
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"math"
+	sorting "sort"
+	"time"
+)
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Aggregations   /////////////////////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// An aggregation is made of operations, each with the items (named like an Order's items) it's made over:
+//
+//	{"count": [], "sum": ["mmr"], "avg": ["mmr"], "min": ["mmr", "profile.joined"], "max": ["mmr"], "distinct": ["profile.country"]}
+//
+// Sums of Int items are Int64s, sums of Uint items are Uint64s, and sums of Float items are Float64s. Int64 and Uint64
+// sums that don't fit their type are an error (helpers.ErrorSumOverflow) instead of wrapping. Averages are Float64s.
+// Min and max work on every item an Order can, and distinct counts the different values of an item. Entries can be
+// grouped by the value of an item, and each group gets it's own results.
+
+// Aggregation operations
+const (
+	AggregateCount    = "count"
+	AggregateSum      = "sum"
+	AggregateAvg      = "avg"
+	AggregateMin      = "min"
+	AggregateMax      = "max"
+	AggregateDistinct = "distinct"
+)
+
+// Aggregation result names
+const (
+	aggregateGroupsName = "groups"
+	aggregateGroupName  = "group"
+)
+
+// Aggregation aggregates the data of entries added to it. Make a new Aggregation for each set of entries.
+type Aggregation struct {
+	count   bool
+	ops     map[string][]aggregateItem
+	groupBy Order
+	groups  map[interface{}]*aggregateGroup
+}
+
+type aggregateItem struct {
+	name string
+	item orderItem
+}
+
+type aggregateGroup struct {
+	value    interface{}            // value of the group by item
+	count    uint64
+	results  map[string][]interface{} // results of each operation, by item
+	avgCount []uint64                 // number of values in each avg
+	distinct []map[interface{}]bool   // values of each distinct item
+}
+
+// NewAggregation makes an Aggregation from a map of operations, grouped by the item groupBy (or "" for no groups)
+func NewAggregation(s Schema, ops map[string]interface{}, groupBy string) (*Aggregation, helpers.Error) {
+	a := Aggregation{ops: make(map[string][]aggregateItem), groups: make(map[interface{}]*aggregateGroup)}
+	for op, params := range ops {
+		items, ok := params.([]interface{})
+		if !ok {
+			return nil, helpers.NewError(helpers.ErrorInvalidMethodParameters, op)
+		}
+		switch op {
+		case AggregateCount:
+			a.count = true
+			continue
+		case AggregateSum, AggregateAvg, AggregateMin, AggregateMax, AggregateDistinct:
+		default:
+			return nil, helpers.NewError(helpers.ErrorInvalidMethod, op)
+		}
+		for _, i := range items {
+			name, ok := i.(string)
+			if !ok {
+				return nil, helpers.NewError(helpers.ErrorInvalidMethodParameters, op)
+			}
+			o, err := NewOrder(s, []string{name})
+			if err.ID != 0 {
+				return nil, err
+			} else if (op == AggregateSum || op == AggregateAvg) && !o[0].si.IsNumeric() {
+				return nil, helpers.NewError(helpers.ErrorInvalidMethod, op + " " + name)
+			}
+			a.ops[op] = append(a.ops[op], aggregateItem{name: name, item: o[0]})
+		}
+	}
+	if groupBy != "" {
+		var err helpers.Error
+		if a.groupBy, err = NewOrder(s, []string{groupBy}); err.ID != 0 {
+			return nil, err
+		}
+	}
+	return &a, helpers.Error{}
+}
+
+// Add aggregates an entry's data. Returns helpers.ErrorSumOverflow if a sum of Int or Uint items doesn't fit it's type.
+func (a *Aggregation) Add(data []interface{}) helpers.Error {
+	var value, groupKey interface{}
+	if len(a.groupBy) > 0 {
+		value = a.groupBy.Values(data)[0]
+		groupKey = value
+		if t, ok := value.(time.Time); ok {
+			// Times in different locations can be equal
+			groupKey = t.UnixNano()
+		}
+	}
+	g := a.groups[groupKey]
+	if g == nil {
+		g = &aggregateGroup{value: value, results: make(map[string][]interface{}, len(a.ops))}
+		for op, items := range a.ops {
+			g.results[op] = make([]interface{}, len(items), len(items))
+		}
+		g.avgCount = make([]uint64, len(a.ops[AggregateAvg]), len(a.ops[AggregateAvg]))
+		g.distinct = make([]map[interface{}]bool, len(a.ops[AggregateDistinct]), len(a.ops[AggregateDistinct]))
+		for i := range g.distinct {
+			g.distinct[i] = make(map[interface{}]bool)
+		}
+		a.groups[groupKey] = g
+	}
+	g.count++
+	for op, items := range a.ops {
+		results := g.results[op]
+		for i, ai := range items {
+			v := Order{ai.item}.Values(data)[0]
+			if v == nil {
+				continue
+			}
+			switch op {
+			case AggregateSum:
+				sum, ok := addValues(results[i], v)
+				if !ok {
+					return helpers.NewError(helpers.ErrorSumOverflow, ai.name)
+				}
+				results[i] = sum
+			case AggregateAvg:
+				f, _ := makeFloat64(v)
+				sum, _ := results[i].(float64)
+				results[i] = sum + f
+				g.avgCount[i]++
+			case AggregateMin, AggregateMax:
+				o := Order{ai.item}
+				if c := o.Compare([]interface{}{v}, []interface{}{results[i]}); results[i] == nil || (op == AggregateMin && c < 0) || (op == AggregateMax && c > 0) {
+					results[i] = v
+				}
+			case AggregateDistinct:
+				if t, ok := v.(time.Time); ok {
+					v = t.UnixNano()
+				}
+				g.distinct[i][v] = true
+			}
+		}
+	}
+	return helpers.Error{}
+}
+
+// addValues adds a numeric value to a sum of the same type. Returns false if an int64 or uint64 sum overflows.
+func addValues(sum interface{}, v interface{}) (interface{}, bool) {
+	switch t := v.(type) {
+	case int64:
+		s, _ := makeInt64(sum)
+		if (t > 0 && s > math.MaxInt64 - t) || (t < 0 && s < math.MinInt64 - t) {
+			return sum, false
+		}
+		return s + t, true
+	case uint64:
+		s, _ := makeUint64(sum)
+		if s > math.MaxUint64 - t {
+			return sum, false
+		}
+		return s + t, true
+	case float64:
+		s, _ := makeFloat64(sum)
+		return s + t, true
+	}
+	return sum, true
+}
+
+// Result gets the results of the Aggregation. Each operation's results are by item name. With groups, results are
+// listed in order of the group by item's value with "groups", and each group has it's value with "group".
+func (a *Aggregation) Result() map[string]interface{} {
+	if len(a.groupBy) == 0 {
+		g := a.groups[nil]
+		if g == nil {
+			// No entries
+			g = &aggregateGroup{}
+		}
+		return a.groupResult(g)
+	}
+	groups := make([]*aggregateGroup, 0, len(a.groups))
+	for _, g := range a.groups {
+		groups = append(groups, g)
+	}
+	sorting.SliceStable(groups, func(i int, j int) bool {
+		return a.groupBy.Compare([]interface{}{groups[i].value}, []interface{}{groups[j].value}) < 0
+	})
+	results := make([]map[string]interface{}, len(groups), len(groups))
+	for i, g := range groups {
+		results[i] = a.groupResult(g)
+		results[i][aggregateGroupName] = g.value
+	}
+	return map[string]interface{}{aggregateGroupsName: results}
+}
+
+// groupResult gets the results of a group
+func (a *Aggregation) groupResult(g *aggregateGroup) map[string]interface{} {
+	result := make(map[string]interface{}, len(a.ops) + 1)
+	if a.count {
+		result[AggregateCount] = g.count
+	}
+	for op, items := range a.ops {
+		opResult := make(map[string]interface{}, len(items))
+		for i, ai := range items {
+			var v interface{}
+			if g.results != nil {
+				v = g.results[op][i]
+			}
+			switch op {
+			case AggregateSum:
+				if v == nil {
+					// Sums of no values are 0
+					v = zeroSum(ai.item)
+				}
+			case AggregateAvg:
+				if v != nil {
+					v = v.(float64) / float64(g.avgCount[i])
+				}
+			case AggregateDistinct:
+				var n uint64
+				if g.distinct != nil {
+					n = uint64(len(g.distinct[i]))
+				}
+				v = n
+			}
+			opResult[ai.name] = v
+		}
+		result[op] = opResult
+	}
+	return result
+}
+
+// zeroSum gets a sum of no values for an item
+func zeroSum(item orderItem) interface{} {
+	switch item.si.typeName {
+	case ItemTypeInt8, ItemTypeInt16, ItemTypeInt32, ItemTypeInt64:
+		return int64(0)
+	case ItemTypeUint8, ItemTypeUint16, ItemTypeUint32, ItemTypeUint64:
+		return uint64(0)
+	}
+	return float64(0)
+}
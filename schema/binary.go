@@ -0,0 +1,456 @@
+package schema
+
+import (
+	"encoding/binary"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"math"
+	"strconv"
+	"time"
+)
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Binary Entry Format   //////////////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A binary entry is the version byte, the length of the rest of the entry as a uvarint, then the entry's header
+// strings (like a key, or a user name and password) followed by it's data. Data items are written in dataIndex order,
+// and each one is a presence byte (0 for nil) followed by the item's value:
+//
+//	- Bool: 1 byte
+//	- Int8-Uint64, Float32, Float64: big-endian, at the width of the item's type
+//	- String: uvarint length + bytes
+//	- Time: uvarint length + time.Time's binary encoding
+//	- Array: uvarint item count + items
+//	- Map: uvarint item count + (key String, item) pairs
+//	- Object: uvarint item count + items in the Object schema's dataIndex order
+//
+// Binary entries start with their version byte, which JSON entries can't, so the two can be told apart on the same
+// storage file.
+
+const (
+	binaryVersion byte = 1
+)
+
+// IsBinary returns true if an entry's bytes are binary encoded, rather than JSON.
+func IsBinary(b []byte) bool {
+	return len(b) > 0 && b[0] == binaryVersion
+}
+
+// EncodeBinary makes the binary encoding of an entry with the provided header strings and data. The data can be an
+// entry's data in memory, or decoded from a JSON entry.
+func EncodeBinary(s Schema, header []string, data []interface{}) ([]byte, int) {
+	p := make([]byte, 0, 64)
+	for _, h := range header {
+		p = appendString(p, h)
+	}
+	var err int
+	if p, err = appendObject(p, s, data); err != 0 {
+		return nil, err
+	}
+	b := make([]byte, 1, len(p)+binary.MaxVarintLen64+1)
+	b[0] = binaryVersion
+	b = binary.AppendUvarint(b, uint64(len(p)))
+	return append(b, p...), 0
+}
+
+// DecodeBinary decodes a binary entry made with EncodeBinary, returning it's header strings and data. headers is
+// the number of header strings the entry was made with. Data is decoded to the same types entries have in memory.
+func DecodeBinary(s Schema, b []byte, headers int) ([]string, []interface{}, int) {
+	if len(b) == 0 || b[0] != binaryVersion {
+		return nil, nil, helpers.ErrorBinaryDecoding
+	}
+	pLen, n := binary.Uvarint(b[1:])
+	if n <= 0 || pLen != uint64(len(b)-1-n) {
+		return nil, nil, helpers.ErrorBinaryDecoding
+	}
+	d := binaryDecoder{b: b[1+n:]}
+	header := make([]string, headers)
+	for i := range header {
+		header[i] = d.string()
+	}
+	data := d.object(s)
+	if d.bad || len(d.b) > 0 {
+		return nil, nil, helpers.ErrorBinaryDecoding
+	}
+	return header, data, 0
+}
+
+// BinaryHeader reads only the header strings of a binary entry, so they can be found even when it's data is damaged.
+func BinaryHeader(b []byte, headers int) ([]string, int) {
+	if len(b) == 0 || b[0] != binaryVersion {
+		return nil, helpers.ErrorBinaryDecoding
+	}
+	_, n := binary.Uvarint(b[1:])
+	if n <= 0 {
+		return nil, helpers.ErrorBinaryDecoding
+	}
+	d := binaryDecoder{b: b[1+n:]}
+	header := make([]string, headers)
+	for i := range header {
+		header[i] = d.string()
+	}
+	if d.bad {
+		return nil, helpers.ErrorBinaryDecoding
+	}
+	return header, 0
+}
+
+// BinaryLength gets the length of the binary entry at the start of b from the length it starts with, so entries can be
+// found in bytes that hold more than one. Returns -1 if b doesn't start with a binary entry, or is too short to hold
+// all of it.
+func BinaryLength(b []byte) int {
+	if len(b) == 0 || b[0] != binaryVersion {
+		return -1
+	}
+	pLen, n := binary.Uvarint(b[1:])
+	if n <= 0 || pLen > uint64(len(b)-1-n) {
+		return -1
+	}
+	return 1 + n + int(pLen)
+}
+
+// schemaByIndex lists a Schema's items by their dataIndex
+func schemaByIndex(s Schema) []SchemaItem {
+	items := make([]SchemaItem, len(s))
+	for _, si := range s {
+		if int(si.dataIndex) < len(items) {
+			items[si.dataIndex] = si
+		}
+	}
+	return items
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Encoding   /////////////////////////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendObject(b []byte, s Schema, data []interface{}) ([]byte, int) {
+	items := schemaByIndex(s)
+	b = binary.AppendUvarint(b, uint64(len(items)))
+	var err int
+	for i, si := range items {
+		var v interface{}
+		if i < len(data) {
+			v = data[i]
+		}
+		if b, err = appendItem(b, si, v); err != 0 {
+			return nil, err
+		}
+	}
+	return b, 0
+}
+
+func appendItem(b []byte, si SchemaItem, v interface{}) ([]byte, int) {
+	if v == nil {
+		return append(b, 0), 0
+	}
+	b = append(b, 1)
+	var ok bool
+	switch si.typeName {
+	case ItemTypeBool:
+		var t bool
+		if t, ok = v.(bool); ok {
+			if t {
+				b = append(b, 1)
+			} else {
+				b = append(b, 0)
+			}
+		}
+
+	case ItemTypeInt8:
+		var i int8
+		if i, ok = makeInt8(v); ok {
+			b = append(b, byte(i))
+		}
+
+	case ItemTypeInt16:
+		var i int16
+		if i, ok = makeInt16(v); ok {
+			b = binary.BigEndian.AppendUint16(b, uint16(i))
+		}
+
+	case ItemTypeInt32:
+		var i int32
+		if i, ok = makeInt32(v); ok {
+			b = binary.BigEndian.AppendUint32(b, uint32(i))
+		}
+
+	case ItemTypeInt64:
+		var i int64
+		if i, ok = makeInt64(v); ok {
+			b = binary.BigEndian.AppendUint64(b, uint64(i))
+		}
+
+	case ItemTypeUint8:
+		var i uint8
+		if i, ok = makeUint8(v); ok {
+			b = append(b, i)
+		}
+
+	case ItemTypeUint16:
+		var i uint16
+		if i, ok = makeUint16(v); ok {
+			b = binary.BigEndian.AppendUint16(b, i)
+		}
+
+	case ItemTypeUint32:
+		var i uint32
+		if i, ok = makeUint32(v); ok {
+			b = binary.BigEndian.AppendUint32(b, i)
+		}
+
+	case ItemTypeUint64:
+		var i uint64
+		if i, ok = makeUint64(v); ok {
+			b = binary.BigEndian.AppendUint64(b, i)
+		}
+
+	case ItemTypeFloat32:
+		var f float32
+		if f, ok = makeFloat32(v); ok {
+			b = binary.BigEndian.AppendUint32(b, math.Float32bits(f))
+		}
+
+	case ItemTypeFloat64:
+		var f float64
+		if f, ok = makeFloat64(v); ok {
+			b = binary.BigEndian.AppendUint64(b, math.Float64bits(f))
+		}
+
+	case ItemTypeString:
+		var s string
+		if s, ok = v.(string); ok {
+			b = appendString(b, s)
+		}
+
+	case ItemTypeTime:
+		var t time.Time
+		if t, ok = v.(time.Time); !ok {
+			// Time from a JSON entry
+			if s, isStr := v.(string); isStr {
+				var tErr error
+				t, tErr = time.Parse(TimeFormatRFC3339, s)
+				ok = tErr == nil
+			}
+		}
+		if ok {
+			tb, tErr := t.MarshalBinary()
+			if tErr != nil {
+				return nil, helpers.ErrorBinaryEncoding
+			}
+			b = appendString(b, string(tb))
+		}
+
+	case ItemTypeArray:
+		var ary []interface{}
+		if ary, ok = v.([]interface{}); ok {
+			b = binary.AppendUvarint(b, uint64(len(ary)))
+			dataType := si.iType.(ArrayItem).dataType
+			var err int
+			for _, item := range ary {
+				if b, err = appendItem(b, dataType, item); err != 0 {
+					return nil, err
+				}
+			}
+		}
+
+	case ItemTypeMap:
+		var m map[string]interface{}
+		if m, ok = v.(map[string]interface{}); ok {
+			b = binary.AppendUvarint(b, uint64(len(m)))
+			dataType := si.iType.(MapItem).dataType
+			var err int
+			for key, item := range m {
+				b = appendString(b, key)
+				if b, err = appendItem(b, dataType, item); err != 0 {
+					return nil, err
+				}
+			}
+		}
+
+	case ItemTypeObject:
+		var obj []interface{}
+		if obj, ok = v.([]interface{}); ok {
+			var err int
+			if b, err = appendObject(b, si.iType.(ObjectItem).schema, obj); err != 0 {
+				return nil, err
+			}
+		}
+	}
+	if !ok {
+		return nil, helpers.ErrorBinaryEncoding
+	}
+	return b, 0
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Decoding   /////////////////////////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// binaryDecoder reads values from the front of b. Once a read goes out of bounds, bad is set and every read after
+// returns a zero value.
+type binaryDecoder struct {
+	b   []byte
+	bad bool
+}
+
+func (d *binaryDecoder) next(n uint64) []byte {
+	if d.bad || n > uint64(len(d.b)) {
+		d.bad = true
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	if d.bad {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.bad = true
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// count reads an item count, checking that there are at least enough bytes left for each item's presence byte
+func (d *binaryDecoder) count() int {
+	c := d.uvarint()
+	if c > uint64(len(d.b)) {
+		d.bad = true
+		return 0
+	}
+	return int(c)
+}
+
+func (d *binaryDecoder) string() string {
+	return string(d.next(d.uvarint()))
+}
+
+func (d *binaryDecoder) object(s Schema) []interface{} {
+	items := schemaByIndex(s)
+	c := d.count()
+	data := make([]interface{}, len(items))
+	for i := 0; i < c && !d.bad; i++ {
+		if i >= len(items) {
+			// Entry was made with a larger schema
+			d.bad = true
+			break
+		}
+		data[i] = d.item(items[i])
+	}
+	// Fill items added to the schema since the entry was made
+	for i := c; i < len(items) && !d.bad; i++ {
+		data[i], _ = defaultVal(items[i])
+	}
+	return data
+}
+
+func (d *binaryDecoder) item(si SchemaItem) interface{} {
+	if p := d.next(1); p == nil || p[0] == 0 {
+		return nil
+	}
+	switch si.typeName {
+	case ItemTypeBool:
+		if v := d.next(1); v != nil {
+			return v[0] == 1
+		}
+
+	case ItemTypeInt8:
+		if v := d.next(1); v != nil {
+			return int8(v[0])
+		}
+
+	case ItemTypeInt16:
+		if v := d.next(2); v != nil {
+			return int16(binary.BigEndian.Uint16(v))
+		}
+
+	case ItemTypeInt32:
+		if v := d.next(4); v != nil {
+			return int32(binary.BigEndian.Uint32(v))
+		}
+
+	case ItemTypeInt64:
+		if v := d.next(8); v != nil {
+			// 64-bit integers are kept in memory as strings
+			return strconv.FormatInt(int64(binary.BigEndian.Uint64(v)), 10)
+		}
+
+	case ItemTypeUint8:
+		if v := d.next(1); v != nil {
+			return v[0]
+		}
+
+	case ItemTypeUint16:
+		if v := d.next(2); v != nil {
+			return binary.BigEndian.Uint16(v)
+		}
+
+	case ItemTypeUint32:
+		if v := d.next(4); v != nil {
+			return binary.BigEndian.Uint32(v)
+		}
+
+	case ItemTypeUint64:
+		if v := d.next(8); v != nil {
+			return strconv.FormatUint(binary.BigEndian.Uint64(v), 10)
+		}
+
+	case ItemTypeFloat32:
+		if v := d.next(4); v != nil {
+			return math.Float32frombits(binary.BigEndian.Uint32(v))
+		}
+
+	case ItemTypeFloat64:
+		if v := d.next(8); v != nil {
+			return math.Float64frombits(binary.BigEndian.Uint64(v))
+		}
+
+	case ItemTypeString:
+		return d.string()
+
+	case ItemTypeTime:
+		var t time.Time
+		if err := t.UnmarshalBinary(d.next(d.uvarint())); err != nil {
+			d.bad = true
+			return nil
+		}
+		return t
+
+	case ItemTypeArray:
+		c := d.count()
+		ary := make([]interface{}, c)
+		dataType := si.iType.(ArrayItem).dataType
+		for i := 0; i < c && !d.bad; i++ {
+			ary[i] = d.item(dataType)
+		}
+		return ary
+
+	case ItemTypeMap:
+		c := d.count()
+		m := make(map[string]interface{}, c)
+		dataType := si.iType.(MapItem).dataType
+		for i := 0; i < c && !d.bad; i++ {
+			key := d.string()
+			m[key] = d.item(dataType)
+		}
+		return m
+
+	case ItemTypeObject:
+		return d.object(si.iType.(ObjectItem).schema)
+
+	default:
+		d.bad = true
+	}
+	return nil
+}
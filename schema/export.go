@@ -0,0 +1,328 @@
+package schema
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"io"
+	sorting "sort"
+	"strconv"
+	"time"
+)
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Exports   //////////////////////////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Tables are exported one entry per row, as JSON Lines or CSV. A row starts with the entry's header values (like a
+// key, or a user name and password), followed by it's items by their schema names:
+//
+//	{"Key":"Mary","Items":{"email":"mary@example.com","friends":[{"name":"Joe","status":1}]}}
+//
+// CSV exports have a header row with the header value and item names as columns, and can only be made for flat
+// schemas (no Array, Map, or Object items).
+//
+// Items are exported as they're stored, so they can be imported without changes: Time items are RFC3339, Int64 and
+// Uint64 items are decimal strings, and encrypted Strings stay encrypted. Imported items are checked with ItemFilter
+// like when they're restored from a data file.
+
+// RowError is an error importing one of the rows of an export
+type RowError struct {
+	Row   int    // Line number of the row
+	Key   string // The row's first header value, if it could be read
+	Error helpers.Error
+}
+
+// ExportItems makes the items of an entry's data into a map of their schema names to their exported values
+func ExportItems(s Schema, data []interface{}) map[string]interface{} {
+	items := make(map[string]interface{}, len(s))
+	for itemName, si := range s {
+		if int(si.dataIndex) < len(data) {
+			items[itemName] = exportItem(si, data[si.dataIndex])
+		} else {
+			items[itemName] = nil
+		}
+	}
+	return items
+}
+
+func exportItem(si SchemaItem, v interface{}) interface{} {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(TimeFormatRFC3339Nano)
+	case []interface{}:
+		switch it := si.iType.(type) {
+		case ObjectItem:
+			return ExportItems(it.schema, t)
+		case ArrayItem:
+			a := make([]interface{}, len(t))
+			for i, av := range t {
+				a[i] = exportItem(it.dataType, av)
+			}
+			return a
+		}
+	case map[string]interface{}:
+		if it, ok := si.iType.(MapItem); ok {
+			m := make(map[string]interface{}, len(t))
+			for n, mv := range t {
+				m[n] = exportItem(it.dataType, mv)
+			}
+			return m
+		}
+	}
+	return v
+}
+
+// Flat returns true if a Schema has no Array, Map, or Object items, so it's entries can be exported as CSV
+func (s Schema) Flat() bool {
+	for _, si := range s {
+		switch si.typeName {
+		case ItemTypeArray, ItemTypeMap, ItemTypeObject:
+			return false
+		}
+	}
+	return true
+}
+
+// ItemNames returns the names of a Schema's items in alphabetical order
+func (s Schema) ItemNames() []string {
+	names := make([]string, 0, len(s))
+	for itemName := range s {
+		names = append(names, itemName)
+	}
+	sorting.Strings(names)
+	return names
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Writing Exports   //////////////////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// RowWriter writes entries to an export
+type RowWriter struct {
+	s     Schema
+	head  []string // Names of the header values
+	names []string // Item names, in CSV column order
+	w     *bufio.Writer
+	cw    *csv.Writer
+}
+
+// NewRowWriter makes a RowWriter for entries of a Schema with the named header values. When asCSV is true, the
+// Schema must be flat, and the CSV header row is written.
+func NewRowWriter(w io.Writer, s Schema, head []string, asCSV bool) (*RowWriter, helpers.Error) {
+	rw := RowWriter{s: s, head: head, w: bufio.NewWriter(w)}
+	if !asCSV {
+		return &rw, helpers.Error{}
+	}
+	if !s.Flat() {
+		return nil, helpers.NewError(helpers.ErrorCSVFormat, "Schema has Array, Map, or Object items")
+	}
+	rw.names = s.ItemNames()
+	rw.cw = csv.NewWriter(rw.w)
+	if err := rw.cw.Write(append(append([]string{}, head...), rw.names...)); err != nil {
+		return nil, helpers.NewError(helpers.ErrorFileWrite, err.Error())
+	}
+	return &rw, helpers.Error{}
+}
+
+// Write writes an entry's header values and data as a row
+func (rw *RowWriter) Write(head []string, data []interface{}) int {
+	items := ExportItems(rw.s, data)
+	if rw.cw != nil {
+		record := append([]string{}, head...)
+		for _, itemName := range rw.names {
+			record = append(record, csvCell(items[itemName]))
+		}
+		if err := rw.cw.Write(record); err != nil {
+			return helpers.ErrorFileWrite
+		}
+		return 0
+	}
+	// Header values are written before the items, in order
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, h := range head {
+		hn, _ := helpers.Fjson.Marshal(rw.head[i])
+		hv, _ := helpers.Fjson.Marshal(h)
+		b.Write(hn)
+		b.WriteByte(':')
+		b.Write(hv)
+		b.WriteByte(',')
+	}
+	ib, jErr := helpers.Fjson.Marshal(items)
+	if jErr != nil {
+		return helpers.ErrorJsonEncoding
+	}
+	b.WriteString("\"Items\":")
+	b.Write(ib)
+	b.WriteString("}\n")
+	if _, err := rw.w.Write(b.Bytes()); err != nil {
+		return helpers.ErrorFileWrite
+	}
+	return 0
+}
+
+// Flush writes any buffered rows
+func (rw *RowWriter) Flush() int {
+	if rw.cw != nil {
+		rw.cw.Flush()
+		if rw.cw.Error() != nil {
+			return helpers.ErrorFileWrite
+		}
+	}
+	if err := rw.w.Flush(); err != nil {
+		return helpers.ErrorFileWrite
+	}
+	return 0
+}
+
+func csvCell(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'g', -1, 32)
+	}
+	return fmt.Sprint(v)
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Reading Exports   //////////////////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// RowReader reads entries from an export
+type RowReader struct {
+	s       Schema
+	head    []string // Names of the header values
+	columns []string // Item names, in CSV column order
+	r       *bufio.Reader
+	cr      *csv.Reader
+	row     int
+}
+
+// NewRowReader makes a RowReader for entries of a Schema with the named header values. When asCSV is true, the CSV
+// header row is read, and must start with the header value names followed by names of items in the Schema.
+func NewRowReader(r io.Reader, s Schema, head []string, asCSV bool) (*RowReader, helpers.Error) {
+	rr := RowReader{s: s, head: head, r: bufio.NewReader(r)}
+	if !asCSV {
+		return &rr, helpers.Error{}
+	}
+	if !s.Flat() {
+		return nil, helpers.NewError(helpers.ErrorCSVFormat, "Schema has Array, Map, or Object items")
+	}
+	rr.cr = csv.NewReader(rr.r)
+	columns, err := rr.cr.Read()
+	rr.row = 1
+	if err != nil {
+		return nil, helpers.NewError(helpers.ErrorCSVFormat, "Missing header row")
+	} else if len(columns) < len(head) {
+		return nil, helpers.NewError(helpers.ErrorCSVFormat, "Header row must start with columns for " + fmt.Sprint(head))
+	}
+	for i, h := range head {
+		if columns[i] != h {
+			return nil, helpers.NewError(helpers.ErrorCSVFormat, "Header row must start with columns for " + fmt.Sprint(head))
+		}
+	}
+	rr.columns = columns[len(head):]
+	for _, itemName := range rr.columns {
+		if _, ok := s[itemName]; !ok {
+			return nil, helpers.NewError(helpers.ErrorInvalidItem, itemName)
+		}
+	}
+	return &rr, helpers.Error{}
+}
+
+// Read reads the next row, returning it's header values and items. Items still need to be checked with ItemFilter
+// (with restore set to true). Returns false when there are no more rows. A row that can't be read returns an error
+// code, and the next row can still be read unless the code is helpers.ErrorFileRead.
+func (rr *RowReader) Read() ([]string, map[string]interface{}, int, bool) {
+	if rr.cr != nil {
+		return rr.readCSV()
+	}
+	for {
+		line, err := rr.r.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			return nil, nil, 0, false
+		} else if err != nil && err != io.EOF {
+			return nil, nil, helpers.ErrorFileRead, true
+		}
+		rr.row++
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		var row map[string]interface{}
+		if jErr := helpers.Fjson.Unmarshal(line, &row); jErr != nil {
+			return nil, nil, helpers.ErrorJsonDecoding, true
+		}
+		head := make([]string, len(rr.head))
+		for i, h := range rr.head {
+			var ok bool
+			if head[i], ok = row[h].(string); !ok {
+				return head[:i], nil, helpers.ErrorJsonDataFormat, true
+			}
+		}
+		items, ok := row["Items"].(map[string]interface{})
+		if !ok && row["Items"] != nil {
+			return head, nil, helpers.ErrorJsonDataFormat, true
+		}
+		for itemName := range items {
+			if _, ok = rr.s[itemName]; !ok {
+				return head, nil, helpers.ErrorInvalidItem, true
+			}
+		}
+		return head, items, 0, true
+	}
+}
+
+func (rr *RowReader) readCSV() ([]string, map[string]interface{}, int, bool) {
+	record, err := rr.cr.Read()
+	if err == io.EOF {
+		return nil, nil, 0, false
+	}
+	if pErr, ok := err.(*csv.ParseError); ok {
+		rr.row = pErr.StartLine
+		return nil, nil, helpers.ErrorCSVFormat, true
+	} else if err != nil {
+		return nil, nil, helpers.ErrorFileRead, true
+	}
+	rr.row, _ = rr.cr.FieldPos(0)
+	head := append([]string{}, record[:len(rr.head)]...)
+	items := make(map[string]interface{}, len(rr.columns))
+	for i, itemName := range rr.columns {
+		if v := csvValue(rr.s[itemName], record[len(rr.head)+i]); v != nil {
+			items[itemName] = v
+		}
+	}
+	return head, items, 0, true
+}
+
+// Row returns the line number of the last row read
+func (rr *RowReader) Row() int {
+	return rr.row
+}
+
+// csvValue converts a CSV cell to the type ItemFilter takes for an item. Empty cells are nil, so the item gets it's
+// default value. Cells that can't be converted are left as strings for ItemFilter to reject.
+func csvValue(si SchemaItem, cell string) interface{} {
+	if len(cell) == 0 {
+		return nil
+	}
+	switch si.typeName {
+	case ItemTypeBool:
+		if b, err := strconv.ParseBool(cell); err == nil {
+			return b
+		}
+	case ItemTypeInt8, ItemTypeInt16, ItemTypeInt32, ItemTypeUint8, ItemTypeUint16,
+		ItemTypeUint32, ItemTypeFloat32, ItemTypeFloat64:
+		if f, err := strconv.ParseFloat(cell, 64); err == nil {
+			return f
+		}
+	}
+	return cell
+}
@@ -769,6 +769,9 @@ func timeFilter(filter *Filter) int {
 		it := filter.schemaItems[len(filter.schemaItems)-1].iType.(TimeItem)
 		filter.item = t.Format(it.format)
 		return 0
+	} else if _, ok := filter.item.(time.Time); ok && filter.restore && len(filter.methods) == 0 {
+		// Restoring from a binary entry
+		return 0
 	} else if i, ok := filter.item.(string); ok {
 		if len(filter.methods) > 0 {
 			return helpers.ErrorInvalidMethod
@@ -0,0 +1,149 @@
+package schema
+
+import (
+	"strings"
+)
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Index Paths   //////////////////////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A table's items can be indexed when they're numeric, or an unencrypted String, either at the top level of the
+// schema or nested in Objects (like "profile.country"). Indexed values are converted to the type their item's query
+// methods compare with (Int64 for Ints, Uint64 for Uints, Float64 for Floats), so an index orders values the same way
+// as *eq, *gt, *gte, *lt, and *lte.
+
+// IndexPath is the path to an item that can be indexed
+type IndexPath struct {
+	name  string
+	items []SchemaItem // schema items from the top level of the schema to the indexed item
+}
+
+// NewIndexPath makes an IndexPath for an item name like "mmr" or "profile.country". Returns false if the item isn't
+// in the schema, or can't be indexed.
+func NewIndexPath(s Schema, name string) (IndexPath, bool) {
+	p := IndexPath{name: name}
+	for _, itemName := range strings.Split(name, ".") {
+		si := s[itemName]
+		if !si.QuickValidate() {
+			return IndexPath{}, false
+		}
+		p.items = append(p.items, si)
+		if si.typeName == ItemTypeObject {
+			s = si.iType.(ObjectItem).schema
+		} else {
+			s = nil
+		}
+	}
+	leaf := p.items[len(p.items)-1]
+	if !leaf.IsNumeric() && (leaf.typeName != ItemTypeString || leaf.iType.(StringItem).encrypted) {
+		return IndexPath{}, false
+	}
+	return p, true
+}
+
+// Name gets the item name the IndexPath was made with
+func (p IndexPath) Name() string {
+	return p.name
+}
+
+// Value gets the indexed item's value from an entry's data
+func (p IndexPath) Value(data []interface{}) (interface{}, bool) {
+	var v interface{} = data
+	for _, si := range p.items {
+		d, ok := v.([]interface{})
+		if !ok || int(si.dataIndex) >= len(d) {
+			return nil, false
+		}
+		v = d[si.dataIndex]
+	}
+	return p.IndexValue(v)
+}
+
+// IndexValue converts a value (like a method parameter) to the type values of the item are indexed as
+func (p IndexPath) IndexValue(v interface{}) (interface{}, bool) {
+	switch p.items[len(p.items)-1].typeName {
+	case ItemTypeInt8, ItemTypeInt16, ItemTypeInt32, ItemTypeInt64:
+		return makeInt64(v)
+	case ItemTypeUint8, ItemTypeUint16, ItemTypeUint32, ItemTypeUint64:
+		return makeUint64(v)
+	case ItemTypeFloat32, ItemTypeFloat64:
+		return makeFloat64(v)
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+// CompareIndexValues compares two values of the same IndexPath. Returns -1 if a is less than b, 1 if a is greater
+// than b, or 0 if they're equal.
+func CompareIndexValues(a interface{}, b interface{}) int {
+	switch at := a.(type) {
+	case int64:
+		if bt := b.(int64); at < bt {
+			return -1
+		} else if at > bt {
+			return 1
+		}
+	case uint64:
+		if bt := b.(uint64); at < bt {
+			return -1
+		} else if at > bt {
+			return 1
+		}
+	case float64:
+		if bt := b.(float64); at < bt {
+			return -1
+		} else if at > bt {
+			return 1
+		}
+	case string:
+		if bt := b.(string); at < bt {
+			return -1
+		} else if at > bt {
+			return 1
+		}
+	}
+	return 0
+}
+
+// IndexBounds gets the lowest and highest values the item at p can have in entries that match w, from w's *eq, *gt,
+// *gte, *lt, and *lte conditions on the item. Bounds are inclusive, and nil when there isn't one. Returns false if w
+// has no conditions on the item.
+func (w Where) IndexBounds(p IndexPath) (interface{}, interface{}, bool) {
+	var lo, hi interface{}
+	var found bool
+	for _, c := range w {
+		if len(c.methods) != len(p.items) || c.si.name != p.items[0].name {
+			continue
+		}
+		var onPath bool = true
+		for i, m := range c.methods[:len(c.methods)-1] {
+			if m != p.items[i+1].name {
+				onPath = false
+				break
+			}
+		}
+		params, ok := c.params.([]interface{})
+		if !onPath || !ok || len(params) != 1 {
+			continue
+		}
+		v, ok := p.IndexValue(params[0])
+		if !ok {
+			continue
+		}
+		method := c.methods[len(c.methods)-1]
+		if method == MethodEquals || method == MethodGreater || method == MethodGreaterOE {
+			if lo == nil || CompareIndexValues(v, lo) > 0 {
+				lo = v
+			}
+			found = true
+		}
+		if method == MethodEquals || method == MethodLess || method == MethodLessOE {
+			if hi == nil || CompareIndexValues(v, hi) < 0 {
+				hi = v
+			}
+			found = true
+		}
+	}
+	return lo, hi, found
+}
@@ -0,0 +1,124 @@
+package schema
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"math"
+	"strconv"
+)
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Inferring a Schema   ///////////////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// When a table loses it's config file and the copy of it, a schema can still be inferred from the data of it's JSON
+// entries. Item names aren't kept with entries, so items are named by their position ("item0", "item1", ...), and
+// each gets the simplest type that fits every value found for it:
+//
+//	- Bools are Bools, and Strings are Strings (Times and Int64s kept as Strings included)
+//	- Numbers are Int64s when they are all whole, or Float64s otherwise
+//	- Maps are Maps of the type that fits their values
+//	- Lists are Arrays of the type that fits their items, or Objects inferred like an entry when they don't fit one
+//	- Items without any values are Strings
+//
+// Limits, defaults, and required, unique, or encrypted settings can't be inferred, and are left off.
+
+const inferItemPrefix = "item"
+
+// Infer makes a schema config from the data of a table's entries. Returns helpers.ErrorSchemaInvalidItemParameters if
+// the values of an item have types that don't fit together.
+func Infer(data [][]interface{}) ([]SchemaConfigItem, int) {
+	var items int
+	for _, d := range data {
+		if len(d) > items {
+			items = len(d)
+		}
+	}
+	sc := make([]SchemaConfigItem, items, items)
+	for i := range sc {
+		values := make([]interface{}, 0, len(data))
+		for _, d := range data {
+			if i < len(d) {
+				values = append(values, d[i])
+			}
+		}
+		dataType, err := inferDataType(values)
+		if err != 0 {
+			return nil, err
+		}
+		sc[i] = SchemaConfigItem{Position: uint32(i), Name: inferItemPrefix + strconv.Itoa(i), DataType: dataType}
+	}
+	return sc, 0
+}
+
+// inferDataType gets the config data type that fits every value of an item
+func inferDataType(values []interface{}) ([]interface{}, int) {
+	var bools, numbers, wholeNumbers, strings, lists, maps int
+	for _, v := range values {
+		switch t := v.(type) {
+		case nil:
+			continue
+		case bool:
+			bools++
+		case float64:
+			numbers++
+			if t == math.Trunc(t) {
+				wholeNumbers++
+			}
+		case string:
+			strings++
+		case []interface{}:
+			lists++
+		case map[string]interface{}:
+			maps++
+		default:
+			return nil, helpers.ErrorSchemaInvalidItemParameters
+		}
+	}
+	switch total := bools + numbers + strings + lists + maps; total {
+	case 0, strings:
+		return []interface{}{ItemTypeString, "", float64(0), false, false, false}, 0
+	case bools:
+		return []interface{}{ItemTypeBool, false}, 0
+	case wholeNumbers:
+		return []interface{}{ItemTypeInt64, float64(0), float64(0), float64(0), false, false, false}, 0
+	case numbers:
+		return []interface{}{ItemTypeFloat64, float64(0), float64(0), float64(0), false, false, false}, 0
+	case maps:
+		var mapValues []interface{}
+		for _, v := range values {
+			if m, ok := v.(map[string]interface{}); ok {
+				for _, mv := range m {
+					mapValues = append(mapValues, mv)
+				}
+			}
+		}
+		dataType, err := inferDataType(mapValues)
+		if err != 0 {
+			return nil, err
+		}
+		return []interface{}{ItemTypeMap, dataType, float64(0), false}, 0
+	case lists:
+		var listItems []interface{}
+		objects := make([][]interface{}, 0, lists)
+		for _, v := range values {
+			if l, ok := v.([]interface{}); ok {
+				listItems = append(listItems, l...)
+				objects = append(objects, l)
+			}
+		}
+		if dataType, err := inferDataType(listItems); err == 0 {
+			return []interface{}{ItemTypeArray, dataType, float64(0), false}, 0
+		}
+		sc, err := Infer(objects)
+		if err != 0 {
+			return nil, err
+		}
+		// Object schemas are restored from their config like a config file's JSON
+		objectSchema := make([]interface{}, len(sc), len(sc))
+		for i, item := range sc {
+			objectSchema[i] = map[string]interface{}{"Position": float64(item.Position), "Name": item.Name, "DataType": item.DataType}
+		}
+		return []interface{}{ItemTypeObject, objectSchema}, 0
+	}
+	return nil, helpers.ErrorSchemaInvalidItemParameters
+}
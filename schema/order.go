@@ -0,0 +1,185 @@
+package schema
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Entry Ordering   ///////////////////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A table's entries can be ordered by one or more of it's items, like an Array is sorted by an item of it's Objects.
+// Each item is named like a sort-by parameter ("mmr", or "profile.joined"), and can end with *sortAsc (the default)
+// or *sortDesc. Entries that are equal for the first item are ordered by the next:
+//
+//	["mmr.*sortDesc", "profile.joined"]
+//
+// Pages of ordered entries continue from a cursor made of the last entry's values and key (see Cursor), so a page
+// starts at the first entry ordered after it, even when the last entry was changed or deleted since.
+
+// Order is an order for a table's entries that's been checked against a schema
+type Order []orderItem
+
+type orderItem struct {
+	si          SchemaItem
+	dataIndexes []int
+	desc        bool
+}
+
+// NewOrder makes an Order from a list of items. Items must be numeric, unencrypted Strings, Times, or Bools, either
+// at the top level of the schema or nested in Objects.
+func NewOrder(s Schema, by []string) (Order, helpers.Error) {
+	o := make(Order, 0, len(by))
+	for _, name := range by {
+		byArr := strings.Split(name, ".")
+		var desc bool
+		if last := byArr[len(byArr)-1]; last == MethodSortAsc || last == MethodSortDesc {
+			desc = last == MethodSortDesc
+			byArr = byArr[:len(byArr)-1]
+		}
+		if len(byArr) == 0 || byArr[0] == "" {
+			return nil, helpers.NewError(helpers.ErrorInvalidItem, name)
+		}
+		dataIndexes := make([]int, len(byArr), len(byArr))
+		si, err := checkSortByItem(s, byArr, dataIndexes, 0)
+		if err != 0 {
+			return nil, helpers.NewError(helpers.ErrorInvalidItem, name)
+		} else if si.typeName == ItemTypeString && si.iType.(StringItem).encrypted {
+			return nil, helpers.NewError(helpers.ErrorArrayItemNotSortable, name)
+		}
+		o = append(o, orderItem{si: si, dataIndexes: dataIndexes, desc: desc})
+	}
+	return o, helpers.Error{}
+}
+
+// Values gets the values an entry is ordered by from it's data. Values that are missing are nil.
+func (o Order) Values(data []interface{}) []interface{} {
+	values := make([]interface{}, len(o), len(o))
+	for i, item := range o {
+		var v interface{} = data
+		for _, dataIndex := range item.dataIndexes {
+			d, ok := v.([]interface{})
+			if !ok || dataIndex >= len(d) {
+				v = nil
+				break
+			}
+			v = d[dataIndex]
+		}
+		values[i] = item.orderValue(v)
+	}
+	return values
+}
+
+// orderValue converts an item's value to the type it's compared as, or nil if it can't be
+func (item orderItem) orderValue(v interface{}) interface{} {
+	var ok bool
+	switch item.si.typeName {
+	case ItemTypeInt8, ItemTypeInt16, ItemTypeInt32, ItemTypeInt64:
+		v, ok = makeInt64(v)
+	case ItemTypeUint8, ItemTypeUint16, ItemTypeUint32, ItemTypeUint64:
+		v, ok = makeUint64(v)
+	case ItemTypeFloat32, ItemTypeFloat64:
+		v, ok = makeFloat64(v)
+	case ItemTypeTime:
+		v, ok = makeTime(v, &item.si)
+	case ItemTypeString:
+		v, ok = v.(string)
+	case ItemTypeBool:
+		v, ok = v.(bool)
+	}
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// Compare compares the values of two entries (see Values). Returns -1 if a is ordered before b, 1 if a is ordered
+// after b, or 0 if they're equal. Missing values are ordered before every other value.
+func (o Order) Compare(a []interface{}, b []interface{}) int {
+	for i, item := range o {
+		var c int
+		if a[i] == nil || b[i] == nil {
+			if a[i] != nil {
+				c = 1
+			} else if b[i] != nil {
+				c = -1
+			}
+		} else if at, ok := a[i].(time.Time); ok {
+			if bt := b[i].(time.Time); at.Before(bt) {
+				c = -1
+			} else if at.After(bt) {
+				c = 1
+			}
+		} else if ab, ok := a[i].(bool); ok {
+			if bb := b[i].(bool); !ab && bb {
+				c = -1
+			} else if ab && !bb {
+				c = 1
+			}
+		} else {
+			c = CompareIndexValues(a[i], b[i])
+		}
+		if item.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Cursor makes a cursor for an entry's place in the order from it's values (see Values) and key. Int64s and Uint64s
+// are kept as decimal strings, and Times as RFC3339 with nanoseconds, so they're read back exactly by ParseCursor.
+func (o Order) Cursor(values []interface{}, key string) string {
+	c := make([]interface{}, len(values) + 1, len(values) + 1)
+	for i, v := range values {
+		switch t := v.(type) {
+		case int64:
+			c[i] = strconv.FormatInt(t, 10)
+		case uint64:
+			c[i] = strconv.FormatUint(t, 10)
+		case time.Time:
+			c[i] = t.Format(TimeFormatRFC3339Nano)
+		default:
+			c[i] = v
+		}
+	}
+	c[len(values)] = key
+	b, jErr := helpers.Fjson.Marshal(c)
+	if jErr != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// ParseCursor gets the values and key of an entry's place in the order from a cursor made with Cursor. Returns false
+// if cursor isn't a cursor of the Order.
+func (o Order) ParseCursor(cursor string) ([]interface{}, string, bool) {
+	var c []interface{}
+	if jErr := helpers.Fjson.Unmarshal([]byte(cursor), &c); jErr != nil || len(c) != len(o) + 1 {
+		return nil, "", false
+	}
+	key, ok := c[len(o)].(string)
+	if !ok {
+		return nil, "", false
+	}
+	values := make([]interface{}, len(o), len(o))
+	for i, item := range o {
+		if c[i] == nil {
+			continue
+		} else if str, ok := c[i].(string); ok && item.si.typeName == ItemTypeTime {
+			t, tErr := time.Parse(TimeFormatRFC3339Nano, str)
+			if tErr != nil {
+				return nil, "", false
+			}
+			values[i] = t
+		} else if values[i] = item.orderValue(c[i]); values[i] == nil {
+			return nil, "", false
+		}
+	}
+	return values, key, true
+}
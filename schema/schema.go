@@ -454,6 +454,27 @@ func (si SchemaItem) IsFloat() bool {
 	}
 }
 
+// Float64 converts a stored value of a numeric SchemaItem to a float64. Int64 and Uint64 values are stored as decimal
+// strings, so they're parsed first.
+func (si SchemaItem) Float64(v interface{}) (float64, bool) {
+	switch si.typeName {
+	case ItemTypeInt64:
+		if i, ok := makeInt64(v); ok {
+			return makeFloat64(i)
+		}
+		return 0, false
+	case ItemTypeUint64:
+		if i, ok := makeUint64(v); ok {
+			return makeFloat64(i)
+		}
+		return 0, false
+	}
+	if !si.IsNumeric() {
+		return 0, false
+	}
+	return makeFloat64(v)
+}
+
 // Unique returns true if the SchemaItem is unique.
 func (si SchemaItem) Required() bool {
 	switch si.typeName {
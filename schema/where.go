@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+)
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Where Clauses   ////////////////////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A where clause is made of conditions in the same format as the items of a get query, each ending with a method
+// that makes a Bool (*eq, *gt, *lt, *gte, *lte, *contains), or naming a Bool item. An entry matches the clause when
+// every condition is true:
+//
+//	{"mmr.*gte": [2000], "friends.*len.*lt": [10], "profile.country.*eq": ["CA"]}
+//
+
+// Where is a where clause that's been checked against a schema
+type Where []whereCondition
+
+type whereCondition struct {
+	name    string
+	methods []string
+	params  interface{}
+	si      SchemaItem
+}
+
+// NewWhere makes a Where from a map of conditions. Every condition must be for an item in the schema.
+func NewWhere(s Schema, conditions map[string]interface{}) (Where, helpers.Error) {
+	w := make(Where, 0, len(conditions))
+	for itemName, params := range conditions {
+		siName, methods := GetQueryItemMethods(itemName)
+		si := s[siName]
+		if !si.QuickValidate() {
+			return nil, helpers.NewError(helpers.ErrorInvalidItem, itemName)
+		}
+		w = append(w, whereCondition{name: itemName, methods: methods, params: params, si: si})
+	}
+	return w, helpers.Error{}
+}
+
+// Matches checks if an entry's data matches every condition. A condition that doesn't make a Bool is an
+// ErrorInvalidMethod.
+func (w Where) Matches(data []interface{}, eCost int) (bool, helpers.Error) {
+	for _, c := range w {
+		var i interface{}
+		if err := ItemFilter(c.params, c.methods, &i, data[c.si.dataIndex], c.si, nil, eCost, true, false); err != 0 {
+			return false, helpers.NewError(err, c.name)
+		}
+		match, ok := i.(bool)
+		if !ok {
+			return false, helpers.NewError(helpers.ErrorInvalidMethod, c.name)
+		} else if !match {
+			return false, helpers.Error{}
+		}
+	}
+	return true, helpers.Error{}
+}
@@ -6,12 +6,6 @@ package main
 //////////////////         - Setting server name/address, subject & body message for password reset emails
 //////////////////         - Send configurable emails for password resets
 //////////////////
-//////////////////     - Database server
-//////////////////         - Connection authentication
-//////////////////         - Connection privillages
-//////////////////
-//////////////////     - Rate & connection limiting
-//////////////////
 //////////////////     - Clustering
 //////////////////         - Connect to cluster nodes & agree upon master node
 //////////////////         - Master assigns nodes key numbers and creates a keyspace unless valid ones have been created already
@@ -27,15 +21,25 @@ package main
 
 import (
 	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/query"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"context"
+	"flag"
 	"fmt"
-	//"html"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 )
 
 var (
 	statusMux  sync.Mutex
 	masterPass []byte
+	noAuth     bool
 	dbStatus   int
 	replica    bool
 	readOnly   bool
@@ -50,7 +54,13 @@ var (
 const (
 	configFile string = "db.conf"
 
-	defaultConfigFile string = "{\"masterPass\":\"\",\"dbs\":[],\"replica\":false,\"readOnly\":false,\"replicas\":[],\"routers\":[],\"AuthTables\":[],\"Leaderboards\":[]}"
+	defaultConfigFile string = "{\"masterPass\":\"\",\"noAuth\":false,\"Keystores\":[],\"replica\":false,\"readOnly\":false,\"replicas\":[],\"routers\":[],\"AuthTables\":[],\"Leaderboards\":[],\"users\":[],\"limits\":{\"maxConnections\":0,\"queryRate\":0,\"queryBurst\":0,\"tables\":{}}}"
+
+	defaultAddress string = "localhost:8082"
+	maxQuerySize   int64  = 1 << 20 // Maximum bytes in a single query body
+
+	shutDownTimeout time.Duration = 10 * time.Second
+	userEncryptCost int           = 10 // bcrypt cost for hashing db.conf user passwords
 )
 
 // Database statuses
@@ -62,15 +72,233 @@ const (
 	statusOffline
 )
 
+// queryResponse is the JSON object sent back to a client for every query.
+type queryResponse struct {
+	R interface{}    `json:",omitempty"` // Query result
+	E *helpers.Error `json:",omitempty"` // Query error
+}
+
 func main() {
+	addr := flag.String("addr", defaultAddress, "address for the database server to listen on")
+	hash := flag.String("hash", "", "print the bcrypt hash of a password for a db.conf user, then exit")
+	convert := flag.String("convert", "", "rewrite a table's entries in the format given with -format, then exit")
+	format := flag.String("format", "binary", "entry format for -convert: \"json\" or \"binary\"")
+	verify := flag.Bool("verify", false, "check every table's data files for damaged lines, then exit")
+	repair := flag.String("repair", "", "rebuild a table's damaged data files and config file, then exit")
+	restoreArchive := flag.String("restore-backup", "", "restore a table from a backup archive, then exit")
+	export := flag.String("export", "", "write a table's entries to the file given with -file, then exit")
+	importName := flag.String("import", "", "insert entries into a table from the file given with -file, then exit")
+	file := flag.String("file", "", "file for -export and -import")
+	asCSV := flag.Bool("csv", false, "use CSV instead of JSON Lines for -export and -import")
+	flag.Parse()
+
+	if len(*hash) > 0 {
+		h, err := helpers.EncryptString(*hash, userEncryptCost)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(string(h))
+		return
+	}
+
+	// Load config
+	if err := loadConfig(); err.ID != 0 {
+		helpers.LogAndPrint(err.From, 5)
+		os.Exit(1)
+	}
+
+	if len(*convert) > 0 {
+		storage.Init()
+		err := convertTable(*convert, *format)
+		storage.ShutDown()
+		if err.ID != 0 {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Converted table '%v' to %v\n", *convert, *format)
+		return
+	} else if *verify {
+		storage.Init()
+		ok := verifyTables()
+		storage.ShutDown()
+		if !ok {
+			os.Exit(1)
+		}
+		fmt.Println("No damaged lines found")
+		return
+	} else if len(*repair) > 0 {
+		storage.Init()
+		err := repairTable(*repair)
+		storage.ShutDown()
+		if err.ID != 0 {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Repaired table '%v'\n", *repair)
+		return
+	} else if len(*restoreArchive) > 0 {
+		storage.Init()
+		name, err := restoreBackup(*restoreArchive)
+		storage.ShutDown()
+		if err.ID != 0 {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Restored table '%v' from '%v'\n", name, *restoreArchive)
+		return
+	} else if len(*export) > 0 || len(*importName) > 0 {
+		if len(*file) == 0 {
+			fmt.Println("-file is required for -export and -import")
+			os.Exit(1)
+		}
+		storage.Init()
+		var n int
+		var err helpers.Error
+		if len(*export) > 0 {
+			n, err = exportTable(*export, *file, *asCSV)
+		} else {
+			n, err = importTable(*importName, *file, *asCSV)
+		}
+		storage.ShutDown()
+		if err.ID != 0 {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if len(*export) > 0 {
+			fmt.Printf("Exported %v entries from table '%v' to '%v'\n", n, *export, *file)
+		} else {
+			fmt.Printf("Imported %v entries into table '%v' from '%v'\n", n, *importName, *file)
+		}
+		return
+	}
+
+	// Refuse to serve without authentication, unless it's turned off
+	if err := checkAuthConfig(); err.ID != 0 {
+		helpers.LogAndPrint(err.From, 5)
+		os.Exit(1)
+	}
+
+	// Initialize storage engine and restore tables
+	storage.Init()
+	restoreTables()
+
 	// initialize and start database server
-	/*http.HandleFunc("/", queryHandler)
+	initLimits()
+	listener, lErr := net.Listen("tcp", *addr)
+	if lErr != nil {
+		helpers.LogAndPrint("Could not listen on "+*addr+": "+lErr.Error(), 5)
+		closeTables()
+		storage.ShutDown()
+		os.Exit(1)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", queryHandler)
+	server := &http.Server{Addr: *addr, Handler: mux, ConnContext: connContext}
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), shutDownTimeout)
+		server.Shutdown(ctx)
+		cancel()
+	}()
 	fmt.Println("starting server...")
-	if err := http.ListenAndServe("localhost:8082", nil); err != nil {
+	if err := server.Serve(newLimitListener(listener, getLimits().MaxConnections)); err != nil && err != http.ErrServerClosed {
 		fmt.Println(err)
-	}*/
+	}
+
+	// Save tables and shut down
+	closeTables()
+	storage.ShutDown()
 }
 
+// queryHandler reads a JSON query array from the request body, executes it, and writes back a queryResponse.
+//
+//     ["Get", "users", "Maya", {"friends": []}]
+//
 func queryHandler(w http.ResponseWriter, r *http.Request) {
-	//
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeResponse(w, nil, helpers.NewError(helpers.ErrorQueryInvalidFormat, "Queries must be sent with POST"))
+		return
+	}
+	// Client rate limit
+	if rErr := allowClient(r); rErr.ID != 0 {
+		w.WriteHeader(http.StatusTooManyRequests)
+		writeResponse(w, nil, rErr)
+		return
+	}
+	// Authenticate
+	conn, aErr := authenticate(r)
+	if aErr.ID != 0 {
+		w.Header().Set("WWW-Authenticate", "Basic realm=\"GopherDB\"")
+		w.WriteHeader(http.StatusUnauthorized)
+		writeResponse(w, nil, aErr)
+		return
+	}
+	// Read query
+	body, rErr := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxQuerySize))
+	if rErr != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		writeResponse(w, nil, helpers.NewError(helpers.ErrorQueryInvalidFormat, rErr.Error()))
+		return
+	}
+	// Run query
+	q, qErr := query.Parse(body)
+	if qErr.ID != 0 {
+		writeResponse(w, nil, qErr)
+		return
+	}
+	if pErr := conn.authorize(q); pErr.ID != 0 {
+		w.WriteHeader(http.StatusForbidden)
+		writeResponse(w, nil, pErr)
+		return
+	}
+	if wErr := allowWrite(q); wErr.ID != 0 {
+		w.WriteHeader(http.StatusForbidden)
+		writeResponse(w, nil, wErr)
+		return
+	}
+	if rErr := allowTableQuery(q); rErr.ID != 0 {
+		w.WriteHeader(http.StatusTooManyRequests)
+		writeResponse(w, nil, rErr)
+		return
+	}
+	res, qErr := q.Execute()
+	if qErr.ID == 0 {
+		updateTableList(q)
+	}
+	writeResponse(w, res, qErr)
+}
+
+// allowWrite rejects queries that change tables while the server is read-only. Replicas are read-only too, since
+// their tables only change by replication.
+func allowWrite(q *query.Query) helpers.Error {
+	switch q.Type {
+	case query.TypeGet, query.TypeSelect, query.TypeBackup:
+		return helpers.Error{}
+	}
+	statusMux.Lock()
+	ro := readOnly || replica
+	statusMux.Unlock()
+	if ro {
+		return helpers.NewError(helpers.ErrorReadOnly, q.Type+" on '"+q.Table+"'")
+	}
+	return helpers.Error{}
+}
+
+func writeResponse(w http.ResponseWriter, res interface{}, err helpers.Error) {
+	resp := queryResponse{R: res}
+	if err.ID != 0 {
+		resp.E = &err
+	}
+	jBytes, jErr := helpers.Fjson.Marshal(resp)
+	if jErr != nil {
+		helpers.LogAndPrint("Failed to encode query response: " + jErr.Error(), 4)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(jBytes)
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"github.com/hewiefreeman/GopherDB/query"
+	"github.com/hewiefreeman/GopherDB/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAllowWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		config dbConfig
+		qType  string
+		err    int
+	}{
+		{"writable Insert", dbConfig{}, query.TypeInsert, 0},
+		{"writable Drop", dbConfig{}, query.TypeDrop, 0},
+		{"readOnly Get", dbConfig{ReadOnly: true}, query.TypeGet, 0},
+		{"readOnly Select", dbConfig{ReadOnly: true}, query.TypeSelect, 0},
+		{"readOnly Backup", dbConfig{ReadOnly: true}, query.TypeBackup, 0},
+		{"readOnly Insert", dbConfig{ReadOnly: true}, query.TypeInsert, helpers.ErrorReadOnly},
+		{"readOnly Update", dbConfig{ReadOnly: true}, query.TypeUpdate, helpers.ErrorReadOnly},
+		{"readOnly Create", dbConfig{ReadOnly: true}, query.TypeCreate, helpers.ErrorReadOnly},
+		{"readOnly Index", dbConfig{ReadOnly: true}, query.TypeIndex, helpers.ErrorReadOnly},
+		{"replica Get", dbConfig{Replica: true}, query.TypeGet, 0},
+		{"replica Delete", dbConfig{Replica: true}, query.TypeDelete, helpers.ErrorReadOnly},
+	}
+	for _, test := range tests {
+		useConfig(t, test.config)
+		if err := allowWrite(&query.Query{Type: test.qType, Table: "users"}); err.ID != test.err {
+			t.Errorf("TestAllowWrite %v expected error %v, but got: %v", test.name, test.err, err)
+		}
+	}
+}
+
+// queryStep is a request posted to queryHandler, and the response it expects
+type queryStep struct {
+	name   string
+	method string
+	body   string
+	status int
+	err    int
+	result string // Expected result as JSON, or empty to skip checking it
+}
+
+// runQuerySteps posts each step to queryHandler with basic auth credentials, unless user is empty
+func runQuerySteps(t *testing.T, user string, pass string, steps []queryStep) {
+	t.Helper()
+	for _, s := range steps {
+		r := httptest.NewRequest(s.method, "/", strings.NewReader(s.body))
+		if len(user) > 0 {
+			r.SetBasicAuth(user, pass)
+		}
+		w := httptest.NewRecorder()
+		queryHandler(w, r)
+		var resp struct {
+			R interface{}
+			E *helpers.Error
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Errorf("TestQueryHandler %v expected a JSON response, but got: %s (%v)", s.name, w.Body.Bytes(), err)
+			continue
+		}
+		if w.Code != s.status || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("TestQueryHandler %v expected status %v, but got: %v", s.name, s.status, w.Code)
+		}
+		if w.Code == http.StatusUnauthorized && len(w.Header().Get("WWW-Authenticate")) == 0 {
+			t.Errorf("TestQueryHandler %v expected a WWW-Authenticate header", s.name)
+		}
+		if resp.E == nil && s.err != 0 || resp.E != nil && resp.E.ID != s.err {
+			t.Errorf("TestQueryHandler %v expected error %v, but got: %v", s.name, s.err, resp.E)
+		}
+		if len(s.result) > 0 {
+			rBytes, _ := json.Marshal(resp.R)
+			if string(rBytes) != s.result {
+				t.Errorf("TestQueryHandler %v expected result %v, but got: %s", s.name, s.result, rBytes)
+			}
+		}
+	}
+}
+
+func TestQueryHandler(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useConfig(t, dbConfig{NoAuth: true, Keystores: []string{}, AuthTables: []string{}, Leaderboards: []string{}})
+	storage.Init()
+
+	runQuerySteps(t, "", "", []queryStep{
+		{"GET request", http.MethodGet, "", http.StatusMethodNotAllowed, helpers.ErrorQueryInvalidFormat, ""},
+		{"Create", http.MethodPost, `["Create", "users", "Keystore", {"mmr": ["Uint16", 1500, 0, 0, false, false], "friends": ["Array", ["Object", {"name": ["String", "", 0, false, false, false], "id": ["Uint32", 0, 0, 0, false, false]}], 0, false]}, false, true]`, http.StatusOK, 0, ""},
+	})
+	if ks := configKeystores(); len(ks) != 1 || ks[0] != "users" {
+		t.Errorf("TestQueryHandler expected Create to list 'users' in the config, but got: %v", ks)
+	}
+
+	runQuerySteps(t, "", "", []queryStep{
+		{"Insert", http.MethodPost, `["Insert", "users", "Maya", {"friends": [{"name": "Mary", "id": 2}, {"name": "Bill", "id": 1}, {"name": "Harry", "id": 0}]}]`, http.StatusOK, 0, ""},
+		{"Get", http.MethodPost, `["Get", "users", "Maya", {"friends": []}]`, http.StatusOK, 0, `{"friends":[{"id":2,"name":"Mary"},{"id":1,"name":"Bill"},{"id":0,"name":"Harry"}]}`},
+		{"Get index", http.MethodPost, `["Get", "users", "Maya", {"friends.1": []}]`, http.StatusOK, 0, `{"friends.1":{"id":1,"name":"Bill"}}`},
+		{"Get index item", http.MethodPost, `["Get", "users", "Maya", {"friends.1.name": []}]`, http.StatusOK, 0, `{"friends.1.name":"Bill"}`},
+		{"Update sort", http.MethodPost, `["Update", "users", "Maya", {"friends.*sortAsc": ["name"]}]`, http.StatusOK, 0, ""},
+		{"Get sorted", http.MethodPost, `["Get", "users", "Maya", {"friends.0.name": [], "friends.2.name": []}]`, http.StatusOK, 0, `{"friends.0.name":"Bill","friends.2.name":"Mary"}`},
+		{"Update append", http.MethodPost, `["Update", "users", "Maya", {"friends.*append": [[{"name": "George", "id": 43523}]]}]`, http.StatusOK, 0, ""},
+		{"Update math", http.MethodPost, `["Update", "users", "Maya", {"mmr.*add.*div": [10, 2]}]`, http.StatusOK, 0, ""},
+		{"Get updated", http.MethodPost, `["Get", "users", "Maya", {"mmr": [], "friends.3.name": []}]`, http.StatusOK, 0, `{"friends.3.name":"George","mmr":755}`},
+		{"Select", http.MethodPost, `["Select", "users", {"where": {"mmr.*gt": [700]}, "items": {"mmr": []}, "limit": 50}]`, http.StatusOK, 0, `{"after":"","entries":[{"items":{"mmr":755},"key":"Maya"}]}`},
+		{"body too large", http.MethodPost, "[" + strings.Repeat(" ", int(maxQuerySize)) + "]", http.StatusRequestEntityTooLarge, helpers.ErrorQueryInvalidFormat, ""},
+		{"malformed body", http.MethodPost, `["Get", "users", "Maya"`, http.StatusOK, helpers.ErrorJsonDecoding, ""},
+		{"unknown table", http.MethodPost, `["Get", "accounts", "Maya", {"mmr": []}]`, http.StatusOK, helpers.ErrorTableDoesntExist, ""},
+		{"unknown key", http.MethodPost, `["Get", "users", "Bob", {"mmr": []}]`, http.StatusOK, helpers.ErrorNoEntryFound, ""},
+		{"Drop", http.MethodPost, `["Drop", "users"]`, http.StatusOK, 0, ""},
+		{"dropped table", http.MethodPost, `["Get", "users", "Maya", {"mmr": []}]`, http.StatusOK, helpers.ErrorTableDoesntExist, ""},
+	})
+	if ks := configKeystores(); len(ks) != 0 {
+		t.Errorf("TestQueryHandler expected Drop to remove 'users' from the config, but got: %v", ks)
+	}
+}
+
+func TestQueryHandlerAuth(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useConfig(t, dbConfig{MasterPass: "secret", ReadOnly: true, Users: testUsers(t), Keystores: []string{}, AuthTables: []string{}, Leaderboards: []string{}})
+	storage.Init()
+
+	create := `["Create", "items", "Keystore", {"level": ["Uint8", 1, 1, 99, false, false]}, false, true]`
+	runQuerySteps(t, "", "", []queryStep{
+		{"no credentials", http.MethodPost, create, http.StatusUnauthorized, helpers.ErrorNotAuthenticated, ""},
+	})
+	runQuerySteps(t, masterUser, "wrong", []queryStep{
+		{"wrong password", http.MethodPost, create, http.StatusUnauthorized, helpers.ErrorNotAuthenticated, ""},
+	})
+	runQuerySteps(t, masterUser, "secret", []queryStep{
+		{"readOnly Create", http.MethodPost, create, http.StatusForbidden, helpers.ErrorReadOnly, ""},
+	})
+	statusMux.Lock()
+	readOnly = false
+	statusMux.Unlock()
+	runQuerySteps(t, masterUser, "secret", []queryStep{
+		{"master Create", http.MethodPost, create, http.StatusOK, 0, ""},
+		{"master Insert", http.MethodPost, `["Insert", "items", "sword", {"level": 5}]`, http.StatusOK, 0, ""},
+	})
+	runQuerySteps(t, "bob", "bobPass", []queryStep{
+		{"read Get", http.MethodPost, `["Get", "items", "sword", {"level": []}]`, http.StatusOK, 0, `{"level":5}`},
+		{"read Insert", http.MethodPost, `["Insert", "items", "shield", {"level": 2}]`, http.StatusForbidden, helpers.ErrorNoPrivileges, ""},
+		{"read Drop", http.MethodPost, `["Drop", "items"]`, http.StatusForbidden, helpers.ErrorNoPrivileges, ""},
+	})
+	runQuerySteps(t, masterUser, "secret", []queryStep{
+		{"master Drop", http.MethodPost, `["Drop", "items"]`, http.StatusOK, 0, ""},
+	})
+}
+
+func configKeystores() []string {
+	configMux.Lock()
+	defer configMux.Unlock()
+	return append([]string{}, config.Keystores...)
+}
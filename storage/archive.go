@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Archives   //////////////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Table backups are gzipped tar archives holding a table's config file and data files, with the same paths they
+// have in the database's folder.
+
+// ArchiveFile is a file in an archive
+type ArchiveFile struct {
+	Name  string
+	Bytes []byte
+}
+
+// WriteArchive writes files to a gzipped tar archive. The archive is written next to it's file name first, so a failed
+// write can't leave a partial archive, or replace an older one.
+func WriteArchive(file string, files []ArchiveFile) int {
+	tmpName := file + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return helpers.ErrorFileOpen
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+	for _, af := range files {
+		hdr := tar.Header{Name: af.Name, Mode: 0755, Size: int64(len(af.Bytes)), ModTime: now, Typeflag: tar.TypeReg}
+		if err = tw.WriteHeader(&hdr); err != nil {
+			break
+		}
+		if _, err = tw.Write(af.Bytes); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gw.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err == nil {
+		err = os.Rename(tmpName, file)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return helpers.ErrorFileWrite
+	}
+	return 0
+}
+
+// ReadArchive reads every file in a gzipped tar archive made with WriteArchive
+func ReadArchive(file string) ([]ArchiveFile, int) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, helpers.ErrorFileOpen
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, helpers.ErrorBackupFormat
+	}
+	tr := tar.NewReader(gr)
+	var files []ArchiveFile
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, helpers.ErrorBackupFormat
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, rErr := ioutil.ReadAll(tr)
+		if rErr != nil {
+			return nil, helpers.ErrorBackupFormat
+		}
+		files = append(files, ArchiveFile{Name: hdr.Name, Bytes: b})
+	}
+	return files, 0
+}
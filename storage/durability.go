@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Durability modes
+const (
+	DurabilityDefault  = iota // Use the storage engine's durability mode (for folders)
+	DurabilityAlways          // Every write's WAL record is synced to the disk before the write is made
+	DurabilityGroup           // Writes wait for a group commit that syncs the WAL for every write logged in the last interval
+	DurabilityBuffered        // The WAL is only synced on checkpoints; the OS decides when writes reach the disk
+)
+
+const (
+	defaultDurability          int           = DurabilityAlways
+	defaultGroupCommitInterval time.Duration = 10 * time.Millisecond
+)
+
+var (
+	durability          atomic.Value // int
+	groupCommitInterval atomic.Value // time.Duration
+
+	folderDurabilityMux sync.Mutex
+	folderDurability    map[string]int = make(map[string]int)
+)
+
+func init() {
+	durability.Store(defaultDurability)
+	groupCommitInterval.Store(defaultGroupCommitInterval)
+}
+
+func validDurability(mode int) bool {
+	return mode >= DurabilityAlways && mode <= DurabilityBuffered
+}
+
+// SetDurability sets the durability mode for folders that don't have their own mode.
+func SetDurability(mode int) {
+	if !validDurability(mode) {
+		return
+	}
+	durability.Store(mode)
+}
+
+// SetGroupCommitInterval sets how long writes are gathered before a group commit when using DurabilityGroup.
+func SetGroupCommitInterval(t time.Duration) {
+	if t <= 0 {
+		return
+	}
+	groupCommitInterval.Store(t)
+}
+
+// SetFolderDurability sets the durability mode for a folder's (table's) storage files. Use DurabilityDefault to go back
+// to the storage engine's durability mode.
+func SetFolderDurability(folder string, mode int) {
+	folderDurabilityMux.Lock()
+	if validDurability(mode) {
+		folderDurability[folder] = mode
+	} else if mode == DurabilityDefault {
+		delete(folderDurability, folder)
+	}
+	folderDurabilityMux.Unlock()
+}
+
+// GetDurability gets the durability mode for a folder's storage files
+func GetDurability(folder string) int {
+	folderDurabilityMux.Lock()
+	mode, ok := folderDurability[folder]
+	folderDurabilityMux.Unlock()
+	if !ok {
+		return durability.Load().(int)
+	}
+	return mode
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+var (
+	fileSystem atomic.Value // fileSystemHolder
+)
+
+// File is a file opened by the storage engine's FileSystem. Implemented by *os.File.
+type File interface {
+	ReadAt(b []byte, off int64) (int, error)
+	WriteAt(b []byte, off int64) (int, error)
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// FileSystem opens the storage engine's storage and write-ahead log files. The default FileSystem uses the os package.
+type FileSystem interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+}
+
+// atomic.Value requires every stored value to have the same concrete type
+type fileSystemHolder struct {
+	fs FileSystem
+}
+
+type osFileSystem struct{}
+
+func (osFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func init() {
+	fileSystem.Store(fileSystemHolder{osFileSystem{}})
+}
+
+// SetFileSystem sets the FileSystem used to open storage and write-ahead log files, or the os package's file system
+// if fs is nil. Should only be changed while no files are open, like before Init or after ShutDown.
+func SetFileSystem(fs FileSystem) {
+	if fs == nil {
+		fs = osFileSystem{}
+	}
+	fileSystem.Store(fileSystemHolder{fs})
+}
+
+func openFile(name string, flag int, perm os.FileMode) (File, error) {
+	return fileSystem.Load().(fileSystemHolder).fs.OpenFile(name, flag, perm)
+}
@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"bytes"
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Storage Repair   ////////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Repair rewrites a damaged storage file with only it's readable lines and a new index. When the file's index can
+// still be read, the lines it points to are checked against their checksum and read with a RecordScanner. Otherwise,
+// or when a line without a checksum can't be read (so the index could be what's wrong), the file is scanned from the
+// start for records, each ending at a new line or where the RecordScanner says it ends, and only the last record for
+// each key is kept. Since old line versions are left in a file until it's vacuumed or compacted, entries deleted
+// since then come back after a scan.
+//
+// Records that can't be read are moved to the file's quarantine file (the storage file
+// name with helpers.FileTypeQuarantine), each followed by a new line, so they can be looked at or fixed by hand.
+
+// RecordScanner reads the record at the start of b for Repair, where b holds the rest of a storage file. It returns
+// the length of the record (not including it's new line), the key of the entry it holds, and an error code if the
+// entry can't be read. When the length doesn't end at a new line, the record is read again up to the next new line.
+type RecordScanner func(b []byte) (int, string, int)
+
+// RepairReport describes what Repair did to a storage file
+type RepairReport struct {
+	File        string
+	Lines       int  // Lines in the repaired file
+	Quarantined int  // Records moved to the quarantine file
+	Scanned     bool // The file's index was damaged, and was rebuilt by scanning the file
+	Repaired    bool // The file was rewritten
+}
+
+// Repair repairs a storage file. The file must not be open, so it should only be called while it's table isn't
+// restored, and after it's folder's write-ahead log has been replayed.
+func Repair(file string, scan RecordScanner) (RepairReport, int) {
+	report := RepairReport{File: file}
+	openFilesMux.Lock()
+	open := openFiles[file] != nil
+	openFilesMux.Unlock()
+	if open {
+		return report, helpers.ErrorFileOpen
+	}
+	f, err := openFile(file, os.O_RDONLY, 0755)
+	if err != nil {
+		return report, helpers.ErrorFileOpen
+	}
+	fs, sErr := f.Stat()
+	if sErr != nil {
+		f.Close()
+		return report, helpers.ErrorFileRead
+	}
+	b := make([]byte, fs.Size())
+	if n, _ := f.ReadAt(b, 0); n < len(b) {
+		f.Close()
+		return report, helpers.ErrorFileRead
+	}
+	lines, indexStart, _, iErr := readIndex(f, int64(len(b)))
+	f.Close()
+
+	var records, quarantine [][]byte
+	if iErr == 0 {
+		if records, quarantine, iErr = indexedRecords(b, lines, indexStart, scan); iErr == 0 && len(quarantine) == 0 {
+			// Nothing to repair
+			report.Lines = len(records)
+			return report, 0
+		}
+	}
+	if iErr != 0 {
+		report.Scanned = true
+		records, quarantine = scanRecords(b, scan)
+	}
+	report.Quarantined = len(quarantine)
+
+	// Move damaged records to the quarantine file before the storage file is rewritten
+	if len(quarantine) > 0 {
+		if qErr := writeQuarantine(strings.TrimSuffix(file, filepath.Ext(file))+helpers.FileTypeQuarantine, quarantine); qErr != 0 {
+			return report, qErr
+		}
+	}
+	// Write the repaired file next to the damaged one, then replace it
+	nb, mErr := MakeFile(records)
+	if mErr != 0 {
+		return report, mErr
+	}
+	tmpName := file + ".tmp"
+	tmp, err := openFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return report, helpers.ErrorFileOpen
+	}
+	if _, wErr := tmp.WriteAt(nb, 0); wErr != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return report, helpers.ErrorFileWrite
+	}
+	if sErr := tmp.Sync(); sErr != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return report, helpers.ErrorFileWrite
+	}
+	tmp.Close()
+	if rErr := os.Rename(tmpName, file); rErr != nil {
+		os.Remove(tmpName)
+		return report, helpers.ErrorFileWrite
+	}
+	report.Lines = len(records)
+	report.Repaired = true
+	return report, 0
+}
+
+// Records scans a storage file that isn't open for records like Repair does when the file's index is damaged, and
+// returns the last readable record for each key with the number of records that couldn't be read. The file isn't
+// changed, so it can be used to look at a table's entries before it's repaired, like when it's config is lost.
+func Records(file string, scan RecordScanner) ([][]byte, int, int) {
+	openFilesMux.Lock()
+	open := openFiles[file] != nil
+	openFilesMux.Unlock()
+	if open {
+		return nil, 0, helpers.ErrorFileOpen
+	}
+	f, err := openFile(file, os.O_RDONLY, 0755)
+	if err != nil {
+		return nil, 0, helpers.ErrorFileOpen
+	}
+	defer f.Close()
+	fs, sErr := f.Stat()
+	if sErr != nil {
+		return nil, 0, helpers.ErrorFileRead
+	}
+	b := make([]byte, fs.Size())
+	if n, _ := f.ReadAt(b, 0); n < len(b) {
+		return nil, 0, helpers.ErrorFileRead
+	}
+	records, quarantine := scanRecords(b, scan)
+	return records, len(quarantine), 0
+}
+
+// indexedRecords reads the lines of a file with a readable index, and returns the readable ones with the damaged
+// ones to quarantine. Returns helpers.ErrorJsonIndexingFormat if the index itself looks wrong, like when it points
+// outside of the file, or at a damaged line it has no checksum for.
+func indexedRecords(b []byte, lines []linePos, indexStart int64, scan RecordScanner) ([][]byte, [][]byte, int) {
+	var records, quarantine [][]byte
+	for _, pos := range lines {
+		if pos[1] == 0 {
+			// Deleted line
+			continue
+		}
+		if pos[0] < 0 || pos[0]+pos[1] >= indexStart {
+			return nil, nil, helpers.ErrorJsonIndexingFormat
+		}
+		lb := b[pos[0] : pos[0]+pos[1]]
+		if pos[2] == noChecksum {
+			if !scanLine(scan, lb) {
+				return nil, nil, helpers.ErrorJsonIndexingFormat
+			}
+		} else if checksum(lb) != pos[2] || !scanLine(scan, lb) {
+			quarantine = append(quarantine, lb)
+			continue
+		}
+		records = append(records, lb)
+	}
+	return records, quarantine, 0
+}
+
+// scanRecords scans a file's bytes for records, and returns the last readable one for each key with the damaged
+// ones to quarantine
+func scanRecords(b []byte, scan RecordScanner) ([][]byte, [][]byte) {
+	var records, quarantine [][]byte
+	// Leave out the old index, it's rebuilt from the records
+	if i := bytes.LastIndexByte(b, newLineIndicator); i >= 0 && bytes.HasPrefix(b[i+1:], []byte("[")) {
+		b = b[:i+1]
+	}
+	keys := make(map[string]int) // Index in records of each key's last record
+	for pos := 0; pos < len(b); {
+		if bytes.HasPrefix(b[pos:], deltaIndexPrefix) || bytes.HasPrefix(b[pos:], []byte("{\"L\":")) {
+			// Old index records are left between lines until the file is vacuumed
+			n := bytes.IndexByte(b[pos:], newLineIndicator)
+			if n < 0 {
+				break
+			}
+			pos += n + 1
+			continue
+		}
+		n, key, err := scan(b[pos:])
+		if n < 0 || pos+n > len(b) || (pos+n < len(b) && b[pos+n] != newLineIndicator) {
+			// Record ends at the next new line
+			if n = bytes.IndexByte(b[pos:], newLineIndicator); n < 0 {
+				n = len(b) - pos
+			}
+			n, key, err = scanRecord(scan, b[pos:pos+n])
+		}
+		rb := b[pos : pos+n]
+		pos += n + 1
+		if n == 0 {
+			continue
+		} else if err != 0 || key == "" {
+			quarantine = append(quarantine, rb)
+		} else if i, ok := keys[key]; ok {
+			records[i] = rb
+		} else {
+			keys[key] = len(records)
+			records = append(records, rb)
+		}
+	}
+	return records, quarantine
+}
+
+// scanLine checks that a line holds exactly one readable record
+func scanLine(scan RecordScanner, lb []byte) bool {
+	_, key, err := scanRecord(scan, lb)
+	return err == 0 && key != ""
+}
+
+// scanRecord reads a record that is known to end at the end of b
+func scanRecord(scan RecordScanner, b []byte) (int, string, int) {
+	n, key, err := scan(b)
+	if n != len(b) && err == 0 {
+		err = helpers.ErrorInternalFormatting
+	}
+	return len(b), key, err
+}
+
+// writeQuarantine appends records to a quarantine file, each followed by a new line
+func writeQuarantine(file string, records [][]byte) int {
+	f, err := openFile(file, os.O_RDWR|os.O_CREATE, 0755)
+	if err != nil {
+		return helpers.ErrorFileOpen
+	}
+	defer f.Close()
+	fs, sErr := f.Stat()
+	if sErr != nil {
+		return helpers.ErrorFileRead
+	}
+	var b []byte
+	for _, rb := range records {
+		b = append(b, rb...)
+		b = append(b, newLineIndicator)
+	}
+	if _, wErr := f.WriteAt(b, fs.Size()); wErr != nil {
+		return helpers.ErrorFileWrite
+	}
+	if sErr = f.Sync(); sErr != nil {
+		return helpers.ErrorFileWrite
+	}
+	return 0
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Storage Snapshots   /////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A snapshot is a point-in-time copy of a storage file's index (and the writes waiting for a group commit), taken
+// without copying the file. Once a line version is written it isn't moved or written over until the file is vacuumed
+// or compacted, so the lines a snapshot points to can be read long after it's taken while the file keeps being
+// written to. Files aren't vacuumed while they have snapshots, and compacting them returns helpers.ErrorFileSnapshot
+// until their snapshots are released.
+//
+// Snapshots of many files are taken together with TakeSnapshots. Writes to the files' folders wait while their indexes
+// are copied, which takes time by the number of lines in the files rather than their size, so a table can take a
+// consistent backup while only pausing for that long.
+
+var (
+	snapshotsMux  sync.Mutex
+	snapshots     map[string]int           = make(map[string]int)           // Snapshots held of each file
+	folderWriters map[string]*sync.RWMutex = make(map[string]*sync.RWMutex) // Read locked by each write to a folder
+)
+
+// FileSnapshot is a snapshot of a storage file
+type FileSnapshot struct {
+	name    string
+	file    File            // The snapshot's own handle to read the file's lines from
+	lines   []linePos       // The file's index when the snapshot was taken
+	pending []*pendingWrite // Writes that were waiting for a group commit when the snapshot was taken
+}
+
+// folderLock gets the lock that writes to a folder's files read lock while they're made
+func folderLock(folder string) *sync.RWMutex {
+	folder = filepath.Clean(folder)
+	snapshotsMux.Lock()
+	defer snapshotsMux.Unlock()
+	l := folderWriters[folder]
+	if l == nil {
+		l = &sync.RWMutex{}
+		folderWriters[folder] = l
+	}
+	return l
+}
+
+// hasSnapshots checks if a file has snapshots that haven't been released
+func hasSnapshots(file string) bool {
+	snapshotsMux.Lock()
+	defer snapshotsMux.Unlock()
+	return snapshots[file] > 0
+}
+
+// TakeSnapshots takes snapshots of files at a single point in time. Every snapshot must be released with Release once
+// it's read.
+func TakeSnapshots(files []string) ([]*FileSnapshot, int) {
+	// Stop writes to every folder the files are in, locking folders in order
+	var folders []string
+	found := make(map[string]bool)
+	for _, file := range files {
+		if folder := filepath.Clean(filepath.Dir(file)); !found[folder] {
+			found[folder] = true
+			folders = append(folders, folder)
+		}
+	}
+	sort.Strings(folders)
+	for _, folder := range folders {
+		l := folderLock(folder)
+		l.Lock()
+		defer l.Unlock()
+	}
+
+	snaps := make([]*FileSnapshot, 0, len(files))
+	for _, file := range files {
+		s, err := takeSnapshot(file)
+		if err != 0 {
+			for _, s := range snaps {
+				s.Release()
+			}
+			return nil, err
+		}
+		snaps = append(snaps, s)
+	}
+	return snaps, 0
+}
+
+// takeSnapshot takes a snapshot of a file. Writes to the file's folder must be stopped.
+func takeSnapshot(file string) (*FileSnapshot, int) {
+	f, fErr := GetOpenFile(file)
+	if fErr != 0 {
+		return nil, fErr
+	}
+	rf, err := openFile(file, os.O_RDONLY, 0755)
+	if err != nil {
+		return nil, helpers.ErrorFileOpen
+	}
+	f.mux.Lock()
+	s := &FileSnapshot{name: file, file: rf, lines: append([]linePos{}, f.lines...), pending: append([]*pendingWrite{}, f.pending...)}
+	snapshotsMux.Lock()
+	snapshots[file]++
+	snapshotsMux.Unlock()
+	f.mux.Unlock()
+	return s, 0
+}
+
+// Bytes returns the bytes of the file as it was when the snapshot was taken, with only the current version of each
+// line like after a vacuum
+func (s *FileSnapshot) Bytes() ([]byte, int) {
+	f := OpenFile{name: s.name, file: s.file, lines: s.lines, pending: s.pending}
+	b, lines, _, err := f.currentLines(false)
+	if err != 0 {
+		return nil, err
+	}
+	linesData, jErr := helpers.Fjson.Marshal(lines)
+	if jErr != nil {
+		return nil, helpers.ErrorInternalFormatting
+	}
+	return append(b, makeIndex(linesData)...), 0
+}
+
+// Release releases the snapshot, so it's file can be vacuumed and compacted again
+func (s *FileSnapshot) Release() {
+	s.file.Close()
+	snapshotsMux.Lock()
+	if snapshots[s.name]--; snapshots[s.name] <= 0 {
+		delete(snapshots, s.name)
+	}
+	snapshotsMux.Unlock()
+}
+
+// ArchiveSnapshots reads snapshots into ArchiveFiles with their file's names, and releases them
+func ArchiveSnapshots(snaps []*FileSnapshot) ([]ArchiveFile, int) {
+	defer func() {
+		for _, s := range snaps {
+			s.Release()
+		}
+	}()
+	files := make([]ArchiveFile, 0, len(snaps))
+	for _, s := range snaps {
+		b, err := s.Bytes()
+		if err != 0 {
+			return nil, err
+		}
+		files = append(files, ArchiveFile{Name: s.name, Bytes: b})
+	}
+	return files, 0
+}
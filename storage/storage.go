@@ -19,22 +19,52 @@ package storage
 
 import (
 	"github.com/hewiefreeman/GopherDB/helpers"
+	"bytes"
 	"encoding/json"
-	"io"
+	"hash/crc32"
 	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// Storage file format
+//
+// A storage file is a list of lines (table entries encoded as JSON or binary), each followed by a new line, then an
+// index holding the position and CRC-32 checksum of every line, and a checksum of the positions themselves:
+// {"L":[[byte offset, length, checksum], ...],"C":checksum}. Lines are only found by the index, so binary lines may
+// contain new lines. The index always follows the file's last new line. Only the index is kept in memory, and lines
+// are read from the disk as they are needed, then checked against their checksum.
+//
+// Updating a line appends it's new version after the file's last line, so no other lines are moved. Deleted lines
+// have a length of 0. Instead of rewriting the whole index, most writes append a delta record holding the new position
+// of the one line they changed, and where the index record before it starts:
+// {"U":[line index, byte offset, length, checksum, previous record's byte offset],"C":checksum}. A file's index is
+// read by following delta records back to it's last full index. A full index is written again (replacing the file's
+// last record) once there are as many delta records as lines, or indexMaxDeltas of them, and on every write to files
+// with fewer than indexDeltaMinLines lines, whose full index is small anyway, so the cost of writing the index stays
+// the same as files grow. Old versions of lines and index records are left in the file until it is vacuumed
+// (rewritten with only the current version of each line), which happens once they take up at least vacuumMinGarbage
+// bytes and half of the file. Files with an index of line positions only ([[offset, length], ...]) or offsets only
+// ([offset, ...]) are still read, and are given the current index on their first write. Their lines have no checksum
+// until the file is vacuumed or compacted.
+
 // Defaults and indicators
 const (
 	newLineIndicator     byte   = byte(10)
-	openBracketIndicator byte   = byte(91)
 	uint32Max            uint32 = 2147483647
 
 	defaultFileOpenTime  time.Duration = 20 * time.Second
 	defaultMaxOpenFiles  uint16        = 25
+
+	indexReadSize    int64 = 4096    // Bytes read at a time from the end of a file while looking for it's index
+	deltaReadSize    int64 = 128     // Bytes first read while looking for the end of a delta record
+	indexMaxDeltas   int   = 8192    // Delta records a file's index can have before a full index is written
+	indexDeltaMinLines int = 64      // Lines a file needs before delta records are written
+	vacuumMinGarbage int64 = 1 << 16 // Bytes of old line versions a file needs before it is vacuumed
+	noChecksum       int64 = -1      // Checksum of lines from files written before line checksums
 )
 
 var (
@@ -48,22 +78,55 @@ var (
 	maxOpenFiles atomic.Value // uint16
 
 	// default vars
-	defaultIndexingBytes []byte = []byte("[]")
+	defaultIndexingBytes []byte = makeIndex([]byte("[]"))
+	deltaIndexPrefix     []byte = []byte("{\"U\":")
 )
 
 // OpenFile represents a file on a disk that is open and ready for I/O
 type OpenFile struct {
 	name        string
 	mux         sync.Mutex
-	file        *os.File
-	bytes       []byte
-	lineByteOn  []int64
-	indexStart  int64
+	writers     *sync.RWMutex   // Read locked by writes, so snapshots can stop them (see TakeSnapshots)
+	file        File
+	lines       []linePos       // Position of every line in the file
+	indexStart  int64           // Where the file's last index record starts
+	size        int64           // Where the file ends, and the next delta record's line version is written
+	deltas      int             // Delta records since the last full index, or -1 if there's no full index
+	garbage     int64           // Bytes taken by old line versions and index records
+	pending     []*pendingWrite // Writes waiting for a group commit
 	accessed    uint32
 	expireTimer *time.Timer
 	cancelChan  chan bool
 }
 
+// linePos is a line's entry in a file's index: [byte offset, length, checksum]
+type linePos [3]int64
+
+// lineDelta is a delta record's change to a file's index: [line index, byte offset, length, checksum, previous record]
+type lineDelta [5]int64
+
+// fileIndex is the JSON structure of a file's index records
+type fileIndex struct {
+	L json.RawMessage // Line positions of a full index
+	U json.RawMessage // lineDelta of a delta record
+	C uint32          // Checksum of L or U
+}
+
+// DamagedLine is a line of a storage file that failed verification
+type DamagedLine struct {
+	File  string // Storage file
+	Line  uint16 // Line number, or 0 when the file's index is damaged
+	Key   string // Key (or user name) of the entry on the line, if it could be found
+	Error int    // Error code of the damage
+}
+
+// pendingWrite is a write waiting for a group commit. Lines are read from it until the write is made.
+type pendingWrite struct {
+	offset int64
+	bytes  []byte
+	done   chan int
+}
+
 // Init initializes the storage package. Must be called before using.
 func Init() {
 	openFilesMux.Lock()
@@ -90,15 +153,46 @@ func ShutDown() {
 		f.mux.Lock()
 		f.cancelChan <- true
 		close(f.cancelChan)
-		f.file.Truncate(int64(len(f.bytes)))
-		f.bytes = nil
-		f.lineByteOn = nil
+		flushWAL(filepath.Dir(f.name))
+		f.lines = nil
+		f.file.Sync()
 		f.file.Close()
 		f.mux.Unlock()
 		delete(openFiles, fName)
 	}
 	inited = false
 	openFilesMux.Unlock()
+	// Checkpoint and close all WALs
+	walsMux.Lock()
+	folders := make([]string, 0, len(wals))
+	for folder := range wals {
+		folders = append(folders, folder)
+	}
+	walsMux.Unlock()
+	for _, folder := range folders {
+		CloseWAL(folder)
+	}
+}
+
+// CloseFiles closes every OpenFile in a folder, like when the table it belongs to is closed, so the files are read
+// from the disk again the next time they're opened.
+func CloseFiles(folder string) {
+	openFilesMux.Lock()
+	for fName, f := range openFiles {
+		if filepath.Dir(fName) != filepath.Clean(folder) {
+			continue
+		}
+		f.mux.Lock()
+		f.cancelChan <- true
+		close(f.cancelChan)
+		flushWAL(filepath.Dir(f.name))
+		f.lines = nil
+		f.file.Sync()
+		f.file.Close()
+		f.mux.Unlock()
+		delete(openFiles, fName)
+	}
+	openFilesMux.Unlock()
 }
 
 //
@@ -118,17 +212,17 @@ func newOpenFile(file string) (*OpenFile, int) {
 		laf.mux.Lock()
 		laf.cancelChan <- true
 		close(laf.cancelChan)
-		laf.file.Truncate(int64(len(laf.bytes)))
-		laf.bytes = nil
-		laf.lineByteOn = nil
+		flushWAL(filepath.Dir(laf.name))
+		laf.lines = nil
+		laf.file.Sync()
 		laf.file.Close()
 		laf.mux.Unlock()
 		delete(openFiles, laf.name)
 	}
 	// Open the File
-	var f *os.File
+	var f File
 	var err error
-	if f, err = os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0755); err != nil {
+	if f, err = openFile(file, os.O_RDWR|os.O_CREATE, 0755); err != nil {
 		return nil, helpers.ErrorFileOpen
 	}
 	// Get file stats
@@ -137,37 +231,30 @@ func newOpenFile(file string) (*OpenFile, int) {
 		return nil, helpers.ErrorFileOpen
 	}
 	// Make new OpenFile object
-	newOF := OpenFile{file: f, name: file, accessed: 1}
-	// Get file bytes
-	newOF.bytes = make([]byte, fs.Size())
-	_, rErr := f.ReadAt(newOF.bytes, 0)
-	if rErr != nil && rErr != io.EOF {
-		return nil, helpers.ErrorFileRead
-	}
+	newOF := OpenFile{file: f, name: file, accessed: 1, writers: folderLock(filepath.Dir(file))}
 	// Get indexing
-	if (len(newOF.bytes) == 0) {
+	if fs.Size() == 0 {
 		// New file, create indexing layer
-		newOF.bytes = append(newOF.bytes, defaultIndexingBytes...)
 		newOF.indexStart = 0
-		newOF.lineByteOn = []int64{}
-		if _, wErr := f.WriteAt(newOF.bytes, int64(0)); wErr != nil {
+		newOF.size = int64(len(defaultIndexingBytes))
+		newOF.lines = []linePos{}
+		if _, wErr := f.WriteAt(defaultIndexingBytes, int64(0)); wErr != nil {
+			f.Close()
 			return nil, helpers.ErrorFileOpen
 		}
 	} else {
-		// Get indexing bytes
-		var iPosBytes []byte
-		for i := len(newOF.bytes) - 1; i >= 0; i-- {
-			if newOF.bytes[i] == openBracketIndicator {
-				iPosBytes = newOF.bytes[i:]
-				newOF.indexStart = int64(i)
-				break
-			} else if i == 0 {
-				return nil, helpers.ErrorJsonIndexingFormat
-			}
+		var iErr int
+		if newOF.lines, newOF.indexStart, newOF.deltas, iErr = readIndex(f, fs.Size()); iErr != 0 {
+			f.Close()
+			return nil, iErr
 		}
-		// Get indexing list
-		if err := json.Unmarshal(iPosBytes, &newOF.lineByteOn); err != nil {
-			return nil, helpers.ErrorJsonIndexingFormat
+		newOF.size = fs.Size()
+		// Everything before the last index record that isn't a current line (or it's new line) is garbage
+		newOF.garbage = newOF.indexStart
+		for _, pos := range newOF.lines {
+			if pos[1] > 0 {
+				newOF.garbage -= pos[1] + 1
+			}
 		}
 	}
 	ofp := &newOF
@@ -179,6 +266,187 @@ func newOpenFile(file string) (*OpenFile, int) {
 	return ofp, 0
 }
 
+// readIndex finds and decodes a file's index, and returns it with the byte the last index record starts at and the
+// number of delta records since the last full index (-1 for the old index formats)
+func readIndex(f File, size int64) ([]linePos, int64, int, int) {
+	// Read back from the end of the file until the last new line
+	var iBytes []byte
+	var indexStart int64
+	for end := size; end > 0; {
+		start := end - indexReadSize
+		if start < 0 {
+			start = 0
+		}
+		chunk := make([]byte, end-start)
+		if n, _ := f.ReadAt(chunk, start); n < len(chunk) {
+			return nil, 0, 0, helpers.ErrorFileRead
+		}
+		if i := bytes.LastIndexByte(chunk, newLineIndicator); i >= 0 {
+			indexStart = start + int64(i) + 1
+			iBytes = append(chunk[i+1:], iBytes...)
+			break
+		}
+		iBytes = append(chunk, iBytes...)
+		end = start
+	}
+	var lines []linePos
+	if bytes.HasPrefix(iBytes, deltaIndexPrefix) {
+		return readDeltaIndex(f, iBytes, indexStart)
+	} else if len(iBytes) > 0 && iBytes[0] == '{' {
+		var err int
+		if lines, err = decodeIndex(iBytes); err != 0 {
+			return nil, 0, 0, err
+		}
+		return lines, indexStart, 0, 0
+	}
+	// Index of line positions without checksums
+	if err := json.Unmarshal(iBytes, &lines); err == nil {
+		for i := range lines {
+			lines[i][2] = noChecksum
+		}
+		return lines, indexStart, -1, 0
+	}
+	// Index of line offsets only, each line ends where the next starts
+	var offsets []int64
+	if err := json.Unmarshal(iBytes, &offsets); err != nil {
+		return nil, 0, 0, helpers.ErrorJsonIndexingFormat
+	}
+	lines = make([]linePos, len(offsets))
+	for i, offset := range offsets {
+		end := indexStart - 1
+		if i < len(offsets)-1 {
+			end = offsets[i+1] - 1
+		}
+		if end < offset {
+			return nil, 0, 0, helpers.ErrorJsonIndexingFormat
+		}
+		lines[i] = linePos{offset, end - offset, noChecksum}
+	}
+	return lines, indexStart, -1, 0
+}
+
+// decodeIndex decodes a full index record
+func decodeIndex(iBytes []byte) ([]linePos, int) {
+	var index fileIndex
+	var lines []linePos
+	if err := json.Unmarshal(iBytes, &index); err != nil {
+		return nil, helpers.ErrorJsonIndexingFormat
+	} else if crc32.ChecksumIEEE(index.L) != index.C {
+		return nil, helpers.ErrorIndexChecksum
+	} else if err = json.Unmarshal(index.L, &lines); err != nil {
+		return nil, helpers.ErrorJsonIndexingFormat
+	}
+	return lines, 0
+}
+
+// readDeltaIndex reads an index that ends with delta records, by following them back to the file's last full index
+// and applying them to it
+func readDeltaIndex(f File, iBytes []byte, indexStart int64) ([]linePos, int64, int, int) {
+	var deltas []lineDelta
+	for start := indexStart; bytes.HasPrefix(iBytes, deltaIndexPrefix); {
+		var index fileIndex
+		var d lineDelta
+		if err := json.Unmarshal(iBytes, &index); err != nil {
+			return nil, 0, 0, helpers.ErrorJsonIndexingFormat
+		} else if crc32.ChecksumIEEE(index.U) != index.C {
+			return nil, 0, 0, helpers.ErrorIndexChecksum
+		} else if err = json.Unmarshal(index.U, &d); err != nil || d[4] < 0 || d[4] >= start {
+			return nil, 0, 0, helpers.ErrorJsonIndexingFormat
+		}
+		deltas = append(deltas, d)
+		start = d[4]
+		var rErr int
+		if iBytes, rErr = readRecord(f, start); rErr != 0 {
+			return nil, 0, 0, rErr
+		}
+	}
+	lines, err := decodeIndex(iBytes)
+	if err != 0 {
+		return nil, 0, 0, err
+	}
+	// Apply the deltas from oldest to newest
+	for i := len(deltas) - 1; i >= 0; i-- {
+		d := deltas[i]
+		pos := linePos{d[1], d[2], d[3]}
+		if d[0] == int64(len(lines)) {
+			lines = append(lines, pos)
+		} else if d[0] >= 0 && d[0] < int64(len(lines)) {
+			lines[d[0]] = pos
+		} else {
+			return nil, 0, 0, helpers.ErrorJsonIndexingFormat
+		}
+	}
+	return lines, indexStart, len(deltas), 0
+}
+
+// readRecord reads the index record that starts at start, and ends at the next new line
+func readRecord(f File, start int64) ([]byte, int) {
+	var b []byte
+	for size := deltaReadSize; ; size *= 2 {
+		chunk := make([]byte, size)
+		n, _ := f.ReadAt(chunk, start+int64(len(b)))
+		if i := bytes.IndexByte(chunk[:n], newLineIndicator); i >= 0 {
+			return append(b, chunk[:i]...), 0
+		} else if n < len(chunk) {
+			return nil, helpers.ErrorJsonIndexingFormat
+		}
+		b = append(b, chunk...)
+	}
+}
+
+// makeIndex makes a file's index from the JSON encoded positions of it's lines
+func makeIndex(lines []byte) []byte {
+	b := make([]byte, 0, len(lines)+20)
+	b = append(b, "{\"L\":"...)
+	b = append(b, lines...)
+	b = append(b, ",\"C\":"...)
+	b = strconv.AppendUint(b, uint64(crc32.ChecksumIEEE(lines)), 10)
+	return append(b, '}')
+}
+
+// makeDeltaIndex makes a delta record setting line i to pos, with the byte offset of the index record before it
+func makeDeltaIndex(i int, pos linePos, prev int64) []byte {
+	d := make([]byte, 0, 64)
+	d = append(d, '[')
+	d = strconv.AppendInt(d, int64(i), 10)
+	for _, v := range []int64{pos[0], pos[1], pos[2], prev} {
+		d = append(d, ',')
+		d = strconv.AppendInt(d, v, 10)
+	}
+	d = append(d, ']')
+	b := make([]byte, 0, len(d)+25)
+	b = append(b, deltaIndexPrefix...)
+	b = append(b, d...)
+	b = append(b, ",\"C\":"...)
+	b = strconv.AppendUint(b, uint64(crc32.ChecksumIEEE(d)), 10)
+	return append(b, '}')
+}
+
+// MakeFile makes the bytes of a storage file holding lines, like a vacuumed file
+func MakeFile(lines [][]byte) ([]byte, int) {
+	var size int
+	for _, lb := range lines {
+		size += len(lb) + 1
+	}
+	b := make([]byte, 0, size)
+	index := make([]linePos, len(lines))
+	for i, lb := range lines {
+		index[i] = linePos{int64(len(b)), int64(len(lb)), checksum(lb)}
+		b = append(b, lb...)
+		b = append(b, newLineIndicator)
+	}
+	linesData, jErr := helpers.Fjson.Marshal(index)
+	if jErr != nil {
+		return nil, helpers.ErrorInternalFormatting
+	}
+	return append(b, makeIndex(linesData)...), 0
+}
+
+// checksum gets the checksum of a line's bytes, as it's kept in the index
+func checksum(b []byte) int64 {
+	return int64(crc32.ChecksumIEEE(b))
+}
+
 // GetOpenFile
 func GetOpenFile(file string) (*OpenFile, int) {
 	var f *OpenFile
@@ -230,9 +498,9 @@ func fileCloseTimer(f *OpenFile) {
 		openFilesMux.Unlock()
 		f.mux.Lock()
 		close(f.cancelChan)
-		f.file.Truncate(int64(len(f.bytes)))
-		f.bytes = nil
-		f.lineByteOn = nil
+		flushWAL(filepath.Dir(f.name))
+		f.lines = nil
+		f.file.Sync()
 		f.file.Close()
 		f.mux.Unlock()
 	case <- f.cancelChan:
@@ -260,69 +528,204 @@ func Read(file string, line uint16) ([]byte, int) {
 	return f.Read(line)
 }
 
-// Read returns the data in an OpenFile from said line.
+// Read returns the data in an OpenFile from said line. If the line doesn't match it's checksum, it's damaged bytes
+// are returned with helpers.ErrorLineChecksum.
 func (f *OpenFile) Read(line uint16) ([]byte, int) {
 	f.mux.Lock()
-	// Get the start and end index of line
-	bStart := f.lineByteOn[line-1]
-	var bEnd int64
-	if len(f.lineByteOn) == int(line) {
-		// Last item in file
-		bEnd = f.indexStart - 1
-	} else {
-		// Not last item...
-		bEnd = f.lineByteOn[line] - 1
-	}
-	if bEnd < bStart {
+	if line == 0 || int(line) > len(f.lines) {
+		f.mux.Unlock()
 		return nil, helpers.ErrorInternalFormatting
 	}
-	bytes := f.bytes[bStart:bEnd]
+	pos := f.lines[line-1]
+	b, err := f.readLine(pos)
 	f.mux.Unlock()
-	return bytes, 0
+	if err == 0 && pos[2] != noChecksum && checksum(b) != pos[2] {
+		err = helpers.ErrorLineChecksum
+	}
+	return b, err
 }
 
-// Update updates JSON encoded []byte line at given index of given file
+// readLine reads a line from the newest pending write that holds it, or from the disk. f.mux must be locked.
+func (f *OpenFile) readLine(pos linePos) ([]byte, int) {
+	b := make([]byte, pos[1])
+	if pos[1] == 0 {
+		return b, 0
+	}
+	for i := len(f.pending) - 1; i >= 0; i-- {
+		p := f.pending[i]
+		if p.offset <= pos[0] && p.offset+int64(len(p.bytes)) >= pos[0]+pos[1] {
+			copy(b, p.bytes[pos[0]-p.offset:])
+			return b, 0
+		}
+	}
+	if n, _ := f.file.ReadAt(b, pos[0]); n < len(b) {
+		return nil, helpers.ErrorFileRead
+	}
+	return b, 0
+}
+
+// write logs and makes a write to the OpenFile. With DurabilityGroup, the write is returned as a pendingWrite that
+// lines are read from until it is made, and callers must wait() on it after unlocking f.mux. f.mux must be locked.
+func (f *OpenFile) write(offset int64, b []byte) (*pendingWrite, int) {
+	done, err := commitWrite(f, offset, b)
+	if err != 0 {
+		return nil, err
+	}
+	if done == nil {
+		// Queued writes are made before any other write, so none are pending anymore
+		f.pending = nil
+		return nil, 0
+	}
+	p := &pendingWrite{offset: offset, bytes: b, done: done}
+	f.pending = append(f.pending, p)
+	return p, 0
+}
+
+// wait waits for a pendingWrite's group commit and returns it's error code
+func (f *OpenFile) wait(p *pendingWrite) int {
+	if p == nil {
+		return 0
+	}
+	err := <-p.done
+	f.mux.Lock()
+	for i, pw := range f.pending {
+		if pw == p {
+			// Writes are made in order, so any before it are made as well
+			f.pending = f.pending[i+1:]
+			break
+		}
+	}
+	if len(f.pending) == 0 {
+		f.pending = nil
+	}
+	f.mux.Unlock()
+	return err
+}
+
+// writeLine writes a new version of line i (or a new line when i is the number of lines) to the end of the OpenFile,
+// followed by it's index. An empty lb deletes the line. f.mux must be locked.
+func (f *OpenFile) writeLine(i int, lb []byte) (*pendingWrite, int) {
+	if f.deltas < 0 || len(f.lines) < indexDeltaMinLines || f.deltas >= len(f.lines) || f.deltas >= indexMaxDeltas {
+		return f.writeLineIndex(i, lb)
+	}
+	// Write the line after the last index record, followed by a delta record pointing back at it
+	var pos linePos
+	b := make([]byte, 0, len(lb)+2+int(deltaReadSize))
+	b = append(b, newLineIndicator)
+	if len(lb) > 0 {
+		pos = linePos{f.size + 1, int64(len(lb)), checksum(lb)}
+		b = append(b, lb...)
+		b = append(b, newLineIndicator)
+	}
+	indexStart := f.size + int64(len(b))
+	b = append(b, makeDeltaIndex(i, pos, f.indexStart)...)
+	p, wErr := f.write(f.size, b)
+	if wErr != 0 {
+		return nil, wErr
+	}
+	f.setLine(i, pos)
+	// The last index record (and it's new line) is now garbage
+	f.garbage += f.size - f.indexStart + 1
+	f.indexStart = indexStart
+	f.size += int64(len(b))
+	f.deltas++
+	return p, 0
+}
+
+// writeLineIndex writes a new version of line i like writeLine, followed by a full index that replaces the OpenFile's
+// last index record. f.mux must be locked.
+func (f *OpenFile) writeLineIndex(i int, lb []byte) (*pendingWrite, int) {
+	var pos linePos
+	if len(lb) > 0 {
+		pos = linePos{f.indexStart, int64(len(lb)), checksum(lb)}
+	}
+	n := len(f.lines)
+	var oldPos linePos
+	if i < n {
+		oldPos = f.lines[i]
+	}
+	f.setLine(i, pos)
+	linesData, err := helpers.Fjson.Marshal(f.lines)
+	if err != nil {
+		f.resetLine(i, n, oldPos)
+		return nil, helpers.ErrorInternalFormatting
+	}
+	indexData := makeIndex(linesData)
+	b := make([]byte, 0, len(lb)+1+len(indexData))
+	if len(lb) > 0 {
+		b = append(b, lb...)
+		b = append(b, newLineIndicator)
+	}
+	p, wErr := f.write(f.indexStart, append(b, indexData...))
+	if wErr != 0 {
+		f.resetLine(i, n, oldPos)
+		return nil, wErr
+	}
+	f.indexStart += int64(len(b))
+	f.size = f.indexStart + int64(len(indexData))
+	f.deltas = 0
+	return p, 0
+}
+
+// setLine sets the position of line i, or adds it when i is the number of lines. f.mux must be locked.
+func (f *OpenFile) setLine(i int, pos linePos) {
+	if i == len(f.lines) {
+		f.lines = append(f.lines, pos)
+	} else {
+		f.lines[i] = pos
+	}
+}
+
+// resetLine undoes a setLine that was made when the OpenFile had n lines. f.mux must be locked.
+func (f *OpenFile) resetLine(i int, n int, oldPos linePos) {
+	if i < n {
+		f.lines[i] = oldPos
+	} else {
+		f.lines = f.lines[:n]
+	}
+}
+
+// Update updates JSON encoded []byte line at given index of given file. An empty jData deletes the line.
 func Update(file string, line uint16, jData []byte) int {
 	f, fErr := GetOpenFile(file)
 	if fErr != 0 {
 		return fErr
 	}
 
+	f.writers.RLock()
 	f.mux.Lock()
-
-	// Get the start and end index of line
-	iStart := f.lineByteOn[line-1]
-	var iEnd int64
-	if len(f.lineByteOn) == int(line) {
-		// Last item in file
-		iEnd = f.indexStart - 1
-	} else {
-		// Not last item...
-		iEnd = f.lineByteOn[line] - 1
-	}
-	// Calculate byte difference for subsequent lines
-	iDif := int64(len(jData)) - (iEnd - iStart)
-	for i := int(line); i < len(f.lineByteOn); i++ {
-		f.lineByteOn[i] += iDif
-	}
-	indexStart := f.indexStart
-	f.indexStart += iDif
-	// Make indexing data
-	lineByteOnData, err := helpers.Fjson.Marshal(f.lineByteOn)
-	if err != nil {
+	if line == 0 || int(line) > len(f.lines) {
+		f.mux.Unlock()
+		f.writers.RUnlock()
 		return helpers.ErrorInternalFormatting
 	}
-	// Make & push data
-	rHalf := append(jData, f.bytes[iEnd:indexStart]...)
-	rHalf = append(rHalf, lineByteOnData...)
-	f.bytes = append(f.bytes[:iStart], rHalf...)
 
-	if _, wErr := f.file.WriteAt(rHalf, int64(iStart)); wErr != nil {
+	// Point the line at it's new version at the end of the file
+	oldPos := f.lines[line-1]
+	p, wErr := f.writeLine(int(line)-1, jData)
+	if wErr != 0 {
 		f.mux.Unlock()
-		return helpers.ErrorFileUpdate
+		f.writers.RUnlock()
+		return wErr
+	}
+	if oldPos[1] > 0 {
+		f.garbage += oldPos[1] + 1
+	}
+
+	// Vacuum the file once old versions take up half of it. It will be tried again on the next Update if it fails, or
+	// if the file has snapshots.
+	var vp *pendingWrite
+	if f.garbage >= vacuumMinGarbage && f.garbage*2 >= f.indexStart && !hasSnapshots(f.name) {
+		_, vp, _ = f.rewrite(false)
 	}
 	f.mux.Unlock()
-	return 0
+	f.writers.RUnlock()
+
+	err := f.wait(p)
+	if vErr := f.wait(vp); err == 0 {
+		err = vErr
+	}
+	return err
 }
 
 // Insert appends a JSON encoded []byte at the end of given JSON file and reports back the
@@ -332,30 +735,120 @@ func Insert(file string, jData []byte) (uint16, int) {
 	if fErr != 0 {
 		return 0, fErr
 	}
+	f.writers.RLock()
 	f.mux.Lock()
 	// Insert and get lineOn
-	lineOn := uint16(len(f.lineByteOn) + 1)
-	f.lineByteOn = append(f.lineByteOn, f.indexStart)
-	// Make indexing data
-	lineByteOnData, err := helpers.Fjson.Marshal(f.lineByteOn)
-	if err != nil {
-		return 0, helpers.ErrorInternalFormatting
-	}
-	// Append a new line to jData and get new indexStart
-	jData = append(jData, newLineIndicator)
-	iStart := f.indexStart
-	f.indexStart += int64(len(jData))
-	// Append lineByteOnData and write jData to disk
-	jData = append(jData, lineByteOnData...)
-	if _, wErr := f.file.WriteAt(jData, iStart); wErr != nil {
-		f.mux.Unlock()
-		return 0, helpers.ErrorFileAppend
-	}
-	f.bytes = append(f.bytes[:iStart], jData...)
+	lineOn := uint16(len(f.lines) + 1)
+	p, wErr := f.writeLine(len(f.lines), jData)
 	f.mux.Unlock()
+	f.writers.RUnlock()
+	if wErr != 0 {
+		return 0, wErr
+	}
+	if err := f.wait(p); err != 0 {
+		return 0, err
+	}
 	return lineOn, 0
 }
 
+// rewrite rewrites the OpenFile with only the current version of each line. When dropEmpty is true, deleted lines
+// are removed as well. Lines without a checksum are given one, and damaged lines are kept with their old checksum.
+// The returned slice holds the new line number for each old line number, at index (old line - 1), with 0 for removed
+// lines. f.mux must be locked.
+func (f *OpenFile) rewrite(dropEmpty bool) ([]uint16, *pendingWrite, int) {
+	b, lines, newLines, err := f.currentLines(dropEmpty)
+	if err != 0 {
+		return nil, nil, err
+	}
+	indexStart := int64(len(b))
+	linesData, jErr := helpers.Fjson.Marshal(lines)
+	if jErr != nil {
+		return nil, nil, helpers.ErrorInternalFormatting
+	}
+	// The whole file is logged, so a replay of older writes followed by this one leaves the rewritten file
+	indexData := makeIndex(linesData)
+	p, wErr := f.write(0, append(b, indexData...))
+	if wErr != 0 {
+		return nil, nil, wErr
+	}
+	f.lines = lines
+	f.indexStart = indexStart
+	f.size = indexStart + int64(len(indexData))
+	f.deltas = 0
+	f.garbage = 0
+	return newLines, p, 0
+}
+
+// currentLines gets the bytes of the current version of each line in the OpenFile (each followed by a new line), with
+// their positions in those bytes and the new line number for each old line, for rewrite. f.mux must be locked.
+func (f *OpenFile) currentLines(dropEmpty bool) ([]byte, []linePos, []uint16, int) {
+	newLines := make([]uint16, len(f.lines))
+	lines := make([]linePos, 0, len(f.lines))
+	b := make([]byte, 0, f.indexStart-f.garbage)
+	for i, pos := range f.lines {
+		if pos[1] == 0 {
+			if !dropEmpty {
+				lines = append(lines, linePos{})
+				newLines[i] = uint16(len(lines))
+			}
+			continue
+		}
+		lb, err := f.readLine(pos)
+		if err != 0 {
+			return nil, nil, nil, err
+		}
+		if pos[2] == noChecksum {
+			pos[2] = checksum(lb)
+		}
+		lines = append(lines, linePos{int64(len(b)), pos[1], pos[2]})
+		newLines[i] = uint16(len(lines))
+		b = append(b, lb...)
+		b = append(b, newLineIndicator)
+	}
+	return b, lines, newLines, 0
+}
+
+// Compact rewrites a file without it's empty (deleted) lines, or old line versions. The returned slice holds the new
+// line number for each old line number, at index (old line - 1), with 0 for removed lines. Callers must make sure
+// nothing reads or writes to the file's lines with old line numbers while compacting. Returns
+// helpers.ErrorFileSnapshot if the file has snapshots (see TakeSnapshots).
+func Compact(file string) ([]uint16, int) {
+	f, fErr := GetOpenFile(file)
+	if fErr != 0 {
+		return nil, fErr
+	}
+	f.writers.RLock()
+	f.mux.Lock()
+	var newLines []uint16
+	var p *pendingWrite
+	err := helpers.ErrorFileSnapshot
+	if !hasSnapshots(f.name) {
+		newLines, p, err = f.rewrite(true)
+	}
+	f.mux.Unlock()
+	f.writers.RUnlock()
+	if err != 0 {
+		return nil, err
+	}
+	if wErr := f.wait(p); wErr != 0 {
+		return nil, wErr
+	}
+	return newLines, 0
+}
+
+// EmptyLines returns the number of empty (deleted) lines in the OpenFile
+func (f *OpenFile) EmptyLines() int {
+	f.mux.Lock()
+	var n int
+	for _, pos := range f.lines {
+		if pos[1] == 0 {
+			n++
+		}
+	}
+	f.mux.Unlock()
+	return n
+}
+
 // SetFileOpenTime preference allows you to keep OpenFiles open for a given duration.
 func SetFileOpenTime(t time.Duration) {
 	if t <= 0 {
@@ -385,7 +878,7 @@ func GetNumOpenFiles() int {
 // Lines returns the number of data lines for this OpenFile
 func (f *OpenFile) Lines() int {
 	f.mux.Lock()
-	l := len(f.lineByteOn)
+	l := len(f.lines)
 	f.mux.Unlock()
 	return l
 }
\ No newline at end of file
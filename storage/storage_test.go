@@ -1,8 +1,18 @@
 package storage
 
 import (
+	"bytes"
+	"github.com/hewiefreeman/GopherDB/helpers"
 	"github.com/hewiefreeman/GopherDB/storage"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 	"fmt"
 )
 
@@ -23,4 +33,709 @@ func TestStorageGet(t *testing.T) {
 		t.Errorf("Error reading file: %v", err)
 	}
 	fmt.Println(string(b))
-}
\ No newline at end of file
+}
+func TestWALReplay(t *testing.T) {
+	folder := "walTest"
+	file := folder + "/0.gdbs"
+	storage.MakeDir(folder)
+	defer storage.DeleteDir(folder)
+	if _, err := storage.Insert(file, []byte("{\"K\":\"a\"}")); err != 0 {
+		t.Fatalf("Error inserting to file: %v", err)
+	}
+	if _, err := storage.Insert(file, []byte("{\"K\":\"b\"}")); err != 0 {
+		t.Fatalf("Error inserting to file: %v", err)
+	}
+	if err := storage.Update(file, 1, []byte("{\"K\":\"c\"}")); err != 0 {
+		t.Fatalf("Error updating file: %v", err)
+	}
+	// Save the WAL before shutting down checkpoints it
+	wal, rErr := ioutil.ReadFile(folder + "/wal" + helpers.FileTypeWAL)
+	if rErr != nil || len(wal) == 0 {
+		t.Fatalf("Write-ahead log was not written: %v", rErr)
+	}
+	storage.ShutDown()
+	// Simulate a crash part way through writing the storage file's tail, and part way through logging another write
+	if tErr := os.Truncate(file, 14); tErr != nil {
+		t.Fatalf("Error truncating file: %v", tErr)
+	}
+	if wErr := ioutil.WriteFile(folder + "/wal" + helpers.FileTypeWAL, append(wal, 0, 0, 0, 40, 1, 2), 0755); wErr != nil {
+		t.Fatalf("Error writing write-ahead log: %v", wErr)
+	}
+	if err := storage.ReplayWAL(folder); err != 0 {
+		t.Fatalf("Error replaying write-ahead log: %v", err)
+	}
+	storage.Init()
+	for i, expected := range []string{"{\"K\":\"c\"}", "{\"K\":\"b\"}"} {
+		b, err := storage.Read(file, uint16(i + 1))
+		if err != 0 {
+			t.Fatalf("Error reading line %v: %v", i + 1, err)
+		} else if string(b) != expected {
+			t.Errorf("Expected line %v to be %v, but got: %v", i + 1, expected, string(b))
+		}
+	}
+	storage.ShutDown()
+}
+
+func TestCompact(t *testing.T) {
+	folder := "compactTest"
+	file := folder + "/0.gdbs"
+	storage.Init()
+	storage.MakeDir(folder)
+	defer storage.DeleteDir(folder)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		if _, err := storage.Insert(file, []byte("{\"K\":\"" + k + "\"}")); err != 0 {
+			t.Fatalf("Error inserting to file: %v", err)
+		}
+	}
+	// Delete lines 1 and 3
+	for _, line := range []uint16{1, 3} {
+		if err := storage.Update(file, line, []byte{}); err != 0 {
+			t.Fatalf("Error deleting line %v: %v", line, err)
+		}
+	}
+	newLines, err := storage.Compact(file)
+	if err != 0 {
+		t.Fatalf("Error compacting file: %v", err)
+	}
+	expected := []uint16{0, 1, 0, 2}
+	if len(newLines) != len(expected) {
+		t.Fatalf("Expected new line numbers %v, but got: %v", expected, newLines)
+	}
+	for i := range expected {
+		if newLines[i] != expected[i] {
+			t.Fatalf("Expected new line numbers %v, but got: %v", expected, newLines)
+		}
+	}
+	// Compacted file should survive a restart
+	storage.ShutDown()
+	storage.Init()
+	f, oErr := storage.GetOpenFile(file)
+	if oErr != 0 {
+		t.Fatalf("Error opening file: %v", oErr)
+	} else if f.Lines() != 2 || f.EmptyLines() != 0 {
+		t.Fatalf("Expected 2 lines and no empty lines, but got %v lines and %v empty lines", f.Lines(), f.EmptyLines())
+	}
+	for i, expected := range []string{"{\"K\":\"b\"}", "{\"K\":\"d\"}"} {
+		b, err := storage.Read(file, uint16(i + 1))
+		if err != 0 {
+			t.Fatalf("Error reading line %v: %v", i + 1, err)
+		} else if string(b) != expected {
+			t.Errorf("Expected line %v to be %v, but got: %v", i + 1, expected, string(b))
+		}
+	}
+	storage.ShutDown()
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Durability   ////////////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// fakeFileSystem keeps files in memory, tracking which bytes have been synced to the "disk"
+type fakeFileSystem struct {
+	mux   sync.Mutex
+	files map[string]*fakeFileData
+}
+
+type fakeFileData struct {
+	data   []byte // Bytes written (OS buffer)
+	synced []byte // Bytes synced to the disk
+	syncs  int
+}
+
+type fakeFile struct {
+	fs     *fakeFileSystem
+	d      *fakeFileData
+	name   string
+	closed bool
+}
+
+type fakeFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi fakeFileInfo) Name() string       { return fi.name }
+func (fi fakeFileInfo) Size() int64        { return fi.size }
+func (fi fakeFileInfo) Mode() os.FileMode  { return 0755 }
+func (fi fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fakeFileInfo) IsDir() bool        { return false }
+func (fi fakeFileInfo) Sys() interface{}   { return nil }
+
+func newFakeFileSystem() *fakeFileSystem {
+	return &fakeFileSystem{files: make(map[string]*fakeFileData)}
+}
+
+func (fs *fakeFileSystem) OpenFile(name string, flag int, perm os.FileMode) (storage.File, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	d := fs.files[name]
+	if d == nil {
+		if flag&os.O_CREATE == 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		d = &fakeFileData{}
+		fs.files[name] = d
+	}
+	return &fakeFile{fs: fs, d: d, name: name}, nil
+}
+
+// crash makes a new fakeFileSystem with only the bytes that were synced, like after a power failure
+func (fs *fakeFileSystem) crash() *fakeFileSystem {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	nfs := newFakeFileSystem()
+	for name, d := range fs.files {
+		nfs.files[name] = &fakeFileData{data: append([]byte{}, d.synced...), synced: append([]byte{}, d.synced...)}
+	}
+	return nfs
+}
+
+func (fs *fakeFileSystem) syncs(name string) int {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if d := fs.files[name]; d != nil {
+		return d.syncs
+	}
+	return 0
+}
+
+func (f *fakeFile) ReadAt(b []byte, off int64) (int, error) {
+	f.fs.mux.Lock()
+	defer f.fs.mux.Unlock()
+	if off >= int64(len(f.d.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.d.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *fakeFile) WriteAt(b []byte, off int64) (int, error) {
+	f.fs.mux.Lock()
+	defer f.fs.mux.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if end := off + int64(len(b)); end > int64(len(f.d.data)) {
+		f.d.data = append(f.d.data, make([]byte, end-int64(len(f.d.data)))...)
+	}
+	copy(f.d.data[off:], b)
+	return len(b), nil
+}
+
+func (f *fakeFile) Stat() (os.FileInfo, error) {
+	f.fs.mux.Lock()
+	defer f.fs.mux.Unlock()
+	return fakeFileInfo{name: f.name, size: int64(len(f.d.data))}, nil
+}
+
+func (f *fakeFile) Truncate(size int64) error {
+	f.fs.mux.Lock()
+	defer f.fs.mux.Unlock()
+	if size < int64(len(f.d.data)) {
+		f.d.data = f.d.data[:size]
+	} else {
+		f.d.data = append(f.d.data, make([]byte, size-int64(len(f.d.data)))...)
+	}
+	return nil
+}
+
+func (f *fakeFile) Sync() error {
+	f.fs.mux.Lock()
+	defer f.fs.mux.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.d.synced = append([]byte{}, f.d.data...)
+	f.d.syncs++
+	return nil
+}
+
+func (f *fakeFile) Close() error {
+	f.fs.mux.Lock()
+	f.closed = true
+	f.fs.mux.Unlock()
+	return nil
+}
+
+// crashAndRestore simulates a power failure, then replays the folder's WAL and starts the storage engine again
+// using the crashed file system's synced bytes
+func crashAndRestore(t *testing.T, fs *fakeFileSystem, folder string) *fakeFileSystem {
+	cfs := fs.crash()
+	storage.ShutDown()
+	storage.SetFileSystem(cfs)
+	if err := storage.ReplayWAL(folder); err != 0 {
+		t.Fatalf("Error replaying write-ahead log: %v", err)
+	}
+	storage.Init()
+	return cfs
+}
+
+func TestDurabilityAlways(t *testing.T) {
+	fs := newFakeFileSystem()
+	storage.SetFileSystem(fs)
+	defer storage.SetFileSystem(nil)
+	storage.SetDurability(storage.DurabilityAlways)
+	storage.Init()
+	if _, err := storage.Insert("always/0.gdbs", []byte("{\"K\":\"a\"}")); err != 0 {
+		t.Fatalf("Error inserting to file: %v", err)
+	}
+	if syncs := fs.syncs("always/wal" + helpers.FileTypeWAL); syncs != 1 {
+		t.Errorf("Expected 1 write-ahead log sync, but got: %v", syncs)
+	}
+	// Acknowledged writes survive a crash
+	crashAndRestore(t, fs, "always")
+	if b, err := storage.Read("always/0.gdbs", 1); err != 0 || string(b) != "{\"K\":\"a\"}" {
+		t.Errorf("Expected line 1 to survive a crash, but got: %v (error %v)", string(b), err)
+	}
+	storage.ShutDown()
+}
+
+func TestDurabilityGroup(t *testing.T) {
+	fs := newFakeFileSystem()
+	storage.SetFileSystem(fs)
+	defer storage.SetFileSystem(nil)
+	storage.SetDurability(storage.DurabilityGroup)
+	defer storage.SetDurability(storage.DurabilityAlways)
+	storage.SetGroupCommitInterval(20 * time.Millisecond)
+	storage.Init()
+	// Concurrent writes share group commits
+	writes := 10
+	var wg sync.WaitGroup
+	for i := 0; i < writes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := storage.Insert("group/0.gdbs", []byte("{\"K\":\"" + strconv.Itoa(i) + "\"}")); err != 0 {
+				t.Errorf("Error inserting to file: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if syncs := fs.syncs("group/wal" + helpers.FileTypeWAL); syncs == 0 || syncs >= writes {
+		t.Errorf("Expected fewer than %v write-ahead log syncs, but got: %v", writes, syncs)
+	}
+	// Acknowledged writes survive a crash
+	crashAndRestore(t, fs, "group")
+	f, err := storage.GetOpenFile("group/0.gdbs")
+	if err != 0 {
+		t.Fatalf("Error opening file: %v", err)
+	} else if f.Lines() != writes {
+		t.Errorf("Expected %v lines to survive a crash, but got: %v", writes, f.Lines())
+	}
+	storage.ShutDown()
+}
+
+func TestDurabilityBuffered(t *testing.T) {
+	fs := newFakeFileSystem()
+	storage.SetFileSystem(fs)
+	defer storage.SetFileSystem(nil)
+	storage.SetDurability(storage.DurabilityBuffered)
+	defer storage.SetDurability(storage.DurabilityAlways)
+	storage.Init()
+	if _, err := storage.Insert("buffered/0.gdbs", []byte("{\"K\":\"a\"}")); err != 0 {
+		t.Fatalf("Error inserting to file: %v", err)
+	}
+	if syncs := fs.syncs("buffered/wal" + helpers.FileTypeWAL); syncs != 0 {
+		t.Errorf("Expected no write-ahead log syncs, but got: %v", syncs)
+	}
+	// Writes that have not been checkpointed are lost in a crash
+	fs = crashAndRestore(t, fs, "buffered")
+	if f, err := storage.GetOpenFile("buffered/0.gdbs"); err != 0 || f.Lines() != 0 {
+		t.Errorf("Expected no lines to survive a crash, but got: %v (error %v)", f.Lines(), err)
+	}
+	// Writes are durable after a checkpoint
+	if _, err := storage.Insert("buffered/0.gdbs", []byte("{\"K\":\"b\"}")); err != 0 {
+		t.Fatalf("Error inserting to file: %v", err)
+	}
+	if err := storage.CloseWAL("buffered"); err != 0 {
+		t.Fatalf("Error closing write-ahead log: %v", err)
+	}
+	crashAndRestore(t, fs, "buffered")
+	if b, err := storage.Read("buffered/0.gdbs", 1); err != 0 || string(b) != "{\"K\":\"b\"}" {
+		t.Errorf("Expected line 1 to survive a crash after a checkpoint, but got: %v (error %v)", string(b), err)
+	}
+	storage.ShutDown()
+}
+
+func TestFolderDurability(t *testing.T) {
+	fs := newFakeFileSystem()
+	storage.SetFileSystem(fs)
+	defer storage.SetFileSystem(nil)
+	storage.SetDurability(storage.DurabilityBuffered)
+	defer storage.SetDurability(storage.DurabilityAlways)
+	storage.SetFolderDurability("folder", storage.DurabilityAlways)
+	defer storage.SetFolderDurability("folder", storage.DurabilityDefault)
+	storage.Init()
+	if storage.GetDurability("folder") != storage.DurabilityAlways || storage.GetDurability("other") != storage.DurabilityBuffered {
+		t.Errorf("Incorrect durability modes: %v, %v", storage.GetDurability("folder"), storage.GetDurability("other"))
+	}
+	if _, err := storage.Insert("folder/0.gdbs", []byte("{\"K\":\"a\"}")); err != 0 {
+		t.Fatalf("Error inserting to file: %v", err)
+	}
+	crashAndRestore(t, fs, "folder")
+	if b, err := storage.Read("folder/0.gdbs", 1); err != 0 || string(b) != "{\"K\":\"a\"}" {
+		t.Errorf("Expected line 1 to survive a crash, but got: %v (error %v)", string(b), err)
+	}
+	storage.ShutDown()
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+//   Paged I/O   /////////////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func TestOffsetIndex(t *testing.T) {
+	folder := "offsetIndexTest"
+	file := folder + "/0.gdbs"
+	storage.Init()
+	storage.MakeDir(folder)
+	defer storage.DeleteDir(folder)
+	// File with an index of line offsets only, and a deleted line 2
+	if wErr := ioutil.WriteFile(file, []byte("{\"K\":\"a\"}\n\n{\"K\":\"c\"}\n[0,10,11]"), 0755); wErr != nil {
+		t.Fatalf("Error writing file: %v", wErr)
+	}
+	for i, expected := range []string{"{\"K\":\"a\"}", "", "{\"K\":\"c\"}"} {
+		if b, err := storage.Read(file, uint16(i + 1)); err != 0 || string(b) != expected {
+			t.Fatalf("Expected line %v to be %v, but got: %v (error %v)", i + 1, expected, string(b), err)
+		}
+	}
+	if err := storage.Update(file, 1, []byte("{\"K\":\"b\"}")); err != 0 {
+		t.Fatalf("Error updating file: %v", err)
+	}
+	storage.ShutDown()
+	b, rErr := ioutil.ReadFile(file)
+	if rErr != nil {
+		t.Fatalf("Error reading file: %v", rErr)
+	}
+	// Only the updated line has a checksum
+	lines := "[[21,9," + strconv.Itoa(int(crc32.ChecksumIEEE([]byte("{\"K\":\"b\"}")))) + "],[10,0,-1],[11,9,-1]]"
+	index := "{\"L\":" + lines + ",\"C\":" + strconv.Itoa(int(crc32.ChecksumIEEE([]byte(lines)))) + "}"
+	if expected := "{\"K\":\"a\"}\n\n{\"K\":\"c\"}\n{\"K\":\"b\"}\n" + index; string(b) != expected {
+		t.Errorf("Expected file to be %q, but got: %q", expected, string(b))
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	folder := "checksumTest"
+	file := folder + "/0.gdbs"
+	storage.Init()
+	storage.MakeDir(folder)
+	defer storage.DeleteDir(folder)
+	for _, k := range []string{"a", "b", "c"} {
+		if _, err := storage.Insert(file, []byte("{\"K\":\"" + k + "\"}")); err != 0 {
+			t.Fatalf("Error inserting to file: %v", err)
+		}
+	}
+	storage.ShutDown()
+	// Damage line 2
+	b, rErr := ioutil.ReadFile(file)
+	if rErr != nil {
+		t.Fatalf("Error reading file: %v", rErr)
+	}
+	b[16] = 'x'
+	if wErr := ioutil.WriteFile(file, b, 0755); wErr != nil {
+		t.Fatalf("Error writing file: %v", wErr)
+	}
+	storage.Init()
+	for i, expected := range []int{0, helpers.ErrorLineChecksum, 0} {
+		if lb, err := storage.Read(file, uint16(i + 1)); err != expected {
+			t.Errorf("Expected error %v reading line %v, but got: %v", expected, i + 1, err)
+		} else if len(lb) != 9 {
+			t.Errorf("Expected the bytes of line %v, but got: %q", i + 1, string(lb))
+		}
+	}
+	// Damage the index
+	storage.ShutDown()
+	b[len(b) - 2] = '0' + (b[len(b) - 2] - '0' + 1) % 10
+	if wErr := ioutil.WriteFile(file, b, 0755); wErr != nil {
+		t.Fatalf("Error writing file: %v", wErr)
+	}
+	storage.Init()
+	if _, err := storage.GetOpenFile(file); err != helpers.ErrorIndexChecksum {
+		t.Errorf("Expected error %v opening file with a damaged index, but got: %v", helpers.ErrorIndexChecksum, err)
+	}
+	storage.ShutDown()
+}
+
+func TestRepair(t *testing.T) {
+	folder := "repairTest"
+	file := folder + "/0.gdbs"
+	storage.Init()
+	storage.MakeDir(folder)
+	defer storage.DeleteDir(folder)
+	scan := func(b []byte) (int, string, int) {
+		n := bytes.IndexByte(b, '\n')
+		if n < 0 {
+			n = len(b)
+		}
+		if key := helpers.JsonFirstString(b[:n], "K"); key != "" && b[n-1] == '}' {
+			return n, key, 0
+		}
+		return n, "", helpers.ErrorJsonDecoding
+	}
+	for _, k := range []string{"a", "b", "c"} {
+		if _, err := storage.Insert(file, []byte("{\"K\":\"" + k + "\"}")); err != 0 {
+			t.Fatalf("Error inserting to file: %v", err)
+		}
+	}
+	storage.ShutDown()
+	// Damage line 2
+	b, rErr := ioutil.ReadFile(file)
+	if rErr != nil {
+		t.Fatalf("Error reading file: %v", rErr)
+	}
+	b[16] = 'x'
+	if wErr := ioutil.WriteFile(file, b, 0755); wErr != nil {
+		t.Fatalf("Error writing file: %v", wErr)
+	}
+	report, err := storage.Repair(file, scan)
+	if err != 0 || report.Lines != 2 || report.Quarantined != 1 || report.Scanned {
+		t.Fatalf("Unexpected repair of a damaged line: %+v (error %v)", report, err)
+	}
+	if q, _ := ioutil.ReadFile(folder + "/0.gdbq"); string(q) != "{\"K\":\"x\"}\n" {
+		t.Errorf("Expected the damaged line in the quarantine file, but got: %q", string(q))
+	}
+	// Lose the index, with an old version of line 1 left in the file
+	if wErr := ioutil.WriteFile(file, []byte("{\"K\":\"a\",\"V\":1}\n{\"K\":\"c\"}\n{\"K\":\n{\"K\":\"a\",\"V\":2}\n[0,16"), 0755); wErr != nil {
+		t.Fatalf("Error writing file: %v", wErr)
+	}
+	if report, err = storage.Repair(file, scan); err != 0 || report.Lines != 2 || report.Quarantined != 1 || !report.Scanned {
+		t.Fatalf("Unexpected repair of a damaged index: %+v (error %v)", report, err)
+	}
+	storage.Init()
+	for i, expected := range []string{"{\"K\":\"a\",\"V\":2}", "{\"K\":\"c\"}"} {
+		if lb, err := storage.Read(file, uint16(i + 1)); err != 0 || string(lb) != expected {
+			t.Errorf("Expected line %v to be %v, but got: %v (error %v)", i + 1, expected, string(lb), err)
+		}
+	}
+	storage.ShutDown()
+}
+
+func TestVacuum(t *testing.T) {
+	folder := "vacuumTest"
+	file := folder + "/0.gdbs"
+	storage.Init()
+	storage.MakeDir(folder)
+	defer storage.DeleteDir(folder)
+	storage.SetFolderDurability(folder, storage.DurabilityBuffered)
+	defer storage.SetFolderDurability(folder, storage.DurabilityDefault)
+	line := []byte("{\"K\":\"a\",\"D\":[\"" + strings.Repeat("a", 1000) + "\"]}")
+	for i := 0; i < 10; i++ {
+		if _, err := storage.Insert(file, line); err != 0 {
+			t.Fatalf("Error inserting to file: %v", err)
+		}
+	}
+	// Old versions of line 1 are removed once they take up half of the file
+	var maxSize int64
+	for i := 0; i < 200; i++ {
+		if err := storage.Update(file, 1, line); err != 0 {
+			t.Fatalf("Error updating file: %v", err)
+		}
+		if fs, sErr := os.Stat(file); sErr == nil && fs.Size() > maxSize {
+			maxSize = fs.Size()
+		}
+	}
+	if maxSize >= 200 * int64(len(line)) {
+		t.Errorf("Expected file to be vacuumed, but it grew to %v bytes", maxSize)
+	}
+	storage.ShutDown()
+	storage.Init()
+	f, err := storage.GetOpenFile(file)
+	if err != 0 || f.Lines() != 10 {
+		t.Fatalf("Expected 10 lines after vacuuming, but got: %v (error %v)", f.Lines(), err)
+	}
+	for i := 1; i <= 10; i++ {
+		if b, err := f.Read(uint16(i)); err != 0 || string(b) != string(line) {
+			t.Errorf("Line %v is incorrect after vacuuming: %v (error %v)", i, string(b), err)
+		}
+	}
+	storage.ShutDown()
+}
+
+func TestDeltaIndex(t *testing.T) {
+	folder := "deltaIndexTest"
+	file := folder + "/0.gdbs"
+	storage.Init()
+	storage.MakeDir(folder)
+	defer storage.DeleteDir(folder)
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = "{\"K\":\"" + strconv.Itoa(i) + "\"}"
+		if _, err := storage.Insert(file, []byte(lines[i])); err != 0 {
+			t.Fatalf("Error inserting to file: %v", err)
+		}
+	}
+	// Updates past the first full index only append the line and a delta record
+	fs, sErr := os.Stat(file)
+	if sErr != nil {
+		t.Fatalf("Error getting file size: %v", sErr)
+	}
+	for i := 0; i < 10; i++ {
+		lines[i] = "{\"K\":\"" + strconv.Itoa(i) + "\",\"V\":1}"
+		if err := storage.Update(file, uint16(i + 1), []byte(lines[i])); err != 0 {
+			t.Fatalf("Error updating file: %v", err)
+		}
+	}
+	lines[10] = ""
+	if err := storage.Update(file, 11, []byte{}); err != 0 {
+		t.Fatalf("Error deleting line: %v", err)
+	}
+	if nfs, _ := os.Stat(file); nfs.Size() - fs.Size() > 11 * 100 {
+		t.Errorf("Expected updates to only append their lines and delta records, but the file grew by %v bytes", nfs.Size() - fs.Size())
+	}
+	storage.ShutDown()
+	storage.Init()
+	f, err := storage.GetOpenFile(file)
+	if err != 0 || f.Lines() != len(lines) || f.EmptyLines() != 1 {
+		t.Fatalf("Expected %v lines with 1 empty after reopening, but got: %v (error %v)", len(lines), f.Lines(), err)
+	}
+	for i, expected := range lines {
+		if b, err := f.Read(uint16(i + 1)); err != 0 || string(b) != expected {
+			t.Errorf("Expected line %v to be %v, but got: %v (error %v)", i + 1, expected, string(b), err)
+		}
+	}
+	storage.ShutDown()
+	// Old index records are left out when the file is scanned for records
+	b, rErr := ioutil.ReadFile(file)
+	if rErr != nil {
+		t.Fatalf("Error reading file: %v", rErr)
+	}
+	if wErr := ioutil.WriteFile(file, b[:len(b) - 1], 0755); wErr != nil {
+		t.Fatalf("Error writing file: %v", wErr)
+	}
+	scan := func(b []byte) (int, string, int) {
+		n := bytes.IndexByte(b, '\n')
+		if n < 0 {
+			n = len(b)
+		}
+		if key := helpers.JsonFirstString(b[:n], "K"); key != "" && b[n-1] == '}' {
+			return n, key, 0
+		}
+		return n, "", helpers.ErrorJsonDecoding
+	}
+	report, rpErr := storage.Repair(file, scan)
+	if rpErr != 0 || !report.Scanned || report.Quarantined != 0 || report.Lines != len(lines) {
+		t.Errorf("Unexpected repair of a file with delta records: %+v (error %v)", report, rpErr)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	folder := "snapshotTest"
+	file := folder + "/0.gdbs"
+	storage.Init()
+	storage.MakeDir(folder)
+	defer storage.DeleteDir(folder)
+	for _, k := range []string{"a", "b", "c"} {
+		if _, err := storage.Insert(file, []byte("{\"K\":\"" + k + "\"}")); err != 0 {
+			t.Fatalf("Error inserting to file: %v", err)
+		}
+	}
+	snaps, err := storage.TakeSnapshots([]string{file})
+	if err != 0 || len(snaps) != 1 {
+		t.Fatalf("Error taking snapshot: %v", err)
+	}
+	// Writes after the snapshot is taken aren't in it
+	if err = storage.Update(file, 1, []byte("{\"K\":\"a\",\"V\":1}")); err != 0 {
+		t.Fatalf("Error updating file: %v", err)
+	}
+	if err = storage.Update(file, 2, []byte{}); err != 0 {
+		t.Fatalf("Error deleting line: %v", err)
+	}
+	if _, err = storage.Insert(file, []byte("{\"K\":\"d\"}")); err != 0 {
+		t.Fatalf("Error inserting to file: %v", err)
+	}
+	// Files with snapshots can't be compacted
+	if _, err = storage.Compact(file); err != helpers.ErrorFileSnapshot {
+		t.Errorf("Expected error %v compacting a file with a snapshot, but got: %v", helpers.ErrorFileSnapshot, err)
+	}
+	files, err := storage.ArchiveSnapshots(snaps)
+	if err != 0 || len(files) != 1 || files[0].Name != file {
+		t.Fatalf("Error reading snapshot: %v", err)
+	}
+	snapFile := folder + "/1.gdbs"
+	if wErr := ioutil.WriteFile(snapFile, files[0].Bytes, 0755); wErr != nil {
+		t.Fatalf("Error writing snapshot: %v", wErr)
+	}
+	f, err := storage.GetOpenFile(snapFile)
+	if err != 0 || f.Lines() != 3 {
+		t.Fatalf("Expected 3 lines in the snapshot, but got: %v (error %v)", f.Lines(), err)
+	}
+	for i, expected := range []string{"{\"K\":\"a\"}", "{\"K\":\"b\"}", "{\"K\":\"c\"}"} {
+		if b, err := f.Read(uint16(i + 1)); err != 0 || string(b) != expected {
+			t.Errorf("Expected snapshot line %v to be %v, but got: %v (error %v)", i + 1, expected, string(b), err)
+		}
+	}
+	// Released snapshots don't stop compacting
+	if _, err = storage.Compact(file); err != 0 {
+		t.Errorf("Error compacting file after releasing it's snapshot: %v", err)
+	}
+	storage.ShutDown()
+}
+
+// makeBenchFile writes a storage file of lines lines, each lineSize bytes long
+func makeBenchFile(b *testing.B, file string, lines int, lineSize int) {
+	line := append([]byte("{\"K\":\"" + strings.Repeat("a", lineSize - 9) + "\"}"), '\n')
+	data := make([]byte, 0, lines * len(line))
+	index := make([][2]int64, lines)
+	for i := range index {
+		index[i] = [2]int64{int64(len(data)), int64(lineSize)}
+		data = append(data, line...)
+	}
+	indexData, _ := helpers.Fjson.Marshal(index)
+	if wErr := ioutil.WriteFile(file, append(data, indexData...), 0755); wErr != nil {
+		b.Fatalf("Error writing file: %v", wErr)
+	}
+}
+
+// benchPartitions runs a benchmark on partitions of growing line counts and line sizes
+func benchPartitions(b *testing.B, bench func(b *testing.B, file string)) {
+	for _, lines := range []int{int(helpers.DefaultPartitionMax), 4000, 65535} {
+		for _, lineSize := range []int{100, 1000, 10000} {
+			if lines * lineSize > 100 << 20 {
+				continue
+			}
+			lines, lineSize := lines, lineSize
+			b.Run(strconv.Itoa(lines) + "x" + strconv.Itoa(lineSize) + "B", func(b *testing.B) {
+				folder := "benchPartition"
+				file := folder + "/0.gdbs"
+				storage.Init()
+				storage.MakeDir(folder)
+				defer storage.DeleteDir(folder)
+				// Measure the storage engine rather than the disk's sync speed
+				storage.SetFolderDurability(folder, storage.DurabilityBuffered)
+				defer storage.SetFolderDurability(folder, storage.DurabilityDefault)
+				makeBenchFile(b, file, lines, lineSize)
+				b.ResetTimer()
+				bench(b, file)
+				b.StopTimer()
+				storage.ShutDown()
+			})
+		}
+	}
+}
+
+// go test storage_test.go -run=NONE -bench=.
+//
+// Update cost should stay the same as partitions grow, in both line count and line size
+func BenchmarkUpdate(b *testing.B) {
+	update := []byte("{\"K\":\"" + strings.Repeat("b", 91) + "\"}")
+	benchPartitions(b, func(b *testing.B, file string) {
+		for i := 0; i < b.N; i++ {
+			if err := storage.Update(file, 1, update); err != 0 {
+				b.Fatalf("Error updating file: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkRead(b *testing.B) {
+	benchPartitions(b, func(b *testing.B, file string) {
+		for i := 0; i < b.N; i++ {
+			if _, err := storage.Read(file, uint16(i % int(helpers.DefaultPartitionMax)) + 1); err != 0 {
+				b.Fatalf("Error reading file: %v", err)
+			}
+		}
+	})
+}
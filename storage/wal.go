@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"github.com/hewiefreeman/GopherDB/helpers"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Write-ahead logging
+//
+// Every write to a storage file is first appended to the write-ahead log (WAL) of the folder the file is in (one
+// folder per table). A record holds the storage file's name, the offset the write starts at, and every byte from
+// that offset to the end of the file, so replaying a record after a crash rewrites the file's tail and indexing
+// layer exactly as they were meant to be. Replaying a record more than once has no extra effect.
+//
+// Record format: [4 byte payload length][4 byte CRC-32 of payload][payload]
+// Payload format: [2 byte file name length][file name][8 byte offset][tail bytes]
+//
+// A record with a bad length or checksum marks the end of the WAL (a write torn by a crash), and it and anything
+// after it are ignored. The WAL is checkpointed (storage files are synced and the WAL is emptied) once it grows
+// past walCheckpointSize, and when a folder's WAL is closed. A WAL is only emptied while none of it's logged writes
+// are still waiting to be made.
+//
+// When a record is synced to the disk depends on the folder's durability mode. With DurabilityAlways the record is
+// synced before the write is made. With DurabilityGroup writes are queued, and every group commit interval the WAL
+// is synced once, and the queued writes are made in order. With DurabilityBuffered the record is not synced.
+
+const (
+	walFileName       string = "wal" + helpers.FileTypeWAL
+	walHeaderSize     int    = 8
+	walCheckpointSize int64  = 4 << 20
+)
+
+var (
+	walsMux sync.Mutex
+	wals    map[string]*writeAheadLog = make(map[string]*writeAheadLog)
+)
+
+// writeAheadLog is the WAL for a single folder
+type writeAheadLog struct {
+	mux       sync.Mutex
+	file      File
+	size      int64
+	pending   int             // Logged writes not yet made to their storage files
+	dirty     map[string]File // Storage files written to since the last checkpoint
+	queue     []queuedWrite   // Writes waiting for the next group commit
+	scheduled bool            // A group commit is scheduled
+}
+
+// queuedWrite is a write waiting for a group commit
+type queuedWrite struct {
+	file   File
+	offset int64
+	tail   []byte
+	done   chan int
+}
+
+// getWAL gets the WAL for a folder, opening it if needed
+func getWAL(folder string) (*writeAheadLog, int) {
+	walsMux.Lock()
+	defer walsMux.Unlock()
+	if w := wals[folder]; w != nil {
+		return w, 0
+	}
+	f, err := openFile(filepath.Join(folder, walFileName), os.O_RDWR|os.O_CREATE, 0755)
+	if err != nil {
+		return nil, helpers.ErrorFileOpen
+	}
+	fs, sErr := f.Stat()
+	if sErr != nil {
+		f.Close()
+		return nil, helpers.ErrorFileOpen
+	}
+	// Drop any torn record left at the end, so new records stay reachable
+	size := walOffsetEnd(f, fs.Size())
+	if size != fs.Size() {
+		if tErr := f.Truncate(size); tErr != nil {
+			f.Close()
+			return nil, helpers.ErrorFileWrite
+		}
+	}
+	w := &writeAheadLog{file: f, size: size, dirty: make(map[string]File)}
+	wals[folder] = w
+	return w, 0
+}
+
+// commitWrite logs a write to a storage file in it's folder's WAL, then makes the write according to the folder's
+// durability mode. f.mux must be locked. With DurabilityGroup, the write is queued and a channel is returned that
+// receives the write's error code once a group commit has made it. Callers should unlock f.mux before waiting on it.
+func commitWrite(f *OpenFile, offset int64, tail []byte) (chan int, int) {
+	folder := filepath.Dir(f.name)
+	w, wErr := getWAL(folder)
+	if wErr != 0 {
+		return nil, wErr
+	}
+	mode := GetDurability(folder)
+	rec := makeWALRecord(filepath.Base(f.name), offset, tail)
+	w.mux.Lock()
+	if w.size >= walCheckpointSize {
+		if err := w.checkpoint(); err != 0 {
+			w.mux.Unlock()
+			return nil, err
+		}
+	}
+	if _, err := w.file.WriteAt(rec, w.size); err != nil {
+		w.mux.Unlock()
+		return nil, helpers.ErrorFileWrite
+	}
+	w.size += int64(len(rec))
+	w.dirty[f.name] = f.file
+	switch mode {
+	case DurabilityGroup:
+		done := make(chan int, 1)
+		w.queue = append(w.queue, queuedWrite{file: f.file, offset: offset, tail: tail, done: done})
+		if !w.scheduled {
+			w.scheduled = true
+			time.AfterFunc(groupCommitInterval.Load().(time.Duration), w.groupCommit)
+		}
+		w.mux.Unlock()
+		return done, 0
+	}
+	// Writes still queued from a group commit are made first, in case the folder's mode has changed
+	w.commitQueue()
+	if mode == DurabilityAlways {
+		if err := w.file.Sync(); err != nil {
+			w.mux.Unlock()
+			return nil, helpers.ErrorFileWrite
+		}
+	}
+	w.pending++
+	w.mux.Unlock()
+	// Make the write
+	err := writeTail(f.file, offset, tail)
+	w.mux.Lock()
+	w.pending--
+	w.mux.Unlock()
+	return nil, err
+}
+
+// writeTail writes the tail of a storage file, cutting off any leftover bytes so the indexing layer stays at the end
+func writeTail(f File, offset int64, tail []byte) int {
+	if _, err := f.WriteAt(tail, offset); err != nil {
+		return helpers.ErrorFileWrite
+	}
+	if err := f.Truncate(offset + int64(len(tail))); err != nil {
+		return helpers.ErrorFileWrite
+	}
+	return 0
+}
+
+// groupCommit syncs the WAL, then makes every queued write in the order they were logged
+func (w *writeAheadLog) groupCommit() {
+	w.mux.Lock()
+	w.commitQueue()
+	w.scheduled = false
+	w.mux.Unlock()
+}
+
+// commitQueue syncs the WAL and makes the queued writes. w.mux must be locked.
+func (w *writeAheadLog) commitQueue() {
+	if len(w.queue) == 0 {
+		return
+	}
+	var err int
+	if sErr := w.file.Sync(); sErr != nil {
+		err = helpers.ErrorFileWrite
+	}
+	for _, qw := range w.queue {
+		wErr := err
+		if wErr == 0 {
+			wErr = writeTail(qw.file, qw.offset, qw.tail)
+		}
+		qw.done <- wErr
+	}
+	w.queue = nil
+}
+
+// flushWAL makes any writes waiting for a folder's group commit. Called before a storage file is closed.
+func flushWAL(folder string) {
+	walsMux.Lock()
+	w := wals[folder]
+	walsMux.Unlock()
+	if w == nil {
+		return
+	}
+	w.mux.Lock()
+	w.commitQueue()
+	w.mux.Unlock()
+}
+
+func makeWALRecord(name string, offset int64, tail []byte) []byte {
+	pLen := 2 + len(name) + 8 + len(tail)
+	rec := make([]byte, walHeaderSize+pLen)
+	p := rec[walHeaderSize:]
+	binary.BigEndian.PutUint16(p, uint16(len(name)))
+	copy(p[2:], name)
+	binary.BigEndian.PutUint64(p[2+len(name):], uint64(offset))
+	copy(p[10+len(name):], tail)
+	binary.BigEndian.PutUint32(rec, uint32(pLen))
+	binary.BigEndian.PutUint32(rec[4:], crc32.ChecksumIEEE(p))
+	return rec
+}
+
+// checkpoint makes any queued writes and syncs every storage file written to since the last checkpoint, then empties
+// the WAL if none of it's writes are pending. w.mux must be locked.
+func (w *writeAheadLog) checkpoint() int {
+	w.commitQueue()
+	if w.pending > 0 {
+		return 0
+	}
+	for name, f := range w.dirty {
+		// Files closed since being written to were synced as they closed
+		if err := f.Sync(); err != nil && !isClosedErr(err) {
+			return helpers.ErrorFileWrite
+		}
+		delete(w.dirty, name)
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return helpers.ErrorFileWrite
+	}
+	if err := w.file.Sync(); err != nil {
+		return helpers.ErrorFileWrite
+	}
+	w.size = 0
+	return 0
+}
+
+func isClosedErr(err error) bool {
+	if pErr, ok := err.(*os.PathError); ok {
+		err = pErr.Err
+	}
+	return err == os.ErrClosed
+}
+
+// CloseWAL checkpoints and closes a folder's WAL. Call when a table is closed or deleted.
+func CloseWAL(folder string) int {
+	walsMux.Lock()
+	w := wals[folder]
+	delete(wals, folder)
+	walsMux.Unlock()
+	if w == nil {
+		return 0
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	err := w.checkpoint()
+	w.file.Close()
+	return err
+}
+
+// ReplayWAL applies every intact record in a folder's WAL to it's storage files, syncs them, then empties the WAL.
+// Must be called before any of the folder's storage files are opened, like when restoring a table.
+func ReplayWAL(folder string) int {
+	wf, err := openFile(filepath.Join(folder, walFileName), os.O_RDWR, 0755)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0
+		}
+		return helpers.ErrorFileOpen
+	}
+	defer wf.Close()
+	fs, sErr := wf.Stat()
+	if sErr != nil {
+		return helpers.ErrorFileRead
+	}
+	b := make([]byte, fs.Size())
+	if _, rErr := wf.ReadAt(b, 0); rErr != nil && rErr != io.EOF {
+		return helpers.ErrorFileRead
+	}
+	files := make(map[string]File)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for pos := 0; pos+walHeaderSize <= len(b); {
+		pLen := int(binary.BigEndian.Uint32(b[pos:]))
+		sum := binary.BigEndian.Uint32(b[pos+4:])
+		if pLen < 10 || pos+walHeaderSize+pLen > len(b) {
+			break // Torn record
+		}
+		p := b[pos+walHeaderSize : pos+walHeaderSize+pLen]
+		if crc32.ChecksumIEEE(p) != sum {
+			break // Torn record
+		}
+		nLen := int(binary.BigEndian.Uint16(p))
+		if 10+nLen > pLen {
+			break
+		}
+		name := filepath.Join(folder, filepath.Base(string(p[2:2+nLen])))
+		offset := int64(binary.BigEndian.Uint64(p[2+nLen:]))
+		f := files[name]
+		if f == nil {
+			if f, err = openFile(name, os.O_RDWR|os.O_CREATE, 0755); err != nil {
+				return helpers.ErrorFileOpen
+			}
+			files[name] = f
+		}
+		if wErr := writeTail(f, offset, p[10+nLen:]); wErr != 0 {
+			return wErr
+		}
+		pos += walHeaderSize + pLen
+	}
+	for _, f := range files {
+		if sErr := f.Sync(); sErr != nil {
+			return helpers.ErrorFileWrite
+		}
+	}
+	// Empty the WAL
+	if tErr := wf.Truncate(0); tErr != nil {
+		return helpers.ErrorFileWrite
+	}
+	if sErr := wf.Sync(); sErr != nil {
+		return helpers.ErrorFileWrite
+	}
+	return 0
+}
+
+// walOffsetEnd reads through a WAL's bytes and returns the end of it's last intact record
+func walOffsetEnd(r io.ReaderAt, size int64) int64 {
+	var pos int64
+	h := make([]byte, walHeaderSize)
+	for pos+int64(walHeaderSize) <= size {
+		if _, err := r.ReadAt(h, pos); err != nil {
+			break
+		}
+		pLen := int64(binary.BigEndian.Uint32(h))
+		if pLen < 10 || pos+int64(walHeaderSize)+pLen > size {
+			break
+		}
+		p := make([]byte, pLen)
+		if _, err := r.ReadAt(p, pos+int64(walHeaderSize)); err != nil || crc32.ChecksumIEEE(p) != binary.BigEndian.Uint32(h[4:]) {
+			break
+		}
+		pos += int64(walHeaderSize) + pLen
+	}
+	return pos
+}